@@ -0,0 +1,8 @@
+// Package api embeds the hand-maintained OpenAPI document. Update
+// openapi.json whenever an endpoint or model changes.
+package api
+
+import _ "embed"
+
+//go:embed openapi.json
+var OpenAPISpec []byte
@@ -2,20 +2,42 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
+	"github.com/gin-gonic/gin"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"log"
 	"my-go-backend/configs"
 	"my-go-backend/internal/handlers"
+	"my-go-backend/internal/health"
+	"my-go-backend/internal/migrations"
 	"my-go-backend/internal/services"
-	"my-go-backend/pkg/models"
+	"my-go-backend/internal/version"
+	"net/http"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 )
 
 func main() {
+	migrateOnly := flag.Bool("migrate", false, "apply pending database migrations and exit")
+	rollback := flag.Bool("rollback", false, "roll back the last database migration and exit")
+	flag.Parse()
+
 	// Load configuration
 	config := configs.LoadConfig()
+	if err := config.Validate(); err != nil {
+		log.Fatal("Invalid configuration: ", err)
+	}
+	if enabled := config.Features.Enabled(); len(enabled) > 0 {
+		log.Printf("Features enabled: %s", strings.Join(enabled, ", "))
+	} else {
+		log.Println("Features enabled: none")
+	}
 
 	// Connect to database
 	db, err := connectDatabase(config)
@@ -23,30 +45,144 @@ func main() {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
-	// Auto-migrate database tables
-	if err := db.AutoMigrate(&models.User{}); err != nil {
+	if *rollback {
+		if err := migrations.Rollback(db); err != nil {
+			log.Fatal("Failed to roll back migration:", err)
+		}
+		return
+	}
+
+	// Apply pending versioned migrations
+	if err := migrations.Migrate(db); err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
+	if *migrateOnly {
+		log.Println("Migrations applied")
+		return
+	}
 
 	// Initialize services
-	authService := services.NewAuthService(db, config.JWTSecret, config.JWTExpiresIn)
-	userService := services.NewUserService(db)
-	cryptoService := services.NewCryptoService()
+	authService := services.NewAuthService(db, config.JWTSecret, config.JWTAccessTTL, config.JWTRefreshTTL, config.JWTIssuer, config.JWTAudience,
+		services.WithServiceClients(config.ServiceClients, config.ServiceTokenTTL))
+	var userOpts []services.UserServiceOption
+	if config.Features.UserCache {
+		userOpts = append(userOpts, services.WithUserCache(config.UserCacheSize, config.UserCacheTTL))
+	}
+	userService := services.NewUserService(db, userOpts...)
+	cryptoOpts := []services.CryptoServiceOption{
+		services.WithRequestTimeout(config.CoinGeckoTimeout),
+		services.WithCoinTimeoutPercent(config.BulkCoinTimeoutPercent),
+		services.WithMaxConcurrency(config.MaxConcurrency),
+		services.WithSubscriberBuffer(config.SubscriberBuffer),
+		services.WithSlowSubscriberPolicy(config.SlowConsumerPolicy),
+		services.WithMaxStreamDuration(config.StreamMaxDuration),
+		services.WithStreamIntervalBounds(config.StreamMinInterval, config.StreamMaxInterval),
+		services.WithPriceHistorySize(config.PriceHistorySize),
+		services.WithDefaultCurrency(config.DefaultCurrency),
+	}
+	if config.Features.ServeStale {
+		cryptoOpts = append(cryptoOpts, services.WithServeStale(config.StaleMaxAge))
+	}
+	cryptoService := services.NewCryptoService(config.CoinGeckoBaseURL, config.CoinGeckoAPIKey, cryptoOpts...)
+	alertService := services.NewAlertService(db)
+	cryptoService.SetAlertEvaluator(alertService)
+	favoriteService := services.NewFavoriteService(db, config.MaxFavorites)
 
-	// Start background price streaming for WebSocket subscribers
-	ctx := context.Background()
-	popularCoins := []string{"bitcoin", "ethereum", "bnb", "solana", "cardano"}
-	go cryptoService.StartPriceStreaming(ctx, popularCoins, 5*time.Second)
+	// Surface a bad CoinGecko URL or key now rather than on the first request
+	if config.StartupCheckCoin != "" {
+		checkCtx, cancelCheck := context.WithTimeout(context.Background(), config.StartupCheckTimeout)
+		err := cryptoService.CheckUpstream(checkCtx, config.StartupCheckCoin)
+		cancelCheck()
+		switch {
+		case err == nil:
+			log.Printf("CoinGecko startup check passed (%s)", config.StartupCheckCoin)
+		case config.StrictStartup:
+			log.Fatalf("CoinGecko startup check failed: %v", err)
+		default:
+			log.Printf("CoinGecko startup check failed, starting anyway: %v", err)
+		}
+	}
+
+	// Cancelled on SIGINT/SIGTERM to begin graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Start background price streaming for WebSocket subscribers, over the
+	// same coins /crypto/popular serves
+	streamCtx, cancelStreaming := context.WithCancel(context.Background())
+	defer cancelStreaming()
+	if config.Features.LiveStreaming {
+		go cryptoService.StartPriceStreaming(streamCtx, config.PopularCoins, 5*time.Second)
+	}
+
+	// Check the database in the background for /ready; stops with ctx so
+	// readiness fails as soon as shutdown begins
+	dbMonitor := health.NewMonitor(health.PingDB(db), config.ReadinessInterval, config.ReadinessTimeout)
+	go dbMonitor.Run(ctx)
+
+	// Release mode in production drops gin's debug output (route listing, warnings)
+	if config.AppEnv == "production" {
+		gin.SetMode(gin.ReleaseMode)
+	}
 
 	// Setup routes
-	router := handlers.SetupRoutes(authService, userService, cryptoService, config.JWTSecret)
+	router := handlers.SetupRoutes(config, dbMonitor, authService, userService, cryptoService, alertService, favoriteService)
 
 	// Start server
 	serverAddr := fmt.Sprintf("%s:%s", config.Host, config.Port)
-	log.Printf("Server starting on %s", serverAddr)
-	if err := router.Run(serverAddr); err != nil {
-		log.Fatal("Failed to start server:", err)
+	srv := &http.Server{
+		Addr:         serverAddr,
+		Handler:      router,
+		ReadTimeout:  config.ServerReadTimeout,
+		WriteTimeout: config.ServerWriteTimeout,
+		IdleTimeout:  config.ServerIdleTimeout,
+	}
+
+	go func() {
+		log.Printf("Server %s (commit %s, built %s) starting on %s", version.Version, version.Commit, version.BuildDate, serverAddr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("Failed to start server:", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("Shutdown signal received")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+
+	// Stop streaming first so long-lived connections end and can be drained:
+	// new streams get 503, open ones a final "shutdown" event and WebSocket
+	// clients a going-away close frame. Meanwhile the server stops accepting
+	// connections and waits for in-flight requests, streams included.
+	cancelStreaming()
+	cryptoService.Shutdown()
+	serverStopped := make(chan error, 1)
+	go func() {
+		serverStopped <- srv.Shutdown(shutdownCtx)
+	}()
+
+	// Streams still open after the drain period are closed
+	drainCtx, cancelDrain := context.WithTimeout(shutdownCtx, config.StreamDrainTimeout)
+	if err := cryptoService.WaitForStreams(drainCtx); err != nil {
+		log.Printf("%d streams still open after %s, closing them", cryptoService.ActiveStreams(), config.StreamDrainTimeout)
+		cryptoService.CloseStreams()
+	}
+	if err := cryptoService.WaitForSubscribers(drainCtx); err != nil {
+		log.Printf("WebSocket connections did not close in time: %v", err)
+	}
+	cancelDrain()
+
+	if err := <-serverStopped; err != nil {
+		log.Printf("Server forced to shut down: %v", err)
+		srv.Close()
+	}
+
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
 	}
+
+	log.Println("Server stopped")
 }
 
 func connectDatabase(config *configs.Config) (*gorm.DB, error) {
@@ -59,10 +195,60 @@ func connectDatabase(config *configs.Config) (*gorm.DB, error) {
 		config.DBSSLMode,
 	)
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	// Postgres may still be starting (e.g. in containers), so retry with backoff
+	var db *gorm.DB
+	var sqlDB *sql.DB
+	err := retryWithBackoff(config.DBConnectMaxAttempts, config.DBConnectRetryDelay, func(attempt int) error {
+		log.Printf("Connecting to database (attempt %d/%d)", attempt, config.DBConnectMaxAttempts)
+
+		var err error
+		db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+		if err != nil {
+			return err
+		}
+
+		sqlDB, err = db.DB()
+		if err != nil {
+			return err
+		}
+
+		if err := sqlDB.Ping(); err != nil {
+			sqlDB.Close()
+			return err
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
+	sqlDB.SetMaxOpenConns(config.DBMaxOpenConns)
+	sqlDB.SetMaxIdleConns(config.DBMaxIdleConns)
+	sqlDB.SetConnMaxLifetime(config.DBConnMaxLifetime)
+
+	log.Printf("Database pool: max_open=%d max_idle=%d max_lifetime=%v",
+		config.DBMaxOpenConns,
+		config.DBMaxIdleConns,
+		config.DBConnMaxLifetime,
+	)
+
 	return db, nil
 }
+
+// retryWithBackoff calls fn until it succeeds or maxAttempts is reached,
+// doubling the delay after each failure.
+func retryWithBackoff(maxAttempts int, delay time.Duration, fn func(attempt int) error) error {
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if err = fn(attempt); err == nil {
+			return nil
+		}
+
+		if attempt < maxAttempts {
+			log.Printf("Attempt %d failed: %v (retrying in %v)", attempt, err, delay)
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+	return fmt.Errorf("giving up after %d attempts: %w", maxAttempts, err)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetryWithBackoff(t *testing.T) {
+	errConnect := errors.New("connection refused")
+
+	tests := []struct {
+		name        string
+		maxAttempts int
+		succeedOn   int // Attempt that connects; 0 never does
+		wantCalls   int
+		wantErr     bool
+		minElapsed  time.Duration // Delays slept: 1ms, then doubling
+	}{
+		{"first attempt succeeds", 3, 1, 1, false, 0},
+		{"succeeds after retries", 5, 3, 3, false, 3 * time.Millisecond},
+		{"gives up at the limit", 3, 0, 3, true, 3 * time.Millisecond},
+		{"success on the last attempt", 3, 3, 3, false, 3 * time.Millisecond},
+		{"single attempt", 1, 0, 1, true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			start := time.Now()
+			err := retryWithBackoff(tt.maxAttempts, time.Millisecond, func(attempt int) error {
+				calls++
+				if attempt != calls {
+					t.Errorf("attempt = %d on call %d", attempt, calls)
+				}
+				if attempt == tt.succeedOn {
+					return nil
+				}
+				return errConnect
+			})
+
+			if calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tt.wantCalls)
+			}
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, errConnect) {
+				t.Errorf("error = %v, want it to wrap the last failure", err)
+			}
+			if elapsed := time.Since(start); elapsed < tt.minElapsed {
+				t.Errorf("took %v, want at least %v of backoff", elapsed, tt.minElapsed)
+			}
+		})
+	}
+}
@@ -1,25 +1,156 @@
 package configs
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"log/slog"
+	"net"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
+
+	"my-go-backend/internal/services"
+	"my-go-backend/pkg/models"
+)
+
+// Demo defaults that must not be used in production
+const (
+	defaultJWTSecret  = "tHiSiSaSeCrEt"
+	defaultDBPassword = "password"
 )
 
+// minServiceSecretLength is the shortest secret accepted in SERVICE_CLIENTS
+const minServiceSecretLength = 16
+
+// defaultPopularCoins is served by /crypto/popular unless POPULAR_COINS is set
+var defaultPopularCoins = []string{
+	"bitcoin", "ethereum", "tether", "bnb", "solana",
+	"usdc", "xrp", "dogecoin", "cardano", "avalanche-2",
+	"chainlink", "polygon", "litecoin", "uniswap", "ethereum-classic",
+}
+
 type Config struct {
-	Port         string
-	Host         string
-	DBHost       string
-	DBPort       string
-	DBUser       string
-	DBPassword   string
-	DBName       string
-	DBSSLMode    string
-	JWTSecret    string
-	JWTExpiresIn time.Duration
-	AppEnv       string
+	Port       string
+	Host       string
+	DBHost     string
+	DBPort     string
+	DBUser     string
+	DBPassword string
+	DBName     string
+	DBSSLMode  string
+
+	// Database connection pool
+	DBMaxOpenConns    int
+	DBMaxIdleConns    int
+	DBConnMaxLifetime time.Duration
+
+	// Startup connection retries (delay doubles after each failed attempt)
+	DBConnectMaxAttempts int
+	DBConnectRetryDelay  time.Duration
+
+	// Fallback for GET /users/:id while the database is unavailable (Features.UserCache)
+	UserCacheSize int           // Max users kept (least recently used are evicted)
+	UserCacheTTL  time.Duration // Max age of a cached user
+
+	MaxFavorites int // Coins each user may keep in /users/me/favorites
+
+	JWTSecret     string
+	JWTAccessTTL  time.Duration // Lifetime of access tokens sent on API requests
+	JWTRefreshTTL time.Duration // Lifetime of refresh tokens exchanged at /auth/refresh
+	JWTIssuer     string        // "iss" claim set on and required of tokens
+	JWTAudience   string        // "aud" claim set on and required of tokens
+	AppEnv        string
+
+	// Machine clients allowed to get service tokens from /auth/token
+	ServiceClients  []services.ServiceClient
+	ServiceTokenTTL time.Duration
+
+	// Readiness: how often /ready's database check runs and how long each ping may take
+	ReadinessInterval time.Duration
+	ReadinessTimeout  time.Duration
+
+	// Graceful shutdown
+	ShutdownTimeout    time.Duration // Max time to drain in-flight requests
+	StreamDrainTimeout time.Duration // Part of it open streams get to close after the "shutdown" event
+
+	// HTTP server timeouts. SSE/NDJSON streams lift the read and write
+	// deadlines once they start, and WebSocket upgrades clear them.
+	ServerReadTimeout  time.Duration // Max time to read a request, headers and body
+	ServerWriteTimeout time.Duration // Max time from the end of the request headers to the end of the response
+	ServerIdleTimeout  time.Duration // Max time a keep-alive connection waits for the next request
+
+	// Observability
+	LogFormat string // Request log format: "text" (default) or "json"
+	LogLevel  string // Minimum request log level: "debug", "info" (default), "warn" or "error"
+
+	// When positive, successful requests are only logged if slower than this
+	SlowRequestThreshold time.Duration
+
+	// CoinGecko API (the key is optional; Pro keys need the pro-api base URL)
+	CoinGeckoBaseURL       string
+	CoinGeckoAPIKey        string
+	CoinGeckoTimeout       time.Duration // Per upstream call, separate from the bulk request timeout
+	MaxBulkCoins           int           // Max coins per bulk/portfolio request
+	BulkCoinTimeoutPercent int           // Per-coin share of the bulk timeout, in percent
+	MaxConcurrency         int           // Concurrent CoinGecko calls per portfolio request
+	PopularCoins           []string      // Coin ids served by /crypto/popular, in order
+	PriceHistorySize       int           // Recent prices kept per coin for /crypto/:coinId/recent
+	DefaultCurrency        string        // Currency of cached prices, and the default for ?currency=
+	StaleMaxAge            time.Duration // Oldest cached price served while CoinGecko fails (Features.ServeStale)
+
+	// Startup check: fetch StartupCheckCoin from CoinGecko on boot ("" skips
+	// it). A failure is logged, or stops the server when StrictStartup is set.
+	StartupCheckCoin    string
+	StartupCheckTimeout time.Duration
+	StrictStartup       bool
+
+	IdempotencyTTL time.Duration // How long bulk/portfolio responses are replayed for an Idempotency-Key
+
+	// WebSocket subscriber queues
+	SubscriberBuffer   int    // Events queued per subscriber
+	SlowConsumerPolicy string // When a queue is full: "drop_newest", "drop_oldest" or "disconnect"
+
+	// WebSocket connection I/O buffer sizes in bytes (compression is Features.WSCompression)
+	WSReadBufferSize  int
+	WSWriteBufferSize int
+
+	StreamMaxDuration time.Duration // Longest an SSE/NDJSON stream runs before its "end" event
+	StreamMinInterval time.Duration // Requested stream intervals are clamped to these bounds
+	StreamMaxInterval time.Duration
+
+	// Origins allowed for CORS and WebSocket upgrades ("*" allows any)
+	AllowedOrigins []string
+
+	// Proxies (IPs or CIDRs) whose X-Forwarded-For header is trusted when
+	// resolving the client IP for logs, rate limits and the audit log
+	TrustedProxies []string
+
+	// Per-IP rate limits (requests per second and burst; 0 rps disables)
+	RateLimitRPS       int
+	RateLimitBurst     int
+	AuthRateLimitRPS   int // Stricter limit for /auth/login and /auth/register
+	AuthRateLimitBurst int
+
+	// Per-user request quotas for /crypto endpoints (0 disables a window; admins are exempt)
+	QuotaHourly int
+	QuotaDaily  int
+
+	// Max request body size in bytes (0 disables)
+	MaxBodyBytes int64
+
+	// Gzip responses of at least CompressionMinBytes for clients that accept it (Features.Compression)
+	CompressionMinBytes int
+
+	// Optional behaviors toggled with FEATURE_* variables
+	Features Features
+
+	// Problems found while loading, reported by Validate
+	loadErrors []error
 }
 
 func LoadConfig() *Config {
@@ -27,21 +158,263 @@ func LoadConfig() *Config {
 		log.Println("No .env file found")
 	}
 
-	jwtExpires, _ := time.ParseDuration(getEnv("JWT_EXPIRES_IN", "24h"))
+	var loadErrors []error
+
+	// JWT_EXPIRES_IN is the old name for the access token lifetime
+	jwtAccessTTL := getEnvDuration("JWT_ACCESS_TTL", getEnv("JWT_EXPIRES_IN", "15m"), &loadErrors)
+	jwtRefreshTTL := getEnvDuration("JWT_REFRESH_TTL", "168h", &loadErrors)
+	shutdownTimeout := getEnvDuration("SHUTDOWN_TIMEOUT", "15s", &loadErrors)
+
+	config := &Config{
+		Port:       getEnv("PORT", "8095"),
+		Host:       getEnv("HOST", "localhost"),
+		DBHost:     getEnv("DB_HOST", "localhost"),
+		DBPort:     getEnv("DB_PORT", "30532"),
+		DBUser:     getEnv("DB_USER", "postgres"),
+		DBPassword: getEnv("DB_PASSWORD", defaultDBPassword),
+		DBName:     getEnv("DB_NAME", "myapp"),
+		DBSSLMode:  getEnv("DB_SSL_MODE", "disable"),
+
+		DBMaxOpenConns:    getEnvInt("DB_MAX_OPEN_CONNS", 25, &loadErrors),
+		DBMaxIdleConns:    getEnvInt("DB_MAX_IDLE_CONNS", 10, &loadErrors),
+		DBConnMaxLifetime: getEnvDuration("DB_CONN_MAX_LIFETIME", "30m", &loadErrors),
+
+		DBConnectMaxAttempts: getEnvInt("DB_CONNECT_MAX_ATTEMPTS", 5, &loadErrors),
+		DBConnectRetryDelay:  getEnvDuration("DB_CONNECT_RETRY_DELAY", "1s", &loadErrors),
+
+		UserCacheSize: getEnvInt("USER_CACHE_SIZE", 1000, &loadErrors),
+		UserCacheTTL:  getEnvDuration("USER_CACHE_TTL", "10m", &loadErrors),
+
+		MaxFavorites: getEnvInt("MAX_FAVORITES", services.DefaultMaxFavorites, &loadErrors),
+
+		JWTSecret:     getEnv("JWT_SECRET", defaultJWTSecret),
+		JWTAccessTTL:  jwtAccessTTL,
+		JWTRefreshTTL: jwtRefreshTTL,
+		JWTIssuer:     getEnv("JWT_ISSUER", "my-go-backend"),
+		JWTAudience:   getEnv("JWT_AUDIENCE", "my-go-backend-api"),
+		AppEnv:        getEnv("APP_ENV", "development"),
+
+		ServiceClients:  getEnvServiceClients("SERVICE_CLIENTS", &loadErrors),
+		ServiceTokenTTL: getEnvDuration("SERVICE_TOKEN_TTL", "15m", &loadErrors),
+
+		ReadinessInterval: getEnvDuration("READINESS_CHECK_INTERVAL", "5s", &loadErrors),
+		ReadinessTimeout:  getEnvDuration("READINESS_CHECK_TIMEOUT", "2s", &loadErrors),
+
+		ShutdownTimeout:    shutdownTimeout,
+		StreamDrainTimeout: getEnvDuration("STREAM_DRAIN_TIMEOUT", "5s", &loadErrors),
+
+		ServerReadTimeout:  getEnvDuration("SERVER_READ_TIMEOUT", "15s", &loadErrors),
+		ServerWriteTimeout: getEnvDuration("SERVER_WRITE_TIMEOUT", "30s", &loadErrors),
+		ServerIdleTimeout:  getEnvDuration("SERVER_IDLE_TIMEOUT", "120s", &loadErrors),
+
+		LogFormat: getEnv("LOG_FORMAT", "text"),
+		LogLevel:  strings.ToLower(getEnv("LOG_LEVEL", "info")),
+
+		SlowRequestThreshold: getEnvDuration("SLOW_REQUEST_THRESHOLD", "0s", &loadErrors),
 
-	return &Config{
-		Port:         getEnv("PORT", "8095"),
-		Host:         getEnv("HOST", "localhost"),
-		DBHost:       getEnv("DB_HOST", "localhost"),
-		DBPort:       getEnv("DB_PORT", "30532"),
-		DBUser:       getEnv("DB_USER", "postgres"),
-		DBPassword:   getEnv("DB_PASSWORD", "password"),
-		DBName:       getEnv("DB_NAME", "myapp"),
-		DBSSLMode:    getEnv("DB_SSL_MODE", "disable"),
-		JWTSecret:    getEnv("JWT_SECRET", "tHiSiSaSeCrEt"),
-		JWTExpiresIn: jwtExpires,
-		AppEnv:       getEnv("APP_ENV", "development"),
+		CoinGeckoBaseURL:       getEnv("COINGECKO_BASE_URL", "https://api.coingecko.com/api/v3"),
+		CoinGeckoAPIKey:        getEnv("COINGECKO_API_KEY", ""),
+		CoinGeckoTimeout:       getEnvDuration("COINGECKO_TIMEOUT", "10s", &loadErrors),
+		MaxBulkCoins:           getEnvInt("MAX_BULK_COINS", 20, &loadErrors),
+		BulkCoinTimeoutPercent: getEnvInt("BULK_COIN_TIMEOUT_PERCENT", 50, &loadErrors),
+		MaxConcurrency:         getEnvInt("CRYPTO_MAX_CONCURRENCY", 5, &loadErrors),
+		PopularCoins:           getEnvList("POPULAR_COINS", defaultPopularCoins),
+		PriceHistorySize:       getEnvInt("PRICE_HISTORY_SIZE", 60, &loadErrors),
+		DefaultCurrency:        strings.ToLower(getEnv("DEFAULT_CURRENCY", services.DefaultCurrency)),
+		StaleMaxAge:            getEnvDuration("STALE_MAX_AGE", "1h", &loadErrors),
+
+		StartupCheckCoin:    getEnv("STARTUP_CHECK_COIN", "bitcoin"),
+		StartupCheckTimeout: getEnvDuration("STARTUP_CHECK_TIMEOUT", "5s", &loadErrors),
+		StrictStartup:       getEnv("STRICT_STARTUP", "false") == "true",
+
+		IdempotencyTTL: getEnvDuration("IDEMPOTENCY_TTL", "5m", &loadErrors),
+
+		SubscriberBuffer:   getEnvInt("WS_SUBSCRIBER_BUFFER", 100, &loadErrors),
+		SlowConsumerPolicy: getEnv("WS_SLOW_CONSUMER_POLICY", "drop_newest"),
+
+		WSReadBufferSize:  getEnvInt("WS_READ_BUFFER_SIZE", 4096, &loadErrors),
+		WSWriteBufferSize: getEnvInt("WS_WRITE_BUFFER_SIZE", 4096, &loadErrors),
+
+		StreamMaxDuration: getEnvDuration("STREAM_MAX_DURATION", "1h", &loadErrors),
+		StreamMinInterval: getEnvDuration("STREAM_MIN_INTERVAL", "2s", &loadErrors),
+		StreamMaxInterval: getEnvDuration("STREAM_MAX_INTERVAL", "5m", &loadErrors),
+
+		AllowedOrigins: getEnvList("ALLOWED_ORIGINS", nil),
+		TrustedProxies: getEnvList("TRUSTED_PROXIES", []string{"127.0.0.1", "::1"}),
+
+		RateLimitRPS:       getEnvInt("RATE_LIMIT_RPS", 20, &loadErrors),
+		RateLimitBurst:     getEnvInt("RATE_LIMIT_BURST", 40, &loadErrors),
+		AuthRateLimitRPS:   getEnvInt("AUTH_RATE_LIMIT_RPS", 1, &loadErrors),
+		AuthRateLimitBurst: getEnvInt("AUTH_RATE_LIMIT_BURST", 5, &loadErrors),
+
+		QuotaHourly: getEnvInt("QUOTA_HOURLY", 0, &loadErrors),
+		QuotaDaily:  getEnvInt("QUOTA_DAILY", 0, &loadErrors),
+
+		MaxBodyBytes: int64(getEnvInt("MAX_BODY_BYTES", 1<<20, &loadErrors)),
+
+		CompressionMinBytes: getEnvInt("COMPRESSION_MIN_BYTES", 1024, &loadErrors),
+
+		Features: loadFeatures(&loadErrors),
 	}
+	// Set once every field has been read, so no error is missed
+	config.loadErrors = loadErrors
+	return config
+}
+
+// logLevels maps LOG_LEVEL values to slog levels
+var logLevels = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+// SlogLevel returns LogLevel as a slog level, info if it's unknown
+func (c *Config) SlogLevel() slog.Level {
+	if level, ok := logLevels[c.LogLevel]; ok {
+		return level
+	}
+	return slog.LevelInfo
+}
+
+// Validate reports unusable settings. Production additionally requires a real
+// JWT secret and database credentials instead of the demo defaults.
+func (c *Config) Validate() error {
+	errs := append([]error{}, c.loadErrors...)
+
+	if c.JWTAccessTTL <= 0 || c.JWTRefreshTTL <= 0 {
+		errs = append(errs, errors.New("JWT_ACCESS_TTL and JWT_REFRESH_TTL must be positive"))
+	} else if c.JWTRefreshTTL < c.JWTAccessTTL {
+		errs = append(errs, errors.New("JWT_REFRESH_TTL must not be shorter than JWT_ACCESS_TTL"))
+	}
+	if c.ServiceTokenTTL <= 0 {
+		errs = append(errs, errors.New("SERVICE_TOKEN_TTL must be positive"))
+	}
+	seenClients := make(map[string]bool, len(c.ServiceClients))
+	for _, client := range c.ServiceClients {
+		if seenClients[client.ID] {
+			errs = append(errs, fmt.Errorf("SERVICE_CLIENTS: client %q is listed twice", client.ID))
+		}
+		seenClients[client.ID] = true
+		if len(client.Secret) < minServiceSecretLength {
+			errs = append(errs, fmt.Errorf("SERVICE_CLIENTS: secret of client %q must be at least %d characters", client.ID, minServiceSecretLength))
+		}
+		for _, scope := range client.Scopes {
+			if !slices.Contains(models.ServiceScopes, scope) {
+				errs = append(errs, fmt.Errorf("SERVICE_CLIENTS: client %q has unknown scope %q", client.ID, scope))
+			}
+		}
+	}
+	if c.ReadinessInterval <= 0 || c.ReadinessTimeout <= 0 {
+		errs = append(errs, errors.New("READINESS_CHECK_INTERVAL and READINESS_CHECK_TIMEOUT must be positive"))
+	}
+	if _, ok := logLevels[c.LogLevel]; !ok {
+		errs = append(errs, errors.New("LOG_LEVEL must be debug, info, warn or error"))
+	}
+	if c.SlowRequestThreshold < 0 {
+		errs = append(errs, errors.New("SLOW_REQUEST_THRESHOLD must not be negative"))
+	}
+	if c.StreamMaxDuration <= 0 {
+		errs = append(errs, errors.New("STREAM_MAX_DURATION must be positive"))
+	}
+	if c.StreamMinInterval <= 0 || c.StreamMaxInterval < c.StreamMinInterval {
+		errs = append(errs, errors.New("STREAM_MIN_INTERVAL must be positive and at most STREAM_MAX_INTERVAL"))
+	}
+	if c.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("SHUTDOWN_TIMEOUT must be positive"))
+	}
+	if c.StreamDrainTimeout <= 0 || c.StreamDrainTimeout > c.ShutdownTimeout {
+		errs = append(errs, errors.New("STREAM_DRAIN_TIMEOUT must be positive and at most SHUTDOWN_TIMEOUT"))
+	}
+	if c.ServerReadTimeout <= 0 || c.ServerWriteTimeout <= 0 || c.ServerIdleTimeout <= 0 {
+		errs = append(errs, errors.New("SERVER_READ_TIMEOUT, SERVER_WRITE_TIMEOUT and SERVER_IDLE_TIMEOUT must be positive"))
+	}
+	if c.DBMaxOpenConns < 1 {
+		errs = append(errs, errors.New("DB_MAX_OPEN_CONNS must be at least 1"))
+	}
+	if c.DBConnectMaxAttempts < 1 {
+		errs = append(errs, errors.New("DB_CONNECT_MAX_ATTEMPTS must be at least 1"))
+	}
+	if c.DBConnectRetryDelay < 0 {
+		errs = append(errs, errors.New("DB_CONNECT_RETRY_DELAY must not be negative"))
+	}
+	if c.Features.UserCache && (c.UserCacheSize < 1 || c.UserCacheTTL <= 0) {
+		errs = append(errs, errors.New("USER_CACHE_SIZE and USER_CACHE_TTL must be positive when FEATURE_USER_CACHE is on"))
+	}
+	if c.CoinGeckoTimeout <= 0 {
+		errs = append(errs, errors.New("COINGECKO_TIMEOUT must be positive"))
+	}
+	if c.StartupCheckTimeout <= 0 {
+		errs = append(errs, errors.New("STARTUP_CHECK_TIMEOUT must be positive"))
+	}
+	if c.MaxBulkCoins < 1 {
+		errs = append(errs, errors.New("MAX_BULK_COINS must be at least 1"))
+	}
+	if c.MaxFavorites < 1 {
+		errs = append(errs, errors.New("MAX_FAVORITES must be at least 1"))
+	}
+	if c.PriceHistorySize < 1 {
+		errs = append(errs, errors.New("PRICE_HISTORY_SIZE must be at least 1"))
+	}
+	if !services.IsSupportedCurrency(c.DefaultCurrency) {
+		errs = append(errs, fmt.Errorf("DEFAULT_CURRENCY: %q is not a supported currency", c.DefaultCurrency))
+	}
+	if c.Features.ServeStale && c.StaleMaxAge <= 0 {
+		errs = append(errs, errors.New("STALE_MAX_AGE must be positive when FEATURE_SERVE_STALE is on"))
+	}
+	if len(c.PopularCoins) == 0 {
+		errs = append(errs, errors.New("POPULAR_COINS must list at least one coin"))
+	}
+	if c.IdempotencyTTL <= 0 {
+		errs = append(errs, errors.New("IDEMPOTENCY_TTL must be positive"))
+	}
+	if c.BulkCoinTimeoutPercent < 1 || c.BulkCoinTimeoutPercent > 100 {
+		errs = append(errs, errors.New("BULK_COIN_TIMEOUT_PERCENT must be between 1 and 100"))
+	}
+	if c.MaxConcurrency < 1 {
+		errs = append(errs, errors.New("CRYPTO_MAX_CONCURRENCY must be at least 1"))
+	}
+	if c.SubscriberBuffer < 1 {
+		errs = append(errs, errors.New("WS_SUBSCRIBER_BUFFER must be at least 1"))
+	}
+	switch c.SlowConsumerPolicy {
+	case "drop_newest", "drop_oldest", "disconnect":
+	default:
+		errs = append(errs, errors.New("WS_SLOW_CONSUMER_POLICY must be drop_newest, drop_oldest or disconnect"))
+	}
+	if c.WSReadBufferSize < 0 || c.WSWriteBufferSize < 0 {
+		errs = append(errs, errors.New("WS_READ_BUFFER_SIZE and WS_WRITE_BUFFER_SIZE must not be negative"))
+	}
+	for _, proxy := range c.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				errs = append(errs, fmt.Errorf("TRUSTED_PROXIES: %q is not an IP or CIDR", proxy))
+			}
+		}
+	}
+	if c.QuotaHourly < 0 || c.QuotaDaily < 0 {
+		errs = append(errs, errors.New("QUOTA_HOURLY and QUOTA_DAILY must not be negative"))
+	}
+	if c.MaxBodyBytes < 0 {
+		errs = append(errs, errors.New("MAX_BODY_BYTES must not be negative"))
+	}
+	if c.CompressionMinBytes < 0 {
+		errs = append(errs, errors.New("COMPRESSION_MIN_BYTES must not be negative"))
+	}
+	if c.DBMaxIdleConns < 0 || c.DBMaxIdleConns > c.DBMaxOpenConns {
+		errs = append(errs, errors.New("DB_MAX_IDLE_CONNS must be between 0 and DB_MAX_OPEN_CONNS"))
+	}
+
+	if c.AppEnv == "production" {
+		if c.JWTSecret == "" || c.JWTSecret == defaultJWTSecret {
+			errs = append(errs, errors.New("JWT_SECRET must be set in production"))
+		}
+		if c.DBUser == "" || c.DBPassword == "" || c.DBPassword == defaultDBPassword {
+			errs = append(errs, errors.New("DB_USER and DB_PASSWORD must be set in production"))
+		}
+	}
+
+	return errors.Join(errs...)
 }
 
 func getEnv(key, defaultValue string) string {
@@ -50,3 +423,61 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvDuration parses a duration, recording a load error if it's invalid
+func getEnvDuration(key, defaultValue string, loadErrors *[]error) time.Duration {
+	d, err := time.ParseDuration(getEnv(key, defaultValue))
+	if err != nil {
+		*loadErrors = append(*loadErrors, fmt.Errorf("invalid %s: %w", key, err))
+	}
+	return d
+}
+
+// getEnvInt parses a whole number, recording a load error if it's invalid
+func getEnvInt(key string, defaultValue int, loadErrors *[]error) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		*loadErrors = append(*loadErrors, fmt.Errorf("invalid %s: %q is not a whole number", key, value))
+		return defaultValue
+	}
+	return parsed
+}
+
+// getEnvServiceClients reads comma-separated "id:secret:scope scope"
+// entries, recording a load error for entries missing a part
+func getEnvServiceClients(key string, loadErrors *[]error) []services.ServiceClient {
+	var clients []services.ServiceClient
+	for _, entry := range getEnvList(key, nil) {
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || len(strings.Fields(parts[2])) == 0 {
+			*loadErrors = append(*loadErrors, fmt.Errorf("invalid %s entry: want id:secret:scopes", key))
+			continue
+		}
+		clients = append(clients, services.ServiceClient{
+			ID:     parts[0],
+			Secret: parts[1],
+			Scopes: strings.Fields(parts[2]),
+		})
+	}
+	return clients
+}
+
+// getEnvList reads a comma-separated list, dropping empty entries
+func getEnvList(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
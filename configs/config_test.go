@@ -0,0 +1,201 @@
+package configs
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want []string // Substrings of the error; none means valid
+	}{
+		{
+			name: "development defaults",
+		},
+		{
+			name: "valid production config",
+			env: map[string]string{
+				"APP_ENV":     "production",
+				"JWT_SECRET":  "a-real-production-secret",
+				"DB_USER":     "app",
+				"DB_PASSWORD": "a-real-db-password",
+			},
+		},
+		{
+			name: "production with demo secrets",
+			env: map[string]string{
+				"APP_ENV": "production",
+			},
+			want: []string{
+				"JWT_SECRET must be set in production",
+				"DB_USER and DB_PASSWORD must be set in production",
+			},
+		},
+		{
+			name: "bad duration",
+			env:  map[string]string{"JWT_ACCESS_TTL": "soon"},
+			want: []string{"invalid JWT_ACCESS_TTL"},
+		},
+		{
+			name: "several problems are all reported",
+			env: map[string]string{
+				"PRICE_HISTORY_SIZE": "0",
+				"MAX_BULK_COINS":     "0",
+				"LOG_LEVEL":          "loud",
+				"COINGECKO_TIMEOUT":  "-1s",
+			},
+			want: []string{
+				"PRICE_HISTORY_SIZE must be at least 1",
+				"MAX_BULK_COINS must be at least 1",
+				"LOG_LEVEL must be debug, info, warn or error",
+				"COINGECKO_TIMEOUT must be positive",
+			},
+		},
+		{
+			name: "refresh shorter than access",
+			env: map[string]string{
+				"JWT_ACCESS_TTL":  "2h",
+				"JWT_REFRESH_TTL": "1h",
+			},
+			want: []string{"JWT_REFRESH_TTL must not be shorter than JWT_ACCESS_TTL"},
+		},
+		{
+			name: "stream drain longer than shutdown",
+			env: map[string]string{
+				"SHUTDOWN_TIMEOUT":     "5s",
+				"STREAM_DRAIN_TIMEOUT": "10s",
+			},
+			want: []string{"STREAM_DRAIN_TIMEOUT must be positive and at most SHUTDOWN_TIMEOUT"},
+		},
+		{
+			name: "bad service clients",
+			env: map[string]string{
+				"SERVICE_CLIENTS": "bot:short:crypto,bot:0123456789abcdef:admin,broken",
+			},
+			want: []string{
+				"invalid SERVICE_CLIENTS entry",
+				`secret of client "bot" must be at least 16 characters`,
+				`client "bot" is listed twice`,
+				`client "bot" has unknown scope "admin"`,
+			},
+		},
+		{
+			name: "unsupported currency",
+			env:  map[string]string{"DEFAULT_CURRENCY": "xyz"},
+			want: []string{`DEFAULT_CURRENCY: "xyz" is not a supported currency`},
+		},
+		{
+			name: "bad feature flag",
+			env:  map[string]string{"FEATURE_SERVE_STALE": "maybe"},
+			want: []string{"invalid FEATURE_SERVE_STALE"},
+		},
+		{
+			name: "bad integers",
+			env:  map[string]string{"RATE_LIMIT_RPS": "abc", "MAX_BULK_COINS": "2O"},
+			want: []string{`invalid RATE_LIMIT_RPS: "abc"`, `invalid MAX_BULK_COINS: "2O"`},
+		},
+		{
+			name: "bad trusted proxy",
+			env:  map[string]string{"TRUSTED_PROXIES": "10.0.0.0/8,proxy.internal"},
+			want: []string{`TRUSTED_PROXIES: "proxy.internal" is not an IP or CIDR`},
+		},
+		{
+			name: "no popular coins",
+			env:  map[string]string{"POPULAR_COINS": " , "},
+			want: []string{"POPULAR_COINS must list at least one coin"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			err := LoadConfig().Validate()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("Validate: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("Validate accepted the config")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not mention %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestJWTTTLs(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		access  time.Duration
+		refresh time.Duration
+	}{
+		{"defaults", nil, 15 * time.Minute, 7 * 24 * time.Hour},
+		{"configured", map[string]string{"JWT_ACCESS_TTL": "5m", "JWT_REFRESH_TTL": "48h"}, 5 * time.Minute, 48 * time.Hour},
+		{"old access name", map[string]string{"JWT_EXPIRES_IN": "30m"}, 30 * time.Minute, 7 * 24 * time.Hour},
+		{"new name wins", map[string]string{"JWT_EXPIRES_IN": "30m", "JWT_ACCESS_TTL": "10m"}, 10 * time.Minute, 7 * 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			config := LoadConfig()
+			if config.JWTAccessTTL != tt.access || config.JWTRefreshTTL != tt.refresh {
+				t.Errorf("TTLs = %v access, %v refresh; want %v, %v", config.JWTAccessTTL, config.JWTRefreshTTL, tt.access, tt.refresh)
+			}
+		})
+	}
+}
+
+func TestSlogLevel(t *testing.T) {
+	tests := []struct {
+		env  string
+		want slog.Level
+	}{
+		{"", slog.LevelInfo},
+		{"debug", slog.LevelDebug},
+		{"WARN", slog.LevelWarn},
+		{"error", slog.LevelError},
+	}
+	for _, tt := range tests {
+		t.Setenv("LOG_LEVEL", tt.env)
+		if got := LoadConfig().SlogLevel(); got != tt.want {
+			t.Errorf("LOG_LEVEL=%q: level = %v, want %v", tt.env, got, tt.want)
+		}
+	}
+
+	// Debug records are dropped by the handler at the default level
+	var buf bytes.Buffer
+	t.Setenv("LOG_LEVEL", "info")
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: LoadConfig().SlogLevel()}))
+	logger.Debug("hidden")
+	logger.Info("shown")
+	if strings.Contains(buf.String(), "hidden") || !strings.Contains(buf.String(), "shown") {
+		t.Errorf("info level logged %q, want only the info record", buf.String())
+	}
+}
+
+func TestDefaultCurrencyConfig(t *testing.T) {
+	t.Setenv("DEFAULT_CURRENCY", "EUR")
+	config := LoadConfig()
+	if config.DefaultCurrency != "eur" {
+		t.Errorf("DefaultCurrency = %q, want eur", config.DefaultCurrency)
+	}
+	if err := config.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package configs
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Features are optional behaviors, each toggled by a FEATURE_* variable.
+// The older *_ENABLED names are still read when the FEATURE_* one is unset.
+type Features struct {
+	Metrics       bool // FEATURE_METRICS: expose Prometheus metrics at /metrics
+	APIDocs       bool // FEATURE_API_DOCS: serve /openapi.json and /docs
+	Compression   bool // FEATURE_COMPRESSION: gzip large responses
+	UserCache     bool // FEATURE_USER_CACHE: serve cached users while the database is down
+	ServeStale    bool // FEATURE_SERVE_STALE: serve expired cached prices while CoinGecko is down
+	LiveStreaming bool // FEATURE_LIVE_STREAMING: poll popular coins for WebSocket subscribers
+	WSCompression bool // FEATURE_WS_COMPRESSION: offer permessage-deflate on WebSocket connections
+}
+
+// feature describes one flag for loading and logging
+type feature struct {
+	name      string // Suffix of the FEATURE_* variable, also used in logs
+	legacyKey string // Older variable read as a fallback, if any
+	value     func(*Features) *bool
+	enabled   bool // Default
+}
+
+var features = []feature{
+	{"METRICS", "METRICS_ENABLED", func(f *Features) *bool { return &f.Metrics }, false},
+	{"API_DOCS", "API_DOCS_ENABLED", func(f *Features) *bool { return &f.APIDocs }, true},
+	{"COMPRESSION", "COMPRESSION_ENABLED", func(f *Features) *bool { return &f.Compression }, true},
+	{"USER_CACHE", "USER_CACHE_ENABLED", func(f *Features) *bool { return &f.UserCache }, false},
+	{"SERVE_STALE", "", func(f *Features) *bool { return &f.ServeStale }, true},
+	{"LIVE_STREAMING", "", func(f *Features) *bool { return &f.LiveStreaming }, true},
+	{"WS_COMPRESSION", "", func(f *Features) *bool { return &f.WSCompression }, true},
+}
+
+// loadFeatures reads every flag, recording unparseable values in loadErrors
+func loadFeatures(loadErrors *[]error) Features {
+	var f Features
+	for _, feat := range features {
+		*feat.value(&f) = getEnvFeature(feat, loadErrors)
+	}
+	return f
+}
+
+// getEnvFeature parses FEATURE_<name>, then the legacy variable, with
+// strconv.ParseBool ("true", "1", "false", "0", ...)
+func getEnvFeature(feat feature, loadErrors *[]error) bool {
+	for _, key := range []string{"FEATURE_" + feat.name, feat.legacyKey} {
+		if key == "" {
+			continue
+		}
+		value := os.Getenv(key)
+		if value == "" {
+			continue
+		}
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			*loadErrors = append(*loadErrors, fmt.Errorf("invalid %s: %w", key, err))
+			return feat.enabled
+		}
+		return enabled
+	}
+	return feat.enabled
+}
+
+// Enabled lists the names of the enabled features, for the startup log
+func (f Features) Enabled() []string {
+	var names []string
+	for _, feat := range features {
+		if *feat.value(&f) {
+			names = append(names, feat.name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,71 @@
+package configs
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadFeatures(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want Features
+	}{
+		{
+			name: "defaults",
+			want: Features{APIDocs: true, Compression: true, ServeStale: true, LiveStreaming: true, WSCompression: true},
+		},
+		{
+			name: "toggled",
+			env: map[string]string{
+				"FEATURE_METRICS":        "true",
+				"FEATURE_API_DOCS":       "0",
+				"FEATURE_USER_CACHE":     "1",
+				"FEATURE_LIVE_STREAMING": "FALSE",
+			},
+			want: Features{Metrics: true, Compression: true, UserCache: true, ServeStale: true, WSCompression: true},
+		},
+		{
+			name: "legacy names",
+			env:  map[string]string{"METRICS_ENABLED": "true", "COMPRESSION_ENABLED": "false"},
+			want: Features{Metrics: true, APIDocs: true, ServeStale: true, LiveStreaming: true, WSCompression: true},
+		},
+		{
+			name: "new name wins",
+			env:  map[string]string{"FEATURE_METRICS": "false", "METRICS_ENABLED": "true"},
+			want: Features{APIDocs: true, Compression: true, ServeStale: true, LiveStreaming: true, WSCompression: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			var loadErrors []error
+			if got := loadFeatures(&loadErrors); got != tt.want {
+				t.Errorf("features = %+v, want %+v", got, tt.want)
+			}
+			if len(loadErrors) != 0 {
+				t.Errorf("load errors = %v, want none", loadErrors)
+			}
+		})
+	}
+
+	t.Run("invalid value keeps the default", func(t *testing.T) {
+		t.Setenv("FEATURE_COMPRESSION", "maybe")
+		var loadErrors []error
+		if got := loadFeatures(&loadErrors); !got.Compression {
+			t.Error("compression disabled, want the default")
+		}
+		if len(loadErrors) != 1 || !strings.Contains(loadErrors[0].Error(), "FEATURE_COMPRESSION") {
+			t.Errorf("load errors = %v, want one for FEATURE_COMPRESSION", loadErrors)
+		}
+	})
+}
+
+func TestFeaturesEnabled(t *testing.T) {
+	f := Features{Metrics: true, ServeStale: true}
+	if got := strings.Join(f.Enabled(), ","); got != "METRICS,SERVE_STALE" {
+		t.Errorf("Enabled = %s, want METRICS,SERVE_STALE", got)
+	}
+}
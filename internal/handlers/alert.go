@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"my-go-backend/internal/respond"
+	"my-go-backend/internal/services"
+	"my-go-backend/pkg/models"
+	"net/http"
+	"strconv"
+)
+
+type AlertHandler struct {
+	alertService *services.AlertService
+}
+
+func NewAlertHandler(alertService *services.AlertService) *AlertHandler {
+	return &AlertHandler{alertService: alertService}
+}
+
+// CreateAlert - Register a price alert for the authenticated user
+func (h *AlertHandler) CreateAlert(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		respond.Error(c, http.StatusUnauthorized, "Invalid user in token", nil)
+		return
+	}
+
+	var req models.CreateAlertRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respond.Error(c, http.StatusBadRequest, "Invalid request data", err)
+		return
+	}
+
+	alert, err := h.alertService.CreateAlert(userID, &req)
+	if errors.Is(err, services.ErrEmptyCoinID) || errors.Is(err, services.ErrInvalidCoinID) {
+		respond.Error(c, http.StatusBadRequest, "Invalid coin ID", err)
+		return
+	}
+	if err != nil {
+		respond.Error(c, http.StatusInternalServerError, "Failed to create alert", err)
+		return
+	}
+
+	respond.Created(c, "Alert created successfully", alert)
+}
+
+// GetAlerts - List the authenticated user's alerts
+func (h *AlertHandler) GetAlerts(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		respond.Error(c, http.StatusUnauthorized, "Invalid user in token", nil)
+		return
+	}
+
+	alerts, err := h.alertService.GetUserAlerts(userID)
+	if err != nil {
+		respond.Error(c, http.StatusInternalServerError, "Failed to retrieve alerts", err)
+		return
+	}
+
+	respond.OK(c, "Alerts retrieved successfully", alerts)
+}
+
+// DeleteAlert - Remove one of the authenticated user's alerts
+func (h *AlertHandler) DeleteAlert(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		respond.Error(c, http.StatusUnauthorized, "Invalid user in token", nil)
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "Invalid alert ID", err)
+		return
+	}
+
+	err = h.alertService.DeleteAlert(userID, uint(id))
+	if errors.Is(err, services.ErrAlertNotFound) {
+		respond.Error(c, http.StatusNotFound, "Alert not found", err)
+		return
+	}
+	if err != nil {
+		respond.Error(c, http.StatusInternalServerError, "Failed to delete alert", err)
+		return
+	}
+
+	respond.OK(c, "Alert deleted successfully", nil)
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"my-go-backend/pkg/models"
+)
+
+func TestAlertRoutes(t *testing.T) {
+	app := newTestRoutes(t)
+	const owner, other = 1, 2
+
+	w := app.serveAs(t, owner, models.RoleUser, http.MethodPost, "/api/v1/crypto/alerts", `{"coin_id":"bitcoin","direction":"above","target_price":60000}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: status = %d, want 201: %s", w.Code, w.Body.String())
+	}
+	var created struct {
+		Data models.PriceAlert `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+	alertPath := fmt.Sprintf("/api/v1/crypto/alerts/%d", created.Data.ID)
+
+	for _, body := range []string{
+		`{"coin_id":"bit/coin","direction":"above","target_price":1}`,
+		`{"coin_id":"bitcoin","direction":"sideways","target_price":1}`,
+		`{"coin_id":"bitcoin","direction":"above","target_price":-1}`,
+	} {
+		if w := app.serveAs(t, owner, models.RoleUser, http.MethodPost, "/api/v1/crypto/alerts", body); w.Code != http.StatusBadRequest {
+			t.Errorf("create %s: status = %d, want 400", body, w.Code)
+		}
+	}
+
+	list := func(userID uint) []models.PriceAlert {
+		t.Helper()
+		w := app.serveAs(t, userID, models.RoleUser, http.MethodGet, "/api/v1/crypto/alerts", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("list: status = %d, want 200", w.Code)
+		}
+		var response struct {
+			Data []models.PriceAlert `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("invalid body: %v", err)
+		}
+		return response.Data
+	}
+	if alerts := list(owner); len(alerts) != 1 || alerts[0].ID != created.Data.ID {
+		t.Errorf("owner's alerts = %+v, want the created one", alerts)
+	}
+	if alerts := list(other); len(alerts) != 0 {
+		t.Errorf("other user's alerts = %+v, want none", alerts)
+	}
+
+	// Another user's alert is not found rather than forbidden
+	if w := app.serveAs(t, other, models.RoleUser, http.MethodDelete, alertPath, ""); w.Code != http.StatusNotFound || errorCodeOf(t, w) != models.CodeAlertNotFound {
+		t.Errorf("other user deleting: status %d: %s; want 404 ALERT_NOT_FOUND", w.Code, w.Body.String())
+	}
+	if w := app.serveAs(t, owner, models.RoleUser, http.MethodDelete, alertPath, ""); w.Code != http.StatusOK {
+		t.Fatalf("delete: status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	if w := app.serveAs(t, owner, models.RoleUser, http.MethodDelete, alertPath, ""); w.Code != http.StatusNotFound || errorCodeOf(t, w) != models.CodeAlertNotFound {
+		t.Errorf("delete again: status %d: %s; want 404 ALERT_NOT_FOUND", w.Code, w.Body.String())
+	}
+	if w := app.serveAs(t, owner, models.RoleUser, http.MethodDelete, "/api/v1/crypto/alerts/abc", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid id: status = %d, want 400", w.Code)
+	}
+
+	// Database failures aren't reported as a missing alert
+	sqlDB, _ := app.db.DB()
+	sqlDB.Close()
+	if w := app.serveAs(t, owner, models.RoleUser, http.MethodDelete, alertPath, ""); w.Code != http.StatusInternalServerError {
+		t.Errorf("database down: status = %d, want 500: %s", w.Code, w.Body.String())
+	}
+}
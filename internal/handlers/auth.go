@@ -1,10 +1,14 @@
 package handlers
 
 import (
+	"errors"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"my-go-backend/internal/respond"
 	"my-go-backend/internal/services"
 	"my-go-backend/pkg/models"
 	"net/http"
+	"strconv"
 )
 
 type AuthHandler struct {
@@ -18,56 +22,205 @@ func NewAuthHandler(authService *services.AuthService) *AuthHandler {
 func (h *AuthHandler) Register(c *gin.Context) {
 	var req models.CreateUserRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.APIResponse{
-			Success: false,
-			Message: "Invalid request data",
-			Error:   err.Error(),
-		})
+		respond.Error(c, http.StatusBadRequest, "Invalid request data", bindingError(err))
 		return
 	}
 
-	user, err := h.authService.Register(&req)
+	user, err := h.authService.Register(&req, clientInfo(c))
+	var fieldErr *services.FieldError
+	if errors.As(err, &fieldErr) {
+		respond.Error(c, http.StatusBadRequest, "Invalid request data", fieldErr)
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusConflict, models.APIResponse{
-			Success: false,
-			Message: "Failed to create user",
-			Error:   err.Error(),
-		})
+		respond.Error(c, http.StatusConflict, "Failed to create user", err)
 		return
 	}
 
-	c.JSON(http.StatusCreated, models.APIResponse{
-		Success: true,
-		Message: "User created successfully",
-		Data:    user,
-	})
+	respond.Created(c, "User created successfully", user)
 }
 
 func (h *AuthHandler) Login(c *gin.Context) {
 	var req models.LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.APIResponse{
-			Success: false,
-			Message: "Invalid request data",
-			Error:   err.Error(),
-		})
+		respond.Error(c, http.StatusBadRequest, "Invalid request data", bindingError(err))
 		return
 	}
 
-	auth, err := h.authService.Login(&req)
+	auth, err := h.authService.Login(&req, clientInfo(c))
 	if err != nil {
 		// This isn't unauthorized, its unauthenticated
-		c.JSON(403, models.APIResponse{
-			Success: false,
-			Message: "Login failed",
-			Error:   err.Error(),
-		})
+		respond.Error(c, 403, "Login failed", err)
+		return
+	}
+
+	respond.OK(c, "Login successful", auth)
+}
+
+// IssueToken - OAuth2 client credentials grant for service-to-service
+// calls. Accepts JSON or a form, with the client id and secret in the body
+// or HTTP Basic auth.
+func (h *AuthHandler) IssueToken(c *gin.Context) {
+	var req models.ServiceTokenRequest
+	if err := c.ShouldBind(&req); err != nil {
+		respond.Error(c, http.StatusBadRequest, "Invalid request data", bindingError(err))
+		return
+	}
+	if id, secret, ok := c.Request.BasicAuth(); ok && req.ClientID == "" {
+		req.ClientID, req.ClientSecret = id, secret
+	}
+
+	token, err := h.authService.IssueServiceToken(req.ClientID, req.ClientSecret, req.Scope, clientInfo(c))
+	if errors.Is(err, services.ErrInvalidClient) {
+		respond.Error(c, http.StatusUnauthorized, "Token request failed", err)
+		return
+	}
+	if errors.Is(err, services.ErrInvalidScope) {
+		respond.Error(c, http.StatusBadRequest, "Token request failed", err)
+		return
+	}
+	if err != nil {
+		respond.Error(c, http.StatusInternalServerError, "Token request failed", err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	respond.OK(c, "Token issued", token)
+}
+
+// Refresh - Exchange a refresh token for a new access and refresh token pair
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req models.RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respond.Error(c, http.StatusBadRequest, "Invalid request data", bindingError(err))
+		return
+	}
+
+	auth, err := h.authService.Refresh(req.RefreshToken, clientInfo(c))
+	if errors.Is(err, services.ErrInvalidRefreshToken) {
+		respond.Error(c, http.StatusUnauthorized, "Token refresh failed", err)
+		return
+	}
+	if err != nil {
+		respond.Error(c, http.StatusInternalServerError, "Token refresh failed", err)
+		return
+	}
+
+	respond.OK(c, "Token refreshed", auth)
+}
+
+// DeleteAccount - Delete the authenticated user's own account
+func (h *AuthHandler) DeleteAccount(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		respond.Error(c, http.StatusUnauthorized, "Invalid user in token", nil)
+		return
+	}
+
+	var req models.DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respond.Error(c, http.StatusBadRequest, "Invalid request data", bindingError(err))
+		return
+	}
+
+	err := h.authService.DeleteAccount(userID, req.Password, clientInfo(c))
+	if errors.Is(err, services.ErrInvalidPassword) {
+		respond.Error(c, http.StatusUnauthorized, "Password confirmation failed", err)
+		return
+	}
+	if errors.Is(err, services.ErrUserNotFound) {
+		respond.Error(c, http.StatusNotFound, "User not found", err)
+		return
+	}
+	if err != nil {
+		respond.Error(c, http.StatusInternalServerError, "Failed to delete account", err)
+		return
+	}
+
+	respond.OK(c, "Account deleted successfully", nil)
+}
+
+// GetSessions - List the authenticated user's active sessions
+func (h *AuthHandler) GetSessions(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		respond.Error(c, http.StatusUnauthorized, "Invalid user in token", nil)
+		return
+	}
+
+	sessions, err := h.authService.ListSessions(userID)
+	if err != nil {
+		respond.Error(c, http.StatusInternalServerError, "Failed to retrieve sessions", err)
+		return
+	}
+
+	respond.OK(c, "Sessions retrieved successfully", sessions)
+}
+
+// RevokeSession - Revoke one of the authenticated user's sessions
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		respond.Error(c, http.StatusUnauthorized, "Invalid user in token", nil)
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "Invalid session ID", err)
+		return
+	}
+
+	err = h.authService.RevokeSession(userID, sessionID.String(), clientInfo(c))
+	if errors.Is(err, services.ErrSessionNotFound) {
+		respond.Error(c, http.StatusNotFound, "Session not found", err)
+		return
+	}
+	if err != nil {
+		respond.Error(c, http.StatusInternalServerError, "Failed to revoke session", err)
+		return
+	}
+
+	respond.OK(c, "Session revoked successfully", nil)
+}
+
+// GetAuthEvents - List authentication audit events, newest first. Admins see
+// everyone's and may filter by user_id; other users see only their own.
+func (h *AuthHandler) GetAuthEvents(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		respond.Error(c, http.StatusUnauthorized, "Invalid user in token", nil)
+		return
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil {
+		page = 1
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(services.DefaultAuthEventPageSize)))
+	if err != nil {
+		limit = services.DefaultAuthEventPageSize
+	}
+
+	opts := services.AuthEventListOptions{UserID: &userID, Type: c.Query("type")}
+	if currentRole(c) == models.RoleAdmin {
+		opts.UserID = nil
+		if userParam := c.Query("user_id"); userParam != "" {
+			filterID, err := strconv.ParseUint(userParam, 10, 32)
+			if err != nil {
+				respond.Error(c, http.StatusBadRequest, "Invalid user ID", err)
+				return
+			}
+			id := uint(filterID)
+			opts.UserID = &id
+		}
+	}
+
+	events, err := h.authService.ListAuthEvents(page, limit, opts)
+	if err != nil {
+		respond.Error(c, http.StatusInternalServerError, "Failed to retrieve auth events", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, models.APIResponse{
-		Success: true,
-		Message: "Login successful",
-		Data:    auth,
-	})
+	respond.OK(c, "Auth events retrieved successfully", events)
 }
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"my-go-backend/pkg/models"
+)
+
+// signIn logs in through the API and returns the tokens
+func (app *testApp) signIn(t *testing.T, email, password string) models.AuthResponse {
+	t.Helper()
+	return app.signInFrom(t, email, password, "")
+}
+
+// signInFrom is signIn from a client with the given User-Agent
+func (app *testApp) signInFrom(t *testing.T, email, password, userAgent string) models.AuthResponse {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", strings.NewReader(`{"email":"`+email+`","password":"`+password+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	w := httptest.NewRecorder()
+	app.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("login as %s: status %d: %s", email, w.Code, w.Body.String())
+	}
+	var response struct {
+		Data models.AuthResponse `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+	return response.Data
+}
+
+func TestDeleteAccount(t *testing.T) {
+	app := newTestRoutes(t)
+	app.register(t, "leaving", "leaving@example.com", "password1")
+	auth := app.signIn(t, "leaving@example.com", "password1")
+	refresh := `{"refresh_token":"` + auth.RefreshToken + `"}`
+
+	w := app.serve(http.MethodDelete, "/api/v1/auth/me", auth.Token, `{"password":"wrong-password"}`)
+	if w.Code != http.StatusUnauthorized || errorCodeOf(t, w) != models.CodeInvalidPassword {
+		t.Fatalf("wrong password: status %d: %s; want 401 INVALID_PASSWORD", w.Code, w.Body.String())
+	}
+	if w := app.serve(http.MethodPost, "/api/v1/auth/refresh", "", refresh); w.Code != http.StatusOK {
+		t.Errorf("refresh after a refused deletion: status = %d, want 200", w.Code)
+	}
+	if w := app.serve(http.MethodDelete, "/api/v1/auth/me", auth.Token, `{}`); w.Code != http.StatusBadRequest {
+		t.Errorf("without a password: status = %d, want 400", w.Code)
+	}
+
+	if w := app.serve(http.MethodDelete, "/api/v1/auth/me", auth.Token, `{"password":"password1"}`); w.Code != http.StatusOK {
+		t.Fatalf("correct password: status %d: %s", w.Code, w.Body.String())
+	}
+	if w := app.serve(http.MethodPost, "/api/v1/auth/refresh", "", refresh); w.Code != http.StatusUnauthorized {
+		t.Errorf("refresh after deletion: status = %d, want 401", w.Code)
+	}
+	if w := app.login("leaving@example.com", "password1"); w.Code != http.StatusForbidden {
+		t.Errorf("login after deletion: status = %d, want 403", w.Code)
+	}
+	if w := app.serve(http.MethodDelete, "/api/v1/auth/me", auth.Token, `{"password":"password1"}`); w.Code != http.StatusNotFound {
+		t.Errorf("deleting again: status = %d, want 404", w.Code)
+	}
+	if w := app.serve(http.MethodDelete, "/api/v1/auth/me", "", `{"password":"password1"}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("without a token: status = %d, want 401", w.Code)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	app := newTestRoutes(t)
+	app.register(t, "owner", "owner@example.com", "password1")
+	app.register(t, "other", "other@example.com", "password2")
+	laptop := app.signInFrom(t, "owner@example.com", "password1", "laptop-browser")
+	phone := app.signInFrom(t, "owner@example.com", "password1", "phone-app")
+	other := app.signIn(t, "other@example.com", "password2")
+
+	sessions := func(token string) map[string]models.Session {
+		t.Helper()
+		w := app.serve(http.MethodGet, "/api/v1/auth/sessions", token, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("list: status %d: %s", w.Code, w.Body.String())
+		}
+		var response struct {
+			Data []models.Session `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("invalid body: %v", err)
+		}
+		byAgent := make(map[string]models.Session)
+		for _, session := range response.Data {
+			byAgent[session.UserAgent] = session
+		}
+		return byAgent
+	}
+	refresh := func(auth models.AuthResponse) int {
+		return app.serve(http.MethodPost, "/api/v1/auth/refresh", "", `{"refresh_token":"`+auth.RefreshToken+`"}`).Code
+	}
+
+	listed := sessions(laptop.Token)
+	if len(listed) != 2 {
+		t.Fatalf("sessions = %+v, want the laptop and the phone", listed)
+	}
+	session, ok := listed["laptop-browser"]
+	if !ok {
+		t.Fatalf("no laptop session in %+v", listed)
+	}
+	if session.ID == "" || session.IP == "" || session.CreatedAt.IsZero() || session.LastUsedAt.IsZero() {
+		t.Errorf("laptop session = %+v, want its id, ip and times", session)
+	}
+
+	// Sessions are only visible to, and revocable by, their owner
+	if w := app.serve(http.MethodDelete, "/api/v1/auth/sessions/"+session.ID, other.Token, ""); w.Code != http.StatusNotFound || errorCodeOf(t, w) != models.CodeSessionNotFound {
+		t.Errorf("another user revoking: status %d: %s; want 404 SESSION_NOT_FOUND", w.Code, w.Body.String())
+	}
+	if got := sessions(other.Token); len(got) != 1 {
+		t.Errorf("other user's sessions = %+v, want only their own", got)
+	}
+	if w := app.serve(http.MethodDelete, "/api/v1/auth/sessions/not-a-uuid", laptop.Token, ""); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid id: status = %d, want 400", w.Code)
+	}
+
+	if w := app.serve(http.MethodDelete, "/api/v1/auth/sessions/"+session.ID, phone.Token, ""); w.Code != http.StatusOK {
+		t.Fatalf("revoke: status %d: %s", w.Code, w.Body.String())
+	}
+	if got := sessions(phone.Token); len(got) != 1 || got["phone-app"].ID == "" {
+		t.Errorf("sessions after revoking = %+v, want only the phone", got)
+	}
+	if code := refresh(laptop); code != http.StatusUnauthorized {
+		t.Errorf("refresh on the revoked session: status = %d, want 401", code)
+	}
+	if code := refresh(phone); code != http.StatusOK {
+		t.Errorf("refresh on the kept session: status = %d, want 200", code)
+	}
+	if w := app.serve(http.MethodDelete, "/api/v1/auth/sessions/"+session.ID, phone.Token, ""); w.Code != http.StatusNotFound {
+		t.Errorf("revoking twice: status = %d, want 404", w.Code)
+	}
+}
+
+func TestRegisterValidation(t *testing.T) {
+	app := newTestRoutes(t)
+
+	tests := []struct {
+		name  string
+		body  string
+		field string
+	}{
+		{"bad email", `{"username":"newuser","email":"not-an-email","password":"password1"}`, "email"},
+		{"email with a display name", `{"username":"newuser","email":"Bob <bob@example.com>","password":"password1"}`, "email"},
+		{"username with spaces", `{"username":"new user","email":"new@example.com","password":"password1"}`, "username"},
+		{"short username", `{"username":"ab","email":"new@example.com","password":"password1"}`, "username"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := app.serve(http.MethodPost, "/api/v1/auth/register", "", tt.body)
+			if w.Code != http.StatusBadRequest || errorCodeOf(t, w) != models.CodeValidation {
+				t.Fatalf("status %d: %s; want 400 VALIDATION", w.Code, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tt.field) {
+				t.Errorf("body = %s, want it to name the %s field", w.Body.String(), tt.field)
+			}
+		})
+	}
+
+	// None of them were stored, so the valid registration goes through
+	app.register(t, "newuser", "new@example.com", "password1")
+}
+
+func TestEmailCaseInsensitive(t *testing.T) {
+	app := newTestRoutes(t)
+
+	user := app.register(t, "mixed", "  Mixed.Case@Example.COM ", "password1")
+	if user.Email != "mixed.case@example.com" {
+		t.Errorf("stored email = %q, want it lowercased", user.Email)
+	}
+
+	for _, email := range []string{"mixed.case@example.com", "MIXED.CASE@EXAMPLE.COM"} {
+		if w := app.login(email, "password1"); w.Code != http.StatusOK {
+			t.Errorf("login as %s: status = %d, want 200", email, w.Code)
+		}
+	}
+
+	w := app.serve(http.MethodPost, "/api/v1/auth/register", "", `{"username":"other","email":"mixed.case@EXAMPLE.com","password":"password2"}`)
+	if w.Code != http.StatusConflict {
+		t.Errorf("same email in another case: status = %d, want 409", w.Code)
+	}
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"my-go-backend/pkg/models"
+)
+
+// currentUserID reads the user ID stored by AuthMiddleware
+func currentUserID(c *gin.Context) (uint, bool) {
+	value, exists := c.Get("user_id")
+	if !exists {
+		return 0, false
+	}
+	return claimToUserID(value)
+}
+
+// currentRole reads the role stored by AuthMiddleware
+func currentRole(c *gin.Context) string {
+	role, _ := c.Get("role")
+	roleStr, _ := role.(string)
+	return roleStr
+}
+
+// clientInfo describes the caller for auth audit events
+func clientInfo(c *gin.Context) models.ClientInfo {
+	return models.ClientInfo{
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+}
+
+// claimToUserID converts a JWT "user_id" claim (decoded as float64) to a uint
+func claimToUserID(value interface{}) (uint, bool) {
+	id, ok := value.(float64)
+	if !ok || id <= 0 {
+		return 0, false
+	}
+	return uint(id), true
+}
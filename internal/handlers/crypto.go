@@ -2,91 +2,301 @@ package handlers
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"my-go-backend/internal/middleware"
+	"my-go-backend/internal/respond"
 	"my-go-backend/internal/services"
 	"my-go-backend/pkg/models"
 )
 
+// SSE connection tuning
+const (
+	sseHeartbeatInterval = 15 * time.Second
+	sseRetryInterval     = 3 * time.Second
+)
+
+// keepStreamOpen lifts the server read and write timeouts for a long-lived
+// stream. Otherwise the write deadline cuts the stream off, and the expired
+// read deadline cancels the request context.
+func keepStreamOpen(c *gin.Context) {
+	rc := http.NewResponseController(c.Writer)
+	if err := rc.SetReadDeadline(time.Time{}); err != nil {
+		log.Printf("Error clearing stream read deadline: %v", err)
+	}
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("Error clearing stream write deadline: %v", err)
+	}
+}
+
+// startStream registers an SSE or NDJSON stream so shutdown can drain it,
+// responding with 503 instead once the server is shutting down. The stream
+// must run on the returned context and call release when it ends.
+func (h *CryptoHandler) startStream(c *gin.Context) (context.Context, func(), bool) {
+	ctx, release, ok := h.cryptoService.StartStream(c.Request.Context())
+	if !ok {
+		respond.Error(c, http.StatusServiceUnavailable, "Server is shutting down", nil)
+	}
+	return ctx, release, ok
+}
+
 type CryptoHandler struct {
 	cryptoService *services.CryptoService
 	upgrader      websocket.Upgrader // WebSocket upgrader
+	maxBulkCoins  int                // Max coins per bulk/portfolio request
+	popularCoins  []string           // Served by GetPopularCoins, in order
 }
 
-func NewCryptoHandler(cryptoService *services.CryptoService) *CryptoHandler {
+// WebSocketOptions tunes the WebSocket upgrader
+type WebSocketOptions struct {
+	ReadBufferSize  int  // Bytes; 0 reuses the HTTP server's buffers
+	WriteBufferSize int  // Bytes; 0 reuses the HTTP server's buffers
+	Compression     bool // Negotiate permessage-deflate with clients that offer it
+}
+
+func NewCryptoHandler(cryptoService *services.CryptoService, allowedOrigins []string, maxBulkCoins int, popularCoins []string, wsOptions WebSocketOptions) *CryptoHandler {
+	if maxBulkCoins < 1 {
+		maxBulkCoins = 1
+	}
 	return &CryptoHandler{
 		cryptoService: cryptoService,
+		maxBulkCoins:  maxBulkCoins,
+		popularCoins:  popularCoins,
 		upgrader: websocket.Upgrader{
+			ReadBufferSize:    wsOptions.ReadBufferSize,
+			WriteBufferSize:   wsOptions.WriteBufferSize,
+			EnableCompression: wsOptions.Compression,
 			CheckOrigin: func(r *http.Request) bool {
-				return true // Allow all origins for demo
+				origin := r.Header.Get("Origin")
+				// Non-browser clients don't send an Origin
+				if origin == "" {
+					return true
+				}
+				// Same-origin pages are always allowed
+				if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+					return true
+				}
+				return middleware.IsOriginAllowed(origin, allowedOrigins)
 			},
 		},
 	}
 }
 
-// GetSingleCrypto - Get data for a single cryptocurrency
+// coinIDParam normalizes the :coinId path parameter, responding with 400
+// when it's empty or has characters a coin id can't contain
+func coinIDParam(c *gin.Context) (string, bool) {
+	coinID, err := services.NormalizeCoinID(c.Param("coinId"))
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "Invalid coin ID", err)
+		return "", false
+	}
+	return coinID, true
+}
+
+// GetSingleCrypto - Get data for a single cryptocurrency, optionally only
+// some of its fields (?fields=price,change_percent_24h)
 func (h *CryptoHandler) GetSingleCrypto(c *gin.Context) {
-	coinID := c.Param("coinId")
-	if coinID == "" {
-		c.JSON(http.StatusBadRequest, models.APIResponse{
-			Success: false,
-			Message: "Coin ID is required",
-		})
+	coinID, ok := coinIDParam(c)
+	if !ok {
+		return
+	}
+	fields, ok := cryptoFieldsParam(c)
+	if !ok {
+		return
+	}
+	sparkline, ok := sparklineParam(c)
+	if !ok {
 		return
 	}
 
-	crypto, err := h.cryptoService.GetSingleCrypto(coinID)
+	crypto, err := h.cryptoService.GetSingleCrypto(c.Request.Context(), coinID)
+	if errors.Is(err, services.ErrCoinNotFound) {
+		respond.Error(c, http.StatusNotFound, "Coin not found", err)
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
-			Success: false,
-			Message: "Failed to fetch crypto data",
-			Error:   err.Error(),
-		})
+		respond.Error(c, cryptoErrorStatus(err), "Failed to fetch crypto data", err)
+		return
+	}
+	if crypto.Stale {
+		c.Header("Warning", `110 - "Response is Stale"`)
+	}
+	if sparkline {
+		sparklines, err := h.cryptoService.GetSparklines(c.Request.Context(), []string{coinID}, h.cryptoService.DefaultCurrency())
+		// A stale price means CoinGecko is failing; serve it without the sparkline
+		if err != nil && !crypto.Stale {
+			respond.Error(c, cryptoErrorStatus(err), "Failed to fetch sparkline", err)
+			return
+		}
+		crypto.Sparkline7d = sparklines[coinID]
+	}
+
+	// Polling clients send back the ETag and get a bodiless 304 until the
+	// cached price is refreshed
+	etag := cryptoETag(crypto, fields)
+	c.Header("ETag", etag)
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	var data interface{} = crypto
+	if fields != nil {
+		if data, err = projectCrypto(*crypto, fields); err != nil {
+			respond.Error(c, http.StatusInternalServerError, "Failed to encode crypto data", err)
+			return
+		}
+	}
+
+	respond.OK(c, "Crypto data retrieved successfully", data)
+}
+
+// cryptoETag is a weak ETag that changes whenever the coin is refetched, goes
+// stale, its sparkline changes or a different set of fields is selected
+func cryptoETag(crypto *models.CryptoData, fields []string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%v|%d|%t|%v|%s", crypto.ID, crypto.Price, crypto.FetchedAt.UnixNano(), crypto.Stale, crypto.Sparkline7d, strings.Join(fields, ","))))
+	return `W/"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header lists etag, using the
+// weak comparison If-None-Match calls for
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// GetRecentPrices - Prices recently fetched for a coin, oldest first
+func (h *CryptoHandler) GetRecentPrices(c *gin.Context) {
+	coinID, ok := coinIDParam(c)
+	if !ok {
+		return
+	}
+
+	history, err := h.cryptoService.GetRecentPrices(coinID)
+	if err != nil {
+		respond.Error(c, http.StatusNotFound, "No recent prices", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, models.APIResponse{
-		Success: true,
-		Message: "Crypto data retrieved successfully",
-		Data:    crypto,
-	})
+	respond.OK(c, "Recent prices retrieved successfully", history)
+}
+
+// sparklineParam parses ?sparkline=true, which adds the heavier 7-day
+// sparkline to each coin. Values other than true or false get 400.
+func sparklineParam(c *gin.Context) (bool, bool) {
+	switch c.DefaultQuery("sparkline", "false") {
+	case "true":
+		return true, true
+	case "false":
+		return false, true
+	default:
+		respond.Error(c, http.StatusBadRequest, "Invalid sparkline parameter", errors.New("sparkline must be true or false"))
+		return false, false
+	}
+}
+
+// cryptoErrorStatus maps CryptoService errors to an HTTP status
+func cryptoErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrCoinNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrRateLimited):
+		return http.StatusTooManyRequests
+	case errors.Is(err, services.ErrUpstreamUnavailable), errors.Is(err, services.ErrMalformedResponse):
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// ListCoins - Paginated list of valid coin ids
+func (h *CryptoHandler) ListCoins(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil {
+		page = 1
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(services.DefaultCoinPageSize)))
+	if err != nil {
+		limit = services.DefaultCoinPageSize
+	}
+
+	coins, err := h.cryptoService.ListCoins(c.Request.Context(), page, limit)
+	if err != nil {
+		respond.Error(c, cryptoErrorStatus(err), "Failed to list coins", err)
+		return
+	}
+
+	respond.OK(c, "Coins retrieved successfully", coins)
+}
+
+// GetOHLC - Candlestick data for charting
+func (h *CryptoHandler) GetOHLC(c *gin.Context) {
+	coinID, ok := coinIDParam(c)
+	if !ok {
+		return
+	}
+	currency := strings.ToLower(c.DefaultQuery("currency", h.cryptoService.DefaultCurrency()))
+	if !services.IsSupportedCurrency(currency) {
+		respond.Error(c, http.StatusBadRequest, "Unsupported currency", nil)
+		return
+	}
+
+	days, err := strconv.Atoi(c.DefaultQuery("days", "7"))
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "Invalid days parameter", err)
+		return
+	}
+
+	candles, err := h.cryptoService.GetOHLC(c.Request.Context(), coinID, currency, days)
+	if errors.Is(err, services.ErrInvalidDays) {
+		respond.Error(c, http.StatusBadRequest, "Invalid days parameter", err)
+		return
+	}
+	if err != nil {
+		respond.Error(c, cryptoErrorStatus(err), "Failed to fetch OHLC data", err)
+		return
+	}
+
+	respond.OK(c, "OHLC data retrieved successfully", candles)
 }
 
 // GetBulkCrypto - Demonstrates goroutines with timeout
 func (h *CryptoHandler) GetBulkCrypto(c *gin.Context) {
 	var req models.BulkCryptoRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.APIResponse{
-			Success: false,
-			Message: "Invalid request format",
-			Error:   err.Error(),
-		})
+		respond.Error(c, http.StatusBadRequest, "Invalid request format", err)
 		return
 	}
 
-	if len(req.Coins) == 0 {
-		c.JSON(http.StatusBadRequest, models.APIResponse{
-			Success: false,
-			Message: "At least one coin is required",
-		})
+	coins, ok := h.normalizeCoins(c, req.Coins)
+	if !ok {
 		return
 	}
 
-	if len(req.Coins) > 20 {
-		c.JSON(http.StatusBadRequest, models.APIResponse{
-			Success: false,
-			Message: "Maximum 20 coins allowed",
-		})
+	opts, ok := portfolioOptions(c, req.Sort, nil)
+	if !ok {
 		return
 	}
 
@@ -96,279 +306,637 @@ func (h *CryptoHandler) GetBulkCrypto(c *gin.Context) {
 		timeout = time.Duration(req.Timeout) * time.Second
 	}
 
-	portfolio, err := h.cryptoService.GetBulkCrypto(req.Coins, timeout)
+	portfolio, err := h.cryptoService.GetBulkCrypto(c.Request.Context(), coins, timeout, opts)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
-			Success: false,
-			Message: "Failed to fetch bulk crypto data",
-			Error:   err.Error(),
-		})
+		respond.Error(c, http.StatusInternalServerError, "Failed to fetch bulk crypto data", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, models.APIResponse{
-		Success: true,
-		Message: "Bulk crypto data retrieved successfully",
-		Data:    portfolio,
-	})
+	// The body is the same either way; the status tells HTTP-aware clients
+	// whether to look at error_count
+	switch {
+	case portfolio.ErrorCount == 0:
+		respond.OK(c, "Bulk crypto data retrieved successfully", portfolio)
+	case portfolio.SuccessCount == 0:
+		respond.ErrorWithData(c, http.StatusBadGateway, "Failed to fetch bulk crypto data", portfolio, nil)
+	default:
+		respond.Success(c, http.StatusMultiStatus, "Bulk crypto data partially retrieved", portfolio)
+	}
+}
+
+// GetCoins - Bulk read via query string, e.g. ?ids=bitcoin,ethereum&currency=usd
+func (h *CryptoHandler) GetCoins(c *gin.Context) {
+	idsParam := c.Query("ids")
+	if idsParam == "" {
+		respond.Error(c, http.StatusBadRequest, "ids parameter is required", nil)
+		return
+	}
+
+	coins, ok := h.normalizeCoins(c, strings.Split(idsParam, ","))
+	if !ok {
+		return
+	}
+
+	opts, ok := portfolioOptions(c, c.Query("sort"), nil)
+	if !ok {
+		return
+	}
+
+	fields, ok := cryptoFieldsParam(c)
+	if !ok {
+		return
+	}
+
+	currency := strings.ToLower(c.DefaultQuery("currency", h.cryptoService.DefaultCurrency()))
+	if !services.IsSupportedCurrency(currency) {
+		respond.Error(c, http.StatusBadRequest, "Unsupported currency", nil)
+		return
+	}
+
+	sparkline, ok := sparklineParam(c)
+	if !ok {
+		return
+	}
+
+	portfolio, err := h.cryptoService.GetMarkets(c.Request.Context(), coins, currency, opts)
+	if err != nil {
+		respond.Error(c, cryptoErrorStatus(err), "Failed to fetch crypto data", err)
+		return
+	}
+	if sparkline {
+		sparklines, err := h.cryptoService.GetSparklines(c.Request.Context(), coins, currency)
+		if err != nil {
+			respond.Error(c, cryptoErrorStatus(err), "Failed to fetch sparklines", err)
+			return
+		}
+		for i := range portfolio.Portfolio {
+			portfolio.Portfolio[i].Sparkline7d = sparklines[portfolio.Portfolio[i].ID]
+		}
+	}
+
+	data, err := projectPortfolio(portfolio, fields)
+	if err != nil {
+		respond.Error(c, http.StatusInternalServerError, "Failed to encode crypto data", err)
+		return
+	}
+
+	// Prices are cached for a minute server-side anyway
+	c.Header("Cache-Control", "private, max-age=60")
+	respond.OK(c, "Crypto data retrieved successfully", data)
+}
+
+// GetGlobal - Market-wide overview for dashboard headers
+func (h *CryptoHandler) GetGlobal(c *gin.Context) {
+	global, err := h.cryptoService.GetGlobal(c.Request.Context())
+	if err != nil {
+		respond.Error(c, cryptoErrorStatus(err), "Failed to fetch global market data", err)
+		return
+	}
+	if global.Stale {
+		c.Header("Warning", `110 - "Response is Stale"`)
+	}
+
+	respond.OK(c, "Global market data retrieved successfully", global)
+}
+
+// CompareCoins - Compare two coins, e.g. ?a=bitcoin&b=ethereum&currency=usd
+func (h *CryptoHandler) CompareCoins(c *gin.Context) {
+	a, b := c.Query("a"), c.Query("b")
+	if a == "" || b == "" {
+		respond.Error(c, http.StatusBadRequest, "a and b parameters are required", nil)
+		return
+	}
+
+	currency := strings.ToLower(c.DefaultQuery("currency", h.cryptoService.DefaultCurrency()))
+	if !services.IsSupportedCurrency(currency) {
+		respond.Error(c, http.StatusBadRequest, "Unsupported currency", nil)
+		return
+	}
+
+	comparison, err := h.cryptoService.Compare(c.Request.Context(), a, b, currency)
+	if errors.Is(err, services.ErrEmptyCoinID) || errors.Is(err, services.ErrInvalidCoinID) {
+		respond.Error(c, http.StatusBadRequest, "Invalid coin ID", err)
+		return
+	}
+	if err != nil {
+		respond.Error(c, cryptoErrorStatus(err), "Failed to compare coins", err)
+		return
+	}
+
+	respond.OK(c, "Coins compared successfully", comparison)
+}
+
+// normalizeCoins de-duplicates the requested coin ids and enforces
+// maxBulkCoins, responding with 400 when the list is unusable
+func (h *CryptoHandler) normalizeCoins(c *gin.Context, requested []string) ([]string, bool) {
+	coins, err := services.NormalizeCoinIDs(requested)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "Invalid coin list", err)
+		return nil, false
+	}
+
+	if len(coins) > h.maxBulkCoins {
+		respond.Error(c, http.StatusBadRequest, fmt.Sprintf("Maximum %d coins allowed", h.maxBulkCoins), nil)
+		return nil, false
+	}
+	return coins, true
+}
+
+// portfolioOptions validates the requested sort and quantities, responding
+// with 400 if the sort is unknown or a quantity is negative
+func portfolioOptions(c *gin.Context, sort string, quantities map[string]float64) (services.PortfolioOptions, bool) {
+	opts := services.PortfolioOptions{Sort: sort, Quantities: quantities}
+	err := opts.Validate()
+	if errors.Is(err, services.ErrNegativeQuantity) {
+		respond.Error(c, http.StatusBadRequest, "Invalid quantities", err)
+		return opts, false
+	}
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "Invalid sort parameter", err)
+		return opts, false
+	}
+	return opts, true
+}
+
+// totalCurrencies validates the currencies a portfolio should be totaled in,
+// responding with 400 if any is unsupported
+func totalCurrencies(c *gin.Context, currencies []string) ([]string, bool) {
+	normalized, err := services.NormalizeCurrencies(currencies)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "Unsupported currency", err)
+		return nil, false
+	}
+	return normalized, true
 }
 
 // GetPortfolioRealtime - Demonstrates goroutines with rate limiting
 func (h *CryptoHandler) GetPortfolioRealtime(c *gin.Context) {
 	var req models.PortfolioRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.APIResponse{
-			Success: false,
-			Message: "Invalid request format",
-			Error:   err.Error(),
-		})
+		respond.Error(c, http.StatusBadRequest, "Invalid request format", err)
 		return
 	}
 
-	if len(req.Coins) == 0 {
-		c.JSON(http.StatusBadRequest, models.APIResponse{
-			Success: false,
-			Message: "At least one coin is required",
-		})
+	coins, ok := h.normalizeCoins(c, req.Coins)
+	if !ok {
+		return
+	}
+
+	opts, ok := portfolioOptions(c, req.Sort, req.Quantities)
+	if !ok {
+		return
+	}
+	if opts.Currencies, ok = totalCurrencies(c, req.Currencies); !ok {
 		return
 	}
 
-	portfolio, err := h.cryptoService.GetPortfolioRealtime(req.Coins)
+	portfolio, err := h.cryptoService.GetPortfolioRealtime(c.Request.Context(), coins, opts)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
-			Success: false,
-			Message: "Failed to fetch portfolio data",
-			Error:   err.Error(),
-		})
+		// Upstream failures come from fetching the currency totals
+		respond.Error(c, cryptoErrorStatus(err), "Failed to fetch portfolio data", err)
+		return
+	}
+
+	respond.OK(c, "Portfolio data retrieved successfully", portfolio)
+}
+
+// ExportPortfolioCSV - Portfolio as a downloadable CSV file
+func (h *CryptoHandler) ExportPortfolioCSV(c *gin.Context) {
+	var req models.PortfolioRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respond.Error(c, http.StatusBadRequest, "Invalid request format", err)
+		return
+	}
+
+	coins, ok := h.normalizeCoins(c, req.Coins)
+	if !ok {
 		return
 	}
 
-	c.JSON(http.StatusOK, models.APIResponse{
-		Success: true,
-		Message: "Portfolio data retrieved successfully",
-		Data:    portfolio,
-	})
+	opts, ok := portfolioOptions(c, req.Sort, req.Quantities)
+	if !ok {
+		return
+	}
+
+	portfolio, err := h.cryptoService.GetPortfolioRealtime(c.Request.Context(), coins, opts)
+	if err != nil {
+		respond.Error(c, http.StatusInternalServerError, "Failed to fetch portfolio data", err)
+		return
+	}
+
+	// Match quantities to the normalized coin ids
+	quantities := services.NormalizeQuantities(req.Quantities)
+
+	filename := fmt.Sprintf("portfolio-%s.csv", time.Now().UTC().Format("20060102-150405"))
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"coin_id", "symbol", "name", "price", "change_percent_24h", "quantity", "value", "error"})
+
+	for _, coin := range portfolio.Portfolio {
+		quantity := services.HoldingQuantity(quantities, coin.ID)
+
+		// Errored coins still get a row so the export matches the request
+		if coin.Error != "" {
+			w.Write([]string{coin.ID, "", "", "", "", formatFloat(quantity), "", coin.Error})
+			continue
+		}
+
+		w.Write([]string{
+			coin.ID,
+			coin.Symbol,
+			coin.Name,
+			formatFloat(coin.Price),
+			formatFloat(coin.ChangePercent),
+			formatFloat(quantity),
+			formatFloat(coin.Price * quantity),
+			"",
+		})
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		log.Printf("Error writing CSV export: %v", err)
+	}
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
 }
 
 // GetCacheStats - Demonstrates read locks
 func (h *CryptoHandler) GetCacheStats(c *gin.Context) {
 	stats := h.cryptoService.GetCacheStats()
 
-	c.JSON(http.StatusOK, models.APIResponse{
-		Success: true,
-		Message: "Cache statistics retrieved",
-		Data:    stats,
-	})
+	respond.OK(c, "Cache statistics retrieved", stats)
 }
 
 // ClearCache - Demonstrates write locks
 func (h *CryptoHandler) ClearCache(c *gin.Context) {
 	h.cryptoService.ClearCache()
 
-	c.JSON(http.StatusOK, models.APIResponse{
-		Success: true,
-		Message: "Cache cleared successfully",
-	})
+	respond.OK(c, "Cache cleared successfully", nil)
+}
+
+// GetCachedCoin - Inspect one coin's price cache entry
+func (h *CryptoHandler) GetCachedCoin(c *gin.Context) {
+	coinID, ok := coinIDParam(c)
+	if !ok {
+		return
+	}
+
+	entry, err := h.cryptoService.GetCachedCoin(coinID)
+	if err != nil {
+		respond.Error(c, http.StatusNotFound, "Coin not cached", err)
+		return
+	}
+
+	respond.OK(c, "Cache entry retrieved", entry)
+}
+
+// EvictCachedCoin - Drop one coin from the price cache
+func (h *CryptoHandler) EvictCachedCoin(c *gin.Context) {
+	coinID, ok := coinIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.cryptoService.EvictCoin(coinID); err != nil {
+		respond.Error(c, http.StatusNotFound, "Coin not cached", err)
+		return
+	}
+
+	respond.OK(c, "Cache entry evicted", nil)
+}
+
+// RefreshCoin - Refetch one coin from CoinGecko and replace its cache entry
+// (admin only)
+func (h *CryptoHandler) RefreshCoin(c *gin.Context) {
+	coinID, ok := coinIDParam(c)
+	if !ok {
+		return
+	}
+
+	crypto, err := h.cryptoService.RefreshCoin(c.Request.Context(), coinID)
+	if err != nil {
+		respond.Error(c, cryptoErrorStatus(err), "Failed to refresh crypto data", err)
+		return
+	}
+
+	respond.OK(c, "Crypto data refreshed", crypto)
 }
 
-// GetPopularCoins - Get top cryptocurrencies (query params demo)
+// GetPopularCoins - Get the first "limit" of the configured popular coins
 func (h *CryptoHandler) GetPopularCoins(c *gin.Context) {
 	limitStr := c.DefaultQuery("limit", "10")
 	limit, err := strconv.Atoi(limitStr)
-	if err != nil || limit < 1 || limit > 50 {
+	if err != nil || limit < 1 {
 		limit = 10
 	}
 
-	// Popular coins to demonstrate bulk fetching
-	popularCoins := []string{
-		"bitcoin", "ethereum", "tether", "bnb", "solana",
-		"usdc", "xrp", "dogecoin", "cardano", "avalanche-2",
-		"chainlink", "polygon", "litecoin", "uniswap", "ethereum-classic",
+	fields, ok := cryptoFieldsParam(c)
+	if !ok {
+		return
 	}
 
 	// Limit the coins based on the request
+	popularCoins := h.popularCoins
 	if limit < len(popularCoins) {
 		popularCoins = popularCoins[:limit]
 	}
 
-	portfolio, err := h.cryptoService.GetPortfolioRealtime(popularCoins)
+	portfolio, err := h.cryptoService.GetPortfolioRealtime(c.Request.Context(), popularCoins, services.PortfolioOptions{})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
-			Success: false,
-			Message: "Failed to fetch popular coins",
-			Error:   err.Error(),
-		})
+		respond.Error(c, http.StatusInternalServerError, "Failed to fetch popular coins", err)
+		return
+	}
+
+	data, err := projectPortfolio(portfolio, fields)
+	if err != nil {
+		respond.Error(c, http.StatusInternalServerError, "Failed to encode crypto data", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, models.APIResponse{
-		Success: true,
-		Message: "Popular coins retrieved successfully",
-		Data:    portfolio,
-	})
+	respond.OK(c, "Popular coins retrieved successfully", data)
 }
 
-// StreamPrices - Server-Sent Events endpoint
-func (h *CryptoHandler) StreamPrices(c *gin.Context) {
-	// Parse query parameters
-	coinsParam := c.Query("coins")
-	if coinsParam == "" {
-		c.JSON(http.StatusBadRequest, models.APIResponse{
-			Success: false,
-			Message: "coins parameter is required",
-		})
-		return
+// parseStreamInterval reads the "interval" query parameter (seconds between
+// updates), responding with 400 when it isn't a positive whole number. The
+// service clamps it to the configured bounds; see setStreamInterval.
+func parseStreamInterval(c *gin.Context, defaultSeconds int) (time.Duration, bool) {
+	intervalStr := c.Query("interval")
+	if intervalStr == "" {
+		return time.Duration(defaultSeconds) * time.Second, true
 	}
 
-	coins := strings.Split(coinsParam, ",")
-	intervalStr := c.DefaultQuery("interval", "5") // Default 5 seconds
 	interval, err := strconv.Atoi(intervalStr)
 	if err != nil || interval < 1 {
-		interval = 5
+		respond.Error(c, http.StatusBadRequest, "Invalid interval parameter", errors.New("interval must be a positive number of seconds"))
+		return 0, false
+	}
+	return time.Duration(interval) * time.Second, true
+}
+
+// setStreamInterval clamps a requested interval to the server's bounds and
+// reports the interval actually used in the X-Stream-Interval header (seconds)
+func (h *CryptoHandler) setStreamInterval(c *gin.Context, requested time.Duration) time.Duration {
+	interval := h.cryptoService.StreamInterval(requested)
+	c.Header("X-Stream-Interval", strconv.FormatFloat(interval.Seconds(), 'f', -1, 64))
+	return interval
+}
+
+// parseStreamDuration reads the optional "duration" query parameter (seconds
+// a stream may run; the service caps it), responding with 400 when it isn't
+// a positive whole number. 0 means no preference.
+func parseStreamDuration(c *gin.Context) (time.Duration, bool) {
+	durationStr := c.Query("duration")
+	if durationStr == "" {
+		return 0, true
+	}
+
+	duration, err := strconv.Atoi(durationStr)
+	if err != nil || duration < 1 {
+		respond.Error(c, http.StatusBadRequest, "Invalid duration parameter", errors.New("duration must be a positive number of seconds"))
+		return 0, false
+	}
+	return time.Duration(duration) * time.Second, true
+}
+
+// parseStreamConfig reads the price stream query parameters shared by the
+// SSE and NDJSON endpoints, responding with 400 when they're invalid
+func (h *CryptoHandler) parseStreamConfig(c *gin.Context) (models.StreamConfig, bool) {
+	coinsParam := c.Query("coins")
+	if coinsParam == "" {
+		respond.Error(c, http.StatusBadRequest, "coins parameter is required", nil)
+		return models.StreamConfig{}, false
+	}
+
+	// Blank entries ("coins=bitcoin,," or "coins=,") are skipped; a stream
+	// with no coins left is rejected instead of ticking with nothing to fetch.
+	// Every tick fetches all the coins, so they're capped like a bulk request.
+	coins, ok := h.normalizeCoins(c, services.DropBlankCoinIDs(strings.Split(coinsParam, ",")))
+	if !ok {
+		return models.StreamConfig{}, false
+	}
+
+	interval, ok := parseStreamInterval(c, 5)
+	if !ok {
+		return models.StreamConfig{}, false
+	}
+
+	duration, ok := parseStreamDuration(c)
+	if !ok {
+		return models.StreamConfig{}, false
 	}
 
 	maxUpdatesStr := c.DefaultQuery("max_updates", "0")
 	maxUpdates, _ := strconv.Atoi(maxUpdatesStr)
 
+	var requestedTypes []string
+	if typesParam := c.Query("types"); typesParam != "" {
+		requestedTypes = strings.Split(typesParam, ",")
+	}
+	updateTypes, err := services.ParseUpdateTypes(requestedTypes)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "Invalid types parameter", err)
+		return models.StreamConfig{}, false
+	}
+
+	return models.StreamConfig{
+		Coins:       coins,
+		Interval:    interval,
+		MaxUpdates:  maxUpdates,
+		Duration:    duration,
+		UpdateTypes: updateTypes,
+	}, true
+}
+
+// StreamPrices - Server-Sent Events endpoint
+func (h *CryptoHandler) StreamPrices(c *gin.Context) {
+	config, ok := h.parseStreamConfig(c)
+	if !ok {
+		return
+	}
+	config.Interval = h.setStreamInterval(c, config.Interval)
+
+	// Cancelled when the client disconnects or shutdown forces streams closed
+	ctx, release, ok := h.startStream(c)
+	if !ok {
+		return
+	}
+	defer release()
+
+	keepStreamOpen(c)
+
 	// Set SSE headers
 	c.Header("Content-Type", "text/event-stream")
 	c.Header("Cache-Control", "no-cache")
 	c.Header("Connection", "keep-alive")
-	c.Header("Access-Control-Allow-Origin", "*")
-	c.Header("Access-Control-Allow-Headers", "Cache-Control")
 
-	// Create context with cancellation
-	ctx, cancel := context.WithCancel(c.Request.Context())
-	defer cancel()
+	// Start streaming; on shutdown the last event is "shutdown"
+	eventChan := h.cryptoService.StreamPriceUpdates(ctx, config)
 
-	// Configure streaming
-	config := models.StreamConfig{
-		Coins:      coins,
-		Interval:   time.Duration(interval) * time.Second,
-		MaxUpdates: maxUpdates,
-	}
+	// Tell browsers how long to wait before reconnecting
+	fmt.Fprintf(c.Writer, "retry: %d\n\n", sseRetryInterval.Milliseconds())
+	fmt.Fprintf(c.Writer, ": interval %s\n\n", config.Interval)
+	c.Writer.Flush()
 
-	// Start streaming
-	eventChan := h.cryptoService.StreamPriceUpdates(ctx, config)
+	// Periodic comments keep proxies from closing an idle connection
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
 
-	// Write events to client
-	for event := range eventChan {
-		eventData, err := json.Marshal(event)
-		if err != nil {
-			log.Printf("Error marshaling event: %v", err)
-			continue
-		}
+	// All writes happen in this loop, so heartbeats and events never race
+	for {
+		select {
+		case <-ctx.Done():
+			// Client disconnected
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(c.Writer, ": keepalive\n\n")
+			c.Writer.Flush()
+		case event, ok := <-eventChan:
+			if !ok {
+				return
+			}
 
-		// Proper SSE format with ID and event type
-		fmt.Fprintf(c.Writer, "id: %s\n", event.ID)
-		fmt.Fprintf(c.Writer, "event: %s\n", event.Type)
-		fmt.Fprintf(c.Writer, "data: %s\n\n", eventData)
-		c.Writer.Flush()
+			eventData, err := json.Marshal(event)
+			if err != nil {
+				log.Printf("Error marshaling event: %v", err)
+				continue
+			}
 
-		// Check if client disconnected
-		if ctx.Err() != nil {
-			break
+			// Proper SSE format with ID and event type
+			fmt.Fprintf(c.Writer, "id: %s\n", event.ID)
+			fmt.Fprintf(c.Writer, "event: %s\n", event.Type)
+			fmt.Fprintf(c.Writer, "data: %s\n\n", eventData)
+			c.Writer.Flush()
 		}
 	}
 }
 
-// WebSocketHandler - WebSocket endpoint
-func (h *CryptoHandler) WebSocketHandler(c *gin.Context) {
-	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
-	if err != nil {
-		log.Printf("WebSocket upgrade error: %v", err)
+// StreamPricesNDJSON - Newline-delimited JSON alternative to SSE
+func (h *CryptoHandler) StreamPricesNDJSON(c *gin.Context) {
+	config, ok := h.parseStreamConfig(c)
+	if !ok {
 		return
 	}
-	defer conn.Close()
+	config.Interval = h.setStreamInterval(c, config.Interval)
 
-	// Generate unique subscriber ID
-	subscriberID := uuid.New().String()
-	log.Printf("New WebSocket connection: %s", subscriberID)
+	ctx, release, ok := h.startStream(c)
+	if !ok {
+		return
+	}
+	defer release()
 
-	// Add subscriber
-	eventChan := h.cryptoService.AddSubscriber(subscriberID)
-	defer h.cryptoService.RemoveSubscriber(subscriberID)
+	keepStreamOpen(c)
 
-	// Handle client messages in separate goroutine
-	go func() {
-		defer func() {
-			log.Printf("WebSocket read goroutine ended for %s", subscriberID)
-		}()
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Cache-Control", "no-cache")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
 
-		for {
-			var msg models.WebSocketMessage
-			err := conn.ReadJSON(&msg)
-			if err != nil {
-				log.Printf("WebSocket read error for %s: %v", subscriberID, err)
-				break
+	eventChan := h.cryptoService.StreamPriceUpdates(ctx, config)
+
+	// Encode writes each event as one JSON object followed by a newline
+	encoder := json.NewEncoder(c.Writer)
+	for {
+		select {
+		case <-ctx.Done():
+			// Client disconnected
+			return
+		case event, ok := <-eventChan:
+			if !ok {
+				return
 			}
 
-			log.Printf("Received message from %s: %+v", subscriberID, msg)
-
-			switch msg.Action {
-			case "ping":
-				err := conn.WriteJSON(models.WebSocketMessage{
-					Action: "pong",
-					Data:   "Server is alive",
-					ID:     msg.ID,
-				})
-				if err != nil {
-					log.Printf("Error sending pong: %v", err)
-				}
-			case "subscribe":
-				err := conn.WriteJSON(models.WebSocketMessage{
-					Action: "subscribed",
-					Data:   fmt.Sprintf("Subscribed to updates for %s", subscriberID),
-					ID:     msg.ID,
-				})
-				if err != nil {
-					log.Printf("Error sending subscribe confirmation: %v", err)
-				}
+			if err := encoder.Encode(event); err != nil {
+				log.Printf("Error writing NDJSON event: %v", err)
+				return
 			}
+			c.Writer.Flush()
 		}
-	}()
+	}
+}
 
-	// Send events to client
-	for event := range eventChan {
-		err := conn.WriteJSON(event)
-		if err != nil {
-			log.Printf("WebSocket write error: %v", err)
-			break
-		}
+// writeFinalSSEEvent sends the "end" or "shutdown" event that closes a stream
+func writeFinalSSEEvent(c *gin.Context, event models.StreamEvent) {
+	eventData, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error marshaling %s event: %v", event.Type, err)
+		return
 	}
+	fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", event.Type, eventData)
+	c.Writer.Flush()
 }
 
 // StreamPortfolio - Stream portfolio updates
 func (h *CryptoHandler) StreamPortfolio(c *gin.Context) {
 	var req models.PortfolioRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.APIResponse{
-			Success: false,
-			Message: "Invalid request format",
-			Error:   err.Error(),
-		})
+		respond.Error(c, http.StatusBadRequest, "Invalid request format", err)
 		return
 	}
 
+	coins, ok := h.normalizeCoins(c, services.DropBlankCoinIDs(req.Coins))
+	if !ok {
+		return
+	}
+
+	opts, ok := portfolioOptions(c, req.Sort, req.Quantities)
+	if !ok {
+		return
+	}
+	if opts.Currencies, ok = totalCurrencies(c, req.Currencies); !ok {
+		return
+	}
+
+	interval, ok := parseStreamInterval(c, 10)
+	if !ok {
+		return
+	}
+	interval = h.setStreamInterval(c, interval)
+
+	duration, ok := parseStreamDuration(c)
+	if !ok {
+		return
+	}
+
+	ctx, release, ok := h.startStream(c)
+	if !ok {
+		return
+	}
+	defer release()
+
+	keepStreamOpen(c)
+
 	// Set SSE headers
 	c.Header("Content-Type", "text/event-stream")
 	c.Header("Cache-Control", "no-cache")
 	c.Header("Connection", "keep-alive")
-	c.Header("Access-Control-Allow-Origin", "*")
 
-	ctx, cancel := context.WithCancel(c.Request.Context())
-	defer cancel()
+	fmt.Fprintf(c.Writer, ": interval %s\n\n", interval)
+	c.Writer.Flush()
 
-	// Stream portfolio updates every 10 seconds
-	ticker := time.NewTicker(10 * time.Second)
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
+	deadline := time.NewTimer(h.cryptoService.StreamDuration(duration))
+	defer deadline.Stop()
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
+		case <-h.cryptoService.Done():
+			writeFinalSSEEvent(c, services.NewShutdownEvent())
+			return
+		case <-deadline.C:
+			writeFinalSSEEvent(c, services.NewStreamEndEvent(models.StreamEndDuration))
+			return
 		case <-ticker.C:
-			portfolio, err := h.cryptoService.GetPortfolioRealtime(req.Coins)
+			portfolio, err := h.cryptoService.GetPortfolioRealtime(ctx, coins, opts)
 			if err != nil {
 				log.Printf("Error getting portfolio: %v", err)
 				continue
@@ -392,104 +960,3 @@ func (h *CryptoHandler) StreamPortfolio(c *gin.Context) {
 		}
 	}
 }
-
-// WebSocketHandlerWithAuth - WebSocket endpoint with query param auth support
-func (h *CryptoHandler) WebSocketHandlerWithAuth(jwtSecret string) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// Check for token in query parameter or Authorization header
-		tokenString := c.Query("token")
-		if tokenString == "" {
-			authHeader := c.GetHeader("Authorization")
-			if authHeader != "" {
-				tokenString = strings.TrimPrefix(authHeader, "Bearer ")
-			}
-		}
-
-		if tokenString == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token required in query param or Authorization header"})
-			return
-		}
-
-		// Validate JWT token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return []byte(jwtSecret), nil
-		})
-
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-			return
-		}
-
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
-			return
-		}
-
-		userID := claims["user_id"]
-		
-		// Upgrade to WebSocket
-		conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
-		if err != nil {
-			log.Printf("WebSocket upgrade error: %v", err)
-			return
-		}
-		defer conn.Close()
-
-		// Generate unique subscriber ID
-		subscriberID := uuid.New().String()
-		log.Printf("New authenticated WebSocket connection: %s (user: %v)", subscriberID, userID)
-
-		// Add subscriber
-		eventChan := h.cryptoService.AddSubscriber(subscriberID)
-		defer h.cryptoService.RemoveSubscriber(subscriberID)
-
-		// Handle client messages in separate goroutine
-		go func() {
-			defer func() {
-				log.Printf("WebSocket read goroutine ended for %s", subscriberID)
-			}()
-
-			for {
-				var msg models.WebSocketMessage
-				err := conn.ReadJSON(&msg)
-				if err != nil {
-					log.Printf("WebSocket read error for %s: %v", subscriberID, err)
-					break
-				}
-
-				log.Printf("Received message from %s: %+v", subscriberID, msg)
-
-				switch msg.Action {
-				case "ping":
-					err := conn.WriteJSON(models.WebSocketMessage{
-						Action: "pong",
-						Data:   "Server is alive",
-						ID:     msg.ID,
-					})
-					if err != nil {
-						log.Printf("Error sending pong: %v", err)
-					}
-				case "subscribe":
-					err := conn.WriteJSON(models.WebSocketMessage{
-						Action: "subscribed",
-						Data:   fmt.Sprintf("Subscribed to updates for %s", subscriberID),
-						ID:     msg.ID,
-					})
-					if err != nil {
-						log.Printf("Error sending subscribe confirmation: %v", err)
-					}
-				}
-			}
-		}()
-
-		// Send events to client
-		for event := range eventChan {
-			err := conn.WriteJSON(event)
-			if err != nil {
-				log.Printf("WebSocket write error: %v", err)
-				break
-			}
-		}
-	}
-}
@@ -0,0 +1,679 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"my-go-backend/internal/services"
+	"my-go-backend/pkg/models"
+)
+
+func TestNormalizeCoinsLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := NewCryptoHandler(nil, nil, 2, nil, WebSocketOptions{})
+
+	tests := []struct {
+		name      string
+		requested []string
+		want      []string
+		status    int
+	}{
+		{"within the limit", []string{"bitcoin", "ethereum"}, []string{"bitcoin", "ethereum"}, http.StatusOK},
+		{"duplicates don't count twice", []string{"bitcoin", "Bitcoin", "ethereum"}, []string{"bitcoin", "ethereum"}, http.StatusOK},
+		{"over the limit", []string{"bitcoin", "ethereum", "solana"}, nil, http.StatusBadRequest},
+		{"invalid id", []string{"bitcoin", ""}, nil, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+
+			coins, ok := h.normalizeCoins(c, tt.requested)
+			if ok != (tt.status == http.StatusOK) {
+				t.Fatalf("ok = %v, want status %d", ok, tt.status)
+			}
+			if !ok && w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if !slices.Equal(coins, tt.want) {
+				t.Errorf("coins = %q, want %q", coins, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetSingleCryptoRejectsInvalidIDs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	upstream := newFakeCoinGecko(map[string]float64{"bitcoin": 50000})
+	h := NewCryptoHandler(newTestCryptoService(t, upstream), nil, 10, nil, WebSocketOptions{})
+
+	router := gin.New()
+	router.GET("/crypto/:coinId", h.GetSingleCrypto)
+
+	for _, path := range []string{
+		"/crypto/bit%20coin",
+		"/crypto/bitcoin%3Fvs_currency%3Deur",
+		"/crypto/bitcoin%26ids%3Dethereum",
+		"/crypto/..%5C..%5Cadmin",
+		"/crypto/bit.coin",
+		"/crypto/" + strings.Repeat("a", services.MaxCoinIDLength+1),
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("GET %s: status = %d, want 400", path, w.Code)
+		}
+	}
+	if calls := upstream.callCount(); calls != 0 {
+		t.Errorf("upstream called %d times for invalid ids", calls)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/crypto/BitCoin", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("GET /crypto/BitCoin: status = %d, want 200", w.Code)
+	}
+}
+
+func TestWebSocketCheckOrigin(t *testing.T) {
+	h := NewCryptoHandler(nil, []string{"https://app.example.com"}, 10, nil, WebSocketOptions{})
+
+	tests := []struct {
+		name   string
+		host   string
+		origin string
+		want   bool
+	}{
+		{"no Origin from a non-browser client", "api.example.com", "", true},
+		{"same host", "api.example.com", "https://api.example.com", true},
+		{"same host ignores case", "api.example.com", "https://API.example.com", true},
+		{"allowed origin", "api.example.com", "https://app.example.com", true},
+		{"disallowed origin", "api.example.com", "https://evil.example.com", false},
+		{"host with a different port", "api.example.com:8080", "https://api.example.com", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/crypto/stream/ws", nil)
+			req.Host = tt.host
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+
+			if got := h.upgrader.CheckOrigin(req); got != tt.want {
+				t.Errorf("CheckOrigin = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEtagMatches(t *testing.T) {
+	const etag = `W/"abc123"`
+
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		want        bool
+	}{
+		{"no header", "", false},
+		{"exact weak match", `W/"abc123"`, true},
+		{"strong form of the same tag", `"abc123"`, true},
+		{"different tag", `W/"def456"`, false},
+		{"wildcard", "*", true},
+		{"listed among others", `"other", W/"abc123"`, true},
+		{"list without a match", `"one", W/"two"`, false},
+		{"extra whitespace", `  W/"abc123"  `, true},
+		{"unquoted tag doesn't match", `abc123`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := etagMatches(tt.ifNoneMatch, etag); got != tt.want {
+				t.Errorf("etagMatches(%q) = %v, want %v", tt.ifNoneMatch, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCryptoETag(t *testing.T) {
+	base := models.CryptoData{ID: "bitcoin", Price: 50000, FetchedAt: time.Unix(1700000000, 0)}
+	etag := cryptoETag(&base, nil)
+
+	if !strings.HasPrefix(etag, `W/"`) || !strings.HasSuffix(etag, `"`) {
+		t.Fatalf("ETag %q is not a quoted weak tag", etag)
+	}
+	if again := base; cryptoETag(&again, nil) != etag {
+		t.Error("ETag differs for the same data")
+	}
+
+	changes := map[string]func(c *models.CryptoData) []string{
+		"price":      func(c *models.CryptoData) []string { c.Price = 50001; return nil },
+		"fetched_at": func(c *models.CryptoData) []string { c.FetchedAt = c.FetchedAt.Add(time.Second); return nil },
+		"stale":      func(c *models.CryptoData) []string { c.Stale = true; return nil },
+		"sparkline":  func(c *models.CryptoData) []string { c.Sparkline7d = []float64{1, 2}; return nil },
+		"fields":     func(c *models.CryptoData) []string { return []string{"price"} },
+	}
+	for name, change := range changes {
+		changed := base
+		fields := change(&changed)
+		if cryptoETag(&changed, fields) == etag {
+			t.Errorf("ETag unchanged after changing %s", name)
+		}
+	}
+}
+
+func TestGetSingleCryptoNotModified(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	upstream := newFakeCoinGecko(map[string]float64{"bitcoin": 50000})
+	svc := newTestCryptoService(t, upstream)
+	h := NewCryptoHandler(svc, nil, 10, nil, WebSocketOptions{})
+
+	router := gin.New()
+	router.GET("/crypto/:coinId", h.GetSingleCrypto)
+
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/crypto/bitcoin", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	first := get("")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("first request: status %d, ETag %q", first.Code, etag)
+	}
+
+	notModified := get(etag)
+	if notModified.Code != http.StatusNotModified {
+		t.Fatalf("matching If-None-Match: status = %d, want 304", notModified.Code)
+	}
+	if notModified.Body.Len() != 0 {
+		t.Errorf("304 has a body: %q", notModified.Body.String())
+	}
+	if notModified.Header().Get("ETag") != etag {
+		t.Errorf("304 ETag = %q, want %q", notModified.Header().Get("ETag"), etag)
+	}
+
+	if w := get(`W/"stale-tag"`); w.Code != http.StatusOK {
+		t.Errorf("other If-None-Match: status = %d, want 200", w.Code)
+	}
+	if w := get("*"); w.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match *: status = %d, want 304", w.Code)
+	}
+
+	// A refetched price gets a new ETag, so the old one no longer matches
+	upstream.setPrice("bitcoin", 51000)
+	if _, err := svc.RefreshCoin(context.Background(), "bitcoin"); err != nil {
+		t.Fatalf("RefreshCoin: %v", err)
+	}
+	refreshed := get(etag)
+	if refreshed.Code != http.StatusOK {
+		t.Fatalf("after refresh: status = %d, want 200", refreshed.Code)
+	}
+	if refreshed.Header().Get("ETag") == etag {
+		t.Error("ETag unchanged after the price was refetched")
+	}
+}
+
+func TestCryptoErrorCodes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	upstream := newFakeCoinGecko(map[string]float64{"bitcoin": 50000})
+	h := NewCryptoHandler(newTestCryptoService(t, upstream), nil, 2, nil, WebSocketOptions{})
+
+	router := gin.New()
+	router.GET("/crypto/:coinId", h.GetSingleCrypto)
+	router.POST("/crypto/bulk", h.GetBulkCrypto)
+	router.GET("/crypto/compare", h.CompareCoins)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		code   string
+	}{
+		{"unknown coin", http.MethodGet, "/crypto/notacoin", "", http.StatusNotFound, models.CodeCoinNotFound},
+		{"invalid coin id", http.MethodGet, "/crypto/bit.coin", "", http.StatusBadRequest, models.CodeValidation},
+		{"unknown field", http.MethodGet, "/crypto/bitcoin?fields=secret", "", http.StatusBadRequest, models.CodeValidation},
+		{"malformed body", http.MethodPost, "/crypto/bulk", `{"coins":`, http.StatusBadRequest, models.CodeValidation},
+		{"missing coins", http.MethodPost, "/crypto/bulk", `{}`, http.StatusBadRequest, models.CodeValidation},
+		{"invalid coin in list", http.MethodPost, "/crypto/bulk", `{"coins":["bitcoin","../etc"]}`, http.StatusBadRequest, models.CodeValidation},
+		{"too many coins", http.MethodPost, "/crypto/bulk", `{"coins":["a","b","c"]}`, http.StatusBadRequest, models.CodeValidation},
+		{"unknown sort", http.MethodPost, "/crypto/bulk", `{"coins":["bitcoin"],"sort":"random"}`, http.StatusBadRequest, models.CodeValidation},
+		{"compare without b", http.MethodGet, "/crypto/compare?a=bitcoin", "", http.StatusBadRequest, models.CodeValidation},
+		{"compare invalid coin", http.MethodGet, "/crypto/compare?a=bitcoin&b=../etc", "", http.StatusBadRequest, models.CodeValidation},
+		{"compare unsupported currency", http.MethodGet, "/crypto/compare?a=bitcoin&b=bitcoin&currency=xyz", "", http.StatusBadRequest, models.CodeValidation},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			var response models.APIResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("invalid body %q: %v", w.Body.String(), err)
+			}
+			if response.Success || response.Code != tt.code {
+				t.Errorf("success %v, code %q; want a failure with %q", response.Success, response.Code, tt.code)
+			}
+		})
+	}
+}
+
+func TestGetPopularCoinsConfigured(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	upstream := newFakeCoinGecko(map[string]float64{"solana": 150, "dogecoin": 0.1, "bitcoin": 50000})
+	popular := []string{"solana", "dogecoin", "bitcoin"}
+	h := NewCryptoHandler(newTestCryptoService(t, upstream), nil, 10, popular, WebSocketOptions{})
+
+	router := gin.New()
+	router.GET("/crypto/popular", h.GetPopularCoins)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", popular},
+		{"?limit=2", []string{"solana", "dogecoin"}},
+		{"?limit=50", popular}, // Clamped to the list
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/crypto/popular"+tt.query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%q: status = %d, want 200: %s", tt.query, w.Code, w.Body.String())
+		}
+
+		var response struct {
+			Data models.PortfolioResponse `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("%q: invalid body: %v", tt.query, err)
+		}
+		var got []string
+		for _, coin := range response.Data.Portfolio {
+			got = append(got, coin.ID)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%q: coins = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestStreamCoinLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := NewCryptoHandler(nil, nil, 2, nil, WebSocketOptions{})
+
+	tests := []struct {
+		name  string
+		coins string
+		want  []string // nil when refused with 400
+	}{
+		{"within the limit", "bitcoin,ethereum", []string{"bitcoin", "ethereum"}},
+		{"duplicates and blanks don't count", "bitcoin,Bitcoin,,ethereum", []string{"bitcoin", "ethereum"}},
+		{"over the limit", "bitcoin,ethereum,solana", nil},
+		{"only blanks", ",,", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/crypto/stream/ndjson?coins="+tt.coins, nil)
+
+			config, ok := h.parseStreamConfig(c)
+			if ok != (tt.want != nil) {
+				t.Fatalf("ok = %v, want %v: %s", ok, tt.want != nil, w.Body.String())
+			}
+			if !ok {
+				if w.Code != http.StatusBadRequest {
+					t.Errorf("status = %d, want 400", w.Code)
+				}
+				return
+			}
+			if !slices.Equal(config.Coins, tt.want) {
+				t.Errorf("coins = %q, want %q", config.Coins, tt.want)
+			}
+		})
+	}
+
+	// Both streaming endpoints refuse before starting the stream
+	router := gin.New()
+	router.GET("/crypto/stream/prices", h.StreamPrices)
+	router.GET("/crypto/stream/ndjson", h.StreamPricesNDJSON)
+	for _, path := range []string{"/crypto/stream/prices", "/crypto/stream/ndjson"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path+"?coins=bitcoin,ethereum,solana", nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s over the limit: status = %d, want 400", path, w.Code)
+		}
+	}
+}
+
+func TestGetBulkCryptoStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	upstream := newFakeCoinGecko(map[string]float64{"bitcoin": 50000, "ethereum": 3000})
+	h := NewCryptoHandler(newTestCryptoService(t, upstream), nil, 10, nil, WebSocketOptions{})
+
+	router := gin.New()
+	router.POST("/crypto/bulk", h.GetBulkCrypto)
+
+	tests := []struct {
+		name        string
+		body        string
+		status      int
+		wantSuccess bool
+		wantErrors  int
+	}{
+		{"all coins loaded", `{"coins":["bitcoin","ethereum"]}`, http.StatusOK, true, 0},
+		{"some coins failed", `{"coins":["bitcoin","no-such-coin"]}`, http.StatusMultiStatus, true, 1},
+		{"every coin failed", `{"coins":["no-such-coin","other-missing-coin"]}`, http.StatusBadGateway, false, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/crypto/bulk", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			var response struct {
+				Success bool                     `json:"success"`
+				Data    models.PortfolioResponse `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("invalid body: %v", err)
+			}
+			if response.Success != tt.wantSuccess {
+				t.Errorf("success = %v, want %v", response.Success, tt.wantSuccess)
+			}
+			// The portfolio is in the body whatever the status
+			if response.Data.ErrorCount != tt.wantErrors || len(response.Data.Portfolio) != 2 {
+				t.Errorf("error_count %d over %d coins, want %d over 2", response.Data.ErrorCount, len(response.Data.Portfolio), tt.wantErrors)
+			}
+		})
+	}
+}
+
+func TestMaxBulkCoinsConfigured(t *testing.T) {
+	t.Setenv("MAX_BULK_COINS", "2")
+	app := newTestRoutes(t)
+	if app.config.MaxBulkCoins != 2 {
+		t.Fatalf("MaxBulkCoins = %d, want 2 from the environment", app.config.MaxBulkCoins)
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{http.MethodPost, "/api/v1/crypto/bulk", `{"coins":%s}`},
+		{http.MethodPost, "/api/v1/crypto/portfolio", `{"coins":%s}`},
+		{http.MethodPost, "/api/v1/crypto/portfolio/export", `{"coins":%s}`},
+		{http.MethodGet, "/api/v1/crypto?ids=%s", ""},
+	}
+	within, over := []string{"bitcoin", "ethereum"}, []string{"bitcoin", "ethereum", "solana"}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+strings.SplitN(tt.path, "?", 2)[0], func(t *testing.T) {
+			request := func(coins []string) *httptest.ResponseRecorder {
+				path, body := tt.path, tt.body
+				if body == "" {
+					path = fmt.Sprintf(path, strings.Join(coins, ","))
+				} else {
+					encoded, _ := json.Marshal(coins)
+					body = fmt.Sprintf(body, encoded)
+				}
+				return app.serveAs(t, 1, models.RoleUser, tt.method, path, body)
+			}
+
+			if w := request(within); w.Code != http.StatusOK {
+				t.Errorf("2 coins: status = %d, want 200: %s", w.Code, w.Body.String())
+			}
+			w := request(over)
+			if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "Maximum 2 coins allowed") {
+				t.Errorf("3 coins: status %d: %s; want 400 naming the limit", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestCryptoErrorStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"coin not found", fmt.Errorf("%w: dogecoin", services.ErrCoinNotFound), http.StatusNotFound, models.CodeCoinNotFound},
+		{"rate limited", services.ErrRateLimited, http.StatusTooManyRequests, models.CodeRateLimited},
+		{"upstream down", fmt.Errorf("%w: API returned status 503", services.ErrUpstreamUnavailable), http.StatusBadGateway, models.CodeUpstreamUnavailable},
+		{"malformed response", fmt.Errorf("%w: non-positive price", services.ErrMalformedResponse), http.StatusBadGateway, models.CodeUpstream},
+		{"anything else", errors.New("out of memory"), http.StatusInternalServerError, ""},
+	}
+
+	for _, tt := range tests {
+		if got := cryptoErrorStatus(tt.err); got != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, got, tt.status)
+		}
+		var coded *services.CodedError
+		if errors.As(tt.err, &coded) != (tt.code != "") || (coded != nil && coded.Code != tt.code) {
+			t.Errorf("%s: coded error = %v, want code %q", tt.name, coded, tt.code)
+		}
+	}
+}
+
+func TestGetSingleCryptoUpstreamStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	upstream := newFakeCoinGecko(map[string]float64{"bitcoin": 50000})
+	h := NewCryptoHandler(newTestCryptoService(t, upstream), nil, 10, nil, WebSocketOptions{})
+
+	router := gin.New()
+	router.GET("/crypto/:coinId", h.GetSingleCrypto)
+
+	tests := []struct {
+		name     string
+		coin     string
+		upstream int // Status CoinGecko answers with; 0 for a normal response
+		status   int
+		code     string
+	}{
+		{"nonexistent coin", "notacoin", 0, http.StatusNotFound, models.CodeCoinNotFound},
+		{"upstream error", "bitcoin", http.StatusInternalServerError, http.StatusBadGateway, models.CodeUpstreamUnavailable},
+		{"upstream unavailable", "bitcoin", http.StatusServiceUnavailable, http.StatusBadGateway, models.CodeUpstreamUnavailable},
+		{"upstream rate limit", "bitcoin", http.StatusTooManyRequests, http.StatusTooManyRequests, models.CodeRateLimited},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream.setStatus(tt.upstream)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/crypto/"+tt.coin, nil))
+
+			if w.Code != tt.status || errorCodeOf(t, w) != tt.code {
+				t.Errorf("status %d: %s; want %d %s", w.Code, w.Body.String(), tt.status, tt.code)
+			}
+		})
+	}
+}
+
+func TestGetCoinsQuery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	upstream := newFakeCoinGecko(map[string]float64{"bitcoin": 50000, "ethereum": 3000})
+	h := NewCryptoHandler(newTestCryptoService(t, upstream), nil, 10, nil, WebSocketOptions{})
+
+	router := gin.New()
+	router.GET("/crypto", h.GetCoins)
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/crypto"+query, nil))
+		return w
+	}
+
+	w := get("?ids=ethereum,Bitcoin,no-such-coin&sort=price_desc")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	var response struct {
+		Data models.PortfolioResponse `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+	var ids []string
+	for _, coin := range response.Data.Portfolio {
+		ids = append(ids, coin.ID)
+	}
+	if got := strings.Join(ids, ","); got != "bitcoin,ethereum,no-such-coin" {
+		t.Errorf("coins = %s, want bitcoin, ethereum, then the missing coin", got)
+	}
+	if response.Data.SuccessCount != 2 || response.Data.ErrorCount != 1 {
+		t.Errorf("success %d, errors %d; want 2 and 1", response.Data.SuccessCount, response.Data.ErrorCount)
+	}
+	if calls := upstream.callCount(); calls != 1 {
+		t.Errorf("%d upstream calls, want the coins fetched in one", calls)
+	}
+
+	for _, query := range []string{"", "?ids=", "?ids=bit.coin", "?ids=bitcoin&sort=random", "?ids=bitcoin&currency=xyz"} {
+		if w := get(query); w.Code != http.StatusBadRequest {
+			t.Errorf("%q: status = %d, want 400", query, w.Code)
+		}
+	}
+}
+
+func TestGetSingleCryptoEnvelope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	upstream := newFakeCoinGecko(map[string]float64{"bitcoin": 50000})
+	h := NewCryptoHandler(newTestCryptoService(t, upstream), nil, 10, nil, WebSocketOptions{})
+
+	router := gin.New()
+	router.GET("/crypto/:coinId", h.GetSingleCrypto)
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	enveloped := get("/crypto/bitcoin")
+	var envelope struct {
+		Success bool              `json:"success"`
+		Message string            `json:"message"`
+		Data    models.CryptoData `json:"data"`
+	}
+	if err := json.Unmarshal(enveloped.Body.Bytes(), &envelope); err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+	if enveloped.Code != http.StatusOK || !envelope.Success || envelope.Message == "" || envelope.Data.Price != 50000 {
+		t.Errorf("default: status %d, body %s; want the coin in the envelope", enveloped.Code, enveloped.Body.String())
+	}
+
+	raw := get("/crypto/bitcoin?envelope=false")
+	var coin map[string]any
+	if err := json.Unmarshal(raw.Body.Bytes(), &coin); err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+	if raw.Code != http.StatusOK || coin["id"] != "bitcoin" || coin["price"] != 50000.0 {
+		t.Errorf("envelope=false: status %d, body %s; want the bare coin", raw.Code, raw.Body.String())
+	}
+	if _, wrapped := coin["success"]; wrapped {
+		t.Errorf("envelope=false: body %s still wrapped", raw.Body.String())
+	}
+
+	// Errors keep the envelope
+	missing := get("/crypto/notacoin?envelope=false")
+	if missing.Code != http.StatusNotFound || !strings.Contains(missing.Body.String(), `"success":false`) {
+		t.Errorf("unknown coin: status %d, body %s; want an enveloped 404", missing.Code, missing.Body.String())
+	}
+}
+
+func TestDefaultCurrencyUsed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	upstream := newFakeCoinGecko(map[string]float64{"bitcoin": 50000, "ethereum": 2500})
+	h := NewCryptoHandler(newTestCryptoService(t, upstream, services.WithDefaultCurrency("eur")), nil, 10, nil, WebSocketOptions{})
+
+	router := gin.New()
+	router.GET("/crypto/compare", h.CompareCoins)
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"?a=bitcoin&b=ethereum", "eur"},
+		{"?a=bitcoin&b=ethereum&currency=USD", "usd"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/crypto/compare"+tt.query, nil))
+		var response struct {
+			Data models.CoinComparison `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("%s: invalid body: %v", tt.query, err)
+		}
+		if w.Code != http.StatusOK || response.Data.Currency != tt.want {
+			t.Errorf("%s: status %d, currency %q; want %s", tt.query, w.Code, response.Data.Currency, tt.want)
+		}
+	}
+}
+
+func TestGetSingleCryptoSparkline(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	upstream := newFakeCoinGecko(map[string]float64{"bitcoin": 50000})
+	h := NewCryptoHandler(newTestCryptoService(t, upstream), nil, 10, nil, WebSocketOptions{})
+
+	router := gin.New()
+	router.GET("/crypto/:coinId", h.GetSingleCrypto)
+	get := func(query string) (int, map[string]any) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/crypto/bitcoin"+query, nil))
+		var response struct {
+			Data map[string]any `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("%s: invalid body: %v", query, err)
+		}
+		return w.Code, response.Data
+	}
+
+	for _, query := range []string{"", "?sparkline=false"} {
+		if code, coin := get(query); code != http.StatusOK || coin["sparkline_7d"] != nil {
+			t.Errorf("%q: status %d, sparkline %v; want 200 without a sparkline", query, code, coin["sparkline_7d"])
+		}
+	}
+
+	code, coin := get("?sparkline=true")
+	sparkline, _ := coin["sparkline_7d"].([]any)
+	if code != http.StatusOK || len(sparkline) != 2 || sparkline[0] != 45000.0 || sparkline[1] != 50000.0 {
+		t.Errorf("sparkline=true: status %d, sparkline %v; want [45000 50000]", code, coin["sparkline_7d"])
+	}
+
+	if code, _ := get("?sparkline=maybe"); code != http.StatusBadRequest {
+		t.Errorf("sparkline=maybe: status = %d, want 400", code)
+	}
+}
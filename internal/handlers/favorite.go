@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"my-go-backend/internal/respond"
+	"my-go-backend/internal/services"
+	"my-go-backend/pkg/models"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type FavoriteHandler struct {
+	favoriteService *services.FavoriteService
+	cryptoService   *services.CryptoService
+}
+
+func NewFavoriteHandler(favoriteService *services.FavoriteService, cryptoService *services.CryptoService) *FavoriteHandler {
+	return &FavoriteHandler{favoriteService: favoriteService, cryptoService: cryptoService}
+}
+
+// AddFavorite - Add a coin to the authenticated user's favorites
+func (h *FavoriteHandler) AddFavorite(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		respond.Error(c, http.StatusUnauthorized, "Invalid user in token", nil)
+		return
+	}
+
+	var req models.AddFavoriteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respond.Error(c, http.StatusBadRequest, "Invalid request data", bindingError(err))
+		return
+	}
+
+	favorite, err := h.favoriteService.AddFavorite(userID, req.CoinID)
+	switch {
+	case errors.Is(err, services.ErrEmptyCoinID), errors.Is(err, services.ErrInvalidCoinID):
+		respond.Error(c, http.StatusBadRequest, "Invalid coin ID", err)
+		return
+	case errors.Is(err, services.ErrFavoriteExists), errors.Is(err, services.ErrTooManyFavorites):
+		respond.Error(c, http.StatusConflict, "Failed to add favorite", err)
+		return
+	case err != nil:
+		respond.Error(c, http.StatusInternalServerError, "Failed to add favorite", err)
+		return
+	}
+
+	respond.Created(c, "Favorite added successfully", favorite)
+}
+
+// GetFavorites - List the authenticated user's favorites. With prices=true
+// each favorite includes its market data, fetched in one batch.
+func (h *FavoriteHandler) GetFavorites(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		respond.Error(c, http.StatusUnauthorized, "Invalid user in token", nil)
+		return
+	}
+
+	withPrices, err := strconv.ParseBool(c.DefaultQuery("prices", "false"))
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "Invalid prices parameter", errors.New("prices must be true or false"))
+		return
+	}
+	currency := strings.ToLower(c.DefaultQuery("currency", h.cryptoService.DefaultCurrency()))
+	if !services.IsSupportedCurrency(currency) {
+		respond.Error(c, http.StatusBadRequest, "Unsupported currency", nil)
+		return
+	}
+
+	favorites, err := h.favoriteService.GetFavorites(userID)
+	if err != nil {
+		respond.Error(c, http.StatusInternalServerError, "Failed to retrieve favorites", err)
+		return
+	}
+
+	response := make([]models.FavoriteResponse, 0, len(favorites))
+	for _, favorite := range favorites {
+		response = append(response, models.FavoriteResponse{Favorite: favorite})
+	}
+
+	if withPrices && len(favorites) > 0 {
+		coins := make([]string, 0, len(favorites))
+		for _, favorite := range favorites {
+			coins = append(coins, favorite.CoinID)
+		}
+		markets, err := h.cryptoService.GetMarkets(c.Request.Context(), coins, currency, services.PortfolioOptions{})
+		if err != nil {
+			respond.Error(c, cryptoErrorStatus(err), "Failed to fetch crypto data", err)
+			return
+		}
+
+		byCoin := make(map[string]*models.CryptoData, len(markets.Portfolio))
+		for i := range markets.Portfolio {
+			byCoin[markets.Portfolio[i].ID] = &markets.Portfolio[i]
+		}
+		for i := range response {
+			response[i].Market = byCoin[response[i].CoinID]
+		}
+	}
+
+	respond.OK(c, "Favorites retrieved successfully", response)
+}
+
+// RemoveFavorite - Remove a coin from the authenticated user's favorites
+func (h *FavoriteHandler) RemoveFavorite(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		respond.Error(c, http.StatusUnauthorized, "Invalid user in token", nil)
+		return
+	}
+
+	err := h.favoriteService.RemoveFavorite(userID, c.Param("coinId"))
+	switch {
+	case errors.Is(err, services.ErrEmptyCoinID), errors.Is(err, services.ErrInvalidCoinID):
+		respond.Error(c, http.StatusBadRequest, "Invalid coin ID", err)
+		return
+	case errors.Is(err, services.ErrFavoriteNotFound):
+		respond.Error(c, http.StatusNotFound, "Favorite not found", err)
+		return
+	case err != nil:
+		respond.Error(c, http.StatusInternalServerError, "Failed to remove favorite", err)
+		return
+	}
+
+	respond.OK(c, "Favorite removed successfully", nil)
+}
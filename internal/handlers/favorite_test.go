@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"my-go-backend/pkg/models"
+)
+
+func TestFavoriteRoutes(t *testing.T) {
+	app := newTestRoutes(t)
+	user := app.register(t, "watcher", "watcher@example.com", "password1").ID
+	other := app.register(t, "other", "other@example.com", "password2").ID
+	const path = "/api/v1/users/me/favorites"
+
+	add := func(userID uint, coin string) *httptest.ResponseRecorder {
+		return app.serveAs(t, userID, models.RoleUser, http.MethodPost, path, `{"coin_id":"`+coin+`"}`)
+	}
+	list := func(userID uint, query string) []models.FavoriteResponse {
+		t.Helper()
+		w := app.serveAs(t, userID, models.RoleUser, http.MethodGet, path+query, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("list%s: status %d: %s", query, w.Code, w.Body.String())
+		}
+		var response struct {
+			Data []models.FavoriteResponse `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("invalid body: %v", err)
+		}
+		return response.Data
+	}
+
+	for _, coin := range []string{"bitcoin", " Ethereum "} {
+		if w := add(user, coin); w.Code != http.StatusCreated {
+			t.Fatalf("adding %q: status %d: %s", coin, w.Code, w.Body.String())
+		}
+	}
+	if w := add(user, "bitcoin"); w.Code != http.StatusConflict || errorCodeOf(t, w) != models.CodeFavoriteExists {
+		t.Errorf("duplicate: status %d: %s; want 409 FAVORITE_EXISTS", w.Code, w.Body.String())
+	}
+	if w := add(user, "bit.coin"); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid coin: status = %d, want 400", w.Code)
+	}
+	// Favorites are per user
+	if w := add(other, "bitcoin"); w.Code != http.StatusCreated {
+		t.Errorf("another user adding the same coin: status %d: %s", w.Code, w.Body.String())
+	}
+
+	favorites := list(user, "")
+	if len(favorites) != 2 || favorites[0].CoinID != "bitcoin" || favorites[1].CoinID != "ethereum" {
+		t.Fatalf("favorites = %+v, want bitcoin then ethereum", favorites)
+	}
+	if favorites[0].Market != nil {
+		t.Errorf("market data without prices=true: %+v", favorites[0].Market)
+	}
+
+	calls := app.upstream.callCount()
+	priced := list(user, "?prices=true")
+	want := map[string]float64{"bitcoin": 50000, "ethereum": 3000}
+	for _, favorite := range priced {
+		if favorite.Market == nil || favorite.Market.Price != want[favorite.CoinID] {
+			t.Errorf("%s: market = %+v, want a price of %v", favorite.CoinID, favorite.Market, want[favorite.CoinID])
+		}
+	}
+	if got := app.upstream.callCount() - calls; got != 1 {
+		t.Errorf("prices took %d upstream calls, want one batch", got)
+	}
+	if w := app.serveAs(t, user, models.RoleUser, http.MethodGet, path+"?prices=maybe", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid prices parameter: status = %d, want 400", w.Code)
+	}
+
+	if w := app.serveAs(t, user, models.RoleUser, http.MethodDelete, path+"/bitcoin", ""); w.Code != http.StatusOK {
+		t.Fatalf("delete: status %d: %s", w.Code, w.Body.String())
+	}
+	if w := app.serveAs(t, user, models.RoleUser, http.MethodDelete, path+"/bitcoin", ""); w.Code != http.StatusNotFound || errorCodeOf(t, w) != models.CodeFavoriteNotFound {
+		t.Errorf("deleting again: status %d: %s; want 404 FAVORITE_NOT_FOUND", w.Code, w.Body.String())
+	}
+	if favorites := list(user, ""); len(favorites) != 1 || favorites[0].CoinID != "ethereum" {
+		t.Errorf("favorites after delete = %+v, want only ethereum", favorites)
+	}
+	if favorites := list(other, ""); len(favorites) != 1 || favorites[0].CoinID != "bitcoin" {
+		t.Errorf("other user's favorites = %+v, want their bitcoin kept", favorites)
+	}
+
+	if w := app.serveAs(t, 0, "", http.MethodGet, path, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("without a token: status = %d, want 401", w.Code)
+	}
+}
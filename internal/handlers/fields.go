@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"my-go-backend/internal/respond"
+	"my-go-backend/pkg/models"
+)
+
+// cryptoFields are the models.CryptoData JSON fields ?fields= may select
+var cryptoFields = jsonFieldNames(reflect.TypeOf(models.CryptoData{}))
+
+// jsonFieldNames lists the JSON names of a struct's exported fields
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := make(map[string]bool, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// cryptoFieldsParam parses ?fields=price,change_percent_24h. It returns nil
+// when the parameter is absent (send every field) and responds with 400 when
+// it names an unknown field.
+func cryptoFieldsParam(c *gin.Context) ([]string, bool) {
+	param := c.Query("fields")
+	if param == "" {
+		return nil, true
+	}
+
+	var fields, unknown []string
+	for _, field := range strings.Split(param, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if !cryptoFields[field] {
+			unknown = append(unknown, field)
+			continue
+		}
+		fields = append(fields, field)
+	}
+	if len(unknown) > 0 {
+		known := make([]string, 0, len(cryptoFields))
+		for field := range cryptoFields {
+			known = append(known, field)
+		}
+		sort.Strings(known)
+		respond.Error(c, http.StatusBadRequest, "Invalid fields parameter",
+			fmt.Errorf("unknown fields %s; valid fields are %s", strings.Join(unknown, ", "), strings.Join(known, ", ")))
+		return nil, false
+	}
+	return fields, true
+}
+
+// projectCrypto keeps only the requested fields of a coin. The id is always
+// kept, and so are the error of a coin that failed to load and the stale flag.
+func projectCrypto(crypto models.CryptoData, fields []string) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(crypto)
+	if err != nil {
+		return nil, err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+
+	projected := map[string]json.RawMessage{"id": all["id"]}
+	if crypto.Error != "" {
+		projected["error"] = all["error"]
+	}
+	if crypto.Stale {
+		projected["stale"] = all["stale"]
+	}
+	for _, field := range fields {
+		if value, ok := all[field]; ok {
+			projected[field] = value
+		}
+	}
+	return projected, nil
+}
+
+// projectedPortfolio is a PortfolioResponse whose coins carry only the
+// requested fields; the outer Portfolio field shadows the embedded one
+type projectedPortfolio struct {
+	*models.PortfolioResponse
+	Portfolio []map[string]json.RawMessage `json:"portfolio"`
+}
+
+// projectPortfolio applies projectCrypto to each coin. With no fields the
+// portfolio is returned unchanged.
+func projectPortfolio(portfolio *models.PortfolioResponse, fields []string) (interface{}, error) {
+	if fields == nil {
+		return portfolio, nil
+	}
+	projected := projectedPortfolio{
+		PortfolioResponse: portfolio,
+		Portfolio:         make([]map[string]json.RawMessage, 0, len(portfolio.Portfolio)),
+	}
+	for _, crypto := range portfolio.Portfolio {
+		coin, err := projectCrypto(crypto, fields)
+		if err != nil {
+			return nil, err
+		}
+		projected.Portfolio = append(projected.Portfolio, coin)
+	}
+	return projected, nil
+}
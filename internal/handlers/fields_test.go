@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"my-go-backend/pkg/models"
+)
+
+// sortedKeys returns the keys of m in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestCryptoFieldsParam(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name   string
+		query  string
+		want   []string
+		status int
+	}{
+		{"absent selects everything", "", nil, http.StatusOK},
+		{"known fields", "?fields=price,change_percent_24h", []string{"price", "change_percent_24h"}, http.StatusOK},
+		{"blanks and spaces are skipped", "?fields=price,%20,%20rank%20,", []string{"price", "rank"}, http.StatusOK},
+		{"unknown field", "?fields=price,password", nil, http.StatusBadRequest},
+		{"field names are case-sensitive", "?fields=Price", nil, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/"+tt.query, nil)
+
+			fields, ok := cryptoFieldsParam(c)
+			if ok != (tt.status == http.StatusOK) {
+				t.Fatalf("ok = %v, want status %d", ok, tt.status)
+			}
+			if !ok {
+				if w.Code != tt.status {
+					t.Errorf("status = %d, want %d", w.Code, tt.status)
+				}
+				if !strings.Contains(w.Body.String(), "unknown fields") {
+					t.Errorf("body doesn't name the unknown fields: %s", w.Body.String())
+				}
+			}
+			if !slices.Equal(fields, tt.want) {
+				t.Errorf("fields = %q, want %q", fields, tt.want)
+			}
+		})
+	}
+}
+
+func TestProjectCrypto(t *testing.T) {
+	crypto := models.CryptoData{
+		ID:            "bitcoin",
+		Symbol:        "btc",
+		Name:          "Bitcoin",
+		Price:         50000,
+		ChangePercent: 2.5,
+		FetchedAt:     time.Now(),
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *models.CryptoData)
+		fields []string
+		want   []string
+	}{
+		{
+			name:   "requested fields plus id",
+			fields: []string{"price", "change_percent_24h"},
+			want:   []string{"change_percent_24h", "id", "price"},
+		},
+		{
+			name:   "no fields keeps only the id",
+			fields: []string{},
+			want:   []string{"id"},
+		},
+		{
+			name:   "error of a failed coin is kept",
+			modify: func(c *models.CryptoData) { c.Error = "coin not found" },
+			fields: []string{"price"},
+			want:   []string{"error", "id", "price"},
+		},
+		{
+			name:   "stale flag is kept",
+			modify: func(c *models.CryptoData) { c.Stale = true },
+			fields: []string{"price"},
+			want:   []string{"id", "price", "stale"},
+		},
+		{
+			name:   "omitted fields aren't invented",
+			fields: []string{"price", "sparkline_7d"},
+			want:   []string{"id", "price"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			coin := crypto
+			if tt.modify != nil {
+				tt.modify(&coin)
+			}
+
+			projected, err := projectCrypto(coin, tt.fields)
+			if err != nil {
+				t.Fatalf("projectCrypto: %v", err)
+			}
+			if got := sortedKeys(projected); !slices.Equal(got, tt.want) {
+				t.Errorf("keys = %q, want %q", got, tt.want)
+			}
+			if price, ok := projected["price"]; ok && string(price) != "50000" {
+				t.Errorf("price = %s, want 50000", price)
+			}
+		})
+	}
+}
+
+func TestProjectPortfolio(t *testing.T) {
+	portfolio := &models.PortfolioResponse{
+		Portfolio: []models.CryptoData{
+			{ID: "bitcoin", Price: 50000, Name: "Bitcoin"},
+			{ID: "ethereum", Price: 3000, Name: "Ethereum"},
+		},
+		TotalValue:   53000,
+		SuccessCount: 2,
+	}
+
+	if unchanged, err := projectPortfolio(portfolio, nil); err != nil || unchanged != portfolio {
+		t.Fatalf("without fields: got %v, %v; want the portfolio unchanged", unchanged, err)
+	}
+
+	projected, err := projectPortfolio(portfolio, []string{"price"})
+	if err != nil {
+		t.Fatalf("projectPortfolio: %v", err)
+	}
+	body, err := json.Marshal(projected)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	var decoded struct {
+		Portfolio    []map[string]interface{} `json:"portfolio"`
+		TotalValue   float64                  `json:"total_value"`
+		SuccessCount int                      `json:"success_count"`
+	}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if decoded.TotalValue != 53000 || decoded.SuccessCount != 2 {
+		t.Errorf("totals not kept: %s", body)
+	}
+	if len(decoded.Portfolio) != 2 {
+		t.Fatalf("portfolio has %d coins, want 2", len(decoded.Portfolio))
+	}
+	for _, coin := range decoded.Portfolio {
+		if got := sortedKeys(coin); !slices.Equal(got, []string{"id", "price"}) {
+			t.Errorf("coin keys = %q, want [id price]", got)
+		}
+	}
+}
+
+func TestGetSingleCryptoFields(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	upstream := newFakeCoinGecko(map[string]float64{"bitcoin": 50000})
+	h := NewCryptoHandler(newTestCryptoService(t, upstream), nil, 10, nil, WebSocketOptions{})
+
+	router := gin.New()
+	router.GET("/crypto/:coinId", h.GetSingleCrypto)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/crypto/bitcoin?fields=price", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if got := sortedKeys(response.Data); !slices.Equal(got, []string{"id", "price"}) {
+		t.Errorf("data keys = %q, want [id price]", got)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/crypto/bitcoin?fields=price,secret", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unknown field: status = %d, want 400", w.Code)
+	}
+}
@@ -2,15 +2,48 @@ package handlers
 
 import (
 	"github.com/gin-gonic/gin"
-	"my-go-backend/pkg/models"
+	"my-go-backend/internal/health"
+	"my-go-backend/internal/respond"
+	"my-go-backend/internal/version"
 	"net/http"
+	"time"
 )
 
+// HealthCheck - Liveness probe, doesn't touch dependencies. Also reports
+// which build is running and for how long.
 func HealthCheck(c *gin.Context) {
-	response := models.APIResponse{
-		Success: true,
-		Message: "Server is running",
-		Data:    gin.H{"status": "healthy"},
+	respond.OK(c, "Server is running", gin.H{
+		"status":     "healthy",
+		"version":    version.Version,
+		"commit":     version.Commit,
+		"build_date": version.BuildDate,
+		"uptime":     version.Uptime().Round(time.Second).String(),
+	})
+}
+
+type HealthHandler struct {
+	monitor *health.Monitor
+}
+
+func NewHealthHandler(monitor *health.Monitor) *HealthHandler {
+	return &HealthHandler{monitor: monitor}
+}
+
+// ReadinessCheck - Readiness probe, reports the background database check
+// without pinging on each request
+func (h *HealthHandler) ReadinessCheck(c *gin.Context) {
+	status := h.monitor.Status()
+
+	var lastPing *time.Time
+	if !status.LastSuccess.IsZero() {
+		lastPing = &status.LastSuccess
 	}
-	c.JSON(http.StatusOK, response)
+
+	if !status.Ready {
+		respond.ErrorWithData(c, http.StatusServiceUnavailable, "Server is not ready",
+			gin.H{"status": "unhealthy", "db": "down", "last_db_ping": lastPing}, status.Err)
+		return
+	}
+
+	respond.OK(c, "Server is ready", gin.H{"status": "healthy", "db": "up", "last_db_ping": lastPing})
 }
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"my-go-backend/internal/health"
+	"my-go-backend/internal/version"
+)
+
+func TestHealthCheckVersion(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	saved := []string{version.Version, version.Commit, version.BuildDate}
+	t.Cleanup(func() { version.Version, version.Commit, version.BuildDate = saved[0], saved[1], saved[2] })
+	version.Version, version.Commit, version.BuildDate = "1.4.0", "abc1234", "2026-01-02T03:04:05Z"
+
+	router := gin.New()
+	router.GET("/health", HealthCheck)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+
+	var response struct {
+		Data map[string]string `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+	want := map[string]string{"status": "healthy", "version": "1.4.0", "commit": "abc1234", "build_date": "2026-01-02T03:04:05Z"}
+	for key, value := range want {
+		if got := response.Data[key]; got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+	if _, err := time.ParseDuration(response.Data["uptime"]); err != nil {
+		t.Errorf("uptime = %q, want a duration: %v", response.Data["uptime"], err)
+	}
+}
+
+func TestReadinessCheck(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var failing atomic.Bool
+	ping := func(ctx context.Context) error {
+		if failing.Load() {
+			return errors.New("connection refused")
+		}
+		return nil
+	}
+	monitor := health.NewMonitor(ping, 5*time.Millisecond, time.Second)
+
+	router := gin.New()
+	router.GET("/ready", NewHealthHandler(monitor).ReadinessCheck)
+	ready := func() (int, map[string]any) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+		var response struct {
+			Data map[string]any `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("invalid body: %v", err)
+		}
+		return w.Code, response.Data
+	}
+	// waitFor polls until the probe answers status, as the monitor pings in
+	// the background
+	waitFor := func(status int) map[string]any {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			code, data := ready()
+			if code == status {
+				return data
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("status = %d, want %d", code, status)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	// Not ready before the first ping
+	if code, data := ready(); code != http.StatusServiceUnavailable || data["last_db_ping"] != nil {
+		t.Errorf("before any ping: status %d, data %v; want 503 without a last ping", code, data)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		monitor.Run(ctx)
+		close(done)
+	}()
+
+	if data := waitFor(http.StatusOK); data["db"] != "up" || data["last_db_ping"] == nil {
+		t.Errorf("healthy: data = %v, want db up with the last ping", data)
+	}
+
+	failing.Store(true)
+	if data := waitFor(http.StatusServiceUnavailable); data["db"] != "down" || data["last_db_ping"] == nil {
+		t.Errorf("failing ping: data = %v, want db down with the last good ping", data)
+	}
+
+	failing.Store(false)
+	waitFor(http.StatusOK)
+
+	// Shutting down reports not ready even though the database is up
+	cancel()
+	<-done
+	if code, _ := ready(); code != http.StatusServiceUnavailable {
+		t.Errorf("after shutdown: status = %d, want 503", code)
+	}
+}
@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"my-go-backend/configs"
+	"my-go-backend/internal/migrations"
+	"my-go-backend/internal/services"
+	"my-go-backend/pkg/models"
+)
+
+// fakeCoinGecko answers /coins/markets and /simple/price with the configured
+// prices and counts the calls made, so tests can tell cached responses from
+// fetches. Prices are in usd; every other currency is worth half as much.
+// With sparkline=true, each coin's sparkline is 90% of its price, then its price.
+type fakeCoinGecko struct {
+	mu     sync.Mutex
+	prices map[string]float64
+	calls  int
+	status int // When set, every call fails with this status
+}
+
+func newFakeCoinGecko(prices map[string]float64) *fakeCoinGecko {
+	return &fakeCoinGecko{prices: prices}
+}
+
+func (f *fakeCoinGecko) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.status != 0 {
+		return &http.Response{
+			StatusCode: f.status,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(`{"error":"upstream failure"}`)),
+			Request:    req,
+		}, nil
+	}
+
+	var result any
+	switch {
+	case strings.HasSuffix(req.URL.Path, "/coins/markets"):
+		var coins []models.CoinGeckoResponse
+		for _, id := range strings.Split(req.URL.Query().Get("ids"), ",") {
+			if price, ok := f.prices[id]; ok {
+				coin := models.CoinGeckoResponse{ID: id, Symbol: id[:3], Name: id, CurrentPrice: price}
+				if req.URL.Query().Get("sparkline") == "true" {
+					coin.SparklineIn7d = &models.CoinGeckoSparkline{Price: []float64{price * 0.9, price}}
+				}
+				coins = append(coins, coin)
+			}
+		}
+		result = coins
+	case strings.HasSuffix(req.URL.Path, "/simple/price"):
+		prices := make(map[string]map[string]float64)
+		for _, id := range strings.Split(req.URL.Query().Get("ids"), ",") {
+			price, ok := f.prices[id]
+			if !ok {
+				continue
+			}
+			prices[id] = make(map[string]float64)
+			for _, currency := range strings.Split(req.URL.Query().Get("vs_currencies"), ",") {
+				if currency == "usd" {
+					prices[id][currency] = price
+				} else {
+					prices[id][currency] = price / 2
+				}
+			}
+		}
+		result = prices
+	}
+	body, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+// setPrice changes a coin's price for later calls
+func (f *fakeCoinGecko) setPrice(coinID string, price float64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.prices[coinID] = price
+}
+
+// setStatus makes later calls fail with status; 0 answers normally again
+func (f *fakeCoinGecko) setStatus(status int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.status = status
+}
+
+// callCount is the number of upstream calls made so far
+func (f *fakeCoinGecko) callCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+// newTestCryptoService returns a CryptoService that talks to upstream
+// instead of CoinGecko
+func newTestCryptoService(t *testing.T, upstream *fakeCoinGecko, opts ...services.CryptoServiceOption) *services.CryptoService {
+	t.Helper()
+	opts = append([]services.CryptoServiceOption{services.WithHTTPClient(&http.Client{Transport: upstream})}, opts...)
+	svc := services.NewCryptoService("http://coingecko.test/api/v3", "", opts...)
+	t.Cleanup(svc.Shutdown)
+	return svc
+}
+
+// newDryRunDB returns a database that builds statements without running
+// them: reads find nothing and writes succeed
+func newDryRunDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=127.0.0.1 port=1"}), &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true, // Beginning one would connect
+	})
+	if err != nil {
+		t.Fatalf("opening dry-run database: %v", err)
+	}
+	return db
+}
+
+// newTestDB returns an empty in-memory SQLite database with the app's
+// migrations applied, for tests whose queries must really run
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("opening test database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("opening test database: %v", err)
+	}
+	// Every connection to ":memory:" is a separate database
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err := migrations.Migrate(db); err != nil {
+		t.Fatalf("migrating test database: %v", err)
+	}
+	return db
+}
+
+// newTestConfig loads the default configuration with rate limiting off, so
+// tests may send many requests from the same address
+func newTestConfig(t *testing.T) *configs.Config {
+	t.Helper()
+	t.Setenv("RATE_LIMIT_RPS", "0")
+	t.Setenv("AUTH_RATE_LIMIT_RPS", "0")
+	t.Setenv("LOG_LEVEL", "error")
+	return configs.LoadConfig()
+}
+
+// signTestToken returns an access token for userID with role, signed the way
+// AuthService signs them for config
+func signTestToken(t *testing.T, config *configs.Config, userID uint, role string) string {
+	t.Helper()
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"user_id": userID,
+		"role":    role,
+		"typ":     services.TokenTypeAccess,
+		"iss":     config.JWTIssuer,
+		"aud":     config.JWTAudience,
+		"iat":     now.Unix(),
+		"nbf":     now.Unix(),
+		"exp":     now.Add(time.Hour).Unix(),
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(config.JWTSecret))
+	if err != nil {
+		t.Fatalf("signing token: %v", err)
+	}
+	return signed
+}
+
+// errorCodeOf returns the code of an APIResponse error body
+func errorCodeOf(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var response models.APIResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid body %q: %v", w.Body.String(), err)
+	}
+	return response.Code
+}
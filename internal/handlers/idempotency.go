@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"my-go-backend/internal/respond"
+	"my-go-backend/internal/services"
+)
+
+// maxIdempotencyKeyLength bounds the Idempotency-Key header
+const maxIdempotencyKeyLength = 255
+
+// idempotent replays the stored response when a request repeats an
+// Idempotency-Key the same user already sent to the same route, instead of
+// running the handler again. Only 2xx responses are stored, so failed
+// requests can be retried with the same key. Requests without the header are
+// unaffected.
+func idempotent(store *services.IdempotencyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("Idempotency-Key")
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			respond.Abort(c, http.StatusBadRequest, "Invalid Idempotency-Key", fmt.Errorf("key must be at most %d characters", maxIdempotencyKeyLength))
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			respond.Abort(c, http.StatusBadRequest, "Failed to read request body", err)
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+		requestHash := hex.EncodeToString(sum[:])
+
+		// Keys are per user, or per client for service tokens
+		owner := "client:" + c.GetString("client_id")
+		if userID, ok := currentUserID(c); ok {
+			owner = strconv.FormatUint(uint64(userID), 10)
+		}
+		scopedKey := fmt.Sprintf("%s:%s:%s", owner, c.FullPath(), key)
+
+		cached, err := store.Begin(scopedKey, requestHash)
+		if errors.Is(err, services.ErrIdempotencyInProgress) {
+			respond.Abort(c, http.StatusConflict, "Request already in progress", err)
+			return
+		}
+		if errors.Is(err, services.ErrIdempotencyMismatch) {
+			respond.Abort(c, http.StatusUnprocessableEntity, "Idempotency-Key reused with a different request", err)
+			return
+		}
+		if cached != nil {
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(cached.Status, cached.ContentType, cached.Body)
+			c.Abort()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		defer func() {
+			c.Writer = recorder.ResponseWriter
+			if r := recover(); r != nil {
+				store.Abandon(scopedKey)
+				panic(r)
+			}
+			status := recorder.Status()
+			if status >= 200 && status < 300 {
+				store.Complete(scopedKey, services.CachedResponse{
+					Status:      status,
+					ContentType: recorder.Header().Get("Content-Type"),
+					Body:        recorder.body.Bytes(),
+					RequestHash: requestHash,
+				})
+			} else {
+				store.Abandon(scopedKey)
+			}
+		}()
+
+		c.Next()
+	}
+}
+
+// responseRecorder copies the response body as it is written
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"my-go-backend/internal/services"
+	"my-go-backend/pkg/models"
+)
+
+// newIdempotentBulkRouter serves POST /crypto/bulk behind idempotent, with
+// the user taken from X-Test-User in place of AuthMiddleware
+func newIdempotentBulkRouter(t *testing.T, svc *services.CryptoService) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	h := NewCryptoHandler(svc, nil, 10, nil, WebSocketOptions{})
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if c.GetHeader("X-Test-User") == "2" {
+			c.Set("user_id", float64(2))
+		} else {
+			c.Set("user_id", float64(1))
+		}
+		c.Next()
+	})
+	router.POST("/crypto/bulk", idempotent(services.NewIdempotencyStore(time.Minute)), h.GetBulkCrypto)
+	return router
+}
+
+func postBulk(router *gin.Engine, key, body, user string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/crypto/bulk", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+	if user != "" {
+		req.Header.Set("X-Test-User", user)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotentReplay(t *testing.T) {
+	upstream := newFakeCoinGecko(map[string]float64{"bitcoin": 50000, "ethereum": 3000})
+	svc := newTestCryptoService(t, upstream)
+	router := newIdempotentBulkRouter(t, svc)
+	const body = `{"coins":["bitcoin","ethereum"]}`
+
+	first := postBulk(router, "key-1", body, "")
+	if first.Code != http.StatusOK {
+		t.Fatalf("first request: status = %d, want 200: %s", first.Code, first.Body.String())
+	}
+	if first.Header().Get("Idempotent-Replayed") != "" {
+		t.Error("first request marked as replayed")
+	}
+	calls := upstream.callCount()
+	if calls == 0 {
+		t.Fatal("first request made no upstream call")
+	}
+
+	// Without the replay, the retry would fetch the new price
+	svc.ClearCache()
+	upstream.setPrice("bitcoin", 60000)
+
+	retry := postBulk(router, "key-1", body, "")
+	if retry.Code != http.StatusOK {
+		t.Fatalf("retry: status = %d, want 200", retry.Code)
+	}
+	if got := retry.Header().Get("Idempotent-Replayed"); got != "true" {
+		t.Errorf("retry: Idempotent-Replayed = %q, want true", got)
+	}
+	if retry.Body.String() != first.Body.String() {
+		t.Errorf("retry body differs:\n got %s\nwant %s", retry.Body.String(), first.Body.String())
+	}
+	if got := retry.Header().Get("Content-Type"); got != first.Header().Get("Content-Type") {
+		t.Errorf("retry Content-Type = %q, want %q", got, first.Header().Get("Content-Type"))
+	}
+	if got := upstream.callCount(); got != calls {
+		t.Errorf("retry made %d upstream calls, want none", got-calls)
+	}
+
+	// A new key, or the same key from another user, runs the handler again
+	for _, tt := range []struct{ name, key, user string }{
+		{"new key", "key-2", ""},
+		{"other user", "key-1", "2"},
+	} {
+		w := postBulk(router, tt.key, body, tt.user)
+		if w.Code != http.StatusOK || w.Header().Get("Idempotent-Replayed") != "" {
+			t.Errorf("%s: status %d, replayed %q; want a fresh 200", tt.name, w.Code, w.Header().Get("Idempotent-Replayed"))
+		}
+		if !strings.Contains(w.Body.String(), "60000") {
+			t.Errorf("%s: body doesn't have the new price: %s", tt.name, w.Body.String())
+		}
+	}
+}
+
+func TestIdempotentKeyReuse(t *testing.T) {
+	upstream := newFakeCoinGecko(map[string]float64{"bitcoin": 50000})
+	router := newIdempotentBulkRouter(t, newTestCryptoService(t, upstream))
+
+	if w := postBulk(router, "key-1", `{"coins":["bitcoin"]}`, ""); w.Code != http.StatusOK {
+		t.Fatalf("first request: status = %d, want 200", w.Code)
+	}
+
+	w := postBulk(router, "key-1", `{"coins":["ethereum"]}`, "")
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("different body: status = %d, want 422", w.Code)
+	}
+	var response models.APIResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+	if response.Code != models.CodeIdempotencyMismatch {
+		t.Errorf("code = %q, want %q", response.Code, models.CodeIdempotencyMismatch)
+	}
+}
+
+func TestIdempotentFailuresAreNotStored(t *testing.T) {
+	upstream := newFakeCoinGecko(map[string]float64{"bitcoin": 50000})
+	router := newIdempotentBulkRouter(t, newTestCryptoService(t, upstream))
+
+	// An invalid request fails; retrying the key with the same body runs again
+	for i := 0; i < 2; i++ {
+		w := postBulk(router, "key-1", `{"coins":["bit.coin"]}`, "")
+		if w.Code != http.StatusBadRequest || w.Header().Get("Idempotent-Replayed") != "" {
+			t.Fatalf("attempt %d: status %d, replayed %q; want a fresh 400", i+1, w.Code, w.Header().Get("Idempotent-Replayed"))
+		}
+	}
+
+	if w := postBulk(router, strings.Repeat("k", maxIdempotencyKeyLength+1), `{"coins":["bitcoin"]}`, ""); w.Code != http.StatusBadRequest {
+		t.Errorf("over-long key: status = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"my-go-backend/pkg/models"
+)
+
+func TestPortfolioTotalsUseQuantities(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	upstream := newFakeCoinGecko(map[string]float64{"bitcoin": 50000, "ethereum": 3000})
+	h := NewCryptoHandler(newTestCryptoService(t, upstream), nil, 10, nil, WebSocketOptions{})
+
+	router := gin.New()
+	router.POST("/crypto/portfolio", h.GetPortfolioRealtime)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		total  float64
+		totals map[string]float64
+	}{
+		{
+			name:   "quantities weight the total",
+			body:   `{"coins":["bitcoin","ethereum"],"quantities":{"bitcoin":0.5,"ethereum":4}}`,
+			status: http.StatusOK,
+			total:  37000,
+		},
+		{
+			name:   "missing quantities count as 1",
+			body:   `{"coins":["bitcoin","ethereum"],"quantities":{"Bitcoin":2}}`,
+			status: http.StatusOK,
+			total:  103000,
+		},
+		{
+			name:   "currency totals",
+			body:   `{"coins":["bitcoin","ethereum"],"quantities":{"bitcoin":0.5,"ethereum":4},"currencies":["usd","eur"]}`,
+			status: http.StatusOK,
+			total:  37000,
+			totals: map[string]float64{"usd": 37000, "eur": 18500},
+		},
+		{
+			name:   "zero quantity",
+			body:   `{"coins":["bitcoin","ethereum"],"quantities":{"bitcoin":0}}`,
+			status: http.StatusOK,
+			total:  3000,
+		},
+		{
+			name:   "negative quantity",
+			body:   `{"coins":["bitcoin","ethereum"],"quantities":{"ethereum":-1}}`,
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/crypto/portfolio", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Data models.PortfolioResponse `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("invalid body: %v", err)
+			}
+			if response.Data.TotalValue != tt.total {
+				t.Errorf("total_value = %v, want %v", response.Data.TotalValue, tt.total)
+			}
+			for currency, want := range tt.totals {
+				if got := response.Data.Totals[currency]; got != want {
+					t.Errorf("totals[%s] = %v, want %v", currency, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestExportPortfolioCSV(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	upstream := newFakeCoinGecko(map[string]float64{"bitcoin": 50000})
+	h := NewCryptoHandler(newTestCryptoService(t, upstream), nil, 10, nil, WebSocketOptions{})
+
+	router := gin.New()
+	router.POST("/crypto/portfolio/export", h.ExportPortfolioCSV)
+
+	req := httptest.NewRequest(http.MethodPost, "/crypto/portfolio/export",
+		strings.NewReader(`{"coins":["bitcoin","dogecoin"],"quantities":{"bitcoin":0.5}}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Type"); got != "text/csv; charset=utf-8" {
+		t.Errorf("Content-Type = %q, want text/csv", got)
+	}
+	if got := w.Header().Get("Content-Disposition"); !strings.HasPrefix(got, `attachment; filename="portfolio-`) {
+		t.Errorf("Content-Disposition = %q, want a portfolio attachment", got)
+	}
+
+	rows, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid CSV: %v", err)
+	}
+	want := map[string]string{
+		"coin_id":  "coin_id,symbol,name,price,change_percent_24h,quantity,value,error",
+		"bitcoin":  "bitcoin,bit,bitcoin,50000,0,0.5,25000,",
+		"dogecoin": "dogecoin,,,,,1,,",
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("rows = %q, want a header and one row per coin", rows)
+	}
+	if got := strings.Join(rows[0], ","); got != want["coin_id"] {
+		t.Errorf("header = %s, want %s", got, want["coin_id"])
+	}
+	for _, row := range rows[1:] {
+		got := strings.Join(row, ",")
+		if row[0] == "dogecoin" {
+			// The error text is the service's; only check it's there
+			if !strings.HasPrefix(got, want["dogecoin"]) || row[7] == "" {
+				t.Errorf("errored row = %s, want %s<error>", got, want["dogecoin"])
+			}
+			continue
+		}
+		if got != want[row[0]] {
+			t.Errorf("row = %s, want %s", got, want[row[0]])
+		}
+	}
+}
@@ -2,72 +2,162 @@ package handlers
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"log"
+	"log/slog"
+	"my-go-backend/configs"
+	"my-go-backend/internal/health"
 	"my-go-backend/internal/middleware"
 	"my-go-backend/internal/services"
+	"my-go-backend/pkg/models"
+	"os"
 )
 
 func SetupRoutes(
+	config *configs.Config,
+	dbMonitor *health.Monitor,
 	authService *services.AuthService,
 	userService *services.UserService,
 	cryptoService *services.CryptoService,
-	jwtSecret string,
+	alertService *services.AlertService,
+	favoriteService *services.FavoriteService,
 ) *gin.Engine {
-	router := gin.Default()
+	// gin.New rather than gin.Default: requests are logged by our own logger
+	router := gin.New()
+	router.Use(gin.Recovery())
+	// Only trusted hops may set the client IP through X-Forwarded-For
+	if err := router.SetTrustedProxies(config.TrustedProxies); err != nil {
+		log.Printf("Invalid TRUSTED_PROXIES, trusting none: %v", err)
+		router.SetTrustedProxies(nil)
+	}
+	jwtConfig := middleware.JWTConfig{
+		Secret:   config.JWTSecret,
+		Issuer:   config.JWTIssuer,
+		Audience: config.JWTAudience,
+	}
+
+	// Global middleware (request ID first so the logger can include it)
+	router.Use(middleware.RequestID())
+	logLevel := config.SlogLevel()
+	if config.LogFormat == "json" {
+		handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: logLevel})
+		router.Use(middleware.StructuredLogger(slog.New(handler), config.SlowRequestThreshold))
+	} else {
+		router.Use(middleware.Logger(logLevel, config.SlowRequestThreshold))
+	}
+	router.Use(middleware.CORS(config.AllowedOrigins))
+	router.Use(middleware.RateLimit(config.RateLimitRPS, config.RateLimitBurst))
+	router.Use(middleware.BodyLimit(config.MaxBodyBytes))
+	if config.Features.Compression {
+		router.Use(middleware.Gzip(config.CompressionMinBytes))
+	}
 
-	// Global middleware
-	router.Use(middleware.Logger())
-	router.Use(middleware.CORS())
+	// Prometheus metrics (optional)
+	if config.Features.Metrics {
+		router.Use(middleware.Metrics())
+		router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	}
+
+	// Health checks (no auth required)
+	healthHandler := NewHealthHandler(dbMonitor)
+	router.GET("/health", HealthCheck)                 // Liveness
+	router.GET("/ready", healthHandler.ReadinessCheck) // Readiness (checks DB)
 
-	// Health check (no auth required)
-	router.GET("/health", HealthCheck)
+	// API documentation (optional, disable in production if not wanted)
+	if config.Features.APIDocs {
+		router.GET("/openapi.json", OpenAPISpec)
+		router.GET("/docs", SwaggerUI)
+	}
 
 	// API v1 group
 	v1 := router.Group("/api/v1")
 
-	// Auth routes (no auth required)
+	// Auth routes (no auth required, except for deleting one's own account, sessions and audit events)
 	authHandler := NewAuthHandler(authService)
 	auth := v1.Group("/auth")
+	authLimit := middleware.RateLimit(config.AuthRateLimitRPS, config.AuthRateLimitBurst)
 	{
-		auth.POST("/register", authHandler.Register)
-		auth.POST("/login", authHandler.Login)
+		auth.POST("/register", authLimit, authHandler.Register)
+		auth.POST("/login", authLimit, authHandler.Login)
+		auth.POST("/refresh", authLimit, authHandler.Refresh)
+		auth.POST("/token", authLimit, authHandler.IssueToken)
+		auth.DELETE("/me", middleware.AuthMiddleware(jwtConfig), authLimit, authHandler.DeleteAccount)
+		auth.GET("/events", middleware.AuthMiddleware(jwtConfig), authHandler.GetAuthEvents)
+		auth.GET("/sessions", middleware.AuthMiddleware(jwtConfig), authHandler.GetSessions)
+		auth.DELETE("/sessions/:id", middleware.AuthMiddleware(jwtConfig), authHandler.RevokeSession)
 	}
 
 	// User routes (auth required)
 	userHandler := NewUserHandler(userService)
+	favoriteHandler := NewFavoriteHandler(favoriteService, cryptoService)
 	users := v1.Group("/users")
-	users.Use(middleware.AuthMiddleware(jwtSecret))
+	users.Use(middleware.AuthMiddleware(jwtConfig))
 	{
 		users.GET("", userHandler.GetUsers)
+		users.POST("/me/favorites", favoriteHandler.AddFavorite)
+		users.GET("/me/favorites", favoriteHandler.GetFavorites)
+		users.DELETE("/me/favorites/:coinId", favoriteHandler.RemoveFavorite)
+		users.POST("", middleware.RequireRole(models.RoleAdmin), userHandler.CreateUser)
+		users.GET("/batch", middleware.RequireRole(models.RoleAdmin), userHandler.GetUsersBatch)
 		users.GET("/:id", userHandler.GetUser)
-		users.PUT("/:id", userHandler.UpdateUser)
-		users.DELETE("/:id", userHandler.DeleteUser)
+		users.PUT("/:id", middleware.RequireSelfOrRole("id", models.RoleAdmin), userHandler.UpdateUser)
+		users.DELETE("/:id", middleware.RequireRole(models.RoleAdmin), userHandler.DeleteUser)
+		users.POST("/:id/restore", middleware.RequireRole(models.RoleAdmin), userHandler.RestoreUser)
 	}
 
-	cryptoHandler := NewCryptoHandler(cryptoService)
+	cryptoHandler := NewCryptoHandler(cryptoService, config.AllowedOrigins, config.MaxBulkCoins, config.PopularCoins, WebSocketOptions{
+		ReadBufferSize:  config.WSReadBufferSize,
+		WriteBufferSize: config.WSWriteBufferSize,
+		Compression:     config.Features.WSCompression,
+	})
+	alertHandler := NewAlertHandler(alertService)
+	idempotency := services.NewIdempotencyStore(config.IdempotencyTTL)
 	crypto := v1.Group("/crypto")
-	crypto.Use(middleware.AuthMiddleware(jwtSecret))
+	cryptoJWT := jwtConfig.WithServiceScope(models.ScopeCrypto)
+	crypto.Use(middleware.AuthMiddleware(cryptoJWT), middleware.Quota(config.QuotaHourly, config.QuotaDaily))
 	{
+		// Multiple coins via query string
+		crypto.GET("", cryptoHandler.GetCoins)
+
 		// Single crypto data
 		crypto.GET("/:coinId", cryptoHandler.GetSingleCrypto)
+		crypto.GET("/:coinId/ohlc", cryptoHandler.GetOHLC)
+		crypto.GET("/:coinId/recent", cryptoHandler.GetRecentPrices)
+		crypto.POST("/:coinId/refresh", middleware.RequireRole(models.RoleAdmin), cryptoHandler.RefreshCoin)
 
 		// Bulk operations (demonstrates goroutines)
-		crypto.POST("/bulk", cryptoHandler.GetBulkCrypto)
-		crypto.POST("/portfolio", cryptoHandler.GetPortfolioRealtime)
+		crypto.POST("/bulk", idempotent(idempotency), cryptoHandler.GetBulkCrypto)
+		crypto.POST("/portfolio", idempotent(idempotency), cryptoHandler.GetPortfolioRealtime)
+		crypto.POST("/portfolio/export", cryptoHandler.ExportPortfolioCSV)
 
 		// Popular coins (query params)
 		crypto.GET("/popular", cryptoHandler.GetPopularCoins)
+		crypto.GET("/coins", cryptoHandler.ListCoins)
+		crypto.GET("/compare", cryptoHandler.CompareCoins)
+		crypto.GET("/global", cryptoHandler.GetGlobal)
 
-		// Cache operations (demonstrates locks)
+		// Cache operations (demonstrates locks); emptying the cache makes
+		// everyone's next requests refetch, so only admins can
 		crypto.GET("/cache/stats", cryptoHandler.GetCacheStats)
-		crypto.DELETE("/cache", cryptoHandler.ClearCache)
+		crypto.DELETE("/cache", middleware.RequireRole(models.RoleAdmin), cryptoHandler.ClearCache)
+		crypto.GET("/cache/:coinId", cryptoHandler.GetCachedCoin)
+		crypto.DELETE("/cache/:coinId", middleware.RequireRole(models.RoleAdmin), cryptoHandler.EvictCachedCoin)
 
 		// Streaming routes
 		crypto.GET("/stream/prices", cryptoHandler.StreamPrices)        // SSE
+		crypto.GET("/stream/ndjson", cryptoHandler.StreamPricesNDJSON)  // NDJSON
 		crypto.POST("/stream/portfolio", cryptoHandler.StreamPortfolio) // JSON streaming
+
+		// Price alerts (evaluated by the background streaming loop); they
+		// belong to a user, so service tokens are refused
+		userOnly := middleware.RequireRole(models.RoleUser, models.RoleAdmin)
+		crypto.POST("/alerts", userOnly, alertHandler.CreateAlert)
+		crypto.GET("/alerts", userOnly, alertHandler.GetAlerts)
+		crypto.DELETE("/alerts/:id", userOnly, alertHandler.DeleteAlert)
 	}
 
 	// WebSocket endpoint with custom auth (supports query param token)
-	v1.GET("/crypto/stream/ws", cryptoHandler.WebSocketHandlerWithAuth(jwtSecret))
+	v1.GET("/crypto/stream/ws", cryptoHandler.WebSocketHandlerWithAuth(cryptoJWT))
 
 	return router
 }
@@ -0,0 +1,356 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"my-go-backend/configs"
+	"my-go-backend/internal/services"
+	"my-go-backend/pkg/models"
+)
+
+// testServiceClients can get service tokens from the test routes
+var testServiceClients = []services.ServiceClient{
+	{ID: "price-bot", Secret: "price-bot-secret-0123", Scopes: []string{models.ScopeCrypto}},
+	{ID: "no-scope-bot", Secret: "no-scope-secret-0123"},
+}
+
+// testApp is the real router over an in-memory database and a fake
+// CoinGecko, with the parts tests look into
+type testApp struct {
+	router   *gin.Engine
+	config   *configs.Config
+	db       *gorm.DB
+	upstream *fakeCoinGecko
+	crypto   *services.CryptoService
+}
+
+// newTestRoutes builds the app with every service wired as in main
+func newTestRoutes(t *testing.T) *testApp {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	app := &testApp{
+		config:   newTestConfig(t),
+		db:       newTestDB(t),
+		upstream: newFakeCoinGecko(map[string]float64{"bitcoin": 50000, "ethereum": 3000}),
+	}
+	app.crypto = newTestCryptoService(t, app.upstream)
+	alertService := services.NewAlertService(app.db)
+	app.crypto.SetAlertEvaluator(alertService)
+
+	config := app.config
+	authService := services.NewAuthService(app.db, config.JWTSecret, config.JWTAccessTTL, config.JWTRefreshTTL, config.JWTIssuer, config.JWTAudience,
+		services.WithServiceClients(testServiceClients, 0))
+	app.router = SetupRoutes(config, nil, authService,
+		services.NewUserService(app.db),
+		app.crypto,
+		alertService,
+		services.NewFavoriteService(app.db, config.MaxFavorites))
+	return app
+}
+
+// serve sends a request with the given bearer token; an empty token sends
+// none
+func (app *testApp) serve(method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	app.router.ServeHTTP(w, req)
+	return w
+}
+
+// serveAs sends a request with an access token for userID and role; an
+// empty role sends none
+func (app *testApp) serveAs(t *testing.T, userID uint, role, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	token := ""
+	if role != "" {
+		token = signTestToken(t, app.config, userID, role)
+	}
+	return app.serve(method, path, token, body)
+}
+
+func TestUserWriteRoutesRequireAdminOrSelf(t *testing.T) {
+	app := newTestRoutes(t)
+	const update = `{"username":"renamed"}`
+
+	tests := []struct {
+		name      string
+		userID    uint
+		role      string
+		method    string
+		path      string
+		forbidden bool
+	}{
+		{"user updating another user", 2, models.RoleUser, http.MethodPut, "/api/v1/users/1", true},
+		{"user updating an admin", 2, models.RoleUser, http.MethodPut, "/api/v1/users/3", true},
+		{"user updating themself", 2, models.RoleUser, http.MethodPut, "/api/v1/users/2", false},
+		{"admin updating another user", 3, models.RoleAdmin, http.MethodPut, "/api/v1/users/1", false},
+		{"user deleting another user", 2, models.RoleUser, http.MethodDelete, "/api/v1/users/1", true},
+		{"user deleting themself", 2, models.RoleUser, http.MethodDelete, "/api/v1/users/2", true},
+		{"admin deleting a user", 3, models.RoleAdmin, http.MethodDelete, "/api/v1/users/1", false},
+		{"user restoring a user", 2, models.RoleUser, http.MethodPost, "/api/v1/users/1/restore", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := app.serveAs(t, tt.userID, tt.role, tt.method, tt.path, update)
+			if tt.forbidden {
+				if w.Code != http.StatusForbidden || errorCodeOf(t, w) != models.CodeForbidden {
+					t.Errorf("status %d: %s; want 403 FORBIDDEN", w.Code, w.Body.String())
+				}
+				return
+			}
+			if w.Code == http.StatusForbidden || w.Code == http.StatusUnauthorized {
+				t.Errorf("status %d: %s; want the request let through", w.Code, w.Body.String())
+			}
+		})
+	}
+
+	if w := app.serveAs(t, 0, "", http.MethodDelete, "/api/v1/users/1", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("without a token: status = %d, want 401", w.Code)
+	}
+}
+
+func TestCacheEntryRoutes(t *testing.T) {
+	app := newTestRoutes(t)
+	const user, admin = 2, 3
+
+	// Nothing is cached yet
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		if w := app.serveAs(t, admin, models.RoleAdmin, method, "/api/v1/crypto/cache/bitcoin", ""); w.Code != http.StatusNotFound {
+			t.Errorf("%s before caching: status = %d, want 404", method, w.Code)
+		}
+	}
+
+	if w := app.serveAs(t, user, models.RoleUser, http.MethodGet, "/api/v1/crypto/bitcoin", ""); w.Code != http.StatusOK {
+		t.Fatalf("fetching bitcoin: status = %d: %s", w.Code, w.Body.String())
+	}
+
+	w := app.serveAs(t, user, models.RoleUser, http.MethodGet, "/api/v1/crypto/cache/bitcoin", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("inspect: status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	var response struct {
+		Data models.CacheEntry `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+	if response.Data.Data.Price != 50000 || !response.Data.Fresh {
+		t.Errorf("entry = %+v, want a fresh price of 50000", response.Data)
+	}
+
+	for _, path := range []string{"/api/v1/crypto/cache/bitcoin", "/api/v1/crypto/cache"} {
+		if w := app.serveAs(t, user, models.RoleUser, http.MethodDelete, path, ""); w.Code != http.StatusForbidden {
+			t.Errorf("user DELETE %s: status = %d, want 403", path, w.Code)
+		}
+	}
+	if w := app.serveAs(t, user, models.RoleUser, http.MethodGet, "/api/v1/crypto/cache/bitcoin", ""); w.Code != http.StatusOK {
+		t.Errorf("after a refused eviction: status = %d, want the entry kept", w.Code)
+	}
+
+	if w := app.serveAs(t, admin, models.RoleAdmin, http.MethodDelete, "/api/v1/crypto/cache/bitcoin", ""); w.Code != http.StatusOK {
+		t.Fatalf("admin evict: status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	if w := app.serveAs(t, user, models.RoleUser, http.MethodGet, "/api/v1/crypto/cache/bitcoin", ""); w.Code != http.StatusNotFound {
+		t.Errorf("after eviction: status = %d, want 404", w.Code)
+	}
+
+	// The next request refetches
+	calls := app.upstream.callCount()
+	app.serveAs(t, user, models.RoleUser, http.MethodGet, "/api/v1/crypto/bitcoin", "")
+	if app.upstream.callCount() == calls {
+		t.Error("request after eviction was served from the cache")
+	}
+
+	if w := app.serveAs(t, admin, models.RoleAdmin, http.MethodDelete, "/api/v1/crypto/cache", ""); w.Code != http.StatusOK {
+		t.Errorf("admin clear: status = %d, want 200", w.Code)
+	}
+}
+
+func TestServiceTokenScopes(t *testing.T) {
+	app := newTestRoutes(t)
+
+	issue := func(clientID, secret, scope string) *httptest.ResponseRecorder {
+		form := url.Values{"grant_type": {"client_credentials"}, "client_id": {clientID}, "client_secret": {secret}, "scope": {scope}}
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/token", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		app.router.ServeHTTP(w, req)
+		return w
+	}
+	token := func(clientID, secret string) string {
+		w := issue(clientID, secret, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("issuing a token for %s: status %d: %s", clientID, w.Code, w.Body.String())
+		}
+		var response struct {
+			Data models.ServiceTokenResponse `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("invalid body: %v", err)
+		}
+		return response.Data.AccessToken
+	}
+
+	if w := issue("price-bot", "wrong-secret", ""); w.Code != http.StatusUnauthorized || errorCodeOf(t, w) != models.CodeInvalidClient {
+		t.Errorf("wrong secret: status %d: %s; want 401 INVALID_CLIENT", w.Code, w.Body.String())
+	}
+	if w := issue("no-scope-bot", testServiceClients[1].Secret, models.ScopeCrypto); w.Code != http.StatusBadRequest || errorCodeOf(t, w) != models.CodeInvalidScope {
+		t.Errorf("scope not granted: status %d: %s; want 400 INVALID_SCOPE", w.Code, w.Body.String())
+	}
+
+	scoped := token("price-bot", testServiceClients[0].Secret)
+	unscoped := token("no-scope-bot", testServiceClients[1].Secret)
+
+	tests := []struct {
+		name   string
+		token  string
+		method string
+		path   string
+		status int
+	}{
+		{"crypto scope reads prices", scoped, http.MethodGet, "/api/v1/crypto/bitcoin", http.StatusOK},
+		{"without the crypto scope", unscoped, http.MethodGet, "/api/v1/crypto/bitcoin", http.StatusForbidden},
+		{"alerts belong to users", scoped, http.MethodGet, "/api/v1/crypto/alerts", http.StatusForbidden},
+		{"admin-only crypto routes", scoped, http.MethodDelete, "/api/v1/crypto/cache", http.StatusForbidden},
+		{"user routes", scoped, http.MethodGet, "/api/v1/users", http.StatusForbidden},
+		{"own account", scoped, http.MethodGet, "/api/v1/auth/sessions", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			w := httptest.NewRecorder()
+			app.router.ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if tt.status == http.StatusForbidden && errorCodeOf(t, w) != models.CodeForbidden {
+				t.Errorf("code = %q, want %q", errorCodeOf(t, w), models.CodeForbidden)
+			}
+		})
+	}
+}
+
+// register signs up a user through the API and returns it
+func (app *testApp) register(t *testing.T, username, email, password string) models.UserResponse {
+	t.Helper()
+	body := `{"username":"` + username + `","email":"` + email + `","password":"` + password + `"}`
+	w := app.serve(http.MethodPost, "/api/v1/auth/register", "", body)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("registering %s: status %d: %s", username, w.Code, w.Body.String())
+	}
+	var response struct {
+		Data models.UserResponse `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+	return response.Data
+}
+
+// login signs in through the API and returns the response
+func (app *testApp) login(email, password string) *httptest.ResponseRecorder {
+	return app.serve(http.MethodPost, "/api/v1/auth/login", "", `{"email":"`+email+`","password":"`+password+`"}`)
+}
+
+func TestTrustedProxies(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.1")
+	app := newTestRoutes(t)
+	app.register(t, "alice", "alice@example.com", "password123")
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		want       string
+	}{
+		{"through the trusted proxy", "10.0.0.1:4000", "203.0.113.7"},
+		{"from an untrusted hop", "192.0.2.9:4000", "192.0.2.9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login",
+				strings.NewReader(`{"email":"alice@example.com","password":"password123"}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-Forwarded-For", "203.0.113.7")
+			req.RemoteAddr = tt.remoteAddr
+			w := httptest.NewRecorder()
+			app.router.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("login: status = %d, want 200", w.Code)
+			}
+
+			// The audit entry records the resolved client IP
+			var event models.AuthEvent
+			if err := app.db.Where("type = ?", models.AuthEventLogin).Last(&event).Error; err != nil {
+				t.Fatalf("reading the login event: %v", err)
+			}
+			if event.IP != tt.want {
+				t.Errorf("client IP = %q, want %q", event.IP, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefreshCoinRoute(t *testing.T) {
+	app := newTestRoutes(t)
+	const user, admin = 2, 3
+	price := func(w *httptest.ResponseRecorder) float64 {
+		t.Helper()
+		var response struct {
+			Data models.CryptoData `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("invalid body: %v", err)
+		}
+		return response.Data.Price
+	}
+
+	if w := app.serveAs(t, user, models.RoleUser, http.MethodGet, "/api/v1/crypto/bitcoin", ""); w.Code != http.StatusOK {
+		t.Fatalf("fetching bitcoin: status = %d: %s", w.Code, w.Body.String())
+	}
+	app.upstream.setPrice("bitcoin", 52000)
+	if w := app.serveAs(t, user, models.RoleUser, http.MethodGet, "/api/v1/crypto/bitcoin", ""); price(w) != 50000 {
+		t.Fatalf("price = %v, want the cached 50000", price(w))
+	}
+
+	if w := app.serveAs(t, user, models.RoleUser, http.MethodPost, "/api/v1/crypto/bitcoin/refresh", ""); w.Code != http.StatusForbidden {
+		t.Errorf("user refresh: status = %d, want 403", w.Code)
+	}
+
+	// The entry is fresh, but the refresh still goes upstream
+	calls := app.upstream.callCount()
+	w := app.serveAs(t, admin, models.RoleAdmin, http.MethodPost, "/api/v1/crypto/bitcoin/refresh", "")
+	if w.Code != http.StatusOK || price(w) != 52000 {
+		t.Fatalf("admin refresh: status %d, price %v; want 200 with 52000", w.Code, price(w))
+	}
+	if app.upstream.callCount() == calls {
+		t.Error("refresh was served from the cache")
+	}
+
+	calls = app.upstream.callCount()
+	if w := app.serveAs(t, user, models.RoleUser, http.MethodGet, "/api/v1/crypto/bitcoin", ""); price(w) != 52000 || app.upstream.callCount() != calls {
+		t.Errorf("after refresh: price %v after %d more calls, want 52000 from the cache", price(w), app.upstream.callCount()-calls)
+	}
+
+	// A failed refresh keeps the cached price
+	app.upstream.setStatus(http.StatusInternalServerError)
+	if w := app.serveAs(t, admin, models.RoleAdmin, http.MethodPost, "/api/v1/crypto/bitcoin/refresh", ""); w.Code != http.StatusBadGateway {
+		t.Errorf("refresh with the upstream down: status = %d, want 502", w.Code)
+	}
+	if w := app.serveAs(t, user, models.RoleUser, http.MethodGet, "/api/v1/crypto/bitcoin", ""); price(w) != 52000 {
+		t.Errorf("after a failed refresh: price = %v, want 52000 kept", price(w))
+	}
+}
@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"my-go-backend/internal/services"
+	"my-go-backend/pkg/models"
+)
+
+func TestStreamDrainOnShutdown(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	svc := newTestCryptoService(t, newFakeCoinGecko(map[string]float64{"bitcoin": 50000}))
+	h := NewCryptoHandler(svc, nil, 10, nil, WebSocketOptions{})
+
+	router := gin.New()
+	router.GET("/crypto/stream/prices", h.StreamPrices)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/crypto/stream/prices?coins=bitcoin&interval=60")
+	if err != nil {
+		t.Fatalf("opening stream: %v", err)
+	}
+	defer resp.Body.Close()
+	lines := bufio.NewScanner(resp.Body)
+
+	// The interval comment is written once the stream is registered
+	readUntil := func(prefix string) bool {
+		for lines.Scan() {
+			if strings.HasPrefix(lines.Text(), prefix) {
+				return true
+			}
+		}
+		return false
+	}
+	if !readUntil(": interval") {
+		t.Fatalf("stream ended before starting: %v", lines.Err())
+	}
+	if got := svc.ActiveStreams(); got != 1 {
+		t.Fatalf("active streams = %d, want 1", got)
+	}
+
+	svc.Shutdown()
+
+	if !readUntil("event: shutdown") {
+		t.Fatalf("stream ended without a shutdown event: %v", lines.Err())
+	}
+	if !readUntil("data: ") || !strings.Contains(lines.Text(), `"reason":"shutdown"`) {
+		t.Errorf("shutdown data = %q, want reason shutdown", lines.Text())
+	}
+	// The handler returns after the notice, ending the response
+	done := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, resp.Body)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream still open after the shutdown event")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := svc.WaitForStreams(ctx); err != nil {
+		t.Errorf("WaitForStreams: %v", err)
+	}
+	if got := svc.ActiveStreams(); got != 0 {
+		t.Errorf("active streams after drain = %d, want 0", got)
+	}
+
+	// New streams are refused while shutting down
+	late, err := http.Get(server.URL + "/crypto/stream/prices?coins=bitcoin")
+	if err != nil {
+		t.Fatalf("opening a stream after shutdown: %v", err)
+	}
+	late.Body.Close()
+	if late.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("stream after shutdown: status = %d, want 503", late.StatusCode)
+	}
+}
+
+func TestStreamPricesNDJSON(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	svc := newTestCryptoService(t, newFakeCoinGecko(map[string]float64{"bitcoin": 50000}),
+		services.WithStreamIntervalBounds(time.Millisecond, 10*time.Millisecond))
+	h := NewCryptoHandler(svc, nil, 10, nil, WebSocketOptions{})
+
+	router := gin.New()
+	router.GET("/crypto/stream/ndjson", h.StreamPricesNDJSON)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/crypto/stream/ndjson?coins=bitcoin&interval=1&max_updates=2")
+	if err != nil {
+		t.Fatalf("opening stream: %v", err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Type"); got != "application/x-ndjson" {
+		t.Errorf("Content-Type = %q, want application/x-ndjson", got)
+	}
+
+	// One JSON event per line: two updates, then the end of the stream
+	var types []string
+	lines := bufio.NewScanner(resp.Body)
+	for lines.Scan() {
+		var event struct {
+			Type string `json:"type"`
+			Data struct {
+				CoinID string `json:"coin_id"`
+				Reason string `json:"reason"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(lines.Bytes(), &event); err != nil {
+			t.Fatalf("line %q isn't a JSON event: %v", lines.Text(), err)
+		}
+		if event.Type == "price_update" && event.Data.CoinID != "bitcoin" {
+			t.Errorf("update for %q, want bitcoin", event.Data.CoinID)
+		}
+		if event.Type == "end" && event.Data.Reason != models.StreamEndMaxUpdates {
+			t.Errorf("end reason = %q, want %q", event.Data.Reason, models.StreamEndMaxUpdates)
+		}
+		types = append(types, event.Type)
+	}
+	if got := strings.Join(types, ","); got != "price_update,price_update,end" {
+		t.Errorf("events = %s, want two price updates then end", got)
+	}
+}
+
+func TestStreamPortfolioInterval(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	svc := newTestCryptoService(t, newFakeCoinGecko(map[string]float64{"bitcoin": 50000}),
+		services.WithStreamIntervalBounds(time.Millisecond, 100*time.Millisecond))
+	h := NewCryptoHandler(svc, nil, 10, nil, WebSocketOptions{})
+
+	router := gin.New()
+	router.POST("/crypto/stream/portfolio", h.StreamPortfolio)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	for _, interval := range []string{"0", "soon"} {
+		resp, err := http.Post(server.URL+"/crypto/stream/portfolio?interval="+interval, "application/json", strings.NewReader(`{"coins":["bitcoin"]}`))
+		if err != nil {
+			t.Fatalf("opening stream: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("interval %q: status = %d, want 400", interval, resp.StatusCode)
+		}
+	}
+
+	// 1 second is clamped to the 100ms maximum, in place of the 10s default
+	resp, err := http.Post(server.URL+"/crypto/stream/portfolio?interval=1", "application/json", strings.NewReader(`{"coins":["bitcoin"]}`))
+	if err != nil {
+		t.Fatalf("opening stream: %v", err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("X-Stream-Interval"); got != "0.1" {
+		t.Errorf("X-Stream-Interval = %q, want 0.1", got)
+	}
+
+	lines := bufio.NewScanner(resp.Body)
+	start := time.Now()
+	updates := 0
+	for updates < 3 && lines.Scan() {
+		if strings.HasPrefix(lines.Text(), "data: ") {
+			updates++
+		}
+	}
+	elapsed := time.Since(start)
+	if updates != 3 {
+		t.Fatalf("stream ended after %d updates: %v", updates, lines.Err())
+	}
+	if elapsed < 250*time.Millisecond || elapsed > 5*time.Second {
+		t.Errorf("3 updates took %v, want about 300ms", elapsed)
+	}
+}
+
+func TestStreamPricesDurationCap(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	svc := newTestCryptoService(t, newFakeCoinGecko(map[string]float64{"bitcoin": 50000}),
+		services.WithStreamIntervalBounds(time.Millisecond, 10*time.Millisecond),
+		services.WithMaxStreamDuration(200*time.Millisecond))
+	h := NewCryptoHandler(svc, nil, 10, nil, WebSocketOptions{})
+
+	router := gin.New()
+	router.GET("/crypto/stream/prices", h.StreamPrices)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	// Asking for an hour without an update limit still ends at the cap
+	start := time.Now()
+	resp, err := http.Get(server.URL + "/crypto/stream/prices?coins=bitcoin&interval=1&duration=3600")
+	if err != nil {
+		t.Fatalf("opening stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var updates int
+	var end string // Data of the end event
+	lines := bufio.NewScanner(resp.Body)
+	for lines.Scan() {
+		if lines.Text() == "event: end" && lines.Scan() {
+			end = lines.Text()
+		} else if strings.HasPrefix(lines.Text(), "data: ") {
+			updates++
+		}
+	}
+	elapsed := time.Since(start)
+
+	if !strings.Contains(end, `"reason":"`+models.StreamEndDuration+`"`) {
+		t.Fatalf("end event data = %q, want reason %q", end, models.StreamEndDuration)
+	}
+	if updates < 2 {
+		t.Errorf("got %d updates before the end, want the stream to run until the cap", updates)
+	}
+	if elapsed < 200*time.Millisecond || elapsed > 5*time.Second {
+		t.Errorf("stream lasted %v, want about 200ms", elapsed)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/crypto/stream/prices?coins=bitcoin&duration=0", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("duration=0: status = %d, want 400", w.Code)
+	}
+}
+
+func TestStreamBlankCoins(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	upstream := newFakeCoinGecko(map[string]float64{"bitcoin": 50000})
+	svc := newTestCryptoService(t, upstream)
+	h := NewCryptoHandler(svc, nil, 10, nil, WebSocketOptions{})
+
+	router := gin.New()
+	router.GET("/crypto/stream/prices", h.StreamPrices)
+	router.GET("/crypto/stream/ndjson", h.StreamPricesNDJSON)
+	router.POST("/crypto/stream/portfolio", h.StreamPortfolio)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+	}{
+		{"prices", http.MethodGet, "/crypto/stream/prices?coins=,,", ""},
+		{"prices with spaces", http.MethodGet, "/crypto/stream/prices?coins=%20,%20", ""},
+		{"ndjson", http.MethodGet, "/crypto/stream/ndjson?coins=,", ""},
+		{"portfolio", http.MethodPost, "/crypto/stream/portfolio", `{"coins":["", " "]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400", w.Code)
+			}
+			if strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+				t.Error("an event stream was started")
+			}
+		})
+	}
+	if got := upstream.callCount(); got != 0 {
+		t.Errorf("made %d upstream calls, want none", got)
+	}
+}
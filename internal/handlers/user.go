@@ -1,11 +1,14 @@
 package handlers
 
 import (
+	"errors"
 	"github.com/gin-gonic/gin"
+	"my-go-backend/internal/respond"
 	"my-go-backend/internal/services"
 	"my-go-backend/pkg/models"
 	"net/http"
 	"strconv"
+	"strings"
 )
 
 type UserHandler struct {
@@ -16,115 +19,202 @@ func NewUserHandler(userService *services.UserService) *UserHandler {
 	return &UserHandler{userService: userService}
 }
 
+// CreateUser - Provision a user with a role (admin only)
+func (h *UserHandler) CreateUser(c *gin.Context) {
+	var req models.AdminCreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respond.Error(c, http.StatusBadRequest, "Invalid request data", bindingError(err))
+		return
+	}
+
+	created, err := h.userService.CreateUser(&req)
+	var fieldErr *services.FieldError
+	if errors.As(err, &fieldErr) {
+		respond.Error(c, http.StatusBadRequest, "Invalid request data", fieldErr)
+		return
+	}
+	if errors.Is(err, services.ErrUserExists) {
+		respond.Error(c, http.StatusConflict, "Failed to create user", err)
+		return
+	}
+	if err != nil {
+		respond.Error(c, http.StatusInternalServerError, "Failed to create user", err)
+		return
+	}
+
+	respond.Created(c, "User created successfully", created)
+}
+
 func (h *UserHandler) GetUser(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, models.APIResponse{
-			Success: false,
-			Message: "Invalid user ID",
-			Error:   err.Error(),
-		})
+		respond.Error(c, http.StatusBadRequest, "Invalid user ID", err)
 		return
 	}
 
 	user, err := h.userService.GetUserByID(uint(id))
+	if errors.Is(err, services.ErrUserNotFound) {
+		respond.Error(c, http.StatusNotFound, "User not found", err)
+		return
+	}
+	if err != nil {
+		respond.Error(c, http.StatusInternalServerError, "Failed to retrieve user", err)
+		return
+	}
+	if user.Stale {
+		c.Header("Warning", `110 - "Response is Stale"`)
+	}
+
+	respond.OK(c, "User retrieved successfully", user)
+}
+
+// GetUsersBatch - Fetch several users by id, e.g. ?ids=1,2,3 (admin only)
+func (h *UserHandler) GetUsersBatch(c *gin.Context) {
+	idsParam := c.Query("ids")
+	if idsParam == "" {
+		respond.Error(c, http.StatusBadRequest, "ids parameter is required", nil)
+		return
+	}
+
+	var ids []uint
+	for _, part := range strings.Split(idsParam, ",") {
+		id, err := strconv.ParseUint(strings.TrimSpace(part), 10, 32)
+		if err != nil {
+			respond.Error(c, http.StatusBadRequest, "Invalid user ID", err)
+			return
+		}
+		ids = append(ids, uint(id))
+	}
+
+	users, err := h.userService.GetUsersByIDs(ids)
+	if errors.Is(err, services.ErrTooManyUserIDs) {
+		respond.Error(c, http.StatusBadRequest, "Too many user IDs", err)
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusNotFound, models.APIResponse{
-			Success: false,
-			Message: "User not found",
-			Error:   err.Error(),
-		})
+		respond.Error(c, http.StatusInternalServerError, "Failed to retrieve users", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, models.APIResponse{
-		Success: true,
-		Message: "User retrieved successfully",
-		Data:    user,
-	})
+	respond.OK(c, "Users retrieved successfully", users)
 }
 
+// GetUsers - List users, paged by offset (page) or by cursor when "cursor"
+// is present (an empty cursor starts from the beginning)
 func (h *UserHandler) GetUsers(c *gin.Context) {
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(services.DefaultPageSize)))
+	if err != nil {
+		limit = services.DefaultPageSize
+	}
+
+	opts := services.UserListOptions{
+		Sort:     c.Query("sort"),
+		Username: c.Query("username"),
+		Email:    c.Query("email"),
+	}
 
-	users, err := h.userService.GetAllUsers(page, limit)
+	var users *models.PaginatedResponse
+	if cursorParam, ok := c.GetQuery("cursor"); ok {
+		var cursor uint64
+		if cursorParam != "" {
+			cursor, err = strconv.ParseUint(cursorParam, 10, 32)
+			if err != nil {
+				respond.Error(c, http.StatusBadRequest, "Invalid cursor", err)
+				return
+			}
+		}
+		users, err = h.userService.GetUsersAfter(uint(cursor), limit, opts)
+	} else {
+		page, convErr := strconv.Atoi(c.DefaultQuery("page", "1"))
+		if convErr != nil {
+			page = 1
+		}
+		users, err = h.userService.GetAllUsers(page, limit, opts)
+	}
+	if errors.Is(err, services.ErrInvalidSort) || errors.Is(err, services.ErrCursorSort) {
+		respond.Error(c, http.StatusBadRequest, "Invalid sort parameter", err)
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
-			Success: false,
-			Message: "Failed to retrieve users",
-			Error:   err.Error(),
-		})
+		respond.Error(c, http.StatusInternalServerError, "Failed to retrieve users", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, models.APIResponse{
-		Success: true,
-		Message: "Users retrieved successfully",
-		Data:    users,
-	})
+	respond.OK(c, "Users retrieved successfully", users)
 }
 
 func (h *UserHandler) UpdateUser(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, models.APIResponse{
-			Success: false,
-			Message: "Invalid user ID",
-			Error:   err.Error(),
-		})
+		respond.Error(c, http.StatusBadRequest, "Invalid user ID", err)
 		return
 	}
 
 	var updates map[string]interface{}
 	if err := c.ShouldBindJSON(&updates); err != nil {
-		c.JSON(http.StatusBadRequest, models.APIResponse{
-			Success: false,
-			Message: "Invalid request data",
-			Error:   err.Error(),
-		})
+		respond.Error(c, http.StatusBadRequest, "Invalid request data", err)
 		return
 	}
 
 	user, err := h.userService.UpdateUser(uint(id), updates)
+	var fieldErr *services.FieldError
+	if errors.As(err, &fieldErr) {
+		respond.Error(c, http.StatusBadRequest, "Invalid request data", fieldErr)
+		return
+	}
+	if errors.Is(err, services.ErrUserNotFound) {
+		respond.Error(c, http.StatusNotFound, "User not found", err)
+		return
+	}
+	if errors.Is(err, services.ErrNoUpdatableFields) {
+		respond.Error(c, http.StatusBadRequest, "Only username and email can be updated", err)
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
-			Success: false,
-			Message: "Failed to update user",
-			Error:   err.Error(),
-		})
+		respond.Error(c, http.StatusInternalServerError, "Failed to update user", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, models.APIResponse{
-		Success: true,
-		Message: "User updated successfully",
-		Data:    user,
-	})
+	respond.OK(c, "User updated successfully", user)
 }
 
 func (h *UserHandler) DeleteUser(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, models.APIResponse{
-			Success: false,
-			Message: "Invalid user ID",
-			Error:   err.Error(),
-		})
+		respond.Error(c, http.StatusBadRequest, "Invalid user ID", err)
 		return
 	}
 
-	if err := h.userService.DeleteUser(uint(id)); err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
-			Success: false,
-			Message: "Failed to delete user",
-			Error:   err.Error(),
-		})
+	err = h.userService.DeleteUser(uint(id))
+	if errors.Is(err, services.ErrUserNotFound) {
+		respond.Error(c, http.StatusNotFound, "User not found", err)
+		return
+	}
+	if err != nil {
+		respond.Error(c, http.StatusInternalServerError, "Failed to delete user", err)
+		return
+	}
+
+	respond.OK(c, "User deleted successfully", nil)
+}
+
+// RestoreUser - Undelete a soft-deleted user (admin only)
+func (h *UserHandler) RestoreUser(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	user, err := h.userService.RestoreUser(uint(id))
+	if errors.Is(err, services.ErrUserNotFound) {
+		respond.Error(c, http.StatusNotFound, "Failed to restore user", err)
+		return
+	}
+	if err != nil {
+		respond.Error(c, http.StatusInternalServerError, "Failed to restore user", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, models.APIResponse{
-		Success: true,
-		Message: "User deleted successfully",
-	})
+	respond.OK(c, "User restored successfully", user)
 }
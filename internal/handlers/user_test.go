@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"my-go-backend/internal/middleware"
+	"my-go-backend/internal/services"
+	"my-go-backend/pkg/models"
+)
+
+func TestCreateUserRequiresAdmin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := NewUserHandler(services.NewUserService(newDryRunDB(t)))
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		// Stand-in for AuthMiddleware
+		if role := c.GetHeader("X-Test-Role"); role != "" {
+			c.Set("user_id", float64(1))
+			c.Set("role", role)
+		}
+		c.Next()
+	})
+	router.POST("/users", middleware.RequireRole(models.RoleAdmin), h.CreateUser)
+
+	const body = `{"username":"newuser","email":"newuser@example.com","password":"SecurePass123!","role":"user"}`
+
+	tests := []struct {
+		name   string
+		role   string
+		status int
+		code   string
+	}{
+		{"admin", models.RoleAdmin, http.StatusCreated, ""},
+		{"user", models.RoleUser, http.StatusForbidden, models.CodeForbidden},
+		{"service client", models.RoleService, http.StatusForbidden, models.CodeForbidden},
+		{"no role", "", http.StatusForbidden, models.CodeForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.role != "" {
+				req.Header.Set("X-Test-Role", tt.role)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+
+			var response struct {
+				models.APIResponse
+				Data *models.AdminCreateUserResponse `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("invalid body %q: %v", w.Body.String(), err)
+			}
+			if response.Code != tt.code {
+				t.Errorf("code = %q, want %q", response.Code, tt.code)
+			}
+			if tt.status != http.StatusCreated {
+				if response.Data != nil {
+					t.Errorf("refused request returned a user: %+v", response.Data)
+				}
+				return
+			}
+			if response.Data == nil || response.Data.User.Username != "newuser" || response.Data.User.Role != models.RoleUser {
+				t.Errorf("data = %+v, want the new user", response.Data)
+			}
+			if response.Data != nil && response.Data.TemporaryPassword != "" {
+				t.Error("temporary password returned although one was given")
+			}
+		})
+	}
+}
+
+func TestSoftDeleteAndRestore(t *testing.T) {
+	app := newTestRoutes(t)
+	const admin = 100
+	kept := app.register(t, "kept", "kept@example.com", "password1")
+	deleted := app.register(t, "deleted", "deleted@example.com", "password2")
+	userPath := fmt.Sprintf("/api/v1/users/%d", deleted.ID)
+
+	listed := func() []string {
+		t.Helper()
+		w := app.serveAs(t, admin, models.RoleAdmin, http.MethodGet, "/api/v1/users", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("list: status %d: %s", w.Code, w.Body.String())
+		}
+		var response struct {
+			Data struct {
+				Data  []models.UserResponse `json:"data"`
+				Total int64                 `json:"total"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("invalid body: %v", err)
+		}
+		var names []string
+		for _, user := range response.Data.Data {
+			names = append(names, user.Username)
+		}
+		if int(response.Data.Total) != len(names) {
+			t.Errorf("total = %d, want %d", response.Data.Total, len(names))
+		}
+		return names
+	}
+
+	if w := app.serveAs(t, admin, models.RoleAdmin, http.MethodPost, userPath+"/restore", ""); w.Code != http.StatusNotFound {
+		t.Errorf("restoring a user that isn't deleted: status = %d, want 404", w.Code)
+	}
+
+	if w := app.serveAs(t, admin, models.RoleAdmin, http.MethodDelete, userPath, ""); w.Code != http.StatusOK {
+		t.Fatalf("delete: status %d: %s", w.Code, w.Body.String())
+	}
+	if got := listed(); strings.Join(got, ",") != kept.Username {
+		t.Errorf("listed after delete = %v, want only %s", got, kept.Username)
+	}
+	if w := app.serveAs(t, admin, models.RoleAdmin, http.MethodGet, userPath, ""); w.Code != http.StatusNotFound {
+		t.Errorf("get after delete: status = %d, want 404", w.Code)
+	}
+	if w := app.login("deleted@example.com", "password2"); w.Code != http.StatusForbidden {
+		t.Errorf("login after delete: status = %d, want 403", w.Code)
+	}
+	if w := app.serveAs(t, admin, models.RoleAdmin, http.MethodDelete, userPath, ""); w.Code != http.StatusNotFound {
+		t.Errorf("deleting twice: status = %d, want 404", w.Code)
+	}
+
+	// The row is still there, so the address stays taken
+	if w := app.serve(http.MethodPost, "/api/v1/auth/register", "", `{"username":"other","email":"deleted@example.com","password":"password3"}`); w.Code != http.StatusConflict {
+		t.Errorf("registering a deleted user's email: status = %d, want 409", w.Code)
+	}
+
+	w := app.serveAs(t, admin, models.RoleAdmin, http.MethodPost, userPath+"/restore", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("restore: status %d: %s", w.Code, w.Body.String())
+	}
+	var restored struct {
+		Data models.UserResponse `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &restored); err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+	if restored.Data != deleted {
+		t.Errorf("restored = %+v, want %+v", restored.Data, deleted)
+	}
+
+	if got := listed(); len(got) != 2 {
+		t.Errorf("listed after restore = %v, want both users", got)
+	}
+	if w := app.serveAs(t, admin, models.RoleAdmin, http.MethodGet, userPath, ""); w.Code != http.StatusOK {
+		t.Errorf("get after restore: status = %d, want 200", w.Code)
+	}
+	if w := app.login("deleted@example.com", "password2"); w.Code != http.StatusOK {
+		t.Errorf("login after restore: status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	if w := app.serveAs(t, admin, models.RoleAdmin, http.MethodPost, "/api/v1/users/999/restore", ""); w.Code != http.StatusNotFound {
+		t.Errorf("restoring a missing user: status = %d, want 404", w.Code)
+	}
+}
+
+func TestGetUsersPagination(t *testing.T) {
+	app := newTestRoutes(t)
+	for i := 1; i <= 3; i++ {
+		app.register(t, fmt.Sprintf("user%d", i), fmt.Sprintf("user%d@example.com", i), "password1")
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		page       int
+		limit      int
+		totalPages int
+		users      int
+	}{
+		{"defaults", "", 1, 10, 1, 3},
+		{"zero limit", "?limit=0", 1, 1, 3, 1},
+		{"negative limit", "?limit=-5", 1, 1, 3, 1},
+		{"negative page", "?page=-2&limit=2", 1, 2, 2, 2},
+		{"oversized limit", "?limit=100000", 1, 100, 1, 3},
+		{"unparsable values", "?page=x&limit=y", 1, 10, 1, 3},
+		{"past the last page", "?page=5&limit=2", 5, 2, 2, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := app.serveAs(t, 1, models.RoleUser, http.MethodGet, "/api/v1/users"+tt.query, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", w.Code, w.Body.String())
+			}
+			var response struct {
+				Data struct {
+					Data       []models.UserResponse `json:"data"`
+					Total      int64                 `json:"total"`
+					Page       int                   `json:"page"`
+					Limit      int                   `json:"limit"`
+					TotalPages int                   `json:"total_pages"`
+				} `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("invalid body: %v", err)
+			}
+			got := response.Data
+			if got.Page != tt.page || got.Limit != tt.limit || got.TotalPages != tt.totalPages || got.Total != 3 {
+				t.Errorf("page %d, limit %d, total_pages %d, total %d; want %d, %d, %d, 3",
+					got.Page, got.Limit, got.TotalPages, got.Total, tt.page, tt.limit, tt.totalPages)
+			}
+			if len(got.Data) != tt.users || got.Data == nil {
+				t.Errorf("%d users (%v), want %d", len(got.Data), got.Data, tt.users)
+			}
+		})
+	}
+}
+
+func TestGetUserErrorStatus(t *testing.T) {
+	app := newTestRoutes(t)
+	user := app.register(t, "alice", "alice@example.com", "password123")
+	const admin = 100
+	userPath := fmt.Sprintf("/api/v1/users/%d", user.ID)
+
+	if w := app.serveAs(t, admin, models.RoleAdmin, http.MethodGet, userPath, ""); w.Code != http.StatusOK {
+		t.Fatalf("existing user: status = %d, want 200", w.Code)
+	}
+	if w := app.serveAs(t, admin, models.RoleAdmin, http.MethodGet, "/api/v1/users/999", ""); w.Code != http.StatusNotFound {
+		t.Errorf("missing user: status = %d, want 404", w.Code)
+	}
+
+	// A failing database is a server error, not a missing user
+	sqlDB, err := app.db.DB()
+	if err != nil {
+		t.Fatalf("db.DB: %v", err)
+	}
+	sqlDB.Close()
+	if w := app.serveAs(t, admin, models.RoleAdmin, http.MethodGet, userPath, ""); w.Code != http.StatusInternalServerError {
+		t.Errorf("database down: status = %d, want 500", w.Code)
+	}
+}
+
+func TestGetUsersBatch(t *testing.T) {
+	app := newTestRoutes(t)
+	alice := app.register(t, "alice", "alice@example.com", "password123")
+	const admin = 100
+
+	w := app.serveAs(t, admin, models.RoleAdmin, http.MethodGet, fmt.Sprintf("/api/v1/users/batch?ids=999,%d", alice.ID), "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	var response struct {
+		Data models.UserBatchResponse `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+	if len(response.Data.Users) != 1 || response.Data.Users[0].ID != alice.ID {
+		t.Errorf("users = %+v, want alice", response.Data.Users)
+	}
+	if len(response.Data.Missing) != 1 || response.Data.Missing[0] != 999 {
+		t.Errorf("missing = %v, want [999]", response.Data.Missing)
+	}
+
+	tooMany := make([]string, services.MaxBatchUserIDs+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprint(i + 1)
+	}
+	tests := []struct {
+		name   string
+		role   string
+		query  string
+		status int
+	}{
+		{"not an admin", models.RoleUser, "?ids=1", http.StatusForbidden},
+		{"no ids", models.RoleAdmin, "", http.StatusBadRequest},
+		{"invalid id", models.RoleAdmin, "?ids=1,x", http.StatusBadRequest},
+		{"too many ids", models.RoleAdmin, "?ids=" + strings.Join(tooMany, ","), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if w := app.serveAs(t, admin, tt.role, http.MethodGet, "/api/v1/users/batch"+tt.query, ""); w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.status)
+		}
+	}
+}
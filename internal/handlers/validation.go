@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// bindingError turns binding validation failures into field-specific
+// messages such as "password: must be at least 6 characters". Other errors
+// (malformed JSON, wrong types) are returned unchanged.
+func bindingError(err error) error {
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return err
+	}
+
+	messages := make([]string, 0, len(validationErrs))
+	for _, fe := range validationErrs {
+		messages = append(messages, strings.ToLower(fe.Field())+": "+fieldMessage(fe))
+	}
+	return errors.New(strings.Join(messages, "; "))
+}
+
+func fieldMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "min":
+		return fmt.Sprintf("must be at least %s characters", fe.Param())
+	case "max":
+		return fmt.Sprintf("must be at most %s characters", fe.Param())
+	case "oneof":
+		return "must be one of: " + fe.Param()
+	default:
+		return "is invalid"
+	}
+}
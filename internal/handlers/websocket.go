@@ -0,0 +1,430 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"my-go-backend/internal/middleware"
+	"my-go-backend/internal/services"
+	"my-go-backend/pkg/models"
+)
+
+// WebSocket timeouts
+const (
+	wsWriteTimeout = 5 * time.Second  // Control frame writes such as close
+	wsAuthTimeout  = 10 * time.Second // Wait for the "auth" message when no token was sent
+)
+
+// wsSession holds the state of one WebSocket connection. gorilla/websocket
+// allows a single concurrent writer, so every write goes through write().
+type wsSession struct {
+	conn         *websocket.Conn
+	subscriberID string
+	ctx          context.Context // Cancelled when the connection ends
+
+	writeMu sync.Mutex
+
+	mu     sync.RWMutex
+	paused bool            // Set by "unsubscribe"
+	coins  map[string]bool // Optional coin filter set by "subscribe"
+	types  map[string]bool // Update types set by "subscribe" (default: price)
+}
+
+func (s *wsSession) write(v interface{}) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return s.conn.WriteJSON(v)
+}
+
+func (s *wsSession) writeClose(code int, text string) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return s.conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(code, text),
+		time.Now().Add(wsWriteTimeout))
+}
+
+// wants reports whether an event should be forwarded to this client
+func (s *wsSession) wants(event models.StreamEvent) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if event.Type != "price_update" {
+		// Alerts, cache_cleared and other notices are always delivered
+		return true
+	}
+	if s.paused {
+		return false
+	}
+	update, ok := event.Data.(models.PriceUpdate)
+	if !ok || !s.types[update.UpdateType] {
+		return false
+	}
+	return len(s.coins) == 0 || s.coins[update.CoinID]
+}
+
+func (s *wsSession) subscribe(coins, types []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.paused = false
+	s.coins = nil
+	if len(coins) > 0 {
+		s.coins = make(map[string]bool, len(coins))
+		for _, coin := range coins {
+			s.coins[coin] = true
+		}
+	}
+	s.types = make(map[string]bool, len(types))
+	for _, updateType := range types {
+		s.types[updateType] = true
+	}
+}
+
+// subscribedCoins returns the coin filter set by "subscribe", if any
+func (s *wsSession) subscribedCoins() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	coins := make([]string, 0, len(s.coins))
+	for coin := range s.coins {
+		coins = append(coins, coin)
+	}
+	sort.Strings(coins)
+	return coins
+}
+
+func (s *wsSession) unsubscribe() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.paused = true
+	s.coins = nil
+}
+
+// serveWebSocket registers the connection as a subscriber, handles client
+// messages and forwards broadcast events until either side closes.
+func (h *CryptoHandler) serveWebSocket(conn *websocket.Conn, subscriberID string, userID uint) {
+	// Cancels in-flight snapshot fetches once the connection ends
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	session := &wsSession{
+		conn:         conn,
+		subscriberID: subscriberID,
+		ctx:          ctx,
+		types:        map[string]bool{models.UpdateTypePrice: true},
+	}
+
+	// Add subscriber, linked to the user for targeted events (price alerts)
+	eventChan, release := h.cryptoService.AddSubscriber(subscriberID, userID)
+	defer release()
+
+	// Handle client messages in separate goroutine
+	go h.readWebSocket(session)
+
+	// Send events to client. The channel is closed by RemoveSubscriber,
+	// either after a client "close" or when the connection drops, or by
+	// Shutdown when the server stops.
+	for event := range eventChan {
+		if !session.wants(event) {
+			continue
+		}
+		if err := session.write(event); err != nil {
+			log.Printf("WebSocket write error: %v", err)
+			return
+		}
+	}
+
+	// Tell clients to reconnect rather than leaving them with an abrupt EOF
+	select {
+	case <-h.cryptoService.Done():
+		if err := session.write(services.NewShutdownEvent()); err != nil {
+			log.Printf("Error sending shutdown event to %s: %v", subscriberID, err)
+		}
+		if err := session.writeClose(websocket.CloseGoingAway, "server shutting down"); err != nil {
+			log.Printf("Error sending shutdown close frame to %s: %v", subscriberID, err)
+		}
+	default:
+	}
+}
+
+func (h *CryptoHandler) readWebSocket(session *wsSession) {
+	subscriberID := session.subscriberID
+	defer func() {
+		// Ends the write loop as well
+		h.cryptoService.RemoveSubscriber(subscriberID)
+		log.Printf("WebSocket read goroutine ended for %s", subscriberID)
+	}()
+
+	for {
+		var msg models.WebSocketMessage
+		if err := session.conn.ReadJSON(&msg); err != nil {
+			log.Printf("WebSocket read error for %s: %v", subscriberID, err)
+			return
+		}
+
+		log.Printf("Received message from %s: %+v", subscriberID, msg)
+
+		var reply models.WebSocketMessage
+		switch msg.Action {
+		case "ping":
+			reply = models.WebSocketMessage{Action: "pong", Data: "Server is alive", ID: msg.ID}
+		case "subscribe":
+			coins, types, err := parseSubscription(msg.Data)
+			if err != nil {
+				reply = models.WebSocketMessage{Action: "error", Data: err.Error(), ID: msg.ID}
+				break
+			}
+			session.subscribe(coins, types)
+			reply = models.WebSocketMessage{Action: "subscribed", Data: gin.H{"subscriber_id": subscriberID, "coins": coins, "types": types}, ID: msg.ID}
+		case "snapshot":
+			coins, err := h.snapshotCoins(session, msg.Data)
+			if err != nil {
+				reply = models.WebSocketMessage{Action: "error", Data: err.Error(), ID: msg.ID}
+				break
+			}
+			// Fetch off the read loop so pings are still answered
+			go h.sendSnapshot(session, coins, msg.ID)
+			continue
+		case "auth":
+			reply = models.WebSocketMessage{Action: "error", Data: "Already authenticated", ID: msg.ID}
+		case "unsubscribe":
+			session.unsubscribe()
+			reply = models.WebSocketMessage{Action: "unsubscribed", Data: "Stopped receiving price updates", ID: msg.ID}
+		case "close":
+			if err := session.write(models.WebSocketMessage{Action: "closing", Data: "Closing connection", ID: msg.ID}); err != nil {
+				log.Printf("Error sending close acknowledgement: %v", err)
+			}
+			if err := session.writeClose(websocket.CloseNormalClosure, "client requested close"); err != nil {
+				log.Printf("Error sending close frame: %v", err)
+			}
+			return
+		default:
+			reply = models.WebSocketMessage{Action: "error", Data: "Unknown action: " + msg.Action, ID: msg.ID}
+		}
+
+		if err := session.write(reply); err != nil {
+			log.Printf("Error sending %s reply: %v", reply.Action, err)
+		}
+	}
+}
+
+// snapshotCoins picks the coins for a "snapshot": the ones in the message,
+// or else the connection's subscribed coins
+func (h *CryptoHandler) snapshotCoins(session *wsSession, data interface{}) ([]string, error) {
+	coins, _, err := parseSubscription(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(coins) == 0 {
+		coins = session.subscribedCoins()
+	}
+	if len(coins) == 0 {
+		return nil, services.ErrNoCoins
+	}
+	if len(coins) > h.maxBulkCoins {
+		return nil, fmt.Errorf("maximum %d coins allowed", h.maxBulkCoins)
+	}
+	return coins, nil
+}
+
+// sendSnapshot replies to one connection with current prices, served from
+// the cache where possible
+func (h *CryptoHandler) sendSnapshot(session *wsSession, coins []string, msgID string) {
+	portfolio, err := h.cryptoService.GetPortfolioRealtime(session.ctx, coins, services.PortfolioOptions{})
+	if err != nil {
+		if err := session.write(models.WebSocketMessage{Action: "error", Data: err.Error(), ID: msgID}); err != nil {
+			log.Printf("Error sending snapshot error: %v", err)
+		}
+		return
+	}
+
+	eventID := msgID
+	if eventID == "" {
+		eventID = uuid.New().String()
+	}
+	err = session.write(models.StreamEvent{
+		Type:      "snapshot",
+		Data:      portfolio,
+		Timestamp: time.Now(),
+		ID:        eventID,
+	})
+	if err != nil {
+		log.Printf("Error sending snapshot to %s: %v", session.subscriberID, err)
+	}
+}
+
+// parseSubscription accepts either ["bitcoin", ...] or
+// {"coins": ["bitcoin", ...], "types": ["price", "volume"]}. No coins means
+// all coins; no types means price updates only.
+func parseSubscription(data interface{}) ([]string, []string, error) {
+	var rawTypes interface{}
+	if m, ok := data.(map[string]interface{}); ok {
+		data = m["coins"]
+		rawTypes = m["types"]
+	}
+
+	types, err := services.ParseUpdateTypes(stringList(rawTypes))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	coins := stringList(data)
+	if len(coins) == 0 {
+		return nil, types, nil
+	}
+	coins, err = services.NormalizeCoinIDs(coins)
+	if err != nil {
+		return nil, nil, err
+	}
+	return coins, types, nil
+}
+
+// stringList converts a decoded JSON array to strings; non-strings become ""
+func stringList(data interface{}) []string {
+	items, ok := data.([]interface{})
+	if !ok {
+		return nil
+	}
+
+	list := make([]string, 0, len(items))
+	for _, item := range items {
+		value, _ := item.(string)
+		list = append(list, value)
+	}
+	return list
+}
+
+// WebSocketHandler - WebSocket endpoint
+func (h *CryptoHandler) WebSocketHandler(c *gin.Context) {
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade error: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	// Generate unique subscriber ID
+	subscriberID := uuid.New().String()
+	log.Printf("New WebSocket connection: %s", subscriberID)
+
+	h.serveWebSocket(conn, subscriberID, 0)
+}
+
+// WebSocketHandlerWithAuth - WebSocket endpoint with query param auth support.
+// Browsers can't set headers on WebSocket connections, so the token may come
+// from the "token" query param, the Authorization header, or a first
+// {"action": "auth", "data": {"token": "..."}} message. Connections that fail
+// authentication are closed with a policy violation (1008) close frame.
+func (h *CryptoHandler) WebSocketHandlerWithAuth(jwtConfig middleware.JWTConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Check for token in query parameter or Authorization header
+		tokenString := c.Query("token")
+		if tokenString == "" {
+			authHeader := c.GetHeader("Authorization")
+			if authHeader != "" {
+				tokenString = strings.TrimPrefix(authHeader, "Bearer ")
+			}
+		}
+
+		// Upgrade to WebSocket; auth failures are reported with a close
+		// frame, which browsers can read unlike a rejected handshake
+		conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			log.Printf("WebSocket upgrade error: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		// Without a token the first message must authenticate
+		authMsgID, viaMessage := "", tokenString == ""
+		if viaMessage {
+			tokenString, authMsgID, err = readAuthMessage(conn)
+			if err != nil {
+				rejectWebSocket(conn, err.Error())
+				return
+			}
+		}
+
+		// Validate JWT token
+		claims, err := middleware.ParseToken(tokenString, jwtConfig)
+		if err != nil {
+			rejectWebSocket(conn, "invalid token")
+			return
+		}
+		// Service tokens with the route's scope connect without a user
+		var uid uint
+		if middleware.IsServiceToken(claims) {
+			if !middleware.HasScope(claims, jwtConfig.ServiceScope) {
+				rejectWebSocket(conn, "insufficient scope")
+				return
+			}
+		} else {
+			id, ok := claimToUserID(claims["user_id"])
+			if !ok {
+				rejectWebSocket(conn, "invalid user in token")
+				return
+			}
+			uid = id
+		}
+
+		// Generate unique subscriber ID
+		subscriberID := uuid.New().String()
+		log.Printf("New authenticated WebSocket connection: %s (user: %d)", subscriberID, uid)
+
+		if viaMessage {
+			reply := models.WebSocketMessage{Action: "authenticated", Data: gin.H{"subscriber_id": subscriberID, "user_id": uid}, ID: authMsgID}
+			if err := conn.WriteJSON(reply); err != nil {
+				log.Printf("Error sending authenticated reply: %v", err)
+				return
+			}
+		}
+
+		h.serveWebSocket(conn, subscriberID, uid)
+	}
+}
+
+// readAuthMessage waits up to wsAuthTimeout for an "auth" message and
+// returns its token and message id. data may be the token itself or
+// {"token": "..."}.
+func readAuthMessage(conn *websocket.Conn) (string, string, error) {
+	conn.SetReadDeadline(time.Now().Add(wsAuthTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	var msg models.WebSocketMessage
+	if err := conn.ReadJSON(&msg); err != nil {
+		return "", "", errors.New("authentication required")
+	}
+	if msg.Action != "auth" {
+		return "", "", errors.New("first message must be auth")
+	}
+
+	token, _ := msg.Data.(string)
+	if m, ok := msg.Data.(map[string]interface{}); ok {
+		token, _ = m["token"].(string)
+	}
+	if token == "" {
+		return "", "", errors.New("token required")
+	}
+	return token, msg.ID, nil
+}
+
+// rejectWebSocket closes a connection that failed authentication
+func rejectWebSocket(conn *websocket.Conn, reason string) {
+	err := conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason),
+		time.Now().Add(wsWriteTimeout))
+	if err != nil {
+		log.Printf("Error sending WebSocket close frame: %v", err)
+	}
+}
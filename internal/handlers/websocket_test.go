@@ -0,0 +1,367 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"my-go-backend/configs"
+	"my-go-backend/internal/middleware"
+	"my-go-backend/internal/services"
+	"my-go-backend/pkg/models"
+)
+
+// newTestWebSocketServer serves WebSocketHandlerWithAuth at /ws and returns
+// its ws:// URL
+func newTestWebSocketServer(t *testing.T, svc *services.CryptoService) (string, *configs.Config) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	config := newTestConfig(t)
+	h := NewCryptoHandler(svc, nil, 10, nil, WebSocketOptions{})
+
+	router := gin.New()
+	router.GET("/ws", h.WebSocketHandlerWithAuth(middleware.JWTConfig{
+		Secret:   config.JWTSecret,
+		Issuer:   config.JWTIssuer,
+		Audience: config.JWTAudience,
+	}))
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http") + "/ws", config
+}
+
+func dialWebSocket(t *testing.T, url string) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dialing %s: %v", url, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+// readCloseCode reads until the server's close frame and returns its code
+func readCloseCode(t *testing.T, conn *websocket.Conn) int {
+	t.Helper()
+	for {
+		_, _, err := conn.ReadMessage()
+		var closeErr *websocket.CloseError
+		if errors.As(err, &closeErr) {
+			return closeErr.Code
+		}
+		if err != nil {
+			t.Fatalf("connection ended without a close frame: %v", err)
+		}
+	}
+}
+
+func TestWebSocketAuth(t *testing.T) {
+	url, config := newTestWebSocketServer(t, newTestCryptoService(t, newFakeCoinGecko(map[string]float64{})))
+	token := signTestToken(t, config, 7, models.RoleUser)
+
+	t.Run("token in query", func(t *testing.T) {
+		conn := dialWebSocket(t, url+"?token="+token)
+		if err := conn.WriteJSON(models.WebSocketMessage{Action: "ping", ID: "1"}); err != nil {
+			t.Fatalf("sending ping: %v", err)
+		}
+		var reply models.WebSocketMessage
+		if err := conn.ReadJSON(&reply); err != nil || reply.Action != "pong" || reply.ID != "1" {
+			t.Fatalf("reply = %+v (%v), want pong 1", reply, err)
+		}
+	})
+
+	t.Run("first message auth", func(t *testing.T) {
+		conn := dialWebSocket(t, url)
+		if err := conn.WriteJSON(models.WebSocketMessage{Action: "auth", Data: map[string]string{"token": token}, ID: "a"}); err != nil {
+			t.Fatalf("sending auth: %v", err)
+		}
+		var reply struct {
+			Action string `json:"action"`
+			ID     string `json:"id"`
+			Data   struct {
+				UserID uint `json:"user_id"`
+			} `json:"data"`
+		}
+		if err := conn.ReadJSON(&reply); err != nil {
+			t.Fatalf("reading reply: %v", err)
+		}
+		if reply.Action != "authenticated" || reply.ID != "a" || reply.Data.UserID != 7 {
+			t.Errorf("reply = %+v, want authenticated as user 7", reply)
+		}
+
+		// Authenticating twice is refused, but the connection stays open
+		conn.WriteJSON(models.WebSocketMessage{Action: "auth", Data: token})
+		var again models.WebSocketMessage
+		if err := conn.ReadJSON(&again); err != nil || again.Action != "error" {
+			t.Errorf("second auth: reply = %+v (%v), want an error", again, err)
+		}
+	})
+
+	rejected := []struct {
+		name  string
+		query string
+		first *models.WebSocketMessage // Sent after connecting, if set
+	}{
+		{"invalid token in query", "?token=not-a-jwt", nil},
+		{"token signed with another secret", "?token=" + signTestToken(t, &configs.Config{JWTSecret: "other", JWTIssuer: config.JWTIssuer, JWTAudience: config.JWTAudience}, 7, models.RoleUser), nil},
+		{"first message isn't auth", "", &models.WebSocketMessage{Action: "ping"}},
+		{"auth without a token", "", &models.WebSocketMessage{Action: "auth"}},
+		{"auth with an invalid token", "", &models.WebSocketMessage{Action: "auth", Data: "not-a-jwt"}},
+	}
+	for _, tt := range rejected {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := dialWebSocket(t, url+tt.query)
+			if tt.first != nil {
+				if err := conn.WriteJSON(tt.first); err != nil {
+					t.Fatalf("sending first message: %v", err)
+				}
+			}
+			if code := readCloseCode(t, conn); code != websocket.ClosePolicyViolation {
+				t.Errorf("close code = %d, want %d", code, websocket.ClosePolicyViolation)
+			}
+		})
+	}
+}
+
+func TestWebSocketShutdownCloseFrame(t *testing.T) {
+	svc := newTestCryptoService(t, newFakeCoinGecko(map[string]float64{}))
+	url, config := newTestWebSocketServer(t, svc)
+	conn := dialWebSocket(t, url+"?token="+signTestToken(t, config, 7, models.RoleUser))
+
+	// A ping round trip makes sure the subscriber is registered
+	conn.WriteJSON(models.WebSocketMessage{Action: "ping"})
+	var pong models.WebSocketMessage
+	if err := conn.ReadJSON(&pong); err != nil || pong.Action != "pong" {
+		t.Fatalf("ping: reply = %+v (%v), want pong", pong, err)
+	}
+
+	svc.Shutdown()
+
+	var event struct {
+		Type string           `json:"type"`
+		Data models.StreamEnd `json:"data"`
+	}
+	if err := conn.ReadJSON(&event); err != nil {
+		t.Fatalf("reading shutdown event: %v", err)
+	}
+	if event.Type != "shutdown" || event.Data.Reason != models.StreamEndShutdown {
+		t.Errorf("event = %+v, want a shutdown notice", event)
+	}
+	if code := readCloseCode(t, conn); code != websocket.CloseGoingAway {
+		t.Errorf("close code = %d, want %d (going away)", code, websocket.CloseGoingAway)
+	}
+
+	// The handler released its subscriber, so shutdown isn't kept waiting
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := svc.WaitForSubscribers(ctx); err != nil {
+		t.Errorf("WaitForSubscribers: %v", err)
+	}
+
+	// New connections after shutdown are closed straight away
+	late := dialWebSocket(t, url+"?token="+signTestToken(t, config, 7, models.RoleUser))
+	if code := readCloseCode(t, late); code != websocket.CloseGoingAway {
+		t.Errorf("connection after shutdown: close code = %d, want %d", code, websocket.CloseGoingAway)
+	}
+}
+
+// wsFrame is any message the server sends: a reply has an action, an event
+// a type
+type wsFrame struct {
+	Action string          `json:"action"`
+	Type   string          `json:"type"`
+	ID     string          `json:"id"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// openWebSocket connects as user 7 and waits until the subscriber is
+// registered
+func openWebSocket(t *testing.T, url string, config *configs.Config) *websocket.Conn {
+	t.Helper()
+	conn := dialWebSocket(t, url+"?token="+signTestToken(t, config, 7, models.RoleUser))
+	if reply := sendWebSocket(t, conn, models.WebSocketMessage{Action: "ping"}); reply.Action != "pong" {
+		t.Fatalf("ping: reply = %+v, want pong", reply)
+	}
+	return conn
+}
+
+// sendWebSocket sends msg and returns the next frame
+func sendWebSocket(t *testing.T, conn *websocket.Conn, msg models.WebSocketMessage) wsFrame {
+	t.Helper()
+	if err := conn.WriteJSON(msg); err != nil {
+		t.Fatalf("sending %s: %v", msg.Action, err)
+	}
+	return readWebSocket(t, conn)
+}
+
+func readWebSocket(t *testing.T, conn *websocket.Conn) wsFrame {
+	t.Helper()
+	var frame wsFrame
+	if err := conn.ReadJSON(&frame); err != nil {
+		t.Fatalf("reading: %v", err)
+	}
+	return frame
+}
+
+func priceUpdateEvent(coinID string) models.StreamEvent {
+	return models.StreamEvent{
+		Type:      "price_update",
+		Data:      models.PriceUpdate{CoinID: coinID, Price: 1, UpdateType: models.UpdateTypePrice},
+		Timestamp: time.Now(),
+	}
+}
+
+func TestWebSocketUnsubscribe(t *testing.T) {
+	svc := newTestCryptoService(t, newFakeCoinGecko(map[string]float64{}))
+	url, config := newTestWebSocketServer(t, svc)
+	conn := openWebSocket(t, url, config)
+
+	svc.BroadcastToSubscribers(priceUpdateEvent("bitcoin"))
+	if frame := readWebSocket(t, conn); frame.Type != "price_update" {
+		t.Fatalf("before unsubscribing: frame = %+v, want a price update", frame)
+	}
+
+	if reply := sendWebSocket(t, conn, models.WebSocketMessage{Action: "unsubscribe", ID: "u"}); reply.Action != "unsubscribed" || reply.ID != "u" {
+		t.Fatalf("unsubscribe: reply = %+v, want unsubscribed", reply)
+	}
+
+	// Price updates stop; other notices still arrive
+	svc.BroadcastToSubscribers(priceUpdateEvent("bitcoin"))
+	svc.BroadcastToSubscribers(models.StreamEvent{Type: "cache_cleared", Timestamp: time.Now()})
+	if frame := readWebSocket(t, conn); frame.Type != "cache_cleared" {
+		t.Errorf("after unsubscribing: frame = %+v, want the cache notice without the price update", frame)
+	}
+
+	// Subscribing again resumes them
+	if reply := sendWebSocket(t, conn, models.WebSocketMessage{Action: "subscribe", Data: []string{"bitcoin"}}); reply.Action != "subscribed" {
+		t.Fatalf("subscribe: reply = %+v, want subscribed", reply)
+	}
+	svc.BroadcastToSubscribers(priceUpdateEvent("ethereum"))
+	svc.BroadcastToSubscribers(priceUpdateEvent("bitcoin"))
+	frame := readWebSocket(t, conn)
+	var update models.PriceUpdate
+	json.Unmarshal(frame.Data, &update)
+	if frame.Type != "price_update" || update.CoinID != "bitcoin" {
+		t.Errorf("after subscribing to bitcoin: frame = %+v, want its price update only", frame)
+	}
+}
+
+func TestWebSocketCloseAction(t *testing.T) {
+	svc := newTestCryptoService(t, newFakeCoinGecko(map[string]float64{}))
+	url, config := newTestWebSocketServer(t, svc)
+	conn := openWebSocket(t, url, config)
+
+	if reply := sendWebSocket(t, conn, models.WebSocketMessage{Action: "close", ID: "c"}); reply.Action != "closing" || reply.ID != "c" {
+		t.Fatalf("close: reply = %+v, want closing", reply)
+	}
+	if code := readCloseCode(t, conn); code != websocket.CloseNormalClosure {
+		t.Errorf("close code = %d, want %d", code, websocket.CloseNormalClosure)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := svc.WaitForSubscribers(ctx); err != nil {
+		t.Errorf("subscriber not removed after close: %v", err)
+	}
+}
+
+func TestWebSocketSnapshot(t *testing.T) {
+	svc := newTestCryptoService(t, newFakeCoinGecko(map[string]float64{"bitcoin": 50000, "ethereum": 3000}))
+	url, config := newTestWebSocketServer(t, svc)
+	conn := openWebSocket(t, url, config)
+
+	snapshot := func(msg models.WebSocketMessage) (wsFrame, models.PortfolioResponse) {
+		t.Helper()
+		// Answered straight away, not at the next broadcast
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		frame := sendWebSocket(t, conn, msg)
+		var portfolio models.PortfolioResponse
+		if frame.Type == "snapshot" {
+			if err := json.Unmarshal(frame.Data, &portfolio); err != nil {
+				t.Fatalf("invalid snapshot: %v", err)
+			}
+		}
+		return frame, portfolio
+	}
+
+	if frame, _ := snapshot(models.WebSocketMessage{Action: "snapshot", ID: "s0"}); frame.Action != "error" || frame.ID != "s0" {
+		t.Errorf("no coins and no subscription: frame = %+v, want an error", frame)
+	}
+
+	frame, portfolio := snapshot(models.WebSocketMessage{Action: "snapshot", Data: []string{"bitcoin", "ethereum"}, ID: "s1"})
+	if frame.Type != "snapshot" || frame.ID != "s1" {
+		t.Fatalf("frame = %+v, want snapshot s1", frame)
+	}
+	if len(portfolio.Portfolio) != 2 || portfolio.Portfolio[0].Price != 50000 || portfolio.Portfolio[1].Price != 3000 {
+		t.Errorf("snapshot = %+v, want bitcoin and ethereum prices", portfolio.Portfolio)
+	}
+
+	// Without coins, the subscribed ones are sent
+	if reply := sendWebSocket(t, conn, models.WebSocketMessage{Action: "subscribe", Data: []string{"ethereum"}}); reply.Action != "subscribed" {
+		t.Fatalf("subscribe: reply = %+v", reply)
+	}
+	frame, portfolio = snapshot(models.WebSocketMessage{Action: "snapshot", ID: "s2"})
+	if frame.Type != "snapshot" || len(portfolio.Portfolio) != 1 || portfolio.Portfolio[0].ID != "ethereum" {
+		t.Errorf("snapshot of subscribed coins: frame %+v, portfolio %+v; want ethereum", frame, portfolio.Portfolio)
+	}
+}
+
+func TestWebSocketCompression(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	config := newTestConfig(t)
+	svc := newTestCryptoService(t, newFakeCoinGecko(map[string]float64{}))
+	token := signTestToken(t, config, 7, models.RoleUser)
+
+	tests := []struct {
+		name           string
+		server, client bool // Compression enabled on each side
+		negotiated     bool
+	}{
+		{"both enabled", true, true, true},
+		{"server disabled", false, true, false},
+		{"client without compression", true, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewCryptoHandler(svc, nil, 10, nil, WebSocketOptions{ReadBufferSize: 512, WriteBufferSize: 512, Compression: tt.server})
+			router := gin.New()
+			router.GET("/ws", h.WebSocketHandlerWithAuth(middleware.JWTConfig{
+				Secret:   config.JWTSecret,
+				Issuer:   config.JWTIssuer,
+				Audience: config.JWTAudience,
+			}))
+			server := httptest.NewServer(router)
+			defer server.Close()
+
+			dialer := websocket.Dialer{EnableCompression: tt.client}
+			url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?token=" + token
+			conn, resp, err := dialer.Dial(url, nil)
+			if err != nil {
+				t.Fatalf("dialing: %v", err)
+			}
+			defer conn.Close()
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+			extensions := resp.Header.Get("Sec-WebSocket-Extensions")
+			if got := strings.Contains(extensions, "permessage-deflate"); got != tt.negotiated {
+				t.Errorf("Sec-WebSocket-Extensions = %q, want permessage-deflate negotiated = %v", extensions, tt.negotiated)
+			}
+
+			// Messages flow either way
+			if err := conn.WriteJSON(models.WebSocketMessage{Action: "ping", ID: "1"}); err != nil {
+				t.Fatalf("sending ping: %v", err)
+			}
+			var reply models.WebSocketMessage
+			if err := conn.ReadJSON(&reply); err != nil || reply.Action != "pong" {
+				t.Errorf("reply = %+v (%v), want pong", reply, err)
+			}
+		})
+	}
+}
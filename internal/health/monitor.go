@@ -0,0 +1,119 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	errNotChecked   = errors.New("database not checked yet")
+	errShuttingDown = errors.New("server is shutting down")
+)
+
+// Monitor pings a dependency in the background and keeps the result, so
+// readiness probes are answered from memory instead of each adding a ping.
+type Monitor struct {
+	ping     func(ctx context.Context) error
+	interval time.Duration
+	timeout  time.Duration
+
+	ready atomic.Bool
+
+	mu          sync.RWMutex
+	lastSuccess time.Time // Zero until the first successful ping
+	lastErr     error
+}
+
+// Status is a snapshot of a Monitor
+type Status struct {
+	Ready       bool
+	LastSuccess time.Time
+	Err         error // Why the last ping failed; nil when Ready
+}
+
+// NewMonitor checks ping every interval, allowing timeout per ping. It
+// reports not ready until Run has completed a successful ping.
+func NewMonitor(ping func(ctx context.Context) error, interval, timeout time.Duration) *Monitor {
+	return &Monitor{
+		ping:     ping,
+		interval: interval,
+		timeout:  timeout,
+		lastErr:  errNotChecked,
+	}
+}
+
+// PingDB returns a ping function for db's connection pool
+func PingDB(db *gorm.DB) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.PingContext(ctx)
+	}
+}
+
+// Run pings straight away and then every interval until ctx is cancelled,
+// after which the monitor reports not ready so load balancers stop sending
+// traffic during shutdown
+func (m *Monitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	m.check(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			m.record(errShuttingDown)
+			return
+		case <-ticker.C:
+			m.check(ctx)
+		}
+	}
+}
+
+func (m *Monitor) check(ctx context.Context) {
+	pingCtx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	err := m.ping(pingCtx)
+	if ctx.Err() != nil {
+		return // Shutting down; Run records that
+	}
+	m.record(err)
+}
+
+func (m *Monitor) record(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wasReady := m.ready.Load()
+	if err == nil {
+		m.lastSuccess = time.Now()
+		if !wasReady {
+			log.Println("Database is reachable, reporting ready")
+		}
+	} else if wasReady {
+		log.Printf("Reporting not ready: %v", err)
+	}
+	m.lastErr = err
+	m.ready.Store(err == nil)
+}
+
+// Status returns the latest result and when a ping last succeeded
+func (m *Monitor) Status() Status {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return Status{
+		Ready:       m.ready.Load(),
+		LastSuccess: m.lastSuccess,
+		Err:         m.lastErr,
+	}
+}
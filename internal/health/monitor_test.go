@@ -0,0 +1,86 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMonitor(t *testing.T) {
+	var failing atomic.Bool
+	var pings atomic.Int32
+	dbErr := errors.New("connection refused")
+	ping := func(ctx context.Context) error {
+		pings.Add(1)
+		if failing.Load() {
+			return dbErr
+		}
+		return nil
+	}
+	m := NewMonitor(ping, 5*time.Millisecond, time.Second)
+
+	if status := m.Status(); status.Ready || !status.LastSuccess.IsZero() || !errors.Is(status.Err, errNotChecked) {
+		t.Errorf("before Run: status = %+v, want not ready and unchecked", status)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		m.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// waitFor polls until the monitor reports ready
+	waitFor := func(ready bool) Status {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			status := m.Status()
+			if status.Ready == ready {
+				return status
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("ready = %v after 2s, want %v", status.Ready, ready)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	up := waitFor(true)
+	if up.Err != nil || up.LastSuccess.IsZero() {
+		t.Errorf("healthy: status = %+v, want no error and a last success", up)
+	}
+
+	failing.Store(true)
+	down := waitFor(false)
+	if !errors.Is(down.Err, dbErr) {
+		t.Errorf("failing: error = %v, want the ping error", down.Err)
+	}
+	if down.LastSuccess.Before(up.LastSuccess) {
+		t.Errorf("failing: last success %v went back from %v", down.LastSuccess, up.LastSuccess)
+	}
+
+	// Reads come from memory, not a ping each
+	before := pings.Load()
+	for i := 0; i < 100; i++ {
+		m.Status()
+	}
+	if got := pings.Load() - before; got > 5 {
+		t.Errorf("100 status reads made %d pings, want them independent", got)
+	}
+
+	failing.Store(false)
+	waitFor(true)
+
+	cancel()
+	<-done
+	if status := m.Status(); status.Ready || !errors.Is(status.Err, errShuttingDown) {
+		t.Errorf("after shutdown: status = %+v, want not ready while shutting down", status)
+	}
+}
@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// HTTPRequests counts requests by route pattern (not raw path) to keep cardinality bounded
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Total HTTP requests by method, route and status.",
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by method and route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	// CoinGeckoRequests counts upstream calls by result ("success", "error")
+	CoinGeckoRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "coingecko_requests_total",
+		Help: "Total CoinGecko API calls by result.",
+	}, []string{"result"})
+
+	CacheHits = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "crypto_cache_hits_total",
+		Help: "Total crypto cache hits.",
+	})
+
+	CacheMisses = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "crypto_cache_misses_total",
+		Help: "Total crypto cache misses.",
+	})
+
+	Subscribers = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "websocket_subscribers",
+		Help: "Current number of WebSocket subscribers.",
+	})
+
+	Streams = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "http_streams",
+		Help: "Current number of open SSE and NDJSON streams.",
+	})
+)
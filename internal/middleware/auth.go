@@ -1,46 +1,161 @@
 package middleware
 
 import (
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"my-go-backend/internal/respond"
+	"my-go-backend/pkg/models"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
 )
 
-func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
+// JWTConfig holds what's needed to verify tokens issued by AuthService
+type JWTConfig struct {
+	Secret   string
+	Issuer   string
+	Audience string
+
+	// Scope a service token must carry to be accepted; with none, only
+	// user tokens are
+	ServiceScope string
+}
+
+// WithServiceScope returns a copy of cfg that accepts service tokens with scope
+func (cfg JWTConfig) WithServiceScope(scope string) JWTConfig {
+	cfg.ServiceScope = scope
+	return cfg
+}
+
+// signingMethod is the only algorithm AuthService signs with. Tokens using
+// anything else (e.g. "none", or RS256 with the secret as a public key) are
+// rejected before the key is handed out.
+var signingMethod = jwt.SigningMethodHS256
+
+// refreshTokenType is the "typ" claim of refresh tokens, which may only be
+// exchanged at /auth/refresh and never authorize a request
+const refreshTokenType = "refresh"
+
+// ParseToken verifies a token's algorithm, signature, expiry, issuer and
+// audience, rejects refresh tokens, and returns its claims
+func ParseToken(tokenString string, cfg JWTConfig) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if token.Method.Alg() != signingMethod.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(cfg.Secret), nil
+	},
+		jwt.WithValidMethods([]string{signingMethod.Alg()}),
+		jwt.WithIssuer(cfg.Issuer),
+		jwt.WithAudience(cfg.Audience),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid token claims")
+	}
+	if claims["typ"] == refreshTokenType {
+		return nil, errors.New("refresh tokens cannot authorize requests")
+	}
+	return claims, nil
+}
+
+// IsServiceToken reports whether claims belong to a service client rather than a user
+func IsServiceToken(claims jwt.MapClaims) bool {
+	return claims["role"] == models.RoleService
+}
+
+// HasScope reports whether a service token's space-separated "scope" claim
+// includes scope. An empty scope is never granted.
+func HasScope(claims jwt.MapClaims, scope string) bool {
+	granted, _ := claims["scope"].(string)
+	return scope != "" && slices.Contains(strings.Fields(granted), scope)
+}
+
+func AuthMiddleware(cfg JWTConfig) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
-			c.Abort()
+			respond.Abort(c, http.StatusUnauthorized, "Authorization header required", errMissingAuthHeader)
 			return
 		}
 
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 		if tokenString == authHeader {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Bearer token required"})
-			c.Abort()
+			respond.Abort(c, http.StatusUnauthorized, "Bearer token required", errBearerRequired)
 			return
 		}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return []byte(jwtSecret), nil
-		})
-
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-			c.Abort()
+		claims, err := ParseToken(tokenString, cfg)
+		if err != nil {
+			respond.Abort(c, http.StatusUnauthorized, "Invalid token", errInvalidToken)
 			return
 		}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
-			c.Abort()
+		// Service tokens have no user; they're allowed by scope instead
+		if IsServiceToken(claims) {
+			if !HasScope(claims, cfg.ServiceScope) {
+				respond.Abort(c, http.StatusForbidden, "Insufficient scope", errInsufficientScope)
+				return
+			}
+			c.Set("client_id", claims["client_id"])
+			c.Set("role", claims["role"])
+			c.Next()
 			return
 		}
 
 		c.Set("user_id", claims["user_id"])
+		c.Set("role", claims["role"])
 		c.Next()
 	}
 }
+
+// RequireRole allows the request only if AuthMiddleware stored one of the given roles
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, _ := c.Get("role")
+		roleStr, _ := role.(string)
+
+		for _, allowed := range roles {
+			if roleStr == allowed {
+				c.Next()
+				return
+			}
+		}
+
+		respond.Abort(c, http.StatusForbidden, "Insufficient permissions", errInsufficientRole)
+	}
+}
+
+// RequireSelfOrRole allows the request if the user id in the path parameter
+// param is the caller's own, or if AuthMiddleware stored one of the given roles
+func RequireSelfOrRole(param string, roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, _ := c.Get("role")
+		roleStr, _ := role.(string)
+		if slices.Contains(roles, roleStr) {
+			c.Next()
+			return
+		}
+
+		userID, _ := c.Get("user_id")
+		id, ok := userID.(float64)
+		pathID, err := strconv.ParseUint(c.Param(param), 10, 64)
+		if ok && err == nil && id > 0 && uint64(id) == pathID {
+			c.Next()
+			return
+		}
+
+		respond.Abort(c, http.StatusForbidden, "Insufficient permissions", errInsufficientRole)
+	}
+}
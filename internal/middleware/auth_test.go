@@ -0,0 +1,348 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"my-go-backend/pkg/models"
+)
+
+var testJWTConfig = JWTConfig{
+	Secret:   "test-secret",
+	Issuer:   "test-issuer",
+	Audience: "test-audience",
+}
+
+// validClaims are the claims AuthService puts in an access token
+func validClaims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"user_id": float64(1),
+		"role":    "user",
+		"typ":     "access",
+		"iss":     testJWTConfig.Issuer,
+		"aud":     testJWTConfig.Audience,
+		"iat":     now.Unix(),
+		"nbf":     now.Unix(),
+		"exp":     now.Add(time.Hour).Unix(),
+	}
+}
+
+// withClaims returns validClaims with some claims replaced
+func withClaims(changes jwt.MapClaims) jwt.MapClaims {
+	claims := validClaims()
+	for name, value := range changes {
+		claims[name] = value
+	}
+	return claims
+}
+
+// errorCode returns the code of an APIResponse error body
+func errorCode(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var response models.APIResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid body %q: %v", w.Body.String(), err)
+	}
+	if response.Success {
+		t.Errorf("success = true on an error response")
+	}
+	return response.Code
+}
+
+func signHS256(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testJWTConfig.Secret))
+	if err != nil {
+		t.Fatalf("signing token: %v", err)
+	}
+	return signed
+}
+
+func TestParseToken(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating RSA key: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		token   func(t *testing.T) string
+		wantErr bool
+	}{
+		{
+			name:  "valid HS256 token",
+			token: func(t *testing.T) string { return signHS256(t, validClaims()) },
+		},
+		{
+			name: "alg none",
+			token: func(t *testing.T) string {
+				signed, err := jwt.NewWithClaims(jwt.SigningMethodNone, validClaims()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+				if err != nil {
+					t.Fatalf("signing token: %v", err)
+				}
+				return signed
+			},
+			wantErr: true,
+		},
+		{
+			name: "HS384 with the right secret",
+			token: func(t *testing.T) string {
+				signed, err := jwt.NewWithClaims(jwt.SigningMethodHS384, validClaims()).SignedString([]byte(testJWTConfig.Secret))
+				if err != nil {
+					t.Fatalf("signing token: %v", err)
+				}
+				return signed
+			},
+			wantErr: true,
+		},
+		{
+			name: "RS256",
+			token: func(t *testing.T) string {
+				signed, err := jwt.NewWithClaims(jwt.SigningMethodRS256, validClaims()).SignedString(rsaKey)
+				if err != nil {
+					t.Fatalf("signing token: %v", err)
+				}
+				return signed
+			},
+			wantErr: true,
+		},
+		{
+			name: "wrong secret",
+			token: func(t *testing.T) string {
+				signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims()).SignedString([]byte("other-secret"))
+				if err != nil {
+					t.Fatalf("signing token: %v", err)
+				}
+				return signed
+			},
+			wantErr: true,
+		},
+		{
+			name: "expired",
+			token: func(t *testing.T) string {
+				return signHS256(t, withClaims(jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()}))
+			},
+			wantErr: true,
+		},
+		{
+			name: "nbf in the future",
+			token: func(t *testing.T) string {
+				return signHS256(t, withClaims(jwt.MapClaims{"nbf": time.Now().Add(time.Hour).Unix()}))
+			},
+			wantErr: true,
+		},
+		{
+			name: "wrong issuer",
+			token: func(t *testing.T) string {
+				return signHS256(t, withClaims(jwt.MapClaims{"iss": "other-service"}))
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing issuer",
+			token: func(t *testing.T) string {
+				claims := validClaims()
+				delete(claims, "iss")
+				return signHS256(t, claims)
+			},
+			wantErr: true,
+		},
+		{
+			name: "wrong audience",
+			token: func(t *testing.T) string {
+				return signHS256(t, withClaims(jwt.MapClaims{"aud": "other-api"}))
+			},
+			wantErr: true,
+		},
+		{
+			name: "audience list including ours",
+			token: func(t *testing.T) string {
+				return signHS256(t, withClaims(jwt.MapClaims{"aud": []string{"other-api", testJWTConfig.Audience}}))
+			},
+		},
+		{
+			name: "refresh token",
+			token: func(t *testing.T) string {
+				return signHS256(t, withClaims(jwt.MapClaims{"typ": refreshTokenType}))
+			},
+			wantErr: true,
+		},
+		{
+			name:    "malformed",
+			token:   func(t *testing.T) string { return "not.a.token" },
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := ParseToken(tt.token(t), testJWTConfig)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseToken accepted the token, claims %v", claims)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseToken: %v", err)
+			}
+			if claims["user_id"] != float64(1) {
+				t.Errorf("user_id = %v, want 1", claims["user_id"])
+			}
+		})
+	}
+}
+
+func TestAuthMiddlewareRejectsForgedAlgorithms(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.GET("/protected", AuthMiddleware(testJWTConfig), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	none, err := jwt.NewWithClaims(jwt.SigningMethodNone, validClaims()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatalf("signing token: %v", err)
+	}
+	hs384, err := jwt.NewWithClaims(jwt.SigningMethodHS384, validClaims()).SignedString([]byte(testJWTConfig.Secret))
+	if err != nil {
+		t.Fatalf("signing token: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"alg none", none, http.StatusUnauthorized},
+		{"HS384", hs384, http.StatusUnauthorized},
+		{"valid", signHS256(t, validClaims()), http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+		})
+	}
+}
+
+func TestAuthErrorCodes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.GET("/protected", AuthMiddleware(testJWTConfig.WithServiceScope("prices:read")), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	router.GET("/admin", AuthMiddleware(testJWTConfig), RequireRole(models.RoleAdmin), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	service := func(scope string) string {
+		return signHS256(t, withClaims(jwt.MapClaims{"user_id": nil, "role": models.RoleService, "client_id": "reporting", "scope": scope}))
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		header string
+		status int
+		code   string
+	}{
+		{"no header", "/protected", "", http.StatusUnauthorized, models.CodeUnauthorized},
+		{"not a bearer token", "/protected", "Basic dXNlcjpwYXNz", http.StatusUnauthorized, models.CodeUnauthorized},
+		{"invalid token", "/protected", "Bearer not-a-jwt", http.StatusUnauthorized, models.CodeUnauthorized},
+		{"expired token", "/protected", "Bearer " + signHS256(t, withClaims(jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()})), http.StatusUnauthorized, models.CodeUnauthorized},
+		{"service token without the scope", "/protected", "Bearer " + service("other:read"), http.StatusForbidden, models.CodeForbidden},
+		{"service token with the scope", "/protected", "Bearer " + service("prices:read"), http.StatusOK, ""},
+		{"user on an admin route", "/admin", "Bearer " + signHS256(t, validClaims()), http.StatusForbidden, models.CodeForbidden},
+		{"admin on an admin route", "/admin", "Bearer " + signHS256(t, withClaims(jwt.MapClaims{"role": models.RoleAdmin})), http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if tt.code == "" {
+				return
+			}
+			if got := errorCode(t, w); got != tt.code {
+				t.Errorf("code = %q, want %q", got, tt.code)
+			}
+		})
+	}
+}
+
+func TestRequireSelfOrRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		// Stand-in for AuthMiddleware
+		if c.GetHeader("X-Test-User") != "" {
+			c.Set("user_id", float64(7))
+		}
+		c.Set("role", c.GetHeader("X-Test-Role"))
+		c.Next()
+	})
+	router.PUT("/users/:id", RequireSelfOrRole("id", models.RoleAdmin), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name   string
+		path   string
+		user   bool
+		role   string
+		status int
+	}{
+		{"own id", "/users/7", true, models.RoleUser, http.StatusOK},
+		{"own id with a leading zero", "/users/07", true, models.RoleUser, http.StatusOK},
+		{"another id", "/users/8", true, models.RoleUser, http.StatusForbidden},
+		{"not a number", "/users/seven", true, models.RoleUser, http.StatusForbidden},
+		{"admin on another id", "/users/8", true, models.RoleAdmin, http.StatusOK},
+		{"no user id", "/users/7", false, models.RoleService, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, tt.path, nil)
+			if tt.user {
+				req.Header.Set("X-Test-User", "7")
+			}
+			req.Header.Set("X-Test-Role", tt.role)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.status == http.StatusForbidden && errorCode(t, w) != models.CodeForbidden {
+				t.Errorf("code = %q, want %q", errorCode(t, w), models.CodeForbidden)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"my-go-backend/internal/respond"
+)
+
+// BodyLimit rejects request bodies larger than maxBytes with 413. The body is
+// read up front so handlers never see a truncated payload as a binding error.
+// A non-positive maxBytes disables the limit.
+func BodyLimit(maxBytes int64) gin.HandlerFunc {
+	if maxBytes <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	return func(c *gin.Context) {
+		if c.Request.Body == nil || c.Request.Body == http.NoBody {
+			c.Next()
+			return
+		}
+
+		if c.Request.ContentLength > maxBytes {
+			abortTooLarge(c, maxBytes)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes))
+		if err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				abortTooLarge(c, maxBytes)
+				return
+			}
+			respond.Abort(c, http.StatusBadRequest, "Failed to read request body", err)
+			return
+		}
+
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		c.Next()
+	}
+}
+
+func abortTooLarge(c *gin.Context, maxBytes int64) {
+	respond.Abort(c, http.StatusRequestEntityTooLarge, "Request body too large", fmt.Errorf("body exceeds %d bytes", maxBytes))
+}
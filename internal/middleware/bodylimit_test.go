@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBodyLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name     string
+		limit    int64
+		body     string
+		chunked  bool // Sent without a Content-Length
+		status   int
+		received string // Body the handler reads, when it runs
+	}{
+		{"within the limit", 10, "0123456789", false, http.StatusOK, "0123456789"},
+		{"oversized", 10, "0123456789a", false, http.StatusRequestEntityTooLarge, ""},
+		{"oversized without a length", 10, "0123456789a", true, http.StatusRequestEntityTooLarge, ""},
+		{"within the limit without a length", 10, "short", true, http.StatusOK, "short"},
+		{"disabled", 0, strings.Repeat("x", 1000), false, http.StatusOK, strings.Repeat("x", 1000)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received := ""
+			router := gin.New()
+			router.Use(BodyLimit(tt.limit))
+			router.POST("/", func(c *gin.Context) {
+				body, _ := io.ReadAll(c.Request.Body)
+				received = string(body)
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			if tt.chunked {
+				req.ContentLength = -1
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if received != tt.received {
+				t.Errorf("handler read %q, want %q", received, tt.received)
+			}
+			if tt.status == http.StatusRequestEntityTooLarge && !strings.Contains(w.Body.String(), "Request body too large") {
+				t.Errorf("body = %s, want the too-large message", w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+var gzipWriterPool = sync.Pool{
+	New: func() interface{} { return gzip.NewWriter(nil) },
+}
+
+// Gzip compresses responses of at least minBytes for clients that accept
+// gzip. Smaller responses are sent as-is. Streams (SSE, NDJSON) are never
+// compressed: they flush before the threshold is reached, and WebSocket
+// upgrades are skipped entirely.
+func Gzip(minBytes int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader("Upgrade") != "" {
+			c.Next()
+			return
+		}
+
+		c.Header("Vary", "Accept-Encoding")
+		if !acceptsGzip(c.GetHeader("Accept-Encoding")) || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+
+		w := &gzipResponseWriter{ResponseWriter: c.Writer, minBytes: minBytes}
+		c.Writer = w
+		defer func() {
+			w.finish()
+			c.Writer = w.ResponseWriter
+		}()
+
+		c.Next()
+	}
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.TrimSpace(coding)
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		q := strings.ReplaceAll(params, " ", "")
+		return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+	}
+	return false
+}
+
+// gzipResponseWriter buffers the body until it reaches minBytes, then
+// switches to gzip. A Flush before that point sends the response uncompressed.
+type gzipResponseWriter struct {
+	gin.ResponseWriter
+	minBytes int
+	buf      bytes.Buffer
+	gz       *gzip.Writer
+	decided  bool // Compression was chosen or ruled out
+}
+
+func (w *gzipResponseWriter) Write(data []byte) (int, error) {
+	if w.decided {
+		if w.gz != nil {
+			return w.gz.Write(data)
+		}
+		return w.ResponseWriter.Write(data)
+	}
+
+	w.buf.Write(data)
+	if w.buf.Len() >= w.minBytes {
+		w.decide(true)
+	}
+	return len(data), nil
+}
+
+func (w *gzipResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush sends buffered data. Before the threshold this means the response is
+// a stream, so it is left uncompressed.
+func (w *gzipResponseWriter) Flush() {
+	if !w.decided {
+		w.decide(false)
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// decide picks compression (when allowed for this response) and writes out
+// the buffered data
+func (w *gzipResponseWriter) decide(compress bool) {
+	w.decided = true
+
+	header := w.Header()
+	if compress && !w.ResponseWriter.Written() && header.Get("Content-Encoding") == "" &&
+		!strings.HasPrefix(header.Get("Content-Type"), "text/event-stream") {
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+		w.gz = gzipWriterPool.Get().(*gzip.Writer)
+		w.gz.Reset(w.ResponseWriter)
+	}
+
+	if w.buf.Len() > 0 {
+		if w.gz != nil {
+			w.gz.Write(w.buf.Bytes())
+		} else {
+			w.ResponseWriter.Write(w.buf.Bytes())
+		}
+		w.buf.Reset()
+	}
+}
+
+// finish writes out a response that stayed below the threshold, or closes
+// the gzip stream
+func (w *gzipResponseWriter) finish() {
+	if !w.decided {
+		w.decide(false)
+	}
+	if w.gz != nil {
+		w.gz.Close()
+		gzipWriterPool.Put(w.gz)
+		w.gz = nil
+	}
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGzip(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	large := `{"data":"` + strings.Repeat("bitcoin ", 200) + `"}`
+
+	router := gin.New()
+	router.Use(Gzip(1024))
+	router.GET("/large", func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json; charset=utf-8", []byte(large))
+	})
+	router.GET("/small", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	})
+	router.GET("/events", func(c *gin.Context) {
+		c.Header("Content-Type", "text/event-stream")
+		c.Writer.WriteString("data: tick\n\n")
+		c.Writer.Flush()
+	})
+
+	tests := []struct {
+		name           string
+		path           string
+		acceptEncoding string
+		gzipped        bool
+	}{
+		{"large JSON", "/large", "gzip, deflate", true},
+		{"large JSON without gzip", "/large", "deflate", false},
+		{"large JSON with gzip refused", "/large", "gzip;q=0", false},
+		{"small JSON", "/small", "gzip", false},
+		{"event stream", "/events", "gzip", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("Vary = %q, want Accept-Encoding", got)
+			}
+			if got := w.Header().Get("Content-Encoding") == "gzip"; got != tt.gzipped {
+				t.Fatalf("gzip encoded = %v, want %v", got, tt.gzipped)
+			}
+			if !tt.gzipped {
+				return
+			}
+
+			zr, err := gzip.NewReader(w.Body)
+			if err != nil {
+				t.Fatalf("invalid gzip body: %v", err)
+			}
+			body, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatalf("reading gzip body: %v", err)
+			}
+			if string(body) != large {
+				t.Errorf("decompressed body differs from the response (%d bytes, want %d)", len(body), len(large))
+			}
+		})
+	}
+}
@@ -5,12 +5,33 @@ import (
 	"net/http"
 )
 
-func CORS() gin.HandlerFunc {
+// CORS allows cross-origin requests only from the configured origins. The
+// matching origin is echoed back; "*" in the list allows any origin.
+func CORS(allowedOrigins []string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
+		origin := c.GetHeader("Origin")
+		c.Header("Vary", "Origin")
+
+		if origin == "" {
+			// Not a cross-origin request
+			c.Next()
+			return
+		}
+
+		if !IsOriginAllowed(origin, allowedOrigins) {
+			if c.Request.Method == "OPTIONS" {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		c.Header("Access-Control-Allow-Origin", origin)
 		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, Cache-Control, Idempotency-Key")
 		c.Header("Access-Control-Allow-Credentials", "true")
+		c.Header("Access-Control-Expose-Headers", "X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset, X-Quota-Limit, X-Quota-Remaining, X-Quota-Reset, Retry-After, Idempotent-Replayed")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(http.StatusNoContent)
@@ -20,3 +41,13 @@ func CORS() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// IsOriginAllowed reports whether origin matches the allow list
+func IsOriginAllowed(origin string, allowedOrigins []string) bool {
+	for _, allowed := range allowedOrigins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+	}
+	return false
+}
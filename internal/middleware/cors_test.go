@@ -0,0 +1,157 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCORS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		allowed    []string
+		method     string
+		origin     string
+		wantStatus int
+		wantACAO   string
+	}{
+		{
+			name:       "allowed origin is echoed",
+			allowed:    []string{"https://app.example.com"},
+			method:     http.MethodGet,
+			origin:     "https://app.example.com",
+			wantStatus: http.StatusOK,
+			wantACAO:   "https://app.example.com",
+		},
+		{
+			name:       "allowed preflight",
+			allowed:    []string{"https://app.example.com"},
+			method:     http.MethodOptions,
+			origin:     "https://app.example.com",
+			wantStatus: http.StatusNoContent,
+			wantACAO:   "https://app.example.com",
+		},
+		{
+			name:       "disallowed origin gets no ACAO",
+			allowed:    []string{"https://app.example.com"},
+			method:     http.MethodGet,
+			origin:     "https://evil.example.com",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "disallowed preflight is refused",
+			allowed:    []string{"https://app.example.com"},
+			method:     http.MethodOptions,
+			origin:     "https://evil.example.com",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "wildcard allows any origin when configured",
+			allowed:    []string{"*"},
+			method:     http.MethodGet,
+			origin:     "https://anywhere.example.com",
+			wantStatus: http.StatusOK,
+			wantACAO:   "https://anywhere.example.com",
+		},
+		{
+			name:       "no wildcard unless configured",
+			allowed:    nil,
+			method:     http.MethodGet,
+			origin:     "https://anywhere.example.com",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "no Origin is not a CORS request",
+			allowed:    []string{"https://app.example.com"},
+			method:     http.MethodGet,
+			origin:     "",
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(CORS(tt.allowed))
+			router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			req := httptest.NewRequest(tt.method, "/", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantACAO {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantACAO)
+			}
+			if got := w.Header().Get("Vary"); got != "Origin" {
+				t.Errorf("Vary = %q, want Origin", got)
+			}
+		})
+	}
+}
+
+func TestCORSPreflightHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(CORS([]string{"https://app.example.com"}))
+	router.POST("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req := httptest.NewRequest(http.MethodOptions, "/", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	req.Header.Set("Access-Control-Request-Headers", "content-type, idempotency-key")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	headerList := func(name string) []string {
+		var values []string
+		for _, value := range strings.Split(w.Header().Get(name), ",") {
+			values = append(values, strings.ToLower(strings.TrimSpace(value)))
+		}
+		return values
+	}
+
+	for _, header := range []string{"content-type", "authorization", "idempotency-key"} {
+		if !slices.Contains(headerList("Access-Control-Allow-Headers"), header) {
+			t.Errorf("Access-Control-Allow-Headers = %q, missing %s", w.Header().Get("Access-Control-Allow-Headers"), header)
+		}
+	}
+	for _, header := range []string{"x-ratelimit-remaining", "x-quota-remaining", "retry-after", "idempotent-replayed"} {
+		if !slices.Contains(headerList("Access-Control-Expose-Headers"), header) {
+			t.Errorf("Access-Control-Expose-Headers = %q, missing %s", w.Header().Get("Access-Control-Expose-Headers"), header)
+		}
+	}
+}
+
+func TestIsOriginAllowed(t *testing.T) {
+	allowed := []string{"https://app.example.com", "http://localhost:3000"}
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://app.example.com", true},
+		{"http://localhost:3000", true},
+		{"http://app.example.com", false},
+		{"https://app.example.com.evil.com", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsOriginAllowed(tt.origin, allowed); got != tt.want {
+			t.Errorf("IsOriginAllowed(%q) = %v, want %v", tt.origin, got, tt.want)
+		}
+	}
+}
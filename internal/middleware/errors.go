@@ -0,0 +1,31 @@
+package middleware
+
+import "my-go-backend/pkg/models"
+
+// Errors the middleware aborts with. Their codes reach the client through
+// respond.Abort.
+var (
+	errMissingAuthHeader = &codedError{code: models.CodeUnauthorized, message: "authorization header required"}
+	errBearerRequired    = &codedError{code: models.CodeUnauthorized, message: "bearer token required"}
+	errInvalidToken      = &codedError{code: models.CodeUnauthorized, message: "invalid or expired token"}
+	errInsufficientScope = &codedError{code: models.CodeForbidden, message: "service token lacks the required scope"}
+	errInsufficientRole  = &codedError{code: models.CodeForbidden, message: "role not allowed"}
+	errRateLimited       = &codedError{code: models.CodeRateLimited, message: "rate limit exceeded"}
+	errQuotaExceeded     = &codedError{code: models.CodeQuotaExceeded, message: "request quota exceeded"}
+)
+
+// codedError is an error with a machine-readable code, which respond.Abort
+// returns as APIResponse.Code instead of the generic code for the status
+type codedError struct {
+	code    string // One of the models.Code* constants
+	message string
+}
+
+func (e *codedError) Error() string {
+	return e.message
+}
+
+// ErrorCode returns the error's models.Code* constant
+func (e *codedError) ErrorCode() string {
+	return e.code
+}
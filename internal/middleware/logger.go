@@ -3,10 +3,40 @@ package middleware
 import (
 	"github.com/gin-gonic/gin"
 	"log"
+	"log/slog"
 	"time"
 )
 
-func Logger() gin.HandlerFunc {
+// requestLevel is the level a request is logged at: error for 5xx, warn for
+// 4xx and slow requests, and info otherwise
+func requestLevel(status int, slow bool) slog.Level {
+	switch {
+	case status >= 500:
+		return slog.LevelError
+	case status >= 400 || slow:
+		return slog.LevelWarn
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// isSlow reports whether a request took longer than slowThreshold. With a
+// threshold of zero no request is slow.
+func isSlow(latency, slowThreshold time.Duration) bool {
+	return slowThreshold > 0 && latency > slowThreshold
+}
+
+// skipFastRequest reports whether a request goes unlogged because only slow
+// requests are: it succeeded with a 2xx and took at most slowThreshold.
+// Nothing is skipped when the threshold is zero.
+func skipFastRequest(status int, latency, slowThreshold time.Duration) bool {
+	return slowThreshold > 0 && status >= 200 && status < 300 && latency <= slowThreshold
+}
+
+// Logger logs each request as a line of text, skipping requests whose level
+// (see requestLevel) is below minLevel. With a positive slowThreshold only
+// requests slower than it, and all non-2xx responses, are logged.
+func Logger(minLevel slog.Level, slowThreshold time.Duration) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		start := time.Now()
 		path := c.Request.URL.Path
@@ -16,8 +46,13 @@ func Logger() gin.HandlerFunc {
 
 		latency := time.Since(start)
 		status := c.Writer.Status()
+		if skipFastRequest(status, latency, slowThreshold) ||
+			requestLevel(status, isSlow(latency, slowThreshold)) < minLevel {
+			return
+		}
 
-		log.Printf("[%s] %s %s - %d - %v",
+		log.Printf("[%s] [%s] %s %s - %d - %v",
+			c.GetString("request_id"),
 			method,
 			path,
 			c.ClientIP(),
@@ -26,3 +61,44 @@ func Logger() gin.HandlerFunc {
 		)
 	}
 }
+
+// StructuredLogger logs each request as a structured record (e.g. JSON) for
+// log aggregators, at the level chosen by requestLevel. The logger's handler
+// decides which levels are written. slowThreshold works as in Logger; slow
+// requests are marked with "slow": true.
+func StructuredLogger(logger *slog.Logger, slowThreshold time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		path := c.Request.URL.Path
+		method := c.Request.Method
+
+		c.Next()
+
+		latency := time.Since(start)
+		status := c.Writer.Status()
+		if skipFastRequest(status, latency, slowThreshold) {
+			return
+		}
+		slow := isSlow(latency, slowThreshold)
+
+		attrs := []slog.Attr{
+			slog.String("method", method),
+			slog.String("path", path),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(latency.Microseconds())/1000),
+			slog.String("client_ip", c.ClientIP()),
+		}
+		if requestID, exists := c.Get("request_id"); exists {
+			attrs = append(attrs, slog.Any("request_id", requestID))
+		}
+		if userID, exists := c.Get("user_id"); exists {
+			attrs = append(attrs, slog.Any("user_id", userID))
+		}
+
+		if slow {
+			attrs = append(attrs, slog.Bool("slow", true))
+		}
+
+		logger.LogAttrs(c.Request.Context(), requestLevel(status, slow), "request", attrs...)
+	}
+}
@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSlowRequestFilter(t *testing.T) {
+	const threshold = 500 * time.Millisecond
+
+	tests := []struct {
+		name      string
+		status    int
+		latency   time.Duration
+		threshold time.Duration
+		wantSkip  bool
+		wantSlow  bool
+		wantLevel slog.Level
+	}{
+		{"threshold 0 logs fast requests", http.StatusOK, time.Millisecond, 0, false, false, slog.LevelInfo},
+		{"threshold 0 never marks slow", http.StatusOK, time.Hour, 0, false, false, slog.LevelInfo},
+		{"fast 2xx is skipped", http.StatusOK, 10 * time.Millisecond, threshold, true, false, slog.LevelInfo},
+		{"2xx at the threshold is skipped", http.StatusNoContent, threshold, threshold, true, false, slog.LevelInfo},
+		{"slow 2xx is logged as warn", http.StatusOK, threshold + time.Millisecond, threshold, false, true, slog.LevelWarn},
+		{"fast 3xx is still logged", http.StatusNotModified, time.Millisecond, threshold, false, false, slog.LevelInfo},
+		{"fast 4xx is still logged", http.StatusNotFound, time.Millisecond, threshold, false, false, slog.LevelWarn},
+		{"fast 5xx is still logged", http.StatusBadGateway, time.Millisecond, threshold, false, false, slog.LevelError},
+		{"slow 5xx stays an error", http.StatusInternalServerError, time.Second, threshold, false, true, slog.LevelError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := skipFastRequest(tt.status, tt.latency, tt.threshold); got != tt.wantSkip {
+				t.Errorf("skipFastRequest = %v, want %v", got, tt.wantSkip)
+			}
+			slow := isSlow(tt.latency, tt.threshold)
+			if slow != tt.wantSlow {
+				t.Errorf("isSlow = %v, want %v", slow, tt.wantSlow)
+			}
+			if got := requestLevel(tt.status, slow); got != tt.wantLevel {
+				t.Errorf("requestLevel = %v, want %v", got, tt.wantLevel)
+			}
+		})
+	}
+}
+
+func TestStructuredLoggerSlowThreshold(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	router := gin.New()
+	router.Use(StructuredLogger(logger, 20*time.Millisecond))
+	router.GET("/fast", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/slow", func(c *gin.Context) {
+		time.Sleep(40 * time.Millisecond)
+		c.Status(http.StatusOK)
+	})
+	router.GET("/missing", func(c *gin.Context) { c.Status(http.StatusNotFound) })
+
+	for _, path := range []string{"/fast", "/slow", "/missing"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("logged %d requests, want 2:\n%s", len(lines), buf.String())
+	}
+
+	type logRecord struct {
+		Level string `json:"level"`
+		Path  string `json:"path"`
+		Slow  bool   `json:"slow"`
+	}
+	var records []logRecord
+	for _, line := range lines {
+		var record logRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("invalid log line %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+
+	if r := records[0]; r.Path != "/slow" || r.Level != "WARN" || !r.Slow {
+		t.Errorf("first record = %+v, want /slow at WARN marked slow", r)
+	}
+	if r := records[1]; r.Path != "/missing" || r.Level != "WARN" || r.Slow {
+		t.Errorf("second record = %+v, want /missing at WARN, not slow", r)
+	}
+}
+
+func TestLoggerMinLevel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	tests := []struct {
+		level  slog.Level
+		logged []string
+	}{
+		{slog.LevelDebug, []string{"/ok", "/missing", "/broken"}},
+		{slog.LevelInfo, []string{"/ok", "/missing", "/broken"}},
+		{slog.LevelWarn, []string{"/missing", "/broken"}},
+		{slog.LevelError, []string{"/broken"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.level.String(), func(t *testing.T) {
+			buf.Reset()
+			router := gin.New()
+			router.Use(Logger(tt.level, 0))
+			router.GET("/ok", func(c *gin.Context) { c.Status(http.StatusOK) })
+			router.GET("/missing", func(c *gin.Context) { c.Status(http.StatusNotFound) })
+			router.GET("/broken", func(c *gin.Context) { c.Status(http.StatusInternalServerError) })
+
+			for _, path := range []string{"/ok", "/missing", "/broken"} {
+				router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+			}
+
+			var logged []string
+			for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+				for _, path := range []string{"/ok", "/missing", "/broken"} {
+					if strings.Contains(line, " "+path+" ") {
+						logged = append(logged, path)
+					}
+				}
+			}
+			if strings.Join(logged, ",") != strings.Join(tt.logged, ",") {
+				t.Errorf("logged %q, want %q", logged, tt.logged)
+			}
+		})
+	}
+}
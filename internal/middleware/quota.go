@@ -0,0 +1,210 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"math"
+	"my-go-backend/internal/respond"
+	"my-go-backend/pkg/models"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// quotaLimit allows max requests per window
+type quotaLimit struct {
+	window time.Duration
+	max    int
+}
+
+// quotaWindow counts a caller's requests for one limit in the current fixed
+// window and the one before it. Weighting the previous count by how much of
+// it still overlaps the last window length approximates a rolling window,
+// so a burst at the end of one window and the start of the next can't use
+// the quota twice.
+type quotaWindow struct {
+	start    time.Time // Start of the current fixed window
+	count    int
+	previous int // Requests in the fixed window before start
+}
+
+// advance moves the window forward to the fixed window holding now
+func (w *quotaWindow) advance(now time.Time, length time.Duration) {
+	start := now.Truncate(length)
+	switch {
+	case start.Equal(w.start):
+	case start.Sub(w.start) == length:
+		w.start, w.previous, w.count = start, w.count, 0
+	default:
+		w.start, w.previous, w.count = start, 0, 0
+	}
+}
+
+// used is the approximate number of requests in the window length before now
+func (w *quotaWindow) used(now time.Time, length time.Duration) float64 {
+	overlap := float64(length-now.Sub(w.start)) / float64(length)
+	return float64(w.previous)*overlap + float64(w.count)
+}
+
+// wait is how long until one more request fits under max
+func (w *quotaWindow) wait(now time.Time, length time.Duration, max int) time.Duration {
+	elapsed := now.Sub(w.start)
+	room := float64(max - 1)
+	var at time.Duration // Time after w.start when used drops to room
+	if float64(w.count) <= room {
+		at = time.Duration(math.Ceil(float64(length) * (1 - (room-float64(w.count))/float64(w.previous))))
+	} else {
+		// Only once this window's count becomes the previous one
+		at = length + time.Duration(math.Ceil(float64(length)*(1-room/float64(w.count))))
+	}
+	return at - elapsed
+}
+
+type quotaTracker struct {
+	mu     sync.Mutex
+	limits []quotaLimit
+	keys   map[string][]quotaWindow // See quotaKey; one window per limit
+}
+
+// quotaStatus describes the tightest limit after a request
+type quotaStatus struct {
+	allowed   bool
+	limit     int
+	remaining int
+	reset     time.Duration // Until a request is allowed again when refused, else until the previous window stops counting
+}
+
+func newQuotaTracker(limits []quotaLimit) *quotaTracker {
+	t := &quotaTracker{
+		limits: limits,
+		keys:   make(map[string][]quotaWindow),
+	}
+	go t.cleanup()
+	return t
+}
+
+// take counts a request against every limit unless one is used up. The
+// status reports the used-up limit that frees up last, or else the limit
+// with the fewest requests left.
+func (t *quotaTracker) take(key string, now time.Time) quotaStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	windows, exists := t.keys[key]
+	if !exists {
+		windows = make([]quotaWindow, len(t.limits))
+		t.keys[key] = windows
+	}
+
+	var exceeded *quotaStatus
+	for i, limit := range t.limits {
+		windows[i].advance(now, limit.window)
+		if windows[i].used(now, limit.window)+1 > float64(limit.max) {
+			reset := windows[i].wait(now, limit.window, limit.max)
+			if exceeded == nil || reset > exceeded.reset {
+				exceeded = &quotaStatus{limit: limit.max, reset: reset}
+			}
+		}
+	}
+	if exceeded != nil {
+		return *exceeded
+	}
+
+	status := quotaStatus{allowed: true, remaining: math.MaxInt}
+	for i, limit := range t.limits {
+		windows[i].count++
+		remaining := int(float64(limit.max) - windows[i].used(now, limit.window))
+		if remaining < status.remaining {
+			status.limit = limit.max
+			status.remaining = remaining
+			status.reset = windows[i].start.Add(limit.window).Sub(now)
+		}
+	}
+	return status
+}
+
+// cleanup drops callers with no requests left in any window
+func (t *quotaTracker) cleanup() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		t.mu.Lock()
+		now := time.Now()
+		for key, windows := range t.keys {
+			expired := true
+			for i, limit := range t.limits {
+				if now.Sub(windows[i].start) < 2*limit.window {
+					expired = false
+					break
+				}
+			}
+			if expired {
+				delete(t.keys, key)
+			}
+		}
+		t.mu.Unlock()
+	}
+}
+
+// quotaKey is who a request is counted against: the "user_id" claim, or the
+// "client_id" claim for service tokens. ok is false when AuthMiddleware
+// stored neither.
+func quotaKey(c *gin.Context) (key string, ok bool) {
+	if userID, ok := c.Get("user_id"); ok {
+		if id, ok := userID.(float64); ok {
+			return "user:" + strconv.FormatFloat(id, 'f', -1, 64), true
+		}
+	}
+	if clientID, ok := c.Get("client_id"); ok {
+		if id, ok := clientID.(string); ok && id != "" {
+			return "client:" + id, true
+		}
+	}
+	return "", false
+}
+
+// Quota limits each authenticated user, and each service client, to hourly
+// and daily request counts, kept in memory. The windows roll: a request
+// counts against the quota for an hour (or a day) after it was made,
+// approximated from the counts of the current and previous clock hour (or
+// day). A non-positive count disables that window; admins are exempt. It
+// must run after AuthMiddleware. Responses carry X-Quota-Limit,
+// X-Quota-Remaining and X-Quota-Reset (seconds) for the tightest window;
+// 429s also send Retry-After.
+func Quota(hourly, daily int) gin.HandlerFunc {
+	var limits []quotaLimit
+	if hourly > 0 {
+		limits = append(limits, quotaLimit{window: time.Hour, max: hourly})
+	}
+	if daily > 0 {
+		limits = append(limits, quotaLimit{window: 24 * time.Hour, max: daily})
+	}
+	if len(limits) == 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	tracker := newQuotaTracker(limits)
+
+	return func(c *gin.Context) {
+		key, ok := quotaKey(c)
+		if !ok || c.GetString("role") == models.RoleAdmin {
+			c.Next()
+			return
+		}
+
+		status := tracker.take(key, time.Now())
+		reset := strconv.Itoa(int(math.Ceil(status.reset.Seconds())))
+		c.Header("X-Quota-Limit", strconv.Itoa(status.limit))
+		c.Header("X-Quota-Remaining", strconv.Itoa(status.remaining))
+		c.Header("X-Quota-Reset", reset)
+
+		if !status.allowed {
+			c.Header("Retry-After", reset)
+			respond.Abort(c, http.StatusTooManyRequests, "Request quota exceeded", errQuotaExceeded)
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,196 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"my-go-backend/pkg/models"
+)
+
+// newTestQuotaTracker is a tracker without the cleanup goroutine
+func newTestQuotaTracker(limits []quotaLimit) *quotaTracker {
+	return &quotaTracker{limits: limits, keys: make(map[string][]quotaWindow)}
+}
+
+func TestQuotaTrackerRolls(t *testing.T) {
+	tracker := newTestQuotaTracker([]quotaLimit{{window: time.Hour, max: 2}})
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	steps := []struct {
+		name          string
+		at            time.Duration // After start
+		key           string
+		wantAllowed   bool
+		wantRemaining int
+		wantReset     time.Duration
+	}{
+		{"first request", 0, "user:1", true, 1, time.Hour},
+		{"second request", 10 * time.Minute, "user:1", true, 0, 50 * time.Minute},
+		{"over the limit", 20 * time.Minute, "user:1", false, 0, 70 * time.Minute},
+		{"other callers have their own count", 20 * time.Minute, "user:2", true, 1, 40 * time.Minute},
+		// A fixed window would start over here
+		{"still over as the next hour starts", time.Hour, "user:1", false, 0, 30 * time.Minute},
+		{"half the previous hour has rolled off", 90 * time.Minute, "user:1", true, 0, 30 * time.Minute},
+		{"over again", 105 * time.Minute, "user:1", false, 0, 15 * time.Minute},
+		{"a skipped hour clears the count", 3 * time.Hour, "user:1", true, 1, time.Hour},
+	}
+
+	for _, step := range steps {
+		status := tracker.take(step.key, start.Add(step.at))
+		if status.allowed != step.wantAllowed {
+			t.Fatalf("%s: allowed = %v, want %v", step.name, status.allowed, step.wantAllowed)
+		}
+		if status.remaining != step.wantRemaining {
+			t.Errorf("%s: remaining = %d, want %d", step.name, status.remaining, step.wantRemaining)
+		}
+		if status.reset != step.wantReset {
+			t.Errorf("%s: reset = %v, want %v", step.name, status.reset, step.wantReset)
+		}
+		if status.limit != 2 {
+			t.Errorf("%s: limit = %d, want 2", step.name, status.limit)
+		}
+	}
+}
+
+func TestQuotaTrackerTightestWindow(t *testing.T) {
+	tracker := newTestQuotaTracker([]quotaLimit{
+		{window: time.Hour, max: 3},
+		{window: 24 * time.Hour, max: 4},
+	})
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 3; i++ {
+		tracker.take("user:1", start.Add(time.Duration(i)*time.Minute))
+	}
+
+	// The hourly window is used up
+	status := tracker.take("user:1", start.Add(5*time.Minute))
+	if status.allowed || status.limit != 3 {
+		t.Fatalf("hourly limit: allowed %v, limit %d; want refused at limit 3", status.allowed, status.limit)
+	}
+
+	// Once the hour has rolled off, one request is left for the day
+	status = tracker.take("user:1", start.Add(2*time.Hour))
+	if !status.allowed || status.limit != 4 || status.remaining != 0 {
+		t.Fatalf("after two hours: %+v; want allowed with 0 left of the daily 4", status)
+	}
+
+	// Only the daily window is used up, and it frees up a request once
+	// enough of today has rolled off tomorrow
+	status = tracker.take("user:1", start.Add(2*time.Hour+time.Minute))
+	if status.allowed || status.limit != 4 {
+		t.Fatalf("daily limit: %+v; want refused at limit 4", status)
+	}
+	if want := 30*time.Hour - 2*time.Hour - time.Minute; status.reset != want {
+		t.Errorf("reset = %v, want %v", status.reset, want)
+	}
+}
+
+func TestQuotaMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		// Stand-in for AuthMiddleware
+		if userID := c.GetHeader("X-Test-User"); userID != "" {
+			id, _ := strconv.ParseFloat(userID, 64)
+			c.Set("user_id", id)
+		}
+		if clientID := c.GetHeader("X-Test-Client"); clientID != "" {
+			c.Set("client_id", clientID)
+		}
+		c.Set("role", c.GetHeader("X-Test-Role"))
+		c.Next()
+	})
+	router.Use(Quota(2, 0))
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	get := func(userID, role string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if role == models.RoleService {
+			req.Header.Set("X-Test-Client", userID)
+		} else {
+			req.Header.Set("X-Test-User", userID)
+		}
+		req.Header.Set("X-Test-Role", role)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	for i, wantRemaining := range []string{"1", "0"} {
+		w := get("1", models.RoleUser)
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want 200", i+1, w.Code)
+		}
+		if got := w.Header().Get("X-Quota-Remaining"); got != wantRemaining {
+			t.Errorf("request %d: X-Quota-Remaining = %q, want %q", i+1, got, wantRemaining)
+		}
+	}
+
+	w := get("1", models.RoleUser)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("over quota: status = %d, want 429", w.Code)
+	}
+	if got := errorCode(t, w); got != models.CodeQuotaExceeded {
+		t.Errorf("over quota: code = %q, want %q", got, models.CodeQuotaExceeded)
+	}
+	if got := w.Header().Get("X-Quota-Limit"); got != "2" {
+		t.Errorf("X-Quota-Limit = %q, want 2", got)
+	}
+	if got := w.Header().Get("X-Quota-Remaining"); got != "0" {
+		t.Errorf("X-Quota-Remaining = %q, want 0", got)
+	}
+	reset, err := strconv.Atoi(w.Header().Get("X-Quota-Reset"))
+	if err != nil || reset < 1 || reset > 2*3600 {
+		t.Errorf("X-Quota-Reset = %q, want 1-7200 seconds", w.Header().Get("X-Quota-Reset"))
+	}
+	if got := w.Header().Get("Retry-After"); got != w.Header().Get("X-Quota-Reset") {
+		t.Errorf("Retry-After = %q, want the reset %q", got, w.Header().Get("X-Quota-Reset"))
+	}
+
+	if w := get("2", models.RoleUser); w.Code != http.StatusOK {
+		t.Errorf("other user: status = %d, want 200", w.Code)
+	}
+	for i := 0; i < 3; i++ {
+		if w := get("3", models.RoleAdmin); w.Code != http.StatusOK || w.Header().Get("X-Quota-Limit") != "" {
+			t.Fatalf("admin request %d: status %d, X-Quota-Limit %q; want exempt", i+1, w.Code, w.Header().Get("X-Quota-Limit"))
+		}
+	}
+	// Service tokens have no user id; they're counted by client id
+	for i := 0; i < 2; i++ {
+		if w := get("1", models.RoleService); w.Code != http.StatusOK {
+			t.Fatalf("service request %d: status = %d, want 200", i+1, w.Code)
+		}
+	}
+	if w := get("1", models.RoleService); w.Code != http.StatusTooManyRequests {
+		t.Errorf("service client over quota: status = %d, want 429", w.Code)
+	}
+	if w := get("2", models.RoleService); w.Code != http.StatusOK {
+		t.Errorf("other service client: status = %d, want 200", w.Code)
+	}
+	if w := get("", models.RoleUser); w.Code != http.StatusOK || w.Header().Get("X-Quota-Limit") != "" {
+		t.Errorf("no user or client: status %d, X-Quota-Limit %q; want not counted", w.Code, w.Header().Get("X-Quota-Limit"))
+	}
+}
+
+func TestQuotaDisabled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("user_id", float64(1)); c.Next() })
+	router.Use(Quota(0, 0))
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for i := 0; i < 5; i++ {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if w.Code != http.StatusOK || w.Header().Get("X-Quota-Limit") != "" {
+			t.Fatalf("request %d: status %d, X-Quota-Limit %q; want no quota", i+1, w.Code, w.Header().Get("X-Quota-Limit"))
+		}
+	}
+}
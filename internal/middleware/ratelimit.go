@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+	"math"
+	"my-go-backend/internal/respond"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Limiters idle for longer than this are removed by the cleanup loop
+const limiterIdleTTL = 3 * time.Minute
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+type ipRateLimiter struct {
+	mu      sync.Mutex
+	clients map[string]*clientLimiter
+	rps     rate.Limit
+	burst   int
+}
+
+func newIPRateLimiter(rps, burst int) *ipRateLimiter {
+	l := &ipRateLimiter{
+		clients: make(map[string]*clientLimiter),
+		rps:     rate.Limit(rps),
+		burst:   burst,
+	}
+	go l.cleanup()
+	return l
+}
+
+func (l *ipRateLimiter) get(ip string) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	client, exists := l.clients[ip]
+	if !exists {
+		client = &clientLimiter{limiter: rate.NewLimiter(l.rps, l.burst)}
+		l.clients[ip] = client
+	}
+	client.lastSeen = time.Now()
+	return client.limiter
+}
+
+// cleanup drops limiters for clients that have gone quiet
+func (l *ipRateLimiter) cleanup() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		l.mu.Lock()
+		for ip, client := range l.clients {
+			if time.Since(client.lastSeen) > limiterIdleTTL {
+				delete(l.clients, ip)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
+
+// RateLimit limits requests per client IP with a token bucket. A non-positive
+// rps disables limiting. Responses carry X-RateLimit-Limit (the burst),
+// X-RateLimit-Remaining (whole tokens left) and X-RateLimit-Reset (seconds
+// until the bucket is full again) so clients can throttle themselves. When
+// routes are limited twice, the inner (route-specific) limiter's headers win.
+func RateLimit(rps, burst int) gin.HandlerFunc {
+	if rps <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+	if burst < 1 {
+		burst = 1
+	}
+
+	limiters := newIPRateLimiter(rps, burst)
+
+	return func(c *gin.Context) {
+		limiter := limiters.get(c.ClientIP())
+		now := time.Now()
+		reservation := limiter.ReserveN(now, 1)
+		delay := reservation.DelayFrom(now)
+		if delay > 0 {
+			reservation.CancelAt(now)
+		}
+		setRateLimitHeaders(c, limiter.TokensAt(now), rps, burst)
+
+		if delay > 0 {
+			retryAfter := int(math.Ceil(delay.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			respond.Abort(c, http.StatusTooManyRequests, "Rate limit exceeded", errRateLimited)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// setRateLimitHeaders describes the bucket after this request's token was taken
+func setRateLimitHeaders(c *gin.Context, tokens float64, rps, burst int) {
+	remaining := int(math.Floor(tokens))
+	if remaining < 0 {
+		remaining = 0
+	}
+	reset := int(math.Ceil((float64(burst) - tokens) / float64(rps)))
+	if reset < 0 {
+		reset = 0
+	}
+
+	c.Header("X-RateLimit-Limit", strconv.Itoa(burst))
+	c.Header("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	c.Header("X-RateLimit-Reset", strconv.Itoa(reset))
+}
@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"my-go-backend/pkg/models"
+)
+
+func TestRateLimitExceedsBurst(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(RateLimit(1, 1))
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	get := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	first := get("192.0.2.1:1234")
+	if first.Code != http.StatusOK {
+		t.Fatalf("first request: status = %d, want 200", first.Code)
+	}
+	if got := first.Header().Get("X-RateLimit-Limit"); got != "1" {
+		t.Errorf("first request: X-RateLimit-Limit = %q, want 1", got)
+	}
+	if got := first.Header().Get("X-RateLimit-Remaining"); got != "0" {
+		t.Errorf("first request: X-RateLimit-Remaining = %q, want 0", got)
+	}
+
+	second := get("192.0.2.1:1234")
+	if second.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request: status = %d, want 429", second.Code)
+	}
+	if got := second.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("second request: Retry-After = %q, want 1", got)
+	}
+	if got := errorCode(t, second); got != models.CodeRateLimited {
+		t.Errorf("second request: code = %q, want %q", got, models.CodeRateLimited)
+	}
+	for _, header := range []string{"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset"} {
+		if second.Header().Get(header) == "" {
+			t.Errorf("second request: %s missing", header)
+		}
+	}
+	if got := second.Header().Get("X-RateLimit-Remaining"); got != "0" {
+		t.Errorf("second request: X-RateLimit-Remaining = %q, want 0", got)
+	}
+
+	// Each client IP has its own bucket
+	if other := get("192.0.2.2:1234"); other.Code != http.StatusOK {
+		t.Errorf("other client: status = %d, want 200", other.Code)
+	}
+}
+
+func TestRateLimitHeadersDecrement(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(RateLimit(1, 5))
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	lastReset := 0
+	for i, want := range []string{"4", "3", "2", "1", "0"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want 200", i+1, w.Code)
+		}
+		if got := w.Header().Get("X-RateLimit-Limit"); got != "5" {
+			t.Errorf("request %d: X-RateLimit-Limit = %q, want 5", i+1, got)
+		}
+		if got := w.Header().Get("X-RateLimit-Remaining"); got != want {
+			t.Errorf("request %d: X-RateLimit-Remaining = %q, want %s", i+1, got, want)
+		}
+		reset, err := strconv.Atoi(w.Header().Get("X-RateLimit-Reset"))
+		if err != nil || reset < lastReset || reset > 5 {
+			t.Errorf("request %d: X-RateLimit-Reset = %q, want it to grow to at most 5s", i+1, w.Header().Get("X-RateLimit-Reset"))
+		}
+		lastReset = reset
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("request 6: status = %d, want 429", w.Code)
+	}
+}
+
+func TestRateLimitDisabled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(RateLimit(0, 0))
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for i := 0; i < 5; i++ {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want 200", i+1, w.Code)
+		}
+		if w.Header().Get("X-RateLimit-Limit") != "" {
+			t.Fatalf("request %d: X-RateLimit-Limit set while disabled", i+1)
+		}
+	}
+}
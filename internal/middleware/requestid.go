@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"my-go-backend/internal/requestid"
+)
+
+// maxRequestIDLength caps client-supplied IDs so they can't bloat logs
+const maxRequestIDLength = 128
+
+// RequestID reuses an incoming X-Request-ID or generates one, and exposes it
+// on the gin context, the request context and the response header.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestid.Header)
+		if id == "" || len(id) > maxRequestIDLength {
+			id = uuid.New().String()
+		}
+
+		c.Set("request_id", id)
+		c.Request = c.Request.WithContext(requestid.NewContext(c.Request.Context(), id))
+		c.Header(requestid.Header, id)
+
+		c.Next()
+	}
+}
@@ -0,0 +1,147 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// Each migration uses its own snapshot of the model so later changes to
+// pkg/models don't rewrite history. Append new migrations to the end.
+var migrations = []Migration{
+	{
+		// Matches the schema previously created by AutoMigrate, so existing
+		// databases upgrade cleanly.
+		ID: "0001_create_users",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&user0001{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("users")
+		},
+	},
+	{
+		ID: "0002_create_price_alerts",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&priceAlert0002{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("price_alerts")
+		},
+	},
+	{
+		ID: "0003_add_user_role",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AddColumn(&user0003{}, "Role")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&user0003{}, "Role")
+		},
+	},
+	{
+		// Emails are now stored lowercased. Rows differing only by case
+		// make the update fail and must be merged by hand first. Down only
+		// drops the index; the original casing isn't recoverable.
+		ID: "0004_lowercase_user_emails",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Exec("UPDATE users SET email = LOWER(TRIM(email)) WHERE email <> LOWER(TRIM(email))").Error; err != nil {
+				return err
+			}
+			return tx.Exec("CREATE UNIQUE INDEX idx_users_email_lower ON users (LOWER(email))").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Exec("DROP INDEX IF EXISTS idx_users_email_lower").Error
+		},
+	},
+	{
+		ID: "0005_create_auth_events",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&authEvent0005{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("auth_events")
+		},
+	},
+	{
+		ID: "0006_create_sessions",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&session0006{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("sessions")
+		},
+	},
+	{
+		ID: "0007_create_favorites",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&favorite0007{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("favorites")
+		},
+	},
+}
+
+type user0001 struct {
+	ID        uint   `gorm:"primaryKey"`
+	Username  string `gorm:"unique;not null"`
+	Email     string `gorm:"unique;not null"`
+	Password  string `gorm:"not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+func (user0001) TableName() string { return "users" }
+
+type priceAlert0002 struct {
+	ID          uint    `gorm:"primaryKey"`
+	UserID      uint    `gorm:"not null;index"`
+	CoinID      string  `gorm:"not null;index"`
+	Direction   string  `gorm:"not null"`
+	TargetPrice float64 `gorm:"not null"`
+	Triggered   bool    `gorm:"not null;default:false"`
+	TriggeredAt *time.Time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (priceAlert0002) TableName() string { return "price_alerts" }
+
+type user0003 struct {
+	Role string `gorm:"not null;default:user"`
+}
+
+func (user0003) TableName() string { return "users" }
+
+type authEvent0005 struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    *uint  `gorm:"index"`
+	Type      string `gorm:"not null;index"`
+	Success   bool   `gorm:"not null"`
+	IP        string
+	UserAgent string
+	CreatedAt time.Time `gorm:"index"`
+}
+
+func (authEvent0005) TableName() string { return "auth_events" }
+
+type session0006 struct {
+	ID         string `gorm:"primaryKey;size:36"`
+	UserID     uint   `gorm:"not null;index"`
+	IP         string
+	UserAgent  string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	ExpiresAt  time.Time `gorm:"index"`
+}
+
+func (session0006) TableName() string { return "sessions" }
+
+type favorite0007 struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null;uniqueIndex:idx_favorites_user_coin"`
+	CoinID    string `gorm:"not null;uniqueIndex:idx_favorites_user_coin"`
+	CreatedAt time.Time
+}
+
+func (favorite0007) TableName() string { return "favorites" }
@@ -0,0 +1,103 @@
+package migrations
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+// Migration is a single ordered, reversible schema change
+type Migration struct {
+	ID   string
+	Up   func(tx *gorm.DB) error
+	Down func(tx *gorm.DB) error
+}
+
+// SchemaMigration records an applied migration in the schema_migrations table
+type SchemaMigration struct {
+	ID        string    `gorm:"primaryKey"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Migrate applies every pending migration in order, each in its own transaction
+func Migrate(db *gorm.DB) error {
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	applied, err := appliedIDs(db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if applied[m.ID] {
+			continue
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{ID: m.ID, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %s failed: %w", m.ID, err)
+		}
+		log.Printf("Applied migration %s", m.ID)
+	}
+
+	return nil
+}
+
+// Rollback reverts the most recently applied migration
+func Rollback(db *gorm.DB) error {
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	applied, err := appliedIDs(db)
+	if err != nil {
+		return err
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if !applied[m.ID] {
+			continue
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{ID: m.ID}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("rollback %s failed: %w", m.ID, err)
+		}
+		log.Printf("Rolled back migration %s", m.ID)
+		return nil
+	}
+
+	log.Println("No migrations to roll back")
+	return nil
+}
+
+func appliedIDs(db *gorm.DB) (map[string]bool, error) {
+	var rows []SchemaMigration
+	if err := db.Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("load schema_migrations: %w", err)
+	}
+
+	applied := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		applied[row.ID] = true
+	}
+	return applied, nil
+}
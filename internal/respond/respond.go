@@ -0,0 +1,106 @@
+// Package respond writes API responses in the shared APIResponse envelope,
+// as JSON or, when the Accept header asks for it, XML
+package respond
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"my-go-backend/pkg/models"
+)
+
+// Raw reports whether the client asked for bare success responses with
+// ?envelope=false. Values that aren't booleans keep the envelope.
+func Raw(c *gin.Context) bool {
+	envelope, err := strconv.ParseBool(c.DefaultQuery("envelope", "true"))
+	return err == nil && !envelope
+}
+
+// OK writes a 200 success response
+func OK(c *gin.Context, message string, data interface{}) {
+	Success(c, http.StatusOK, message, data)
+}
+
+// Created writes a 201 success response
+func Created(c *gin.Context, message string, data interface{}) {
+	Success(c, http.StatusCreated, message, data)
+}
+
+// Success writes data wrapped in an APIResponse, or on its own when Raw. A
+// bare response without data is an empty 204.
+func Success(c *gin.Context, status int, message string, data interface{}) {
+	if Raw(c) {
+		if data == nil {
+			c.Status(http.StatusNoContent)
+			return
+		}
+		write(c, status, data)
+		return
+	}
+
+	write(c, status, models.APIResponse{
+		Success: true,
+		Message: message,
+		Data:    data,
+	})
+}
+
+// statusCodes are the generic error codes for errors that don't carry one
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            models.CodeValidation,
+	http.StatusUnauthorized:          models.CodeUnauthorized,
+	http.StatusForbidden:             models.CodeForbidden,
+	http.StatusNotFound:              models.CodeNotFound,
+	http.StatusConflict:              models.CodeConflict,
+	http.StatusRequestEntityTooLarge: models.CodePayloadTooLarge,
+	http.StatusTooManyRequests:       models.CodeRateLimited,
+	http.StatusBadGateway:            models.CodeUpstream,
+	http.StatusServiceUnavailable:    models.CodeUnavailable,
+}
+
+// ErrorCode returns err's own code when it has one (an ErrorCode method
+// anywhere in its chain), otherwise the generic code for status
+func ErrorCode(status int, err error) string {
+	var coded interface{ ErrorCode() string }
+	if errors.As(err, &coded) {
+		return coded.ErrorCode()
+	}
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	if status >= http.StatusInternalServerError {
+		return models.CodeInternal
+	}
+	return models.CodeValidation
+}
+
+// Error writes a failed response. err may be nil when the message says it
+// all. The request ID is included so clients can quote it, and the code is
+// chosen by ErrorCode.
+func Error(c *gin.Context, status int, message string, err error) {
+	ErrorWithData(c, status, message, nil, err)
+}
+
+// ErrorWithData is Error for failures that still describe something, such
+// as a failed readiness check
+func ErrorWithData(c *gin.Context, status int, message string, data interface{}, err error) {
+	response := models.APIResponse{
+		Success:   false,
+		RequestID: c.GetString("request_id"),
+		Message:   message,
+		Data:      data,
+		Code:      ErrorCode(status, err),
+	}
+	if err != nil {
+		response.Error = err.Error()
+	}
+	write(c, status, response)
+}
+
+// Abort is Error for middleware: it also stops the remaining handlers
+func Abort(c *gin.Context, status int, message string, err error) {
+	Error(c, status, message, err)
+	c.Abort()
+}
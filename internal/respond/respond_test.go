@@ -0,0 +1,225 @@
+package respond
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"my-go-backend/pkg/models"
+)
+
+// codedErr is an error with its own code, like services.CodedError
+type codedErr string
+
+func (e codedErr) Error() string     { return "coded" }
+func (e codedErr) ErrorCode() string { return string(e) }
+
+// serve runs handler for a GET of target, with the request ID set the way
+// the RequestID middleware does
+func serve(t *testing.T, target string, handler gin.HandlerFunc) (*httptest.ResponseRecorder, map[string]json.RawMessage) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("request_id", "req-123") })
+	router.GET("/", handler)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+
+	var body map[string]json.RawMessage
+	if w.Body.Len() > 0 {
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("invalid JSON body %q: %v", w.Body.String(), err)
+		}
+	}
+	return w, body
+}
+
+func keys(m map[string]json.RawMessage) []string {
+	out := make([]string, 0, len(m))
+	for key := range m {
+		out = append(out, key)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestSuccessShape(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   string
+		handler  gin.HandlerFunc
+		status   int
+		wantKeys []string
+		wantData string
+	}{
+		{
+			name:     "ok",
+			target:   "/",
+			handler:  func(c *gin.Context) { OK(c, "Coin retrieved", map[string]int{"price": 1}) },
+			status:   http.StatusOK,
+			wantKeys: []string{"data", "message", "success"},
+			wantData: `{"price":1}`,
+		},
+		{
+			name:     "created",
+			target:   "/",
+			handler:  func(c *gin.Context) { Created(c, "Alert created", map[string]int{"id": 7}) },
+			status:   http.StatusCreated,
+			wantKeys: []string{"data", "message", "success"},
+			wantData: `{"id":7}`,
+		},
+		{
+			name:     "no data",
+			target:   "/",
+			handler:  func(c *gin.Context) { OK(c, "Logged out", nil) },
+			status:   http.StatusOK,
+			wantKeys: []string{"message", "success"},
+		},
+		{
+			name:     "raw",
+			target:   "/?envelope=false",
+			handler:  func(c *gin.Context) { OK(c, "Coin retrieved", map[string]int{"price": 1}) },
+			status:   http.StatusOK,
+			wantKeys: []string{"price"},
+		},
+		{
+			name:    "raw without data",
+			target:  "/?envelope=false",
+			handler: func(c *gin.Context) { OK(c, "Logged out", nil) },
+			status:  http.StatusNoContent,
+		},
+		{
+			name:     "non-boolean envelope keeps it",
+			target:   "/?envelope=nope",
+			handler:  func(c *gin.Context) { OK(c, "Coin retrieved", map[string]int{"price": 1}) },
+			status:   http.StatusOK,
+			wantKeys: []string{"data", "message", "success"},
+			wantData: `{"price":1}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, body := serve(t, tt.target, tt.handler)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if got := keys(body); !slices.Equal(got, tt.wantKeys) {
+				t.Errorf("keys = %q, want %q", got, tt.wantKeys)
+			}
+			if success, ok := body["success"]; ok && string(success) != "true" {
+				t.Errorf("success = %s, want true", success)
+			}
+			if tt.wantData != "" && string(body["data"]) != tt.wantData {
+				t.Errorf("data = %s, want %s", body["data"], tt.wantData)
+			}
+		})
+	}
+}
+
+func TestErrorShape(t *testing.T) {
+	w, body := serve(t, "/?envelope=false", func(c *gin.Context) {
+		Error(c, http.StatusNotFound, "Coin not found", fmt.Errorf("lookup: %w", codedErr(models.CodeCoinNotFound)))
+	})
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404", w.Code)
+	}
+
+	// Errors keep the envelope even when a bare response was asked for
+	want := map[string]string{
+		"success":    "false",
+		"message":    `"Coin not found"`,
+		"error":      `"lookup: coded"`,
+		"code":       `"COIN_NOT_FOUND"`,
+		"request_id": `"req-123"`,
+	}
+	if got := keys(body); len(got) != len(want) {
+		t.Errorf("keys = %q, want the five error fields", got)
+	}
+	for key, value := range want {
+		if string(body[key]) != value {
+			t.Errorf("%s = %s, want %s", key, body[key], value)
+		}
+	}
+}
+
+func TestErrorWithoutErr(t *testing.T) {
+	_, body := serve(t, "/", func(c *gin.Context) {
+		Error(c, http.StatusUnauthorized, "Invalid token", nil)
+	})
+	if _, ok := body["error"]; ok {
+		t.Errorf("error field set without an error: %s", body["error"])
+	}
+	if string(body["code"]) != `"UNAUTHORIZED"` {
+		t.Errorf("code = %s, want UNAUTHORIZED", body["code"])
+	}
+}
+
+func TestErrorWithData(t *testing.T) {
+	w, body := serve(t, "/", func(c *gin.Context) {
+		ErrorWithData(c, http.StatusServiceUnavailable, "Not ready", map[string]string{"database": "down"}, errors.New("ping failed"))
+	})
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", w.Code)
+	}
+	if string(body["data"]) != `{"database":"down"}` || string(body["code"]) != `"SERVICE_UNAVAILABLE"` {
+		t.Errorf("body = %s", w.Body.String())
+	}
+}
+
+func TestAbortStopsHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	reached := false
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		Abort(c, http.StatusForbidden, "Insufficient permissions", nil)
+	})
+	router.GET("/", func(c *gin.Context) { reached = true })
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if reached {
+		t.Error("handler ran after Abort")
+	}
+	var response models.APIResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+	if w.Code != http.StatusForbidden || response.Success || response.Code != models.CodeForbidden ||
+		response.Message != "Insufficient permissions" {
+		t.Errorf("status %d, body %+v", w.Code, response)
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		err    error
+		want   string
+	}{
+		{"own code wins over the status", http.StatusTooManyRequests, codedErr(models.CodeQuotaExceeded), models.CodeQuotaExceeded},
+		{"own code found when wrapped", http.StatusNotFound, fmt.Errorf("get: %w", codedErr(models.CodeUserNotFound)), models.CodeUserNotFound},
+		{"plain error uses the status", http.StatusNotFound, errors.New("missing"), models.CodeNotFound},
+		{"nil error uses the status", http.StatusTooManyRequests, nil, models.CodeRateLimited},
+		{"bad request", http.StatusBadRequest, nil, models.CodeValidation},
+		{"unmapped 5xx", http.StatusGatewayTimeout, nil, models.CodeInternal},
+		{"unmapped 4xx", http.StatusUnprocessableEntity, nil, models.CodeValidation},
+	}
+
+	for _, tt := range tests {
+		if got := ErrorCode(tt.status, tt.err); got != tt.want {
+			t.Errorf("%s: ErrorCode = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package respond
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MIME types served as XML; anything else gets JSON
+var xmlTypes = []string{gin.MIMEXML, gin.MIMEXML2}
+
+// wantsXML reports whether the Accept header prefers XML over JSON. Clients
+// that send no Accept header, or accept anything, get JSON.
+func wantsXML(c *gin.Context) bool {
+	c.Writer.Header().Add("Vary", "Accept")
+	format := c.NegotiateFormat(append([]string{gin.MIMEJSON}, xmlTypes...)...)
+	return format == gin.MIMEXML || format == gin.MIMEXML2
+}
+
+// write sends v as JSON, or as XML when the client asked for it
+func write(c *gin.Context, status int, v interface{}) {
+	if !wantsXML(c) {
+		c.JSON(status, v)
+		return
+	}
+
+	body, err := toXML("response", v)
+	if err != nil {
+		c.JSON(status, v)
+		return
+	}
+	c.Data(status, gin.MIMEXML+"; charset=utf-8", body)
+}
+
+// toXML encodes v as XML with the same structure and names as its JSON
+// form, so models need no xml tags and maps (which encoding/xml can't
+// handle) work too. Objects become child elements named after their keys,
+// array entries become <item> elements and null becomes an empty element.
+// Keys that aren't valid element names are written as <entry key="...">.
+func toXML(root string, v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	if err := encodeXMLValue(dec, enc, xml.StartElement{Name: xml.Name{Local: root}}); err != nil {
+		return nil, err
+	}
+	if err := enc.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeXMLValue reads one JSON value from dec and writes it as the element start
+func encodeXMLValue(dec *json.Decoder, enc *xml.Encoder, start xml.StartElement) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+
+	switch t := tok.(type) {
+	case json.Delim:
+		for dec.More() {
+			child := xml.StartElement{Name: xml.Name{Local: "item"}}
+			if t == '{' {
+				keyTok, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				child = keyElement(keyTok.(string))
+			}
+			if err := encodeXMLValue(dec, enc, child); err != nil {
+				return err
+			}
+		}
+		// Closing "}" or "]"
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+	case string:
+		err = enc.EncodeToken(xml.CharData(t))
+	case json.Number:
+		err = enc.EncodeToken(xml.CharData(t.String()))
+	case bool:
+		err = enc.EncodeToken(xml.CharData(strconv.FormatBool(t)))
+	case nil:
+	default:
+		err = fmt.Errorf("unexpected JSON token %v", tok)
+	}
+	if err != nil {
+		return err
+	}
+	return enc.EncodeToken(start.End())
+}
+
+// keyElement names an element after a JSON object key when the key is a
+// valid XML name, and uses <entry key="..."> otherwise
+func keyElement(key string) xml.StartElement {
+	if isXMLName(key) {
+		return xml.StartElement{Name: xml.Name{Local: key}}
+	}
+	return xml.StartElement{
+		Name: xml.Name{Local: "entry"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: key}},
+	}
+}
+
+// isXMLName is a conservative check: a letter or "_", then letters, digits,
+// "_", "-" or ".", and not starting with "xml"
+func isXMLName(name string) bool {
+	if name == "" || (len(name) >= 3 && strings.EqualFold(name[:3], "xml")) {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case unicode.IsLetter(r) || r == '_':
+		case i > 0 && (unicode.IsDigit(r) || r == '-' || r == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
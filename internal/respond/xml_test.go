@@ -0,0 +1,185 @@
+package respond
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"my-go-backend/pkg/models"
+)
+
+func TestToXML(t *testing.T) {
+	tests := []struct {
+		name string
+		in   interface{}
+		want string // Body after the XML header
+	}{
+		{
+			name: "scalars",
+			in:   map[string]interface{}{"name": "bitcoin", "price": 50000.5, "ok": true},
+			want: "<response><name>bitcoin</name><ok>true</ok><price>50000.5</price></response>",
+		},
+		{
+			name: "nested objects",
+			in:   map[string]interface{}{"data": map[string]interface{}{"coin": map[string]interface{}{"id": "bitcoin"}}},
+			want: "<response><data><coin><id>bitcoin</id></coin></data></response>",
+		},
+		{
+			name: "arrays become items",
+			in:   map[string]interface{}{"coins": []interface{}{"bitcoin", map[string]interface{}{"id": "ethereum"}, []int{1, 2}}},
+			want: "<response><coins><item>bitcoin</item><item><id>ethereum</id></item><item><item>1</item><item>2</item></item></coins></response>",
+		},
+		{
+			name: "empty array and object",
+			in:   map[string]interface{}{"a": []string{}, "b": map[string]string{}},
+			want: "<response><a></a><b></b></response>",
+		},
+		{
+			name: "null is an empty element",
+			in:   map[string]interface{}{"missing": nil, "list": []interface{}{nil}},
+			want: "<response><list><item></item></list><missing></missing></response>",
+		},
+		{
+			name: "invalid element names become entries",
+			in:   map[string]interface{}{"1h": 1, "with space": 2, "xmlns": 3, "a&b": 4},
+			want: `<response><entry key="1h">1</entry><entry key="a&amp;b">4</entry><entry key="with space">2</entry><entry key="xmlns">3</entry></response>`,
+		},
+		{
+			name: "text is escaped",
+			in:   map[string]interface{}{"error": `<script>"&"</script>`},
+			want: "<response><error>&lt;script&gt;&#34;&amp;&#34;&lt;/script&gt;</error></response>",
+		},
+		{
+			name: "large numbers keep their digits",
+			in:   map[string]interface{}{"market_cap": int64(1234567890123456789)},
+			want: "<response><market_cap>1234567890123456789</market_cap></response>",
+		},
+		{
+			name: "top-level array",
+			in:   []string{"a", "b"},
+			want: "<response><item>a</item><item>b</item></response>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := toXML("response", tt.in)
+			if err != nil {
+				t.Fatalf("toXML: %v", err)
+			}
+
+			got, ok := strings.CutPrefix(string(body), xml.Header)
+			if !ok {
+				t.Fatalf("missing XML header: %s", body)
+			}
+			if got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+
+			// The output must be well-formed
+			dec := xml.NewDecoder(strings.NewReader(string(body)))
+			for {
+				if _, err := dec.Token(); err != nil {
+					if err.Error() != "EOF" {
+						t.Errorf("invalid XML: %v", err)
+					}
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestIsXMLName(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"price", true},
+		{"change_percent_24h", true},
+		{"_private", true},
+		{"a-b.c", true},
+		{"prix", true},
+		{"", false},
+		{"1h", false},
+		{"-x", false},
+		{"with space", false},
+		{"a:b", false},
+		{"xml", false},
+		{"XMLData", false},
+		{"a&b", false},
+	}
+
+	for _, tt := range tests {
+		if got := isXMLName(tt.name); got != tt.want {
+			t.Errorf("isXMLName(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWriteNegotiatesXML(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.GET("/", func(c *gin.Context) {
+		OK(c, "Portfolio retrieved", models.PortfolioResponse{
+			Portfolio:    []models.CryptoData{{ID: "bitcoin", Price: 50000}},
+			TotalValue:   50000,
+			SuccessCount: 1,
+		})
+	})
+
+	tests := []struct {
+		accept  string
+		wantXML bool
+	}{
+		{"", false},
+		{"*/*", false},
+		{"application/json", false},
+		{"application/xml", true},
+		{"text/xml", true},
+		{"application/json, application/xml", false},
+		{"application/xml, application/json", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			contentType := w.Header().Get("Content-Type")
+			if isXML := strings.HasPrefix(contentType, gin.MIMEXML); isXML != tt.wantXML {
+				t.Fatalf("Content-Type = %q, want XML %v", contentType, tt.wantXML)
+			}
+			if !tt.wantXML {
+				return
+			}
+
+			var decoded struct {
+				XMLName xml.Name `xml:"response"`
+				Success bool     `xml:"success"`
+				Data    struct {
+					Portfolio []struct {
+						ID    string  `xml:"id"`
+						Price float64 `xml:"price"`
+					} `xml:"portfolio>item"`
+					TotalValue float64 `xml:"total_value"`
+				} `xml:"data"`
+			}
+			if err := xml.Unmarshal(w.Body.Bytes(), &decoded); err != nil {
+				t.Fatalf("invalid XML body: %v\n%s", err, w.Body.String())
+			}
+			if !decoded.Success || decoded.Data.TotalValue != 50000 ||
+				len(decoded.Data.Portfolio) != 1 || decoded.Data.Portfolio[0].ID != "bitcoin" {
+				t.Errorf("unexpected body: %s", w.Body.String())
+			}
+		})
+	}
+}
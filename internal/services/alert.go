@@ -0,0 +1,113 @@
+package services
+
+import (
+	"gorm.io/gorm"
+	"my-go-backend/pkg/models"
+	"time"
+)
+
+// ErrAlertNotFound is returned when the user has no alert with the given id
+var ErrAlertNotFound = newCodedError(models.CodeAlertNotFound, "alert not found")
+
+type AlertService struct {
+	db *gorm.DB
+}
+
+func NewAlertService(db *gorm.DB) *AlertService {
+	return &AlertService{db: db}
+}
+
+func (s *AlertService) CreateAlert(userID uint, req *models.CreateAlertRequest) (*models.PriceAlert, error) {
+	coinID, err := NormalizeCoinID(req.CoinID)
+	if err != nil {
+		return nil, err
+	}
+
+	alert := models.PriceAlert{
+		UserID:      userID,
+		CoinID:      coinID,
+		Direction:   req.Direction,
+		TargetPrice: req.TargetPrice,
+	}
+
+	if err := s.db.Create(&alert).Error; err != nil {
+		return nil, err
+	}
+
+	return &alert, nil
+}
+
+func (s *AlertService) GetUserAlerts(userID uint) ([]models.PriceAlert, error) {
+	alerts := []models.PriceAlert{}
+	if err := s.db.Where("user_id = ?", userID).Order("id").Find(&alerts).Error; err != nil {
+		return nil, err
+	}
+	return alerts, nil
+}
+
+func (s *AlertService) DeleteAlert(userID, alertID uint) error {
+	result := s.db.Where("id = ? AND user_id = ?", alertID, userID).Delete(&models.PriceAlert{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAlertNotFound
+	}
+	return nil
+}
+
+// ActiveCoins returns the distinct coins that have at least one alert
+func (s *AlertService) ActiveCoins() ([]string, error) {
+	var coins []string
+	if err := s.db.Model(&models.PriceAlert{}).Distinct().Pluck("coin_id", &coins).Error; err != nil {
+		return nil, err
+	}
+	return coins, nil
+}
+
+// Evaluate checks the alerts for a coin against its latest price and returns
+// the ones that just crossed their threshold. An alert fires once per crossing
+// and is re-armed when the price moves back to the other side. The flag is
+// flipped with a conditional update, so evaluations that overlap (e.g. a slow
+// streaming tick and the next one) report each crossing only once.
+func (s *AlertService) Evaluate(coinID string, price float64) ([]models.PriceAlert, error) {
+	var alerts []models.PriceAlert
+	if err := s.db.Where("coin_id = ?", coinID).Find(&alerts).Error; err != nil {
+		return nil, err
+	}
+
+	var fired []models.PriceAlert
+	for _, alert := range alerts {
+		crossed := (alert.Direction == "above" && price >= alert.TargetPrice) ||
+			(alert.Direction == "below" && price <= alert.TargetPrice)
+
+		switch {
+		case crossed && !alert.Triggered:
+			now := time.Now()
+			result := s.db.Model(&models.PriceAlert{}).
+				Where("id = ? AND triggered = ?", alert.ID, false).
+				Updates(map[string]interface{}{
+					"triggered":    true,
+					"triggered_at": now,
+				})
+			if result.Error != nil {
+				return fired, result.Error
+			}
+			// Another evaluation got there first
+			if result.RowsAffected == 0 {
+				continue
+			}
+			alert.Triggered = true
+			alert.TriggeredAt = &now
+			fired = append(fired, alert)
+		case !crossed && alert.Triggered:
+			if err := s.db.Model(&models.PriceAlert{}).
+				Where("id = ? AND triggered = ?", alert.ID, true).
+				Update("triggered", false).Error; err != nil {
+				return fired, err
+			}
+		}
+	}
+
+	return fired, nil
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+	"my-go-backend/pkg/models"
+)
+
+func TestAlertCRUD(t *testing.T) {
+	svc := NewAlertService(newTestDB(t))
+
+	alert, err := svc.CreateAlert(1, &models.CreateAlertRequest{CoinID: " Bitcoin ", Direction: "above", TargetPrice: 60000})
+	if err != nil {
+		t.Fatalf("CreateAlert: %v", err)
+	}
+	if alert.ID == 0 || alert.CoinID != "bitcoin" || alert.Triggered {
+		t.Errorf("alert = %+v, want a stored, untriggered bitcoin alert", alert)
+	}
+	if _, err := svc.CreateAlert(1, &models.CreateAlertRequest{CoinID: "bit/coin", Direction: "below", TargetPrice: 1}); !errors.Is(err, ErrInvalidCoinID) {
+		t.Errorf("invalid coin: error = %v, want ErrInvalidCoinID", err)
+	}
+	if _, err := svc.CreateAlert(2, &models.CreateAlertRequest{CoinID: "ethereum", Direction: "below", TargetPrice: 2000}); err != nil {
+		t.Fatalf("CreateAlert for user 2: %v", err)
+	}
+
+	alerts, err := svc.GetUserAlerts(1)
+	if err != nil {
+		t.Fatalf("GetUserAlerts: %v", err)
+	}
+	if len(alerts) != 1 || alerts[0].ID != alert.ID {
+		t.Errorf("user 1 alerts = %+v, want only their own", alerts)
+	}
+
+	// Another user's alert is as good as missing
+	if err := svc.DeleteAlert(2, alert.ID); !errors.Is(err, ErrAlertNotFound) {
+		t.Errorf("deleting another user's alert: error = %v, want ErrAlertNotFound", err)
+	}
+	if err := svc.DeleteAlert(1, alert.ID); err != nil {
+		t.Fatalf("DeleteAlert: %v", err)
+	}
+	if err := svc.DeleteAlert(1, alert.ID); !errors.Is(err, ErrAlertNotFound) {
+		t.Errorf("deleting twice: error = %v, want ErrAlertNotFound", err)
+	}
+	if alerts, _ := svc.GetUserAlerts(1); len(alerts) != 0 {
+		t.Errorf("alerts after delete = %+v, want none", alerts)
+	}
+}
+
+func TestAlertEvaluate(t *testing.T) {
+	svc := NewAlertService(newTestDB(t))
+	above, _ := svc.CreateAlert(1, &models.CreateAlertRequest{CoinID: "bitcoin", Direction: "above", TargetPrice: 60000})
+	below, _ := svc.CreateAlert(1, &models.CreateAlertRequest{CoinID: "bitcoin", Direction: "below", TargetPrice: 40000})
+	svc.CreateAlert(1, &models.CreateAlertRequest{CoinID: "ethereum", Direction: "above", TargetPrice: 1})
+
+	steps := []struct {
+		name  string
+		price float64
+		want  []uint // Alerts fired, in id order
+	}{
+		{"between the targets", 50000, nil},
+		{"crosses above", 61000, []uint{above.ID}},
+		{"stays above: fires once per crossing", 62000, nil},
+		{"target price counts as crossed", 60000, nil},
+		{"back between re-arms", 50000, nil},
+		{"crosses above again", 60000, []uint{above.ID}},
+		{"crosses below", 39000, []uint{below.ID}},
+		{"stays below", 30000, nil},
+	}
+
+	for _, step := range steps {
+		fired, err := svc.Evaluate("bitcoin", step.price)
+		if err != nil {
+			t.Fatalf("%s: Evaluate: %v", step.name, err)
+		}
+		var ids []uint
+		for _, alert := range fired {
+			ids = append(ids, alert.ID)
+			if !alert.Triggered || alert.TriggeredAt == nil {
+				t.Errorf("%s: fired alert %+v not marked triggered", step.name, alert)
+			}
+		}
+		if len(ids) != len(step.want) || (len(ids) > 0 && ids[0] != step.want[0]) {
+			t.Errorf("%s at %v: fired %v, want %v", step.name, step.price, ids, step.want)
+		}
+	}
+}
+
+func TestAlertEvaluateOverlapping(t *testing.T) {
+	db := newTestDB(t)
+	svc := NewAlertService(db)
+	alert, _ := svc.CreateAlert(1, &models.CreateAlertRequest{CoinID: "bitcoin", Direction: "above", TargetPrice: 60000})
+
+	// A second evaluation (e.g. the next streaming tick) runs to completion
+	// between the first one loading the alerts and updating them
+	var overlapping []models.PriceAlert
+	started := false
+	err := db.Callback().Query().After("gorm:query").Register("test:overlap", func(tx *gorm.DB) {
+		if started {
+			return
+		}
+		started = true
+		var err error
+		if overlapping, err = svc.Evaluate("bitcoin", 61000); err != nil {
+			t.Errorf("overlapping Evaluate: %v", err)
+		}
+	})
+	if err != nil {
+		t.Fatalf("registering callback: %v", err)
+	}
+
+	fired, err := svc.Evaluate("bitcoin", 61000)
+	if err != nil {
+		t.Fatalf("Evaluate: %v", err)
+	}
+	if len(overlapping) != 1 || len(fired) != 0 {
+		t.Errorf("alert %d fired %d times in the overlapping evaluation and %d in the first, want once in total",
+			alert.ID, len(overlapping), len(fired))
+	}
+}
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"gorm.io/gorm"
+	"log"
+	"my-go-backend/pkg/models"
+)
+
+// Pagination bounds for ListAuthEvents
+const (
+	DefaultAuthEventPageSize = 20
+	MaxAuthEventPageSize     = 100
+)
+
+// AuthEventListOptions filters ListAuthEvents
+type AuthEventListOptions struct {
+	UserID *uint  // Only this user's events; nil for everyone
+	Type   string // Only this event type, e.g. "login"
+}
+
+// recordEvent writes an audit entry. It is best-effort: a failed write is
+// logged and never fails the operation being audited. Operations that change
+// an account write their entry with insertEvent inside their transaction.
+func (s *AuthService) recordEvent(userID *uint, eventType string, success bool, client models.ClientInfo) {
+	if err := insertEvent(s.db, userID, eventType, success, client); err != nil {
+		log.Printf("Failed to record %s auth event: %v", eventType, err)
+	}
+}
+
+// insertEvent writes an audit entry with db, which may be a transaction
+func insertEvent(db *gorm.DB, userID *uint, eventType string, success bool, client models.ClientInfo) error {
+	event := models.AuthEvent{
+		UserID:    userID,
+		Type:      eventType,
+		Success:   success,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+	}
+	return db.Create(&event).Error
+}
+
+// ListAuthEvents returns audit entries, newest first
+func (s *AuthService) ListAuthEvents(page, limit int, opts AuthEventListOptions) (*models.PaginatedResponse, error) {
+	filtered := func(tx *gorm.DB) *gorm.DB {
+		query := tx.Model(&models.AuthEvent{})
+		if opts.UserID != nil {
+			query = query.Where("user_id = ?", *opts.UserID)
+		}
+		if opts.Type != "" {
+			query = query.Where("type = ?", opts.Type)
+		}
+		return query
+	}
+
+	events := []models.AuthEvent{}
+	return paginate(s.db, filtered, "id desc", page, limit, MaxAuthEventPageSize, &events)
+}
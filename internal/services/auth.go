@@ -3,81 +3,254 @@ package services
 import (
 	"errors"
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 	"my-go-backend/pkg/models"
+	"strings"
 	"time"
 )
 
+// ErrInvalidPassword is returned when a password re-confirmation fails
+var ErrInvalidPassword = newCodedError(models.CodeInvalidPassword, "invalid password")
+
+// ErrInvalidCredentials is returned when a login's email or password is wrong
+var ErrInvalidCredentials = newCodedError(models.CodeInvalidCredentials, "invalid credentials")
+
+// ErrInvalidRefreshToken is returned when a refresh token is malformed,
+// expired, not a refresh token, belongs to a deleted user, or its session
+// was revoked
+var ErrInvalidRefreshToken = newCodedError(models.CodeInvalidRefreshToken, "invalid refresh token")
+
+// Token types, stored in the "typ" claim. Tokens without one predate refresh
+// tokens and are access tokens.
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+)
+
 type AuthService struct {
-	db        *gorm.DB
-	jwtSecret string
-	jwtExpiry time.Duration
+	db          *gorm.DB
+	jwtSecret   string
+	accessTTL   time.Duration
+	refreshTTL  time.Duration
+	jwtIssuer   string
+	jwtAudience string
+
+	// Clients that may get service tokens, by id; see WithServiceClients
+	serviceClients  map[string]ServiceClient
+	serviceTokenTTL time.Duration
 }
 
-func NewAuthService(db *gorm.DB, jwtSecret string, jwtExpiry time.Duration) *AuthService {
-	return &AuthService{
-		db:        db,
-		jwtSecret: jwtSecret,
-		jwtExpiry: jwtExpiry,
+func NewAuthService(db *gorm.DB, jwtSecret string, accessTTL, refreshTTL time.Duration, jwtIssuer, jwtAudience string, opts ...AuthServiceOption) *AuthService {
+	s := &AuthService{
+		db:              db,
+		jwtSecret:       jwtSecret,
+		accessTTL:       accessTTL,
+		refreshTTL:      refreshTTL,
+		jwtIssuer:       jwtIssuer,
+		jwtAudience:     jwtAudience,
+		serviceTokenTTL: DefaultServiceTokenTTL,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
-func (s *AuthService) Register(req *models.CreateUserRequest) (*models.UserResponse, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+func (s *AuthService) Register(req *models.CreateUserRequest, client models.ClientInfo) (*models.UserResponse, error) {
+	username, err := NormalizeUsername(req.Username)
+	if err != nil {
+		return nil, err
+	}
+	email, err := NormalizeEmail(req.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := HashPassword(req.Password, PasswordCost)
 	if err != nil {
 		return nil, err
 	}
 
 	user := models.User{
-		Username: req.Username,
-		Email:    req.Email,
-		Password: string(hashedPassword),
+		Username: username,
+		Email:    email,
+		Password: hashedPassword,
+		Role:     models.RoleUser,
 	}
 
-	if err := s.db.Create(&user).Error; err != nil {
+	// The account only exists together with its audit entry
+	err = withTx(s.db, func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		return insertEvent(tx, &user.ID, models.AuthEventRegister, true, client)
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	return &models.UserResponse{
-		ID:       user.ID,
-		Username: user.Username,
-		Email:    user.Email,
-	}, nil
+	return newUserResponse(&user), nil
+}
+
+func (s *AuthService) Login(req *models.LoginRequest, client models.ClientInfo) (*models.AuthResponse, error) {
+	// Stored emails are lowercased, so match the same way. Login doesn't
+	// validate the format; an odd email simply won't be found.
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+
+	var user models.User
+	if err := s.db.Where("email = ?", email).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			s.recordEvent(nil, models.AuthEventLogin, false, client)
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	if !CheckPassword(user.Password, req.Password) {
+		s.recordEvent(&user.ID, models.AuthEventLogin, false, client)
+		return nil, ErrInvalidCredentials
+	}
+
+	session, err := s.startSession(user.ID, client)
+	if err != nil {
+		return nil, err
+	}
+	auth, err := s.issueTokens(&user, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	s.recordEvent(&user.ID, models.AuthEventLogin, true, client)
+	return auth, nil
 }
 
-func (s *AuthService) Login(req *models.LoginRequest) (*models.AuthResponse, error) {
+// Refresh exchanges a refresh token for a new access and refresh token pair.
+// The user is re-read so a changed role takes effect and a deleted account
+// can't refresh. Old refresh tokens stay valid until they expire or their
+// session is revoked. Tokens without a "sid" claim predate sessions and
+// start a new one.
+func (s *AuthService) Refresh(refreshToken string, client models.ClientInfo) (*models.AuthResponse, error) {
+	token, err := jwt.Parse(refreshToken, func(token *jwt.Token) (interface{}, error) {
+		return []byte(s.jwtSecret), nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(s.jwtIssuer),
+		jwt.WithAudience(s.jwtAudience),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil || !token.Valid {
+		s.recordEvent(nil, models.AuthEventRefresh, false, client)
+		return nil, ErrInvalidRefreshToken
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["typ"] != TokenTypeRefresh {
+		s.recordEvent(nil, models.AuthEventRefresh, false, client)
+		return nil, ErrInvalidRefreshToken
+	}
+	claimedID, ok := claims["user_id"].(float64)
+	if !ok {
+		s.recordEvent(nil, models.AuthEventRefresh, false, client)
+		return nil, ErrInvalidRefreshToken
+	}
+	userID := uint(claimedID)
+
 	var user models.User
-	if err := s.db.Where("email = ?", req.Email).First(&user).Error; err != nil {
+	if err := s.db.First(&user, userID).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("invalid credentials")
+			s.recordEvent(&userID, models.AuthEventRefresh, false, client)
+			return nil, ErrInvalidRefreshToken
 		}
 		return nil, err
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
-		return nil, errors.New("invalid credentials")
+	sessionID, _ := claims["sid"].(string)
+	if sessionID == "" {
+		session, err := s.startSession(userID, client)
+		if err != nil {
+			return nil, err
+		}
+		sessionID = session.ID
+	} else if err := s.touchSession(userID, sessionID, client); err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			s.recordEvent(&userID, models.AuthEventRefresh, false, client)
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
 	}
 
-	token, err := s.generateToken(user.ID)
+	auth, err := s.issueTokens(&user, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	s.recordEvent(&userID, models.AuthEventRefresh, true, client)
+	return auth, nil
+}
+
+// issueTokens signs a new access and refresh token pair for user, tying the
+// refresh token to sessionID
+func (s *AuthService) issueTokens(user *models.User, sessionID string) (*models.AuthResponse, error) {
+	accessToken, err := s.generateToken(user.ID, user.Role, TokenTypeAccess, "", s.accessTTL)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := s.generateToken(user.ID, user.Role, TokenTypeRefresh, sessionID, s.refreshTTL)
 	if err != nil {
 		return nil, err
 	}
 
 	return &models.AuthResponse{
-		Token: token,
-		User: models.UserResponse{
-			ID:       user.ID,
-			Username: user.Username,
-			Email:    user.Email,
-		},
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(s.accessTTL.Seconds()),
+		User:         *newUserResponse(user),
 	}, nil
 }
 
-func (s *AuthService) generateToken(userID uint) (string, error) {
+// DeleteAccount soft-deletes the user after re-checking their password, so a
+// stolen or forgotten-open session alone can't remove the account. Their
+// sessions are deleted; access tokens already issued stay valid until they
+// expire.
+func (s *AuthService) DeleteAccount(userID uint, password string, client models.ClientInfo) error {
+	var user models.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+
+	if !CheckPassword(user.Password, password) {
+		s.recordEvent(&userID, models.AuthEventAccountDeleted, false, client)
+		return ErrInvalidPassword
+	}
+
+	return withTx(s.db, func(tx *gorm.DB) error {
+		if err := tx.Delete(&user).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.Session{}).Error; err != nil {
+			return err
+		}
+		return insertEvent(tx, &userID, models.AuthEventAccountDeleted, true, client)
+	})
+}
+
+// generateToken signs a token of the given type that expires after ttl. A
+// non-empty sessionID is stored in the "sid" claim.
+func (s *AuthService) generateToken(userID uint, role, tokenType, sessionID string, ttl time.Duration) (string, error) {
+	now := time.Now()
 	claims := jwt.MapClaims{
 		"user_id": userID,
-		"exp":     time.Now().Add(s.jwtExpiry).Unix(),
+		"role":    role,
+		"typ":     tokenType,
+		"iss":     s.jwtIssuer,
+		"aud":     s.jwtAudience,
+		"iat":     now.Unix(),
+		"nbf":     now.Unix(),
+		"exp":     now.Add(ttl).Unix(),
+	}
+	if sessionID != "" {
+		claims["sid"] = sessionID
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
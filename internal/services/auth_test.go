@@ -0,0 +1,131 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+	"my-go-backend/pkg/models"
+)
+
+const testJWTSecret = "test-secret"
+
+// newTestAuthService returns an auth service with a 15 minute access token
+// and a 7 day refresh token
+func newTestAuthService(t *testing.T, db *gorm.DB) *AuthService {
+	t.Helper()
+	return NewAuthService(db, testJWTSecret, 15*time.Minute, 7*24*time.Hour, "test-issuer", "test-audience")
+}
+
+// registerUser creates an account through Register
+func registerUser(t *testing.T, s *AuthService, username, email, password string) *models.UserResponse {
+	t.Helper()
+	user, err := s.Register(&models.CreateUserRequest{Username: username, Email: email, Password: password}, models.ClientInfo{})
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	return user
+}
+
+// tokenLifetime returns how long a signed token is valid for, from its
+// "iat" and "exp" claims
+func tokenLifetime(t *testing.T, token string) time.Duration {
+	t.Helper()
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return []byte(testJWTSecret), nil
+	})
+	if err != nil {
+		t.Fatalf("parsing token: %v", err)
+	}
+	issued, err := claims.GetIssuedAt()
+	if err != nil || issued == nil {
+		t.Fatalf("token has no iat: %v", err)
+	}
+	expires, err := claims.GetExpirationTime()
+	if err != nil || expires == nil {
+		t.Fatalf("token has no exp: %v", err)
+	}
+	return expires.Sub(issued.Time)
+}
+
+func TestTokenExpiryPerType(t *testing.T) {
+	s := newTestAuthService(t, newTestDB(t))
+	registerUser(t, s, "alice", "alice@example.com", "password123")
+
+	auth, err := s.Login(&models.LoginRequest{Email: "alice@example.com", Password: "password123"}, models.ClientInfo{})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if got := tokenLifetime(t, auth.Token); got != 15*time.Minute {
+		t.Errorf("access token lifetime = %v, want 15m", got)
+	}
+	if got := tokenLifetime(t, auth.RefreshToken); got != 7*24*time.Hour {
+		t.Errorf("refresh token lifetime = %v, want 168h", got)
+	}
+	if auth.ExpiresIn != 900 {
+		t.Errorf("expires_in = %d, want 900", auth.ExpiresIn)
+	}
+
+	refreshed, err := s.Refresh(auth.RefreshToken, models.ClientInfo{})
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if got := tokenLifetime(t, refreshed.Token); got != 15*time.Minute {
+		t.Errorf("refreshed access token lifetime = %v, want 15m", got)
+	}
+}
+
+func TestLoginAuthEvents(t *testing.T) {
+	db := newTestDB(t)
+	s := newTestAuthService(t, db)
+	alice := registerUser(t, s, "alice", "alice@example.com", "password123")
+	client := models.ClientInfo{IP: "203.0.113.7", UserAgent: "test-agent"}
+
+	attempts := []models.LoginRequest{
+		{Email: "alice@example.com", Password: "password123"},
+		{Email: "alice@example.com", Password: "wrong"},
+		{Email: "nobody@example.com", Password: "password123"},
+	}
+	for _, req := range attempts {
+		s.Login(&req, client)
+	}
+
+	page, err := s.ListAuthEvents(1, 10, AuthEventListOptions{Type: models.AuthEventLogin})
+	if err != nil {
+		t.Fatalf("ListAuthEvents: %v", err)
+	}
+	events := page.Data.([]models.AuthEvent)
+	if len(events) != 3 {
+		t.Fatalf("got %d login events, want 3: %+v", len(events), events)
+	}
+
+	// Newest first
+	want := []struct {
+		userID  *uint
+		success bool
+	}{
+		{nil, false},       // Unknown email
+		{&alice.ID, false}, // Wrong password
+		{&alice.ID, true},
+	}
+	for i, w := range want {
+		event := events[i]
+		if event.Success != w.success || (event.UserID == nil) != (w.userID == nil) ||
+			(event.UserID != nil && *event.UserID != *w.userID) {
+			t.Errorf("event %d = %+v, want user %v, success %v", i, event, w.userID, w.success)
+		}
+		if event.IP != client.IP || event.UserAgent != client.UserAgent {
+			t.Errorf("event %d client = %s %q, want %s %q", i, event.IP, event.UserAgent, client.IP, client.UserAgent)
+		}
+	}
+
+	// A failed audit write doesn't fail the login
+	if err := db.Migrator().DropTable(&models.AuthEvent{}); err != nil {
+		t.Fatalf("dropping auth events: %v", err)
+	}
+	if _, err := s.Login(&attempts[0], client); err != nil {
+		t.Errorf("Login without the audit table: %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// ttlCache is a small thread-safe map whose entries expire after ttl
+type ttlCache[V any] struct {
+	mu      sync.RWMutex
+	ttl     time.Duration
+	entries map[string]ttlEntry[V]
+}
+
+type ttlEntry[V any] struct {
+	value     V
+	expiresAt time.Time
+}
+
+func newTTLCache[V any](ttl time.Duration) *ttlCache[V] {
+	return &ttlCache[V]{
+		ttl:     ttl,
+		entries: make(map[string]ttlEntry[V]),
+	}
+}
+
+func (c *ttlCache[V]) get(key string) (V, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, exists := c.entries[key]
+	if !exists || time.Now().After(entry.expiresAt) {
+		var zero V
+		return zero, false
+	}
+	return entry.value, true
+}
+
+func (c *ttlCache[V]) set(key string, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[key] = ttlEntry[V]{value: value, expiresAt: time.Now().Add(c.ttl)}
+}
+
+// sweep drops expired entries, for caches with unbounded key sets
+func (c *ttlCache[V]) sweep() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for key, entry := range c.entries {
+		if now.After(entry.expiresAt) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+func (c *ttlCache[V]) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]ttlEntry[V])
+}
+
+// lruCache is a thread-safe, size-bounded cache that evicts the least
+// recently used entry when full. Entries also expire after ttl.
+type lruCache[K comparable, V any] struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	order    *list.List // Front is most recently used
+	entries  map[K]*list.Element
+}
+
+type lruEntry[K comparable, V any] struct {
+	key      K
+	value    V
+	storedAt time.Time
+}
+
+func newLRUCache[K comparable, V any](capacity int, ttl time.Duration) *lruCache[K, V] {
+	return &lruCache[K, V]{
+		capacity: capacity,
+		ttl:      ttl,
+		order:    list.New(),
+		entries:  make(map[K]*list.Element),
+	}
+}
+
+// get returns the value and when it was stored
+func (c *lruCache[K, V]) get(key K) (V, time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, exists := c.entries[key]
+	if !exists {
+		var zero V
+		return zero, time.Time{}, false
+	}
+	entry := elem.Value.(*lruEntry[K, V])
+	if time.Since(entry.storedAt) > c.ttl {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		var zero V
+		return zero, time.Time{}, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.value, entry.storedAt, true
+}
+
+func (c *lruCache[K, V]) set(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, exists := c.entries[key]; exists {
+		elem.Value = &lruEntry[K, V]{key: key, value: value, storedAt: time.Now()}
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&lruEntry[K, V]{key: key, value: value, storedAt: time.Now()})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry[K, V]).key)
+	}
+}
+
+func (c *lruCache[K, V]) remove(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, exists := c.entries[key]; exists {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+	}
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// MaxCoinIDLength is well above the longest CoinGecko id
+const MaxCoinIDLength = 100
+
+// Coin id validation errors
+var (
+	ErrNoCoins       = errors.New("at least one coin is required")
+	ErrEmptyCoinID   = errors.New("coin ids must not be empty")
+	ErrInvalidCoinID = fmt.Errorf("coin ids may only contain lowercase letters, digits and '-', up to %d characters", MaxCoinIDLength)
+)
+
+// coinIDPattern matches CoinGecko ids such as "avalanche-2". Ids end up in
+// upstream URLs and cache keys, so nothing else ("/", "?", spaces) is allowed.
+var coinIDPattern = regexp.MustCompile(fmt.Sprintf(`^[a-z0-9-]{1,%d}$`, MaxCoinIDLength))
+
+// NormalizeCoinID lowercases and trims a coin id and checks its characters
+func NormalizeCoinID(coin string) (string, error) {
+	coin = strings.ToLower(strings.TrimSpace(coin))
+	if coin == "" {
+		return "", ErrEmptyCoinID
+	}
+	if !coinIDPattern.MatchString(coin) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidCoinID, coin)
+	}
+	return coin, nil
+}
+
+// DropBlankCoinIDs removes empty and whitespace-only ids, e.g. from a
+// trailing comma in "bitcoin,". Passing the result to NormalizeCoinIDs
+// reports ErrNoCoins when nothing is left.
+func DropBlankCoinIDs(coins []string) []string {
+	kept := make([]string, 0, len(coins))
+	for _, coin := range coins {
+		if strings.TrimSpace(coin) != "" {
+			kept = append(kept, coin)
+		}
+	}
+	return kept
+}
+
+// NormalizeCoinIDs normalizes each id with NormalizeCoinID and de-duplicates
+// them, keeping the order of first appearance, so "Bitcoin" and "bitcoin" are
+// fetched once.
+func NormalizeCoinIDs(coins []string) ([]string, error) {
+	if len(coins) == 0 {
+		return nil, ErrNoCoins
+	}
+
+	seen := make(map[string]bool, len(coins))
+	normalized := make([]string, 0, len(coins))
+	for _, coin := range coins {
+		coin, err := NormalizeCoinID(coin)
+		if err != nil {
+			return nil, err
+		}
+		if seen[coin] {
+			continue
+		}
+		seen[coin] = true
+		normalized = append(normalized, coin)
+	}
+	return normalized, nil
+}
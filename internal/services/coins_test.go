@@ -0,0 +1,105 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeCoinID(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr error
+	}{
+		{in: "bitcoin", want: "bitcoin"},
+		{in: "Bitcoin", want: "bitcoin"},
+		{in: "  ETHEREUM\t", want: "ethereum"},
+		{in: "avalanche-2", want: "avalanche-2"},
+		{in: "", wantErr: ErrEmptyCoinID},
+		{in: "   ", wantErr: ErrEmptyCoinID},
+		{in: strings.Repeat("a", MaxCoinIDLength), want: strings.Repeat("a", MaxCoinIDLength)},
+		{in: strings.Repeat("a", MaxCoinIDLength+1), wantErr: ErrInvalidCoinID},
+		{in: "../admin", wantErr: ErrInvalidCoinID},
+		{in: "bit/coin", wantErr: ErrInvalidCoinID},
+		{in: "bit coin", wantErr: ErrInvalidCoinID},
+		{in: "bitcoin?vs_currency=eur", wantErr: ErrInvalidCoinID},
+		{in: "bitcoin&x=1", wantErr: ErrInvalidCoinID},
+		{in: "bitcoin#", wantErr: ErrInvalidCoinID},
+		{in: "bit_coin", wantErr: ErrInvalidCoinID},
+		{in: "BIT.COIN", wantErr: ErrInvalidCoinID},
+		{in: "bitcoin\n", want: "bitcoin"},
+		{in: "bitcöin", wantErr: ErrInvalidCoinID},
+	}
+
+	for _, tt := range tests {
+		got, err := NormalizeCoinID(tt.in)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("NormalizeCoinID(%q) error = %v, want %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("NormalizeCoinID(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeCoinIDs(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      []string
+		want    []string
+		wantErr error
+	}{
+		{
+			name: "duplicates in any case are fetched once",
+			in:   []string{"bitcoin", "Bitcoin", " BITCOIN "},
+			want: []string{"bitcoin"},
+		},
+		{
+			name: "order of first appearance is kept",
+			in:   []string{"solana", "Bitcoin", "solana", "ethereum"},
+			want: []string{"solana", "bitcoin", "ethereum"},
+		},
+		{
+			name:    "empty id",
+			in:      []string{"bitcoin", ""},
+			wantErr: ErrEmptyCoinID,
+		},
+		{
+			name:    "one invalid id fails the list",
+			in:      []string{"bitcoin", "../ethereum"},
+			wantErr: ErrInvalidCoinID,
+		},
+		{
+			name:    "no coins",
+			in:      nil,
+			wantErr: ErrNoCoins,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeCoinIDs(tt.in)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDropBlankCoinIDs(t *testing.T) {
+	got := DropBlankCoinIDs([]string{"bitcoin", "", "  ", "ethereum", "\t"})
+	if want := []string{"bitcoin", "ethereum"}; !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Nothing left is reported by NormalizeCoinIDs
+	if _, err := NormalizeCoinIDs(DropBlankCoinIDs([]string{"", " "})); !errors.Is(err, ErrNoCoins) {
+		t.Errorf("error = %v, want ErrNoCoins", err)
+	}
+}
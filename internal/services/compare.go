@@ -0,0 +1,51 @@
+package services
+
+import (
+	"context"
+	"strings"
+
+	"my-go-backend/pkg/models"
+)
+
+// Compare prices coins a and b in currency and reports a relative to b.
+// Both are fetched in one batched call; comparing a coin with itself is
+// allowed. The first coin that can't be priced fails the comparison.
+func (s *CryptoService) Compare(ctx context.Context, a, b, currency string) (*models.CoinComparison, error) {
+	a, err := NormalizeCoinID(a)
+	if err != nil {
+		return nil, err
+	}
+	b, err = NormalizeCoinID(b)
+	if err != nil {
+		return nil, err
+	}
+	currency = strings.ToLower(currency)
+
+	coins := []string{a}
+	if b != a {
+		coins = append(coins, b)
+	}
+	prices, failures, err := s.marketData(ctx, coins, currency)
+	if err != nil {
+		return nil, err
+	}
+	for _, coinID := range coins {
+		if err, failed := failures[coinID]; failed {
+			return nil, err
+		}
+	}
+
+	coinA, coinB := prices[a], prices[b]
+	comparison := &models.CoinComparison{
+		Currency:      currency,
+		A:             coinA,
+		B:             coinB,
+		PriceRatio:    coinA.Price / coinB.Price, // Prices are validated to be positive
+		Change24hDiff: coinA.ChangePercent - coinB.ChangePercent,
+	}
+	if coinB.MarketCap > 0 {
+		ratio := float64(coinA.MarketCap) / float64(coinB.MarketCap)
+		comparison.MarketCapRatio = &ratio
+	}
+	return comparison, nil
+}
@@ -2,109 +2,775 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-resty/resty/v2"
 	"github.com/google/uuid"
+	"my-go-backend/internal/metrics"
+	"my-go-backend/internal/requestid"
 	"my-go-backend/pkg/models"
 )
 
+// Errors returned by price lookups; wrapped with details, match with errors.Is
+var (
+	ErrCoinNotFound        = newCodedError(models.CodeCoinNotFound, "coin not found")
+	ErrUpstreamUnavailable = newCodedError(models.CodeUpstreamUnavailable, "price API unavailable")
+	ErrRateLimited         = newCodedError(models.CodeRateLimited, "price API rate limit exceeded")
+	ErrMalformedResponse   = newCodedError(models.CodeUpstream, "malformed response from price API")
+)
+
 type CryptoService struct {
 	client  *resty.Client
 	baseURL string
 	// Mutex for thread-safe operations
 	mu sync.RWMutex
-	// In-memory cache with timestamp
-	cache map[string]models.CryptoData
+	// In-memory cache with timestamp, priced in currency
+	cache    map[string]models.CryptoData
+	currency string // Also the default for requests that name no currency
+	// Oldest cache entry GetSingleCrypto falls back to when CoinGecko fails; 0 disables
+	staleMaxAge time.Duration
+
+	history     map[string]*priceRing // Recent cached prices per coin, see storePrice
+	historyMu   sync.RWMutex
+	historySize int
+
+	// Last market overview, kept past its TTL as a fallback; see GetGlobal
+	global          *models.GlobalMarketData
+	globalFetchedAt time.Time
+	globalMu        sync.Mutex
+
+	subscribers      map[string]*subscriber          // WebSocket subscribers by ID
+	userSubscribers  map[uint]map[string]*subscriber // Authenticated subscribers by user ID
+	subMu            sync.RWMutex                    // Protect subscribers maps
+	subscriberConns  sync.WaitGroup                  // Connections not yet released, see AddSubscriber
+	subscriberBuffer int                             // Channel size per subscriber
+	slowPolicy       string                          // What to do when a subscriber's channel is full
+
+	streamConns   sync.WaitGroup     // SSE and NDJSON streams not yet released, see StartStream
+	activeStreams atomic.Int64       // Count of the same, for stats
+	streamsCtx    context.Context    // Parent of every stream's context
+	closeStreams  context.CancelFunc // Cancels streamsCtx to force streams closed
+
+	alerts AlertEvaluator // Optional price alert evaluation
+
+	ohlcCache  *ttlCache[[]models.OHLCCandle]   // Keyed by coin:currency:days
+	sparklines *ttlCache[[]float64]             // Keyed by coin:currency
+	coinsCache *ttlCache[[]models.CoinListItem] // Keyed by page:limit
+	coinCount  *ttlCache[int]                   // Total number of listed coins
+
+	coinTimeoutPercent int           // Per-coin share of a bulk request's timeout
+	maxConcurrency     int           // Max concurrent upstream calls per portfolio request
+	maxStreamDuration  time.Duration // Longest a price or portfolio stream may run
+	minStreamInterval  time.Duration // Bounds on the time between stream updates
+	maxStreamInterval  time.Duration
+
+	done     chan struct{} // Closed on Shutdown to stop streams
+	doneOnce sync.Once
+}
+
+// AlertEvaluator is consulted by the background streaming loop
+type AlertEvaluator interface {
+	ActiveCoins() ([]string, error)
+	Evaluate(coinID string, price float64) ([]models.PriceAlert, error)
+}
+
+// CryptoServiceOption customizes NewCryptoService
+type CryptoServiceOption func(*cryptoServiceOptions)
+
+type cryptoServiceOptions struct {
+	httpClient         *http.Client
+	requestTimeout     time.Duration
+	coinTimeoutPercent int
+	maxConcurrency     int
+	subscriberBuffer   int
+	slowPolicy         string
+	maxStreamDuration  time.Duration
+	minStreamInterval  time.Duration
+	maxStreamInterval  time.Duration
+	historySize        int
+	staleMaxAge        time.Duration
+	currency           string
+}
+
+// Defaults for CryptoServiceOption settings
+const (
+	DefaultCoinTimeoutPercent = 50  // Per-coin share of a bulk request's timeout
+	DefaultMaxConcurrency     = 5   // Concurrent upstream calls per portfolio request
+	DefaultSubscriberBuffer   = 100 // Events queued per WebSocket subscriber
+
+	DefaultMaxStreamDuration = time.Hour // Longest a price or portfolio stream may run
+
+	DefaultMinStreamInterval = 2 * time.Second // Fastest a stream may update
+	DefaultMaxStreamInterval = 5 * time.Minute // Slowest a stream may update
+
+	DefaultRequestTimeout = 10 * time.Second // Per CoinGecko call, independent of bulk deadlines
+
+	DefaultCurrency = "usd" // Currency of the price cache unless set with WithDefaultCurrency
+)
+
+// WithHTTPClient makes the service send requests through httpClient, e.g. one
+// pointed at an httptest.Server or with a stubbed Transport.
+func WithHTTPClient(httpClient *http.Client) CryptoServiceOption {
+	return func(o *cryptoServiceOptions) {
+		o.httpClient = httpClient
+	}
+}
+
+// WithRequestTimeout limits each CoinGecko call, however long the caller's
+// context allows. It also applies to a client given with WithHTTPClient.
+func WithRequestTimeout(d time.Duration) CryptoServiceOption {
+	return func(o *cryptoServiceOptions) {
+		o.requestTimeout = d
+	}
+}
+
+// WithCoinTimeoutPercent bounds each coin in GetBulkCrypto to percent (1-100)
+// of the overall timeout, so one slow coin can't use up the whole budget.
+func WithCoinTimeoutPercent(percent int) CryptoServiceOption {
+	return func(o *cryptoServiceOptions) {
+		o.coinTimeoutPercent = percent
+	}
+}
+
+// WithMaxConcurrency limits how many coins GetPortfolioRealtime fetches at once
+func WithMaxConcurrency(n int) CryptoServiceOption {
+	return func(o *cryptoServiceOptions) {
+		o.maxConcurrency = n
+	}
+}
+
+// WithSubscriberBuffer sets how many events each WebSocket subscriber can
+// queue before the slow-consumer policy applies
+func WithSubscriberBuffer(n int) CryptoServiceOption {
+	return func(o *cryptoServiceOptions) {
+		o.subscriberBuffer = n
+	}
+}
+
+// WithSlowSubscriberPolicy picks what happens when a subscriber's buffer is
+// full: SlowPolicyDropNewest, SlowPolicyDropOldest or SlowPolicyDisconnect
+func WithSlowSubscriberPolicy(policy string) CryptoServiceOption {
+	return func(o *cryptoServiceOptions) {
+		o.slowPolicy = policy
+	}
+}
+
+// WithMaxStreamDuration caps how long a price or portfolio stream runs, even
+// if the client asked for longer or for no limit
+func WithMaxStreamDuration(d time.Duration) CryptoServiceOption {
+	return func(o *cryptoServiceOptions) {
+		o.maxStreamDuration = d
+	}
+}
+
+// WithStreamIntervalBounds clamps the update interval clients ask streams
+// for, so a 1-second stream over many coins can't flood the upstream
+func WithStreamIntervalBounds(min, max time.Duration) CryptoServiceOption {
+	return func(o *cryptoServiceOptions) {
+		o.minStreamInterval = min
+		o.maxStreamInterval = max
+	}
+}
+
+// WithPriceHistorySize sets how many recent prices GetRecentPrices keeps per coin
+func WithPriceHistorySize(n int) CryptoServiceOption {
+	return func(o *cryptoServiceOptions) {
+		o.historySize = n
+	}
+}
+
+// WithServeStale makes GetSingleCrypto fall back to a cached price up to
+// maxAge old, marked Stale, when CoinGecko fails. Zero (the default) disables it.
+func WithServeStale(maxAge time.Duration) CryptoServiceOption {
+	return func(o *cryptoServiceOptions) {
+		o.staleMaxAge = maxAge
+	}
+}
 
-	subscribers map[string]chan models.StreamEvent // WebSocket subscribers
-	subMu       sync.RWMutex                       // Protect subscribers map
+// WithDefaultCurrency prices the cache, recent history and streams in
+// currency, and makes it the default for requests that don't name one.
+// Unsupported currencies are ignored.
+func WithDefaultCurrency(currency string) CryptoServiceOption {
+	return func(o *cryptoServiceOptions) {
+		o.currency = strings.ToLower(currency)
+	}
 }
 
-func NewCryptoService() *CryptoService {
-	client := resty.New()
-	client.SetTimeout(10 * time.Second)
+// NewCryptoService creates a service for the CoinGecko API at baseURL. When
+// apiKey is set it's sent as a Pro or Demo key depending on the host.
+func NewCryptoService(baseURL, apiKey string, opts ...CryptoServiceOption) *CryptoService {
+	options := cryptoServiceOptions{
+		coinTimeoutPercent: DefaultCoinTimeoutPercent,
+		maxConcurrency:     DefaultMaxConcurrency,
+		subscriberBuffer:   DefaultSubscriberBuffer,
+		slowPolicy:         SlowPolicyDropNewest,
+		maxStreamDuration:  DefaultMaxStreamDuration,
+		minStreamInterval:  DefaultMinStreamInterval,
+		maxStreamInterval:  DefaultMaxStreamInterval,
+		historySize:        DefaultPriceHistorySize,
+		currency:           DefaultCurrency,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	var client *resty.Client
+	if options.httpClient != nil {
+		client = resty.NewWithClient(options.httpClient)
+		if options.requestTimeout > 0 {
+			client.SetTimeout(options.requestTimeout)
+		}
+	} else {
+		if options.requestTimeout <= 0 {
+			options.requestTimeout = DefaultRequestTimeout
+		}
+		client = resty.New()
+		client.SetTimeout(options.requestTimeout)
+	}
+
+	if options.coinTimeoutPercent < 1 || options.coinTimeoutPercent > 100 {
+		options.coinTimeoutPercent = DefaultCoinTimeoutPercent
+	}
+	if options.maxConcurrency < 1 {
+		options.maxConcurrency = 1
+	}
+	if options.subscriberBuffer < 1 {
+		options.subscriberBuffer = DefaultSubscriberBuffer
+	}
+	if !IsSlowSubscriberPolicy(options.slowPolicy) {
+		options.slowPolicy = SlowPolicyDropNewest
+	}
+	if options.maxStreamDuration <= 0 {
+		options.maxStreamDuration = DefaultMaxStreamDuration
+	}
+	if options.minStreamInterval <= 0 || options.maxStreamInterval < options.minStreamInterval {
+		options.minStreamInterval = DefaultMinStreamInterval
+		options.maxStreamInterval = DefaultMaxStreamInterval
+	}
+	if options.historySize < 1 {
+		options.historySize = DefaultPriceHistorySize
+	}
+	if !IsSupportedCurrency(options.currency) {
+		options.currency = DefaultCurrency
+	}
+
+	if apiKey != "" {
+		header := "x-cg-demo-api-key"
+		if strings.Contains(baseURL, "pro-api.coingecko.com") {
+			header = "x-cg-pro-api-key"
+		}
+		client.SetHeader(header, apiKey)
+	}
+
+	streamsCtx, closeStreams := context.WithCancel(context.Background())
 
 	return &CryptoService{
-		client:      client,
-		baseURL:     "https://api.coingecko.com/api/v3",
-		cache:       make(map[string]models.CryptoData),
-		subscribers: make(map[string]chan models.StreamEvent),
+		client:          client,
+		baseURL:         strings.TrimRight(baseURL, "/"),
+		cache:           make(map[string]models.CryptoData),
+		currency:        options.currency,
+		history:         make(map[string]*priceRing),
+		historySize:     options.historySize,
+		staleMaxAge:     options.staleMaxAge,
+		subscribers:     make(map[string]*subscriber),
+		userSubscribers: make(map[uint]map[string]*subscriber),
+		ohlcCache:       newTTLCache[[]models.OHLCCandle](5 * time.Minute),
+		sparklines:      newTTLCache[[]float64](sparklineCacheTTL),
+		coinsCache:      newTTLCache[[]models.CoinListItem](10 * time.Minute),
+		coinCount:       newTTLCache[int](time.Hour),
+		done:            make(chan struct{}),
+		streamsCtx:      streamsCtx,
+		closeStreams:    closeStreams,
+
+		coinTimeoutPercent: options.coinTimeoutPercent,
+		maxConcurrency:     options.maxConcurrency,
+		subscriberBuffer:   options.subscriberBuffer,
+		slowPolicy:         options.slowPolicy,
+		maxStreamDuration:  options.maxStreamDuration,
+		minStreamInterval:  options.minStreamInterval,
+		maxStreamInterval:  options.maxStreamInterval,
 	}
 }
 
-// GetSingleCrypto fetches data for a single cryptocurrency
-func (s *CryptoService) GetSingleCrypto(coinID string) (*models.CryptoData, error) {
+// DefaultCurrency is the currency cached prices are in, used by requests
+// that don't name one
+func (s *CryptoService) DefaultCurrency() string {
+	return s.currency
+}
+
+// SetAlertEvaluator enables price alert checks in StartPriceStreaming
+func (s *CryptoService) SetAlertEvaluator(alerts AlertEvaluator) {
+	s.alerts = alerts
+}
+
+// priceCacheTTL is how long fetched prices are served from the cache
+const priceCacheTTL = time.Minute
+
+// GetSingleCrypto fetches data for a single cryptocurrency. The API call is
+// abandoned when ctx is cancelled. With WithServeStale, a CoinGecko failure
+// returns the expired cache entry marked Stale instead, unless the coin
+// wasn't found.
+func (s *CryptoService) GetSingleCrypto(ctx context.Context, coinID string) (*models.CryptoData, error) {
 	// Check cache first (with read lock)
-	s.mu.RLock()
-	if cached, exists := s.cache[coinID]; exists {
-		// Cache valid for 1 minute
-		if time.Since(cached.FetchedAt) < time.Minute {
-			s.mu.RUnlock()
-			log.Printf("Cache hit for %s", coinID)
-			return &cached, nil
+	if cached, ok := s.cachedCrypto(coinID); ok {
+		log.Printf("Cache hit for %s", coinID)
+		metrics.CacheHits.Inc()
+		return &cached, nil
+	}
+	metrics.CacheMisses.Inc()
+
+	crypto, err := s.fetchSingleCrypto(ctx, coinID)
+	if err != nil && !errors.Is(err, ErrCoinNotFound) {
+		if stale, ok := s.staleCrypto(coinID); ok {
+			log.Printf("Error fetching %s, serving copy from %s ago: %v",
+				coinID, time.Since(stale.FetchedAt).Round(time.Second), err)
+			return &stale, nil
+		}
+	}
+	return crypto, err
+}
+
+// RefreshCoin fetches coinID from CoinGecko even when it is cached, and
+// replaces the cache entry. On failure the existing entry is left alone.
+func (s *CryptoService) RefreshCoin(ctx context.Context, coinID string) (*models.CryptoData, error) {
+	crypto, err := s.fetchSingleCrypto(ctx, coinID)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Refreshed %s in cache", coinID)
+	return crypto, nil
+}
+
+// fetchSingleCrypto fetches one coin in the default currency and caches it
+func (s *CryptoService) fetchSingleCrypto(ctx context.Context, coinID string) (*models.CryptoData, error) {
+	response, err := s.fetchMarkets(ctx, []string{coinID}, s.currency, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(response) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrCoinNotFound, coinID)
+	}
+
+	coin := response[0]
+	if err := validateCoinResponse(coinID, coin); err != nil {
+		// Don't cache zero values from a null or mismatched payload
+		log.Printf("Rejected CoinGecko response for %s: %v", coinID, err)
+		return nil, err
+	}
+
+	// Convert to our internal structure
+	crypto := newCryptoData(coin)
+
+	// Update cache and recent history (with write locks)
+	s.storePrice(coinID, crypto)
+
+	return &crypto, nil
+}
+
+// CheckUpstream fetches coinID straight from CoinGecko, bypassing the cache,
+// to confirm the base URL and API key work. Nothing is cached.
+func (s *CryptoService) CheckUpstream(ctx context.Context, coinID string) error {
+	coinID, err := NormalizeCoinID(coinID)
+	if err != nil {
+		return err
+	}
+
+	response, err := s.fetchMarkets(ctx, []string{coinID}, s.currency, false)
+	if err != nil {
+		return err
+	}
+	if len(response) == 0 {
+		return fmt.Errorf("%w: %s", ErrCoinNotFound, coinID)
+	}
+	return validateCoinResponse(coinID, response[0])
+}
+
+// GetMarkets fetches several coins in a single /coins/markets call, priced in
+// currency. Cached prices are reused for the default currency; coins that are missing or fail
+// validation are returned with an error instead of failing the batch.
+func (s *CryptoService) GetMarkets(ctx context.Context, coins []string, currency string, opts PortfolioOptions) (*models.PortfolioResponse, error) {
+	startTime := time.Now()
+
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	coins, err := NormalizeCoinIDs(coins)
+	if err != nil {
+		return nil, err
+	}
+	currency = strings.ToLower(currency)
+
+	prices, failures, err := s.marketData(ctx, coins, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	portfolio := make([]models.CryptoData, 0, len(coins))
+	for _, coinID := range coins {
+		if err, failed := failures[coinID]; failed {
+			portfolio = append(portfolio, models.CryptoData{ID: coinID, Error: err.Error(), FetchedAt: time.Now()})
+			continue
+		}
+		portfolio = append(portfolio, prices[coinID])
+	}
+
+	successCount := 0
+	errorCount := 0
+	for _, result := range portfolio {
+		if result.Error == "" {
+			successCount++
+		} else {
+			errorCount++
+		}
+	}
+
+	sortPortfolio(portfolio, coins, opts)
+
+	return &models.PortfolioResponse{
+		Portfolio:    portfolio,
+		TotalValue:   portfolioValue(portfolio, NormalizeQuantities(opts.Quantities)),
+		SuccessCount: successCount,
+		ErrorCount:   errorCount,
+		FetchTime:    fmt.Sprintf("%.2fs", time.Since(startTime).Seconds()),
+	}, nil
+}
+
+// marketData prices coins in currency with at most one /coins/markets call,
+// reusing cached prices for the default currency. Coins that are missing or fail validation are
+// reported in failures rather than failing the batch.
+func (s *CryptoService) marketData(ctx context.Context, coins []string, currency string) (map[string]models.CryptoData, map[string]error, error) {
+	prices := make(map[string]models.CryptoData, len(coins))
+	failures := make(map[string]error)
+
+	var missing []string
+	for _, coinID := range coins {
+		if currency == s.currency {
+			if cached, ok := s.cachedCrypto(coinID); ok {
+				metrics.CacheHits.Inc()
+				prices[coinID] = cached
+				continue
+			}
+			metrics.CacheMisses.Inc()
+		}
+		missing = append(missing, coinID)
+	}
+	if len(missing) == 0 {
+		return prices, failures, nil
+	}
+
+	response, err := s.fetchMarkets(ctx, missing, currency, false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fetched := make(map[string]models.CoinGeckoResponse, len(response))
+	for _, coin := range response {
+		fetched[coin.ID] = coin
+	}
+
+	for _, coinID := range missing {
+		coin, ok := fetched[coinID]
+		if !ok {
+			failures[coinID] = fmt.Errorf("%w: %s", ErrCoinNotFound, coinID)
+			continue
+		}
+		if err := validateCoinResponse(coinID, coin); err != nil {
+			log.Printf("Rejected CoinGecko response for %s: %v", coinID, err)
+			failures[coinID] = err
+			continue
+		}
+
+		crypto := newCryptoData(coin)
+		if currency == s.currency {
+			s.storePrice(coinID, crypto)
 		}
+		prices[coinID] = crypto
+	}
+	return prices, failures, nil
+}
+
+// cachedCrypto returns a price fetched within priceCacheTTL
+func (s *CryptoService) cachedCrypto(coinID string) (models.CryptoData, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cached, exists := s.cache[coinID]
+	if !exists || time.Since(cached.FetchedAt) >= priceCacheTTL {
+		return models.CryptoData{}, false
+	}
+	return cached, true
+}
+
+// staleCrypto returns an expired price no older than staleMaxAge, marked
+// Stale
+func (s *CryptoService) staleCrypto(coinID string) (models.CryptoData, bool) {
+	if s.staleMaxAge <= 0 {
+		return models.CryptoData{}, false
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cached, exists := s.cache[coinID]
+	if !exists || time.Since(cached.FetchedAt) > s.staleMaxAge {
+		return models.CryptoData{}, false
 	}
-	s.mu.RUnlock()
+	cached.Stale = true
+	return cached, true
+}
 
-	// Make API call
+// fetchMarkets calls /coins/markets for one or more coin ids. The 7-day
+// sparkline, which makes the response much larger, is only included when
+// sparkline is set.
+func (s *CryptoService) fetchMarkets(ctx context.Context, coins []string, currency string, sparkline bool) ([]models.CoinGeckoResponse, error) {
 	url := fmt.Sprintf("%s/coins/markets", s.baseURL)
 
 	var response []models.CoinGeckoResponse
 	resp, err := s.client.R().
-		SetQueryParam("vs_currency", "usd").
-		SetQueryParam("ids", coinID).
+		SetContext(ctx).
+		SetQueryParam("vs_currency", currency).
+		SetQueryParam("ids", strings.Join(coins, ",")).
+		SetQueryParam("sparkline", strconv.FormatBool(sparkline)).
 		SetResult(&response).
 		Get(url)
 
 	if err != nil {
-		return nil, fmt.Errorf("API call failed: %w", err)
+		metrics.CoinGeckoRequests.WithLabelValues("error").Inc()
+		return nil, upstreamError(resp, err)
 	}
 
 	if resp.StatusCode() != 200 {
-		return nil, fmt.Errorf("API returned status %d", resp.StatusCode())
+		metrics.CoinGeckoRequests.WithLabelValues("error").Inc()
+		return nil, upstreamError(resp, nil)
 	}
+	metrics.CoinGeckoRequests.WithLabelValues("success").Inc()
 
-	if len(response) == 0 {
-		return nil, fmt.Errorf("coin not found: %s", coinID)
-	}
+	return response, nil
+}
 
-	// Convert to our internal structure
-	crypto := models.CryptoData{
-		ID:            response[0].ID,
-		Symbol:        response[0].Symbol,
-		Name:          response[0].Name,
-		Price:         response[0].CurrentPrice,
-		MarketCap:     response[0].MarketCap,
-		Rank:          response[0].MarketCapRank,
-		Change24h:     response[0].PriceChange24h,
-		ChangePercent: response[0].PriceChangePercent24h,
+// newCryptoData converts a CoinGecko market entry to our internal structure
+func newCryptoData(coin models.CoinGeckoResponse) models.CryptoData {
+	return models.CryptoData{
+		ID:            coin.ID,
+		Symbol:        coin.Symbol,
+		Name:          coin.Name,
+		Price:         coin.CurrentPrice,
+		MarketCap:     coin.MarketCap,
+		Rank:          coin.MarketCapRank,
+		Change24h:     coin.PriceChange24h,
+		ChangePercent: coin.PriceChangePercent24h,
+		Volume24h:     coin.TotalVolume,
 		FetchedAt:     time.Now(),
 	}
+}
 
-	// Update cache (with write lock)
-	s.mu.Lock()
-	s.cache[coinID] = crypto
-	s.mu.Unlock()
+// upstreamError classifies a failed CoinGecko call. err is the transport
+// error, if any; otherwise resp carries an unexpected status.
+func upstreamError(resp *resty.Response, err error) error {
+	if err != nil {
+		return fmt.Errorf("%w: API call failed: %w", ErrUpstreamUnavailable, err)
+	}
+	if resp.StatusCode() == http.StatusTooManyRequests {
+		return ErrRateLimited
+	}
+	return fmt.Errorf("%w: API returned status %d", ErrUpstreamUnavailable, resp.StatusCode())
+}
 
-	return &crypto, nil
+// validateCoinResponse guards against null numeric fields silently decoding
+// to zero and against CoinGecko returning a different coin than requested.
+func validateCoinResponse(coinID string, coin models.CoinGeckoResponse) error {
+	if coin.ID != coinID {
+		return fmt.Errorf("%w: expected coin %q, got %q", ErrMalformedResponse, coinID, coin.ID)
+	}
+	if coin.CurrentPrice <= 0 {
+		return fmt.Errorf("%w: non-positive price %v for %s", ErrMalformedResponse, coin.CurrentPrice, coinID)
+	}
+	return nil
+}
+
+// ErrInvalidDays is returned for an OHLC range CoinGecko doesn't support
+var ErrInvalidDays = errors.New("days must be one of 1, 7, 14, 30, 90, 180, 365")
+
+// validOHLCDays are the ranges supported by CoinGecko's /coins/{id}/ohlc
+var validOHLCDays = map[int]bool{1: true, 7: true, 14: true, 30: true, 90: true, 180: true, 365: true}
+
+// GetOHLC fetches open/high/low/close candles for a coin
+func (s *CryptoService) GetOHLC(ctx context.Context, coinID, currency string, days int) ([]models.OHLCCandle, error) {
+	if !validOHLCDays[days] {
+		return nil, ErrInvalidDays
+	}
+
+	cacheKey := fmt.Sprintf("%s:%s:%d", coinID, currency, days)
+	if candles, ok := s.ohlcCache.get(cacheKey); ok {
+		metrics.CacheHits.Inc()
+		return candles, nil
+	}
+	metrics.CacheMisses.Inc()
+
+	url := fmt.Sprintf("%s/coins/%s/ohlc", s.baseURL, coinID)
+
+	// CoinGecko returns [timestamp_ms, open, high, low, close] rows
+	var response [][]float64
+	resp, err := s.client.R().
+		SetContext(ctx).
+		SetQueryParam("vs_currency", currency).
+		SetQueryParam("days", strconv.Itoa(days)).
+		SetResult(&response).
+		Get(url)
+
+	if err != nil {
+		metrics.CoinGeckoRequests.WithLabelValues("error").Inc()
+		return nil, upstreamError(resp, err)
+	}
+
+	if resp.StatusCode() == 404 {
+		metrics.CoinGeckoRequests.WithLabelValues("error").Inc()
+		return nil, fmt.Errorf("%w: %s", ErrCoinNotFound, coinID)
+	}
+
+	if resp.StatusCode() != 200 {
+		metrics.CoinGeckoRequests.WithLabelValues("error").Inc()
+		return nil, upstreamError(resp, nil)
+	}
+	metrics.CoinGeckoRequests.WithLabelValues("success").Inc()
+
+	candles := make([]models.OHLCCandle, 0, len(response))
+	for _, row := range response {
+		if len(row) < 5 {
+			continue
+		}
+		candles = append(candles, models.OHLCCandle{
+			Timestamp: time.UnixMilli(int64(row[0])).UTC(),
+			Open:      row[1],
+			High:      row[2],
+			Low:       row[3],
+			Close:     row[4],
+		})
+	}
+
+	s.ohlcCache.set(cacheKey, candles)
+	return candles, nil
+}
+
+// Pagination bounds for ListCoins; CoinGecko caps per_page at 250
+const (
+	DefaultCoinPageSize = 50
+	MaxCoinPageSize     = 250
+)
+
+// ListCoins returns one page of coins ordered by market cap rank
+func (s *CryptoService) ListCoins(ctx context.Context, page, limit int) (*models.PaginatedResponse, error) {
+	page, limit = clampPage(page, limit, MaxCoinPageSize)
+
+	total, err := s.countCoins(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheKey := fmt.Sprintf("%d:%d", page, limit)
+	coins, ok := s.coinsCache.get(cacheKey)
+	if ok {
+		metrics.CacheHits.Inc()
+	} else {
+		metrics.CacheMisses.Inc()
+
+		var response []models.CoinGeckoResponse
+		resp, err := s.client.R().
+			SetContext(ctx).
+			SetQueryParam("vs_currency", "usd").
+			SetQueryParam("order", "market_cap_desc").
+			SetQueryParam("per_page", strconv.Itoa(limit)).
+			SetQueryParam("page", strconv.Itoa(page)).
+			SetResult(&response).
+			Get(fmt.Sprintf("%s/coins/markets", s.baseURL))
+
+		if err != nil {
+			metrics.CoinGeckoRequests.WithLabelValues("error").Inc()
+			return nil, upstreamError(resp, err)
+		}
+
+		if resp.StatusCode() != 200 {
+			metrics.CoinGeckoRequests.WithLabelValues("error").Inc()
+			return nil, upstreamError(resp, nil)
+		}
+		metrics.CoinGeckoRequests.WithLabelValues("success").Inc()
+
+		coins = make([]models.CoinListItem, 0, len(response))
+		for _, coin := range response {
+			coins = append(coins, models.CoinListItem{
+				ID:     coin.ID,
+				Symbol: coin.Symbol,
+				Name:   coin.Name,
+				Rank:   coin.MarketCapRank,
+			})
+		}
+		s.coinsCache.set(cacheKey, coins)
+	}
+
+	return newPaginatedResponse(coins, int64(total), page, limit), nil
+}
+
+// countCoins returns the number of coins known to CoinGecko. /coins/markets
+// doesn't report a total, so it's taken from the (large) /coins/list.
+func (s *CryptoService) countCoins(ctx context.Context) (int, error) {
+	if total, ok := s.coinCount.get("total"); ok {
+		return total, nil
+	}
+
+	var response []struct {
+		ID string `json:"id"`
+	}
+	resp, err := s.client.R().
+		SetContext(ctx).
+		SetResult(&response).
+		Get(fmt.Sprintf("%s/coins/list", s.baseURL))
+
+	if err != nil {
+		metrics.CoinGeckoRequests.WithLabelValues("error").Inc()
+		return 0, upstreamError(resp, err)
+	}
+
+	if resp.StatusCode() != 200 {
+		metrics.CoinGeckoRequests.WithLabelValues("error").Inc()
+		return 0, upstreamError(resp, nil)
+	}
+	metrics.CoinGeckoRequests.WithLabelValues("success").Inc()
+
+	s.coinCount.set("total", len(response))
+	return len(response), nil
 }
 
 // GetBulkCrypto demonstrates goroutines, wait groups, and locks
-func (s *CryptoService) GetBulkCrypto(coins []string, timeout time.Duration) (*models.PortfolioResponse, error) {
+func (s *CryptoService) GetBulkCrypto(ctx context.Context, coins []string, timeout time.Duration, opts PortfolioOptions) (*models.PortfolioResponse, error) {
 	startTime := time.Now()
 
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	coins, err := NormalizeCoinIDs(coins)
+	if err != nil {
+		return nil, err
+	}
+
 	// Create context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
+	// Each coin gets its own share of the budget
+	coinTimeout := timeout * time.Duration(s.coinTimeoutPercent) / 100
+
 	// Channels for collecting results
 	results := make(chan models.CryptoData, len(coins))
-	errors := make(chan error, len(coins))
 
 	// WaitGroup to wait for all goroutines
 	var wg sync.WaitGroup
@@ -115,6 +781,9 @@ func (s *CryptoService) GetBulkCrypto(coins []string, timeout time.Duration) (*m
 		go func(coinID string) {
 			defer wg.Done()
 
+			coinCtx, coinCancel := context.WithTimeout(ctx, coinTimeout)
+			defer coinCancel()
+
 			// Create a channel for this specific request
 			done := make(chan struct{})
 			var crypto *models.CryptoData
@@ -123,13 +792,21 @@ func (s *CryptoService) GetBulkCrypto(coins []string, timeout time.Duration) (*m
 			// Launch the actual API call in another goroutine
 			go func() {
 				defer close(done)
-				crypto, err = s.GetSingleCrypto(coinID)
+				crypto, err = s.GetSingleCrypto(coinCtx, coinID)
 			}()
 
 			// Wait for either completion or context timeout
 			select {
 			case <-done:
-				if err != nil {
+				if err != nil && coinCtx.Err() != nil {
+					// The call was aborted by one of the deadlines
+					log.Printf("Timeout fetching %s", coinID)
+					results <- models.CryptoData{
+						ID:        coinID,
+						Error:     bulkTimeoutReason(ctx),
+						FetchedAt: time.Now(),
+					}
+				} else if err != nil {
 					log.Printf("Error fetching %s: %v", coinID, err)
 					// Send error data instead of nil
 					results <- models.CryptoData{
@@ -140,11 +817,11 @@ func (s *CryptoService) GetBulkCrypto(coins []string, timeout time.Duration) (*m
 				} else {
 					results <- *crypto
 				}
-			case <-ctx.Done():
+			case <-coinCtx.Done():
 				log.Printf("Timeout fetching %s", coinID)
 				results <- models.CryptoData{
 					ID:        coinID,
-					Error:     "timeout",
+					Error:     bulkTimeoutReason(ctx),
 					FetchedAt: time.Now(),
 				}
 			}
@@ -155,12 +832,10 @@ func (s *CryptoService) GetBulkCrypto(coins []string, timeout time.Duration) (*m
 	go func() {
 		wg.Wait()
 		close(results)
-		close(errors)
 	}()
 
 	// Collect results
 	var portfolio []models.CryptoData
-	var totalValue float64
 	successCount := 0
 	errorCount := 0
 
@@ -173,7 +848,6 @@ func (s *CryptoService) GetBulkCrypto(coins []string, timeout time.Duration) (*m
 		portfolio = append(portfolio, result)
 
 		if result.Error == "" {
-			totalValue += result.Price
 			successCount++
 		} else {
 			errorCount++
@@ -181,19 +855,38 @@ func (s *CryptoService) GetBulkCrypto(coins []string, timeout time.Duration) (*m
 		resultMu.Unlock()
 	}
 
+	sortPortfolio(portfolio, coins, opts)
+
 	return &models.PortfolioResponse{
 		Portfolio:    portfolio,
-		TotalValue:   totalValue,
+		TotalValue:   portfolioValue(portfolio, NormalizeQuantities(opts.Quantities)),
 		SuccessCount: successCount,
 		ErrorCount:   errorCount,
 		FetchTime:    fmt.Sprintf("%.2fs", time.Since(startTime).Seconds()),
 	}, nil
 }
 
+// bulkTimeoutReason reports "timeout" when a coin hit its own deadline and
+// "overall timeout" when the whole bulk request ran out of time.
+func bulkTimeoutReason(overall context.Context) string {
+	if overall.Err() != nil {
+		return "overall timeout"
+	}
+	return "timeout"
+}
+
 // GetPortfolioRealtime demonstrates different concurrency patterns
-func (s *CryptoService) GetPortfolioRealtime(coins []string) (*models.PortfolioResponse, error) {
+func (s *CryptoService) GetPortfolioRealtime(ctx context.Context, coins []string, opts PortfolioOptions) (*models.PortfolioResponse, error) {
 	startTime := time.Now()
 
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	coins, err := NormalizeCoinIDs(coins)
+	if err != nil {
+		return nil, err
+	}
+
 	// Buffered channel to prevent blocking
 	results := make(chan models.CryptoData, len(coins))
 
@@ -201,20 +894,29 @@ func (s *CryptoService) GetPortfolioRealtime(coins []string) (*models.PortfolioR
 	var wg sync.WaitGroup
 
 	// Launch limited number of goroutines (rate limiting)
-	semaphore := make(chan struct{}, 5) // Max 5 concurrent requests
+	semaphore := make(chan struct{}, s.maxConcurrency)
 
 	for _, coin := range coins {
 		wg.Add(1)
 		go func(coinID string) {
 			defer wg.Done()
 
-			// Acquire semaphore
-			semaphore <- struct{}{}
-			defer func() { <-semaphore }()
+			// Acquire semaphore, unless the caller has gone away
+			select {
+			case semaphore <- struct{}{}:
+				defer func() { <-semaphore }()
+			case <-ctx.Done():
+				results <- models.CryptoData{
+					ID:        coinID,
+					Error:     ctx.Err().Error(),
+					FetchedAt: time.Now(),
+				}
+				return
+			}
 
 			log.Printf("Fetching %s...", coinID)
 
-			crypto, err := s.GetSingleCrypto(coinID)
+			crypto, err := s.GetSingleCrypto(ctx, coinID)
 			if err != nil {
 				results <- models.CryptoData{
 					ID:        coinID,
@@ -236,7 +938,6 @@ func (s *CryptoService) GetPortfolioRealtime(coins []string) (*models.PortfolioR
 
 	// Thread-safe result collection
 	var portfolio []models.CryptoData
-	var totalValue float64
 	successCount := 0
 	errorCount := 0
 
@@ -245,29 +946,147 @@ func (s *CryptoService) GetPortfolioRealtime(coins []string) (*models.PortfolioR
 		portfolio = append(portfolio, result)
 
 		if result.Error == "" {
-			totalValue += result.Price
 			successCount++
 		} else {
 			errorCount++
 		}
 	}
 
+	sortPortfolio(portfolio, coins, opts)
+
+	quantities := NormalizeQuantities(opts.Quantities)
+	var totals map[string]float64
+	if len(opts.Currencies) > 0 {
+		totals, err = s.portfolioTotals(ctx, portfolio, quantities, opts.Currencies)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &models.PortfolioResponse{
 		Portfolio:    portfolio,
-		TotalValue:   totalValue,
+		TotalValue:   portfolioValue(portfolio, quantities),
+		Totals:       totals,
 		SuccessCount: successCount,
 		ErrorCount:   errorCount,
 		FetchTime:    fmt.Sprintf("%.2fs", time.Since(startTime).Seconds()),
 	}, nil
 }
 
-// ClearCache demonstrates write locks
+// portfolioTotals values the successfully fetched coins in each currency,
+// like TotalValue (price times quantity), with one /simple/price call for all
+// of them
+func (s *CryptoService) portfolioTotals(ctx context.Context, portfolio []models.CryptoData, quantities map[string]float64, currencies []string) (map[string]float64, error) {
+	totals := make(map[string]float64, len(currencies))
+	for _, currency := range currencies {
+		totals[currency] = 0
+	}
+
+	var coins []string
+	for _, result := range portfolio {
+		if result.Error == "" {
+			coins = append(coins, result.ID)
+		}
+	}
+	if len(coins) == 0 {
+		return totals, nil
+	}
+
+	prices, err := s.fetchSimplePrices(ctx, coins, currencies)
+	if err != nil {
+		return nil, err
+	}
+	for _, coinID := range coins {
+		for currency, price := range prices[coinID] {
+			if _, requested := totals[currency]; requested {
+				totals[currency] += price * HoldingQuantity(quantities, coinID)
+			}
+		}
+	}
+	return totals, nil
+}
+
+// fetchSimplePrices calls /simple/price, returning prices by coin id, then currency
+func (s *CryptoService) fetchSimplePrices(ctx context.Context, coins, currencies []string) (map[string]map[string]float64, error) {
+	url := fmt.Sprintf("%s/simple/price", s.baseURL)
+
+	var response map[string]map[string]float64
+	resp, err := s.client.R().
+		SetContext(ctx).
+		SetQueryParam("ids", strings.Join(coins, ",")).
+		SetQueryParam("vs_currencies", strings.Join(currencies, ",")).
+		SetResult(&response).
+		Get(url)
+
+	if err != nil {
+		metrics.CoinGeckoRequests.WithLabelValues("error").Inc()
+		return nil, upstreamError(resp, err)
+	}
+
+	if resp.StatusCode() != 200 {
+		metrics.CoinGeckoRequests.WithLabelValues("error").Inc()
+		return nil, upstreamError(resp, nil)
+	}
+	metrics.CoinGeckoRequests.WithLabelValues("success").Inc()
+
+	return response, nil
+}
+
+// ClearCache demonstrates write locks. WebSocket subscribers are then sent a
+// "cache_cleared" event, since the next prices they get are freshly fetched.
 func (s *CryptoService) ClearCache() {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-
 	s.cache = make(map[string]models.CryptoData)
+	s.ohlcCache.clear()
+	s.sparklines.clear()
+	s.coinsCache.clear()
+	s.coinCount.clear()
+	s.mu.Unlock()
+	s.globalMu.Lock()
+	s.global = nil
+	s.globalMu.Unlock()
 	log.Println("Cache cleared")
+
+	s.BroadcastToSubscribers(models.StreamEvent{
+		Type:      "cache_cleared",
+		Timestamp: time.Now(),
+		ID:        uuid.New().String(),
+	})
+}
+
+// ErrNotCached is returned when a coin has no entry in the price cache
+var ErrNotCached = errors.New("coin is not cached")
+
+// GetCachedCoin returns a coin's price cache entry and its age, whether or
+// not it is still fresh
+func (s *CryptoService) GetCachedCoin(coinID string) (*models.CacheEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cached, exists := s.cache[coinID]
+	if !exists {
+		return nil, ErrNotCached
+	}
+
+	age := time.Since(cached.FetchedAt)
+	return &models.CacheEntry{
+		Data:       cached,
+		AgeSeconds: age.Seconds(),
+		Fresh:      age < priceCacheTTL,
+	}, nil
+}
+
+// EvictCoin drops one coin from the price cache so the next request refetches it
+func (s *CryptoService) EvictCoin(coinID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.cache[coinID]; !exists {
+		return ErrNotCached
+	}
+	delete(s.cache, coinID)
+	log.Printf("Evicted %s from cache", coinID)
+	return nil
 }
 
 // GetCacheStats demonstrates read locks
@@ -276,7 +1095,10 @@ func (s *CryptoService) GetCacheStats() map[string]interface{} {
 	defer s.mu.RUnlock()
 
 	return map[string]interface{}{
-		"cached_coins": len(s.cache),
+		"cached_coins":    len(s.cache),
+		"max_concurrency": s.maxConcurrency,
+		"subscribers":     s.SubscriberStats(),
+		"active_streams":  s.ActiveStreams(),
 		"cache_keys": func() []string {
 			keys := make([]string, 0, len(s.cache))
 			for k := range s.cache {
@@ -290,27 +1112,45 @@ func (s *CryptoService) GetCacheStats() map[string]interface{} {
 // StreamPriceUpdates - Server-Sent Events streaming
 func (s *CryptoService) StreamPriceUpdates(ctx context.Context, config models.StreamConfig) <-chan models.StreamEvent {
 	eventChan := make(chan models.StreamEvent, 100)
+	reqID := requestid.FromContext(ctx)
+
+	updateTypes := config.UpdateTypes
+	if len(updateTypes) == 0 {
+		updateTypes = []string{models.UpdateTypePrice}
+	}
 
 	go func() {
 		defer close(eventChan)
 
-		ticker := time.NewTicker(config.Interval)
+		ticker := time.NewTicker(s.StreamInterval(config.Interval))
 		defer ticker.Stop()
 
+		deadline := time.NewTimer(s.StreamDuration(config.Duration))
+		defer deadline.Stop()
+
 		updateCount := 0
 
 		for {
 			select {
 			case <-ctx.Done():
-				log.Println("Stream context cancelled")
+				log.Printf("[%s] Stream context cancelled", reqID)
+				return
+			case <-s.done:
+				log.Printf("[%s] Stream stopped: service shutting down", reqID)
+				sendStreamEvent(ctx, eventChan, NewShutdownEvent())
+				return
+			case <-deadline.C:
+				log.Printf("[%s] Reached stream duration limit", reqID)
+				sendStreamEvent(ctx, eventChan, NewStreamEndEvent(models.StreamEndDuration))
 				return
 			case <-ticker.C:
 				// Fetch latest prices for all coins concurrently
-				s.streamPriceUpdates(config.Coins, eventChan)
+				s.streamPriceUpdates(ctx, config.Coins, updateTypes, eventChan)
 
 				updateCount++
 				if config.MaxUpdates > 0 && updateCount >= config.MaxUpdates {
-					log.Printf("Reached max updates limit: %d", config.MaxUpdates)
+					log.Printf("[%s] Reached max updates limit: %d", reqID, config.MaxUpdates)
+					sendStreamEvent(ctx, eventChan, NewStreamEndEvent(models.StreamEndMaxUpdates))
 					return
 				}
 			}
@@ -320,10 +1160,120 @@ func (s *CryptoService) StreamPriceUpdates(ctx context.Context, config models.St
 	return eventChan
 }
 
+// StreamDuration returns how long a stream may run when the client asked for
+// requested (0 for no preference): the request, capped at the server maximum
+func (s *CryptoService) StreamDuration(requested time.Duration) time.Duration {
+	if requested <= 0 || requested > s.maxStreamDuration {
+		return s.maxStreamDuration
+	}
+	return requested
+}
+
+// StreamInterval clamps a requested update interval to the configured bounds
+func (s *CryptoService) StreamInterval(requested time.Duration) time.Duration {
+	switch {
+	case requested < s.minStreamInterval:
+		return s.minStreamInterval
+	case requested > s.maxStreamInterval:
+		return s.maxStreamInterval
+	default:
+		return requested
+	}
+}
+
+// sendStreamEvent queues the final event of a stream, unless the client has
+// already gone
+func sendStreamEvent(ctx context.Context, eventChan chan<- models.StreamEvent, event models.StreamEvent) {
+	select {
+	case eventChan <- event:
+	case <-ctx.Done():
+	}
+}
+
+// NewStreamEndEvent builds the last event of a stream that ended on its own
+func NewStreamEndEvent(reason string) models.StreamEvent {
+	return models.StreamEvent{
+		Type:      "end",
+		Data:      models.StreamEnd{Reason: reason},
+		Timestamp: time.Now(),
+		ID:        uuid.New().String(),
+	}
+}
+
+// NewShutdownEvent builds the last event of a stream cut short because the
+// server is stopping; clients should reconnect
+func NewShutdownEvent() models.StreamEvent {
+	return models.StreamEvent{
+		Type:      "shutdown",
+		Data:      models.StreamEnd{Reason: models.StreamEndShutdown},
+		Timestamp: time.Now(),
+		ID:        uuid.New().String(),
+	}
+}
+
+// ErrInvalidUpdateType is returned for an unknown stream update type
+var ErrInvalidUpdateType = errors.New("update types must be price, volume or market_cap")
+
+var allUpdateTypes = []string{models.UpdateTypePrice, models.UpdateTypeVolume, models.UpdateTypeMarketCap}
+
+// ParseUpdateTypes validates and de-duplicates requested update types,
+// defaulting to price updates only
+func ParseUpdateTypes(types []string) ([]string, error) {
+	if len(types) == 0 {
+		return []string{models.UpdateTypePrice}, nil
+	}
+
+	seen := make(map[string]bool, len(types))
+	parsed := make([]string, 0, len(types))
+	for _, updateType := range types {
+		updateType = strings.ToLower(strings.TrimSpace(updateType))
+		switch updateType {
+		case models.UpdateTypePrice, models.UpdateTypeVolume, models.UpdateTypeMarketCap:
+		default:
+			return nil, ErrInvalidUpdateType
+		}
+		if !seen[updateType] {
+			seen[updateType] = true
+			parsed = append(parsed, updateType)
+		}
+	}
+	return parsed, nil
+}
+
+// priceUpdates builds one update per requested type from fetched coin data
+func priceUpdates(crypto *models.CryptoData, types []string) []models.PriceUpdate {
+	now := time.Now()
+	updates := make([]models.PriceUpdate, 0, len(types))
+	for _, updateType := range types {
+		update := models.PriceUpdate{
+			CoinID:     crypto.ID,
+			Symbol:     crypto.Symbol,
+			Price:      crypto.Price,
+			Change24h:  crypto.Change24h,
+			Timestamp:  now,
+			UpdateType: updateType,
+		}
+
+		switch updateType {
+		case models.UpdateTypePrice:
+			// Simulate price fluctuation (in real app, this would be actual API data)
+			priceChange := (rand.Float64() - 0.5) * 0.02 // ±1% change
+			update.Price = crypto.Price * (1 + priceChange)
+		case models.UpdateTypeVolume:
+			update.Volume = crypto.Volume24h
+		case models.UpdateTypeMarketCap:
+			update.MarketCap = crypto.MarketCap
+		}
+
+		updates = append(updates, update)
+	}
+	return updates
+}
+
 // streamPriceUpdates - Helper to fetch and send price updates
-func (s *CryptoService) streamPriceUpdates(coins []string, eventChan chan<- models.StreamEvent) {
+func (s *CryptoService) streamPriceUpdates(ctx context.Context, coins, types []string, eventChan chan<- models.StreamEvent) {
 	var wg sync.WaitGroup
-	updateChan := make(chan models.PriceUpdate, len(coins))
+	updateChan := make(chan models.PriceUpdate, len(coins)*len(types))
 
 	// Fetch prices concurrently
 	for _, coin := range coins {
@@ -331,26 +1281,15 @@ func (s *CryptoService) streamPriceUpdates(coins []string, eventChan chan<- mode
 		go func(coinID string) {
 			defer wg.Done()
 
-			crypto, err := s.GetSingleCrypto(coinID)
+			crypto, err := s.GetSingleCrypto(ctx, coinID)
 			if err != nil {
 				log.Printf("Error fetching %s: %v", coinID, err)
 				return
 			}
 
-			// Simulate price fluctuation (in real app, this would be actual API data)
-			priceChange := (rand.Float64() - 0.5) * 0.02 // ±1% change
-			newPrice := crypto.Price * (1 + priceChange)
-
-			update := models.PriceUpdate{
-				CoinID:     crypto.ID,
-				Symbol:     crypto.Symbol,
-				Price:      newPrice,
-				Change24h:  crypto.Change24h,
-				Timestamp:  time.Now(),
-				UpdateType: "price",
+			for _, update := range priceUpdates(crypto, types) {
+				updateChan <- update
 			}
-
-			updateChan <- update
 		}(coin)
 	}
 
@@ -377,41 +1316,22 @@ func (s *CryptoService) streamPriceUpdates(coins []string, eventChan chan<- mode
 	}
 }
 
-// WebSocket subscriber management
-func (s *CryptoService) AddSubscriber(id string) <-chan models.StreamEvent {
-	s.subMu.Lock()
-	defer s.subMu.Unlock()
-
-	eventChan := make(chan models.StreamEvent, 100)
-	s.subscribers[id] = eventChan
-
-	log.Printf("Added subscriber: %s", id)
-	return eventChan
-}
-
-func (s *CryptoService) RemoveSubscriber(id string) {
-	s.subMu.Lock()
-	defer s.subMu.Unlock()
-
-	if eventChan, exists := s.subscribers[id]; exists {
-		close(eventChan)
-		delete(s.subscribers, id)
-		log.Printf("Removed subscriber: %s", id)
-	}
+// Shutdown stops active streams, which send a final "shutdown" event, and
+// closes all subscriber channels. New streams and subscribers are refused.
+func (s *CryptoService) Shutdown() {
+	s.doneOnce.Do(func() {
+		// Under subMu so AddSubscriber and StartStream see it atomically
+		s.subMu.Lock()
+		close(s.done)
+		s.subMu.Unlock()
+	})
+
+	s.removeAllSubscribers()
 }
 
-// Broadcast to all WebSocket subscribers
-func (s *CryptoService) BroadcastToSubscribers(event models.StreamEvent) {
-	s.subMu.RLock()
-	defer s.subMu.RUnlock()
-
-	for id, eventChan := range s.subscribers {
-		select {
-		case eventChan <- event:
-		case <-time.After(100 * time.Millisecond):
-			log.Printf("Subscriber %s channel full, dropping event", id)
-		}
-	}
+// Done is closed once the service starts shutting down
+func (s *CryptoService) Done() <-chan struct{} {
+	return s.done
 }
 
 // StartPriceStreaming - Background service for WebSocket broadcasting
@@ -428,44 +1348,63 @@ func (s *CryptoService) StartPriceStreaming(ctx context.Context, coins []string,
 			hasSubscribers := len(s.subscribers) > 0
 			s.subMu.RUnlock()
 
-			if !hasSubscribers {
+			// Coins with active alerts are checked even without subscribers
+			var alertCoins []string
+			if s.alerts != nil {
+				var err error
+				alertCoins, err = s.alerts.ActiveCoins()
+				if err != nil {
+					log.Printf("Error loading alert coins: %v", err)
+				}
+			}
+
+			if !hasSubscribers && len(alertCoins) == 0 {
 				continue
 			}
 
+			broadcast := make(map[string]bool)
+			if hasSubscribers {
+				for _, coin := range coins {
+					broadcast[coin] = true
+				}
+			}
+			targets := make(map[string]bool, len(broadcast)+len(alertCoins))
+			for coin := range broadcast {
+				targets[coin] = true
+			}
+			for _, coin := range alertCoins {
+				targets[coin] = true
+			}
+
 			// Fetch and broadcast updates
 			go func() {
 				var wg sync.WaitGroup
-				for _, coin := range coins {
+				for coin := range targets {
 					wg.Add(1)
 					go func(coinID string) {
 						defer wg.Done()
 
-						crypto, err := s.GetSingleCrypto(coinID)
+						crypto, err := s.GetSingleCrypto(ctx, coinID)
 						if err != nil {
 							return
 						}
 
-						// Simulate price change
-						priceChange := (rand.Float64() - 0.5) * 0.02
-						newPrice := crypto.Price * (1 + priceChange)
-
-						update := models.PriceUpdate{
-							CoinID:     crypto.ID,
-							Symbol:     crypto.Symbol,
-							Price:      newPrice,
-							Change24h:  crypto.Change24h,
-							Timestamp:  time.Now(),
-							UpdateType: "price",
-						}
+						s.checkAlerts(crypto)
 
-						event := models.StreamEvent{
-							Type:      "price_update",
-							Data:      update,
-							Timestamp: time.Now(),
-							ID:        uuid.New().String(),
+						if !broadcast[coinID] {
+							return
 						}
 
-						s.BroadcastToSubscribers(event)
+						// Every update type is broadcast; connections
+						// filter by what their client subscribed to
+						for _, update := range priceUpdates(crypto, allUpdateTypes) {
+							s.BroadcastToSubscribers(models.StreamEvent{
+								Type:      "price_update",
+								Data:      update,
+								Timestamp: time.Now(),
+								ID:        uuid.New().String(),
+							})
+						}
 					}(coin)
 				}
 				wg.Wait()
@@ -473,3 +1412,33 @@ func (s *CryptoService) StartPriceStreaming(ctx context.Context, coins []string,
 		}
 	}
 }
+
+// checkAlerts evaluates price alerts for a fetched coin and notifies owners
+func (s *CryptoService) checkAlerts(crypto *models.CryptoData) {
+	if s.alerts == nil {
+		return
+	}
+
+	fired, err := s.alerts.Evaluate(crypto.ID, crypto.Price)
+	if err != nil {
+		log.Printf("Error evaluating alerts for %s: %v", crypto.ID, err)
+	}
+
+	for _, alert := range fired {
+		log.Printf("Alert %d triggered for user %d: %s %s %.2f", alert.ID, alert.UserID, alert.CoinID, alert.Direction, alert.TargetPrice)
+
+		s.BroadcastToUser(alert.UserID, models.StreamEvent{
+			Type: "alert",
+			Data: models.AlertEvent{
+				AlertID:      alert.ID,
+				CoinID:       alert.CoinID,
+				Direction:    alert.Direction,
+				TargetPrice:  alert.TargetPrice,
+				CurrentPrice: crypto.Price,
+				TriggeredAt:  *alert.TriggeredAt,
+			},
+			Timestamp: time.Now(),
+			ID:        uuid.New().String(),
+		})
+	}
+}
@@ -0,0 +1,725 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"my-go-backend/pkg/models"
+)
+
+// roundTripFunc lets a function stand in for CoinGecko
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+// jsonResponse answers req with status and a JSON body
+func jsonResponse(req *http.Request, status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}
+}
+
+// newStubCryptoService returns a service at baseURL whose CoinGecko calls
+// are answered by upstream
+func newStubCryptoService(t *testing.T, baseURL, apiKey string, upstream roundTripFunc, opts ...CryptoServiceOption) *CryptoService {
+	t.Helper()
+	opts = append([]CryptoServiceOption{WithHTTPClient(&http.Client{Transport: upstream})}, opts...)
+	svc := NewCryptoService(baseURL, apiKey, opts...)
+	t.Cleanup(svc.Shutdown)
+	return svc
+}
+
+// marketsHandler serves /coins/markets for the coins in prices. Each coin's
+// volume is twice its price and its market cap ten times.
+func marketsHandler(prices map[string]float64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/coins/markets") {
+			http.NotFound(w, r)
+			return
+		}
+		coins := []models.CoinGeckoResponse{}
+		for _, id := range strings.Split(r.URL.Query().Get("ids"), ",") {
+			if price, ok := prices[id]; ok {
+				coins = append(coins, models.CoinGeckoResponse{
+					ID: id, Symbol: id[:3], Name: id, CurrentPrice: price, TotalVolume: 2 * price, MarketCap: int64(10 * price),
+				})
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(coins)
+	}
+}
+
+const bitcoinMarkets = `[{"id":"bitcoin","symbol":"btc","name":"Bitcoin","current_price":50000}]`
+
+func TestCoinGeckoBaseURLAndKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		baseURL string
+		apiKey  string
+		wantURL string
+		header  string // Header the key is sent in; empty when none is sent
+	}{
+		{"demo key", "http://coingecko.test/api/v3/", "demo-key", "http://coingecko.test/api/v3/coins/markets", "x-cg-demo-api-key"},
+		{"pro key", "https://pro-api.coingecko.com/api/v3", "pro-key", "https://pro-api.coingecko.com/api/v3/coins/markets", "x-cg-pro-api-key"},
+		{"no key", "https://api.coingecko.com/api/v3", "", "https://api.coingecko.com/api/v3/coins/markets", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *http.Request
+			svc := newStubCryptoService(t, tt.baseURL, tt.apiKey, func(req *http.Request) (*http.Response, error) {
+				got = req
+				return jsonResponse(req, http.StatusOK, bitcoinMarkets), nil
+			})
+
+			if _, err := svc.GetSingleCrypto(context.Background(), "bitcoin"); err != nil {
+				t.Fatalf("GetSingleCrypto: %v", err)
+			}
+			if url := got.URL.Scheme + "://" + got.URL.Host + got.URL.Path; url != tt.wantURL {
+				t.Errorf("requested %s, want %s", url, tt.wantURL)
+			}
+			for _, header := range []string{"x-cg-demo-api-key", "x-cg-pro-api-key"} {
+				want := ""
+				if header == tt.header {
+					want = tt.apiKey
+				}
+				if value := got.Header.Get(header); value != want {
+					t.Errorf("%s = %q, want %q", header, value, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCryptoServiceAgainstStubServer(t *testing.T) {
+	server := httptest.NewServer(marketsHandler(map[string]float64{"bitcoin": 50000, "ethereum": 3000}))
+	defer server.Close()
+	svc := NewCryptoService(server.URL, "", WithStreamIntervalBounds(time.Millisecond, time.Second))
+	defer svc.Shutdown()
+	ctx := context.Background()
+
+	crypto, err := svc.GetSingleCrypto(ctx, "bitcoin")
+	if err != nil {
+		t.Fatalf("GetSingleCrypto: %v", err)
+	}
+	if crypto.Price != 50000 || crypto.Symbol != "bit" {
+		t.Errorf("bitcoin = %+v, want a price of 50000", crypto)
+	}
+
+	bulk, err := svc.GetBulkCrypto(ctx, []string{"bitcoin", "ethereum"}, 5*time.Second, PortfolioOptions{})
+	if err != nil {
+		t.Fatalf("GetBulkCrypto: %v", err)
+	}
+	prices := make(map[string]float64)
+	for _, coin := range bulk.Portfolio {
+		prices[coin.ID] = coin.Price
+	}
+	if len(prices) != 2 || prices["bitcoin"] != 50000 || prices["ethereum"] != 3000 {
+		t.Errorf("bulk prices = %v, want bitcoin 50000 and ethereum 3000", prices)
+	}
+
+	events := svc.StreamPriceUpdates(ctx, models.StreamConfig{Coins: []string{"ethereum"}, Interval: time.Millisecond, MaxUpdates: 1})
+	var types []string
+	for event := range events {
+		types = append(types, event.Type)
+	}
+	if strings.Join(types, ",") != "price_update,end" {
+		t.Errorf("stream events = %v, want one price_update then end", types)
+	}
+}
+
+func TestGetOHLC(t *testing.T) {
+	var requests []*http.Request
+	svc := newStubCryptoService(t, "http://coingecko.test/api/v3", "", func(req *http.Request) (*http.Response, error) {
+		requests = append(requests, req)
+		if strings.Contains(req.URL.Path, "/coins/missing/") {
+			return jsonResponse(req, http.StatusNotFound, `{"error":"coin not found"}`), nil
+		}
+		// The short row is skipped
+		return jsonResponse(req, http.StatusOK, `[[1700000000000,100,110,90,105],[1700014400000,105,120,100,115],[1700028800000,115]]`), nil
+	})
+	ctx := context.Background()
+
+	candles, err := svc.GetOHLC(ctx, "bitcoin", "eur", 30)
+	if err != nil {
+		t.Fatalf("GetOHLC: %v", err)
+	}
+	want := []models.OHLCCandle{
+		{Timestamp: time.UnixMilli(1700000000000).UTC(), Open: 100, High: 110, Low: 90, Close: 105},
+		{Timestamp: time.UnixMilli(1700014400000).UTC(), Open: 105, High: 120, Low: 100, Close: 115},
+	}
+	if len(candles) != len(want) {
+		t.Fatalf("candles = %+v, want %+v", candles, want)
+	}
+	for i := range want {
+		if candles[i] != want[i] {
+			t.Errorf("candle %d = %+v, want %+v", i, candles[i], want[i])
+		}
+	}
+
+	req := requests[0]
+	if req.URL.Path != "/api/v3/coins/bitcoin/ohlc" || req.URL.Query().Get("vs_currency") != "eur" || req.URL.Query().Get("days") != "30" {
+		t.Errorf("requested %s, want /coins/bitcoin/ohlc in eur over 30 days", req.URL)
+	}
+
+	if _, err := svc.GetOHLC(ctx, "bitcoin", "eur", 30); err != nil || len(requests) != 1 {
+		t.Errorf("second call: error %v after %d requests, want it cached", err, len(requests))
+	}
+	if _, err := svc.GetOHLC(ctx, "bitcoin", "eur", 5); !errors.Is(err, ErrInvalidDays) || len(requests) != 1 {
+		t.Errorf("unsupported days: error = %v, want ErrInvalidDays without a request", err)
+	}
+	if _, err := svc.GetOHLC(ctx, "missing", "usd", 7); !errors.Is(err, ErrCoinNotFound) {
+		t.Errorf("unknown coin: error = %v, want ErrCoinNotFound", err)
+	}
+}
+
+func TestListCoins(t *testing.T) {
+	var markets []*http.Request
+	svc := newStubCryptoService(t, "http://coingecko.test/api/v3", "", func(req *http.Request) (*http.Response, error) {
+		if strings.HasSuffix(req.URL.Path, "/coins/list") {
+			return jsonResponse(req, http.StatusOK, `[{"id":"bitcoin"},{"id":"ethereum"},{"id":"tether"},{"id":"solana"},{"id":"dogecoin"}]`), nil
+		}
+		markets = append(markets, req)
+		return jsonResponse(req, http.StatusOK, `[
+			{"id":"tether","symbol":"usdt","name":"Tether","current_price":1,"market_cap_rank":3},
+			{"id":"solana","symbol":"sol","name":"Solana","current_price":150,"market_cap_rank":4}
+		]`), nil
+	})
+	ctx := context.Background()
+
+	page, err := svc.ListCoins(ctx, 2, 2)
+	if err != nil {
+		t.Fatalf("ListCoins: %v", err)
+	}
+	want := []models.CoinListItem{
+		{ID: "tether", Symbol: "usdt", Name: "Tether", Rank: 3},
+		{ID: "solana", Symbol: "sol", Name: "Solana", Rank: 4},
+	}
+	coins := page.Data.([]models.CoinListItem)
+	if len(coins) != len(want) || coins[0] != want[0] || coins[1] != want[1] {
+		t.Errorf("coins = %+v, want %+v", coins, want)
+	}
+	if page.Total != 5 || page.Page != 2 || page.Limit != 2 || page.TotalPages != 3 {
+		t.Errorf("page = %+v, want page 2 of 3 with 5 coins in total", page)
+	}
+
+	query := markets[0].URL.Query()
+	if query.Get("page") != "2" || query.Get("per_page") != "2" || query.Get("order") != "market_cap_desc" {
+		t.Errorf("markets query = %s, want page 2 of 2 by market cap", markets[0].URL.RawQuery)
+	}
+
+	if _, err := svc.ListCoins(ctx, 2, 2); err != nil || len(markets) != 1 {
+		t.Errorf("same page again: error %v after %d markets calls, want it cached", err, len(markets))
+	}
+
+	page, err = svc.ListCoins(ctx, 0, 1000)
+	if err != nil {
+		t.Fatalf("ListCoins: %v", err)
+	}
+	if page.Page != 1 || page.Limit != MaxCoinPageSize || markets[1].URL.Query().Get("per_page") != "250" {
+		t.Errorf("out of range: page %d, limit %d; want them clamped to 1 and %d", page.Page, page.Limit, MaxCoinPageSize)
+	}
+}
+
+func TestMalformedResponsesAreNotCached(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want error
+	}{
+		{"null price", `[{"id":"bitcoin","symbol":"btc","name":"Bitcoin","current_price":null}]`, ErrMalformedResponse},
+		{"missing price", `[{"id":"bitcoin","symbol":"btc","name":"Bitcoin"}]`, ErrMalformedResponse},
+		{"zero price", `[{"id":"bitcoin","current_price":0}]`, ErrMalformedResponse},
+		{"another coin", `[{"id":"ethereum","current_price":3000}]`, ErrMalformedResponse},
+		{"empty list", `[]`, ErrCoinNotFound},
+		{"not JSON", `<html>Bad gateway</html>`, ErrUpstreamUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newStubCryptoService(t, "http://coingecko.test/api/v3", "", func(req *http.Request) (*http.Response, error) {
+				return jsonResponse(req, http.StatusOK, tt.body), nil
+			})
+
+			crypto, err := svc.GetSingleCrypto(context.Background(), "bitcoin")
+			if !errors.Is(err, tt.want) {
+				t.Errorf("error = %v, want %v", err, tt.want)
+			}
+			if crypto != nil {
+				t.Errorf("returned %+v along with the error", crypto)
+			}
+			if _, err := svc.GetCachedCoin("bitcoin"); !errors.Is(err, ErrNotCached) {
+				t.Errorf("cache lookup: error = %v, want nothing cached", err)
+			}
+		})
+	}
+}
+
+func TestGetBulkCryptoSlowCoin(t *testing.T) {
+	markets := marketsHandler(map[string]float64{"bitcoin": 50000, "ethereum": 3000})
+	svc := newStubCryptoService(t, "http://coingecko.test/api/v3", "", func(req *http.Request) (*http.Response, error) {
+		if req.URL.Query().Get("ids") == "dogecoin" {
+			// Hangs until the coin's deadline gives up on it
+			<-req.Context().Done()
+			return nil, req.Context().Err()
+		}
+		w := httptest.NewRecorder()
+		markets(w, req)
+		return w.Result(), nil
+	}, WithCoinTimeoutPercent(50))
+
+	bulk, err := svc.GetBulkCrypto(context.Background(), []string{"bitcoin", "dogecoin", "ethereum"}, 400*time.Millisecond, PortfolioOptions{})
+	if err != nil {
+		t.Fatalf("GetBulkCrypto: %v", err)
+	}
+
+	results := make(map[string]models.CryptoData)
+	for _, coin := range bulk.Portfolio {
+		results[coin.ID] = coin
+	}
+	if results["bitcoin"].Price != 50000 || results["ethereum"].Price != 3000 {
+		t.Errorf("bitcoin and ethereum = %+v, %+v; want their prices", results["bitcoin"], results["ethereum"])
+	}
+	// "timeout" rather than "overall timeout": it hit its own 200ms deadline
+	if got := results["dogecoin"].Error; got != "timeout" {
+		t.Errorf("dogecoin error = %q, want timeout", got)
+	}
+	if bulk.SuccessCount != 2 || bulk.ErrorCount != 1 {
+		t.Errorf("success %d, errors %d; want 2 and 1", bulk.SuccessCount, bulk.ErrorCount)
+	}
+}
+
+func TestPortfolioConcurrencyLimit(t *testing.T) {
+	prices := map[string]float64{"a-coin": 1, "b-coin": 2, "c-coin": 3, "d-coin": 4, "e-coin": 5, "f-coin": 6}
+	markets := marketsHandler(prices)
+
+	var mu sync.Mutex
+	inFlight, peak := 0, 0
+	svc := newStubCryptoService(t, "http://coingecko.test/api/v3", "", func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		inFlight++
+		peak = max(peak, inFlight)
+		mu.Unlock()
+
+		// Long enough for the other fetches to pile up if they were allowed
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		w := httptest.NewRecorder()
+		markets(w, req)
+		return w.Result(), nil
+	}, WithMaxConcurrency(2))
+
+	coins := make([]string, 0, len(prices))
+	for coin := range prices {
+		coins = append(coins, coin)
+	}
+	portfolio, err := svc.GetPortfolioRealtime(context.Background(), coins, PortfolioOptions{})
+	if err != nil {
+		t.Fatalf("GetPortfolioRealtime: %v", err)
+	}
+	if portfolio.SuccessCount != len(coins) {
+		t.Errorf("%d of %d coins loaded", portfolio.SuccessCount, len(coins))
+	}
+	if peak != 2 {
+		t.Errorf("at most %d upstream calls at once, want 2", peak)
+	}
+}
+
+func TestStreamUpdateTypes(t *testing.T) {
+	markets := marketsHandler(map[string]float64{"bitcoin": 50000})
+	svc := newStubCryptoService(t, "http://coingecko.test/api/v3", "", func(req *http.Request) (*http.Response, error) {
+		w := httptest.NewRecorder()
+		markets(w, req)
+		return w.Result(), nil
+	}, WithStreamIntervalBounds(time.Millisecond, time.Second))
+
+	types, err := ParseUpdateTypes([]string{"Volume", "price", "market_cap", "volume"})
+	if err != nil {
+		t.Fatalf("ParseUpdateTypes: %v", err)
+	}
+	events := svc.StreamPriceUpdates(context.Background(), models.StreamConfig{
+		Coins:       []string{"bitcoin"},
+		Interval:    time.Millisecond,
+		MaxUpdates:  1,
+		UpdateTypes: types,
+	})
+
+	updates := make(map[string]models.PriceUpdate)
+	for event := range events {
+		if event.Type != "price_update" {
+			continue
+		}
+		update := event.Data.(models.PriceUpdate)
+		updates[update.UpdateType] = update
+	}
+	if len(updates) != 3 {
+		t.Fatalf("update types = %v, want price, volume and market_cap", updates)
+	}
+	if price := updates[models.UpdateTypePrice].Price; price < 49000 || price > 51000 {
+		t.Errorf("price update = %v, want about 50000", price)
+	}
+	if volume := updates[models.UpdateTypeVolume].Volume; volume != 100000 {
+		t.Errorf("volume update = %v, want 100000", volume)
+	}
+	if marketCap := updates[models.UpdateTypeMarketCap].MarketCap; marketCap != 500000 {
+		t.Errorf("market cap update = %v, want 500000", marketCap)
+	}
+
+	if _, err := ParseUpdateTypes([]string{"price", "supply"}); !errors.Is(err, ErrInvalidUpdateType) {
+		t.Errorf("unknown type: error = %v, want ErrInvalidUpdateType", err)
+	}
+}
+
+func TestCancelledContextAbortsFetch(t *testing.T) {
+	started := make(chan struct{})
+	svc := newStubCryptoService(t, "http://coingecko.test/api/v3", "", func(req *http.Request) (*http.Response, error) {
+		close(started)
+		// Never answers; only the caller's context ends the call
+		<-req.Context().Done()
+		return nil, req.Context().Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := svc.GetSingleCrypto(ctx, "bitcoin")
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("error = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("fetch kept running after its context was cancelled")
+	}
+	if _, err := svc.GetCachedCoin("bitcoin"); !errors.Is(err, ErrNotCached) {
+		t.Errorf("cache lookup: error = %v, want nothing cached", err)
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name string
+		opts []CryptoServiceOption
+	}{
+		{"default client", nil},
+		{"custom client", []CryptoServiceOption{WithHTTPClient(&http.Client{})}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := NewCryptoService(server.URL, "", append(tt.opts, WithRequestTimeout(100*time.Millisecond))...)
+			defer svc.Shutdown()
+
+			start := time.Now()
+			_, err := svc.GetSingleCrypto(context.Background(), "bitcoin")
+			elapsed := time.Since(start)
+
+			if !errors.Is(err, ErrUpstreamUnavailable) {
+				t.Errorf("error = %v, want ErrUpstreamUnavailable", err)
+			}
+			if elapsed < 100*time.Millisecond || elapsed > 2*time.Second {
+				t.Errorf("call gave up after %v, want about 100ms", elapsed)
+			}
+		})
+	}
+}
+
+func TestCompare(t *testing.T) {
+	var requests []*http.Request
+	svc := newStubCryptoService(t, "http://coingecko.test/api/v3", "", func(req *http.Request) (*http.Response, error) {
+		requests = append(requests, req)
+		return jsonResponse(req, http.StatusOK, `[
+			{"id":"bitcoin","symbol":"btc","name":"Bitcoin","current_price":60000,"market_cap":1200000000000,"price_change_percentage_24h":2.5},
+			{"id":"ethereum","symbol":"eth","name":"Ethereum","current_price":3000,"market_cap":400000000000,"price_change_percentage_24h":-1.5}
+		]`), nil
+	})
+
+	comparison, err := svc.Compare(context.Background(), "Bitcoin", "ethereum", "EUR")
+	if err != nil {
+		t.Fatalf("Compare: %v", err)
+	}
+	if len(requests) != 1 {
+		t.Errorf("made %d upstream calls, want one batched call", len(requests))
+	} else if ids := requests[0].URL.Query().Get("ids"); ids != "bitcoin,ethereum" {
+		t.Errorf("requested ids %q, want bitcoin,ethereum", ids)
+	}
+	if comparison.Currency != "eur" || comparison.A.ID != "bitcoin" || comparison.B.ID != "ethereum" {
+		t.Errorf("comparison = %+v, want bitcoin against ethereum in eur", comparison)
+	}
+	if comparison.PriceRatio != 20 {
+		t.Errorf("price ratio = %v, want 20", comparison.PriceRatio)
+	}
+	if comparison.MarketCapRatio == nil || *comparison.MarketCapRatio != 3 {
+		t.Errorf("market cap ratio = %v, want 3", comparison.MarketCapRatio)
+	}
+	if comparison.Change24hDiff != 4 {
+		t.Errorf("24h change difference = %v, want 4", comparison.Change24hDiff)
+	}
+
+	if _, err := svc.Compare(context.Background(), "bitcoin", "../eth", "usd"); !errors.Is(err, ErrInvalidCoinID) {
+		t.Errorf("invalid id: error = %v, want ErrInvalidCoinID", err)
+	}
+	if _, err := svc.Compare(context.Background(), "bitcoin", "tether", "usd"); !errors.Is(err, ErrCoinNotFound) {
+		t.Errorf("coin missing from the response: error = %v, want ErrCoinNotFound", err)
+	}
+}
+
+func TestCheckUpstream(t *testing.T) {
+	healthy := httptest.NewServer(marketsHandler(map[string]float64{"bitcoin": 50000}))
+	defer healthy.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"invalid api key"}`, http.StatusUnauthorized)
+	}))
+	defer failing.Close()
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer slow.Close()
+
+	tests := []struct {
+		name    string
+		baseURL string
+		coin    string
+		want    error // nil for a passing check
+	}{
+		{"reachable", healthy.URL, "bitcoin", nil},
+		{"unknown coin", healthy.URL, "notacoin", ErrCoinNotFound},
+		{"rejected", failing.URL, "bitcoin", ErrUpstreamUnavailable},
+		{"too slow", slow.URL, "bitcoin", context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := NewCryptoService(tt.baseURL, "")
+			defer svc.Shutdown()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			err := svc.CheckUpstream(ctx, tt.coin)
+			if tt.want == nil && err != nil {
+				t.Errorf("CheckUpstream: %v", err)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetGlobal(t *testing.T) {
+	var calls int
+	var failing bool
+	svc := newStubCryptoService(t, "http://coingecko.test/api/v3", "", func(req *http.Request) (*http.Response, error) {
+		calls++
+		if failing {
+			return jsonResponse(req, http.StatusBadGateway, `{}`), nil
+		}
+		if !strings.HasSuffix(req.URL.Path, "/global") {
+			t.Errorf("requested %s, want /global", req.URL.Path)
+		}
+		return jsonResponse(req, http.StatusOK, `{"data":{
+			"active_cryptocurrencies":14000,
+			"total_market_cap":{"usd":2500000000000,"eur":2300000000000},
+			"total_volume":{"usd":90000000000},
+			"market_cap_percentage":{"btc":52.5,"eth":17.1},
+			"market_cap_change_percentage_24h_usd":-1.25,
+			"updated_at":1700000000
+		}}`), nil
+	})
+	ctx := context.Background()
+
+	global, err := svc.GetGlobal(ctx)
+	if err != nil {
+		t.Fatalf("GetGlobal: %v", err)
+	}
+	want := models.GlobalMarketData{
+		ActiveCryptocurrencies: 14000,
+		TotalMarketCapUSD:      2500000000000,
+		TotalVolume24hUSD:      90000000000,
+		BTCDominance:           52.5,
+		MarketCapChange24h:     -1.25,
+		UpdatedAt:              time.Unix(1700000000, 0).UTC(),
+	}
+	if *global != want {
+		t.Errorf("global = %+v, want %+v", *global, want)
+	}
+
+	if _, err := svc.GetGlobal(ctx); err != nil || calls != 1 {
+		t.Errorf("second call: error %v after %d upstream calls, want it cached", err, calls)
+	}
+
+	// Once expired, a failing upstream serves the last overview marked Stale
+	failing = true
+	svc.globalMu.Lock()
+	svc.globalFetchedAt = time.Now().Add(-globalCacheTTL)
+	svc.globalMu.Unlock()
+	stale, err := svc.GetGlobal(ctx)
+	if err != nil {
+		t.Fatalf("GetGlobal with the upstream down: %v", err)
+	}
+	if !stale.Stale || stale.TotalMarketCapUSD != want.TotalMarketCapUSD {
+		t.Errorf("global = %+v, want the last overview marked Stale", stale)
+	}
+
+	svc.ClearCache()
+	if _, err := svc.GetGlobal(ctx); !errors.Is(err, ErrUpstreamUnavailable) {
+		t.Errorf("nothing cached: error = %v, want ErrUpstreamUnavailable", err)
+	}
+}
+
+// ageCachedPrice moves a cached price's fetch time back by age
+func ageCachedPrice(svc *CryptoService, coinID string, age time.Duration) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	entry := svc.cache[coinID]
+	entry.FetchedAt = entry.FetchedAt.Add(-age)
+	svc.cache[coinID] = entry
+}
+
+func TestServeStale(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      []CryptoServiceOption
+		age       time.Duration
+		wantStale bool
+	}{
+		{"expired entry served", []CryptoServiceOption{WithServeStale(10 * time.Minute)}, 2 * time.Minute, true},
+		{"too old to serve", []CryptoServiceOption{WithServeStale(10 * time.Minute)}, 20 * time.Minute, false},
+		{"disabled", nil, 2 * time.Minute, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var failing bool
+			svc := newStubCryptoService(t, "http://coingecko.test/api/v3", "", func(req *http.Request) (*http.Response, error) {
+				if failing {
+					return jsonResponse(req, http.StatusServiceUnavailable, `{}`), nil
+				}
+				return jsonResponse(req, http.StatusOK, bitcoinMarkets), nil
+			}, tt.opts...)
+			ctx := context.Background()
+
+			fresh, err := svc.GetSingleCrypto(ctx, "bitcoin")
+			if err != nil {
+				t.Fatalf("GetSingleCrypto: %v", err)
+			}
+			ageCachedPrice(svc, "bitcoin", tt.age)
+			failing = true
+
+			got, err := svc.GetSingleCrypto(ctx, "bitcoin")
+			if !tt.wantStale {
+				if !errors.Is(err, ErrUpstreamUnavailable) {
+					t.Errorf("error = %v, want ErrUpstreamUnavailable", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetSingleCrypto with the upstream down: %v", err)
+			}
+			if !got.Stale || got.Price != fresh.Price {
+				t.Errorf("coin = %+v, want the cached price marked Stale", got)
+			}
+		})
+	}
+}
+
+func TestDefaultCurrency(t *testing.T) {
+	tests := []struct {
+		name     string
+		currency string
+		want     string
+	}{
+		{"configured", "eur", "eur"},
+		{"unsupported falls back", "xyz", DefaultCurrency},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var currencies []string
+			svc := newStubCryptoService(t, "http://coingecko.test/api/v3", "", func(req *http.Request) (*http.Response, error) {
+				currencies = append(currencies, req.URL.Query().Get("vs_currency"))
+				return jsonResponse(req, http.StatusOK, bitcoinMarkets), nil
+			}, WithDefaultCurrency(tt.currency))
+
+			if got := svc.DefaultCurrency(); got != tt.want {
+				t.Errorf("DefaultCurrency = %q, want %q", got, tt.want)
+			}
+			if _, err := svc.GetSingleCrypto(context.Background(), "bitcoin"); err != nil {
+				t.Fatalf("GetSingleCrypto: %v", err)
+			}
+			if err := svc.CheckUpstream(context.Background(), "bitcoin"); err != nil {
+				t.Fatalf("CheckUpstream: %v", err)
+			}
+			if len(currencies) != 2 || currencies[0] != tt.want || currencies[1] != tt.want {
+				t.Errorf("requested currencies %q, want %s for both", currencies, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetSparklines(t *testing.T) {
+	var requests []*http.Request
+	svc := newStubCryptoService(t, "http://coingecko.test/api/v3", "", func(req *http.Request) (*http.Response, error) {
+		requests = append(requests, req)
+		if req.URL.Query().Get("sparkline") != "true" {
+			return jsonResponse(req, http.StatusOK, bitcoinMarkets), nil
+		}
+		return jsonResponse(req, http.StatusOK, `[
+			{"id":"bitcoin","current_price":50000,"sparkline_in_7d":{"price":[48000,49000,50000]}},
+			{"id":"tether","current_price":1}
+		]`), nil
+	})
+	ctx := context.Background()
+
+	if _, err := svc.GetSingleCrypto(ctx, "bitcoin"); err != nil {
+		t.Fatalf("GetSingleCrypto: %v", err)
+	}
+	if got := requests[0].URL.Query().Get("sparkline"); got == "true" {
+		t.Errorf("plain price request asked for the sparkline")
+	}
+
+	sparklines, err := svc.GetSparklines(ctx, []string{"bitcoin", "tether"}, "usd")
+	if err != nil {
+		t.Fatalf("GetSparklines: %v", err)
+	}
+	if got := sparklines["bitcoin"]; len(got) != 3 || got[0] != 48000 || got[2] != 50000 {
+		t.Errorf("bitcoin sparkline = %v, want [48000 49000 50000]", got)
+	}
+	if _, ok := sparklines["tether"]; ok {
+		t.Errorf("tether sparkline = %v, want it left out", sparklines["tether"])
+	}
+
+	if _, err := svc.GetSparklines(ctx, []string{"bitcoin"}, "usd"); err != nil || len(requests) != 2 {
+		t.Errorf("cached sparkline: error %v after %d requests, want no new request", err, len(requests))
+	}
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// supportedCurrencies are the vs_currency values accepted by the API
+var supportedCurrencies = map[string]bool{
+	"usd": true, "eur": true, "gbp": true, "jpy": true, "aud": true, "cad": true,
+	"chf": true, "cny": true, "inr": true, "krw": true, "btc": true, "eth": true,
+}
+
+// ErrUnsupportedCurrency is returned for a currency not in supportedCurrencies
+var ErrUnsupportedCurrency = errors.New("unsupported currency")
+
+// IsSupportedCurrency reports whether currency can be used as a vs_currency
+func IsSupportedCurrency(currency string) bool {
+	return supportedCurrencies[strings.ToLower(currency)]
+}
+
+// NormalizeCurrencies lowercases and de-duplicates currencies, keeping their
+// order, and rejects any that aren't supported
+func NormalizeCurrencies(currencies []string) ([]string, error) {
+	seen := make(map[string]bool, len(currencies))
+	normalized := make([]string, 0, len(currencies))
+	for _, currency := range currencies {
+		currency = strings.ToLower(strings.TrimSpace(currency))
+		if !supportedCurrencies[currency] {
+			return nil, fmt.Errorf("%w: %q", ErrUnsupportedCurrency, currency)
+		}
+		if seen[currency] {
+			continue
+		}
+		seen[currency] = true
+		normalized = append(normalized, currency)
+	}
+	return normalized, nil
+}
@@ -0,0 +1,32 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"my-go-backend/internal/migrations"
+)
+
+// newTestDB returns an empty in-memory SQLite database with the app's
+// migrations applied, for tests whose queries must really run
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("opening test database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("opening test database: %v", err)
+	}
+	// Every connection to ":memory:" is a separate database
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err := migrations.Migrate(db); err != nil {
+		t.Fatalf("migrating test database: %v", err)
+	}
+	return db
+}
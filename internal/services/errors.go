@@ -0,0 +1,41 @@
+package services
+
+import (
+	"errors"
+	"gorm.io/gorm"
+)
+
+// CodedError is an error with a machine-readable code, which the respond
+// package returns as APIResponse.Code. Sentinels of this type still match
+// with errors.Is.
+type CodedError struct {
+	Code    string // One of the models.Code* constants
+	Message string
+}
+
+func newCodedError(code, message string) *CodedError {
+	return &CodedError{Code: code, Message: message}
+}
+
+func (e *CodedError) Error() string {
+	return e.Message
+}
+
+// ErrorCode returns the error's models.Code* constant
+func (e *CodedError) ErrorCode() string {
+	return e.Code
+}
+
+// uniqueViolation is the SQLSTATE Postgres reports when an insert or update
+// conflicts with a unique index
+const uniqueViolation = "23505"
+
+// isUniqueViolation reports whether err is a unique constraint violation,
+// either translated by gorm or as reported by the driver
+func isUniqueViolation(err error) bool {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return true
+	}
+	var sqlErr interface{ SQLState() string }
+	return errors.As(err, &sqlErr) && sqlErr.SQLState() == uniqueViolation
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"my-go-backend/pkg/models"
+	"slices"
+)
+
+// DefaultMaxFavorites caps a user's favorites unless NewFavoriteService is given another limit
+const DefaultMaxFavorites = 50
+
+// ErrFavoriteExists is returned when a coin is already one of the user's favorites
+var ErrFavoriteExists = newCodedError(models.CodeFavoriteExists, "coin is already a favorite")
+
+// ErrFavoriteNotFound is returned when a coin isn't one of the user's favorites
+var ErrFavoriteNotFound = newCodedError(models.CodeFavoriteNotFound, "favorite not found")
+
+// ErrTooManyFavorites is returned when a user already has the maximum number of favorites
+var ErrTooManyFavorites = newCodedError(models.CodeFavoritesLimit, "favorites limit reached")
+
+type FavoriteService struct {
+	db           *gorm.DB
+	maxFavorites int
+}
+
+// NewFavoriteService keeps up to maxFavorites coins per user
+// (DefaultMaxFavorites when not positive)
+func NewFavoriteService(db *gorm.DB, maxFavorites int) *FavoriteService {
+	if maxFavorites <= 0 {
+		maxFavorites = DefaultMaxFavorites
+	}
+	return &FavoriteService{db: db, maxFavorites: maxFavorites}
+}
+
+// AddFavorite adds a coin to the user's favorites
+func (s *FavoriteService) AddFavorite(userID uint, coinID string) (*models.Favorite, error) {
+	coinID, err := NormalizeCoinID(coinID)
+	if err != nil {
+		return nil, err
+	}
+
+	favorite := models.Favorite{UserID: userID, CoinID: coinID}
+	err = withTx(s.db, func(tx *gorm.DB) error {
+		var coins []string
+		if err := tx.Model(&models.Favorite{}).Where("user_id = ?", userID).Pluck("coin_id", &coins).Error; err != nil {
+			return err
+		}
+		if slices.Contains(coins, coinID) {
+			return ErrFavoriteExists
+		}
+		if len(coins) >= s.maxFavorites {
+			return fmt.Errorf("%w: at most %d coins", ErrTooManyFavorites, s.maxFavorites)
+		}
+
+		// The unique index catches a concurrent add of the same coin
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&favorite)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrFavoriteExists
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &favorite, nil
+}
+
+// GetFavorites lists the user's favorites in the order they were added
+func (s *FavoriteService) GetFavorites(userID uint) ([]models.Favorite, error) {
+	favorites := []models.Favorite{}
+	if err := s.db.Where("user_id = ?", userID).Order("created_at, id").Find(&favorites).Error; err != nil {
+		return nil, err
+	}
+	return favorites, nil
+}
+
+// RemoveFavorite removes a coin from the user's favorites
+func (s *FavoriteService) RemoveFavorite(userID uint, coinID string) error {
+	coinID, err := NormalizeCoinID(coinID)
+	if err != nil {
+		return err
+	}
+
+	result := s.db.Where("user_id = ? AND coin_id = ?", userID, coinID).Delete(&models.Favorite{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrFavoriteNotFound
+	}
+	return nil
+}
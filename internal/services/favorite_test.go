@@ -0,0 +1,32 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFavoritesLimit(t *testing.T) {
+	s := NewFavoriteService(newTestDB(t), 2)
+
+	for _, coin := range []string{"bitcoin", "ethereum"} {
+		if _, err := s.AddFavorite(1, coin); err != nil {
+			t.Fatalf("adding %s: %v", coin, err)
+		}
+	}
+	if _, err := s.AddFavorite(1, "bitcoin"); !errors.Is(err, ErrFavoriteExists) {
+		t.Errorf("duplicate at the limit: error = %v, want ErrFavoriteExists", err)
+	}
+	if _, err := s.AddFavorite(1, "solana"); !errors.Is(err, ErrTooManyFavorites) {
+		t.Errorf("over the limit: error = %v, want ErrTooManyFavorites", err)
+	}
+	if _, err := s.AddFavorite(2, "solana"); err != nil {
+		t.Errorf("another user: %v, want their own limit", err)
+	}
+
+	if err := s.RemoveFavorite(1, "bitcoin"); err != nil {
+		t.Fatalf("RemoveFavorite: %v", err)
+	}
+	if _, err := s.AddFavorite(1, "solana"); err != nil {
+		t.Errorf("after removing one: %v, want room for another", err)
+	}
+}
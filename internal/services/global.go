@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"my-go-backend/internal/metrics"
+	"my-go-backend/pkg/models"
+)
+
+// globalCacheTTL is how long the market overview is served without refetching
+const globalCacheTTL = 5 * time.Minute
+
+// coinGeckoGlobal is the part of CoinGecko's /global response we use
+type coinGeckoGlobal struct {
+	Data struct {
+		ActiveCryptocurrencies int                `json:"active_cryptocurrencies"`
+		TotalMarketCap         map[string]float64 `json:"total_market_cap"`
+		TotalVolume            map[string]float64 `json:"total_volume"`
+		MarketCapPercentage    map[string]float64 `json:"market_cap_percentage"`
+		MarketCapChange24hUSD  float64            `json:"market_cap_change_percentage_24h_usd"`
+		UpdatedAt              int64              `json:"updated_at"`
+	} `json:"data"`
+}
+
+// GetGlobal returns the market overview, cached for globalCacheTTL. When
+// CoinGecko fails, the last fetched overview is returned marked Stale; the
+// error is only returned if there is none.
+func (s *CryptoService) GetGlobal(ctx context.Context) (*models.GlobalMarketData, error) {
+	s.globalMu.Lock()
+	cached, fetchedAt := s.global, s.globalFetchedAt
+	s.globalMu.Unlock()
+
+	if cached != nil && time.Since(fetchedAt) < globalCacheTTL {
+		metrics.CacheHits.Inc()
+		global := *cached
+		return &global, nil
+	}
+	metrics.CacheMisses.Inc()
+
+	global, err := s.fetchGlobal(ctx)
+	if err != nil {
+		if cached == nil {
+			return nil, err
+		}
+		log.Printf("Error fetching global market data, serving copy from %s ago: %v",
+			time.Since(fetchedAt).Round(time.Second), err)
+		stale := *cached
+		stale.Stale = true
+		return &stale, nil
+	}
+
+	s.globalMu.Lock()
+	s.global, s.globalFetchedAt = global, time.Now()
+	s.globalMu.Unlock()
+
+	result := *global
+	return &result, nil
+}
+
+// fetchGlobal calls /global
+func (s *CryptoService) fetchGlobal(ctx context.Context) (*models.GlobalMarketData, error) {
+	var response coinGeckoGlobal
+	resp, err := s.client.R().
+		SetContext(ctx).
+		SetResult(&response).
+		Get(fmt.Sprintf("%s/global", s.baseURL))
+
+	if err != nil {
+		metrics.CoinGeckoRequests.WithLabelValues("error").Inc()
+		return nil, upstreamError(resp, err)
+	}
+
+	if resp.StatusCode() != 200 {
+		metrics.CoinGeckoRequests.WithLabelValues("error").Inc()
+		return nil, upstreamError(resp, nil)
+	}
+	metrics.CoinGeckoRequests.WithLabelValues("success").Inc()
+
+	data := response.Data
+	if data.TotalMarketCap["usd"] <= 0 {
+		return nil, fmt.Errorf("%w: missing total market cap", ErrMalformedResponse)
+	}
+
+	return &models.GlobalMarketData{
+		ActiveCryptocurrencies: data.ActiveCryptocurrencies,
+		TotalMarketCapUSD:      data.TotalMarketCap["usd"],
+		TotalVolume24hUSD:      data.TotalVolume["usd"],
+		BTCDominance:           data.MarketCapPercentage["btc"],
+		MarketCapChange24h:     data.MarketCapChange24hUSD,
+		UpdatedAt:              time.Unix(data.UpdatedAt, 0).UTC(),
+	}, nil
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"errors"
+	"my-go-backend/pkg/models"
+)
+
+// DefaultPriceHistorySize is how many recent prices are kept per coin
+const DefaultPriceHistorySize = 60
+
+// ErrNoPriceHistory is returned for coins with no recorded prices
+var ErrNoPriceHistory = errors.New("no recent prices recorded for coin")
+
+// priceRing holds the last len(points) prices of one coin, overwriting the
+// oldest once full. It isn't safe for concurrent use; CryptoService guards it
+// with historyMu.
+type priceRing struct {
+	points []models.PricePoint
+	next   int  // Index the next push writes to
+	full   bool // Every slot has been written
+}
+
+func newPriceRing(size int) *priceRing {
+	return &priceRing{points: make([]models.PricePoint, size)}
+}
+
+func (r *priceRing) push(point models.PricePoint) {
+	r.points[r.next] = point
+	r.next = (r.next + 1) % len(r.points)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// snapshot returns a copy of the points, oldest first
+func (r *priceRing) snapshot() []models.PricePoint {
+	if !r.full {
+		return append([]models.PricePoint(nil), r.points[:r.next]...)
+	}
+	ordered := make([]models.PricePoint, 0, len(r.points))
+	ordered = append(ordered, r.points[r.next:]...)
+	return append(ordered, r.points[:r.next]...)
+}
+
+// storePrice caches a freshly fetched default-currency price and records it
+// in the coin's recent history
+func (s *CryptoService) storePrice(coinID string, crypto models.CryptoData) {
+	s.mu.Lock()
+	s.cache[coinID] = crypto
+	s.mu.Unlock()
+
+	s.historyMu.Lock()
+	defer s.historyMu.Unlock()
+
+	ring, exists := s.history[coinID]
+	if !exists {
+		ring = newPriceRing(s.historySize)
+		s.history[coinID] = ring
+	}
+	ring.push(models.PricePoint{Price: crypto.Price, Timestamp: crypto.FetchedAt})
+}
+
+// GetRecentPrices returns the last prices fetched for a coin, oldest first.
+// Only default-currency prices fetched through the cache are recorded.
+func (s *CryptoService) GetRecentPrices(coinID string) (*models.PriceHistory, error) {
+	s.historyMu.RLock()
+	defer s.historyMu.RUnlock()
+
+	ring, exists := s.history[coinID]
+	if !exists {
+		return nil, ErrNoPriceHistory
+	}
+	return &models.PriceHistory{CoinID: coinID, Points: ring.snapshot()}, nil
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"my-go-backend/pkg/models"
+)
+
+// prices returns the prices of points, in order
+func prices(points []models.PricePoint) []float64 {
+	out := make([]float64, 0, len(points))
+	for _, point := range points {
+		out = append(out, point.Price)
+	}
+	return out
+}
+
+func TestPriceRing(t *testing.T) {
+	const size = 5
+
+	tests := []struct {
+		name   string
+		pushes int
+		want   []float64
+	}{
+		{"empty", 0, []float64{}},
+		{"partly filled", 3, []float64{1, 2, 3}},
+		{"exactly full", size, []float64{1, 2, 3, 4, 5}},
+		{"wrapped around", size + 3, []float64{4, 5, 6, 7, 8}},
+		{"wrapped around twice", 2*size + 1, []float64{7, 8, 9, 10, 11}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ring := newPriceRing(size)
+			start := time.Now()
+			for i := 1; i <= tt.pushes; i++ {
+				ring.push(models.PricePoint{Price: float64(i), Timestamp: start.Add(time.Duration(i) * time.Second)})
+			}
+
+			points := ring.snapshot()
+			if got := prices(points); !slices.Equal(got, tt.want) {
+				t.Fatalf("prices = %v, want %v", got, tt.want)
+			}
+			for i := 1; i < len(points); i++ {
+				if !points[i].Timestamp.After(points[i-1].Timestamp) {
+					t.Errorf("point %d is not newer than point %d", i, i-1)
+				}
+			}
+		})
+	}
+}
+
+func TestPriceRingSnapshotIsACopy(t *testing.T) {
+	ring := newPriceRing(3)
+	ring.push(models.PricePoint{Price: 1})
+	ring.push(models.PricePoint{Price: 2})
+
+	snapshot := ring.snapshot()
+	snapshot[0].Price = 100
+	ring.push(models.PricePoint{Price: 3})
+
+	if got := prices(ring.snapshot()); !slices.Equal(got, []float64{1, 2, 3}) {
+		t.Errorf("prices = %v, want [1 2 3]", got)
+	}
+}
+
+func TestGetRecentPrices(t *testing.T) {
+	svc := NewCryptoService("http://coingecko.test", "", WithPriceHistorySize(3))
+	t.Cleanup(svc.Shutdown)
+
+	if _, err := svc.GetRecentPrices("bitcoin"); !errors.Is(err, ErrNoPriceHistory) {
+		t.Fatalf("error = %v, want ErrNoPriceHistory", err)
+	}
+
+	for i := 1; i <= 6; i++ {
+		svc.storePrice("bitcoin", models.CryptoData{ID: "bitcoin", Price: float64(i), FetchedAt: time.Now()})
+	}
+	svc.storePrice("ethereum", models.CryptoData{ID: "ethereum", Price: 10, FetchedAt: time.Now()})
+
+	history, err := svc.GetRecentPrices("bitcoin")
+	if err != nil {
+		t.Fatalf("GetRecentPrices: %v", err)
+	}
+	if got := prices(history.Points); !slices.Equal(got, []float64{4, 5, 6}) {
+		t.Errorf("bitcoin prices = %v, want [4 5 6]", got)
+	}
+	if history.CoinID != "bitcoin" {
+		t.Errorf("CoinID = %q, want bitcoin", history.CoinID)
+	}
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"my-go-backend/pkg/models"
+	"sync"
+	"time"
+)
+
+// Idempotency errors
+var (
+	ErrIdempotencyInProgress = newCodedError(models.CodeIdempotencyInProgress, "a request with this idempotency key is still in progress")
+	ErrIdempotencyMismatch   = newCodedError(models.CodeIdempotencyMismatch, "idempotency key was already used with a different request body")
+)
+
+// DefaultIdempotencyTTL is how long a response is replayed for its key
+const DefaultIdempotencyTTL = 5 * time.Minute
+
+// CachedResponse is a completed response kept for replay
+type CachedResponse struct {
+	Status      int
+	ContentType string
+	Body        []byte
+	RequestHash string // Hash of the request body the response answered
+}
+
+// IdempotencyStore remembers responses by idempotency key so retried POSTs
+// get the original response instead of repeating the work. Callers scope
+// keys (e.g. per user and route) before passing them in.
+type IdempotencyStore struct {
+	responses *ttlCache[CachedResponse]
+
+	mu        sync.Mutex
+	inFlight  map[string]string // Key to request hash of requests still running
+	lastSweep time.Time
+	ttl       time.Duration
+}
+
+func NewIdempotencyStore(ttl time.Duration) *IdempotencyStore {
+	if ttl <= 0 {
+		ttl = DefaultIdempotencyTTL
+	}
+	return &IdempotencyStore{
+		responses: newTTLCache[CachedResponse](ttl),
+		inFlight:  make(map[string]string),
+		lastSweep: time.Now(),
+		ttl:       ttl,
+	}
+}
+
+// Begin claims key for a request. It returns the stored response when the
+// key was already answered, ErrIdempotencyMismatch if that response was for a
+// different body, and ErrIdempotencyInProgress while another request holds
+// the key. Otherwise the caller owns the key and must call Complete or Abandon.
+func (s *IdempotencyStore) Begin(key, requestHash string) (*CachedResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cached, ok := s.responses.get(key); ok {
+		if cached.RequestHash != requestHash {
+			return nil, ErrIdempotencyMismatch
+		}
+		return &cached, nil
+	}
+	if hash, running := s.inFlight[key]; running {
+		if hash != requestHash {
+			return nil, ErrIdempotencyMismatch
+		}
+		return nil, ErrIdempotencyInProgress
+	}
+
+	s.inFlight[key] = requestHash
+	return nil, nil
+}
+
+// Complete stores the response for key and releases it
+func (s *IdempotencyStore) Complete(key string, response CachedResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.inFlight, key)
+	s.responses.set(key, response)
+
+	if time.Since(s.lastSweep) > s.ttl {
+		s.responses.sweep()
+		s.lastSweep = time.Now()
+	}
+}
+
+// Abandon releases key without storing a response, so a retry runs again
+func (s *IdempotencyStore) Abandon(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.inFlight, key)
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"gorm.io/gorm"
+	"my-go-backend/pkg/models"
+	"reflect"
+)
+
+// clampPage bounds page to at least 1 and limit to 1-maxLimit. The applied
+// values are returned in the response.
+func clampPage(page, limit, maxLimit int) (int, int) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 1
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+	return page, limit
+}
+
+// newPaginatedResponse builds the response shared by every listing endpoint,
+// so users and coins report total, page, limit and total_pages the same way
+func newPaginatedResponse(data interface{}, total int64, page, limit int) *models.PaginatedResponse {
+	totalPages := int(total) / limit
+	if int(total)%limit != 0 {
+		totalPages++
+	}
+
+	return &models.PaginatedResponse{
+		Data:       data,
+		Total:      total,
+		Page:       page,
+		Limit:      limit,
+		TotalPages: totalPages,
+	}
+}
+
+// paginate loads one page of the rows matched by query, sorted by order, into
+// out (a pointer to a slice) and counts all matching rows. Both run in one
+// read snapshot so total matches the rows returned. page and limit are
+// clamped as by clampPage; Data is the filled slice.
+func paginate(db *gorm.DB, query func(*gorm.DB) *gorm.DB, order string, page, limit, maxLimit int, out interface{}) (*models.PaginatedResponse, error) {
+	page, limit = clampPage(page, limit, maxLimit)
+
+	var total int64
+	err := withReadTx(db, func(tx *gorm.DB) error {
+		if err := query(tx).Count(&total).Error; err != nil {
+			return err
+		}
+		return query(tx).Order(order).Offset((page - 1) * limit).Limit(limit).Find(out).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return newPaginatedResponse(reflect.ValueOf(out).Elem().Interface(), total, page, limit), nil
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+	"my-go-backend/pkg/models"
+)
+
+func TestNewPaginatedResponse(t *testing.T) {
+	tests := []struct {
+		name       string
+		total      int64
+		page       int
+		limit      int
+		totalPages int
+	}{
+		{"first of several", 45, 1, 20, 3},
+		{"partial last page", 45, 3, 20, 3},
+		{"exact multiple", 40, 2, 20, 2},
+		{"single page", 5, 1, 20, 1},
+		{"empty", 0, 1, 20, 0},
+	}
+	for _, tt := range tests {
+		got := newPaginatedResponse(nil, tt.total, tt.page, tt.limit)
+		if got.Total != tt.total || got.Page != tt.page || got.Limit != tt.limit || got.TotalPages != tt.totalPages {
+			t.Errorf("%s: response = %+v, want total %d, page %d, limit %d, total_pages %d",
+				tt.name, got, tt.total, tt.page, tt.limit, tt.totalPages)
+		}
+	}
+}
+
+func TestClampPage(t *testing.T) {
+	tests := []struct {
+		page, limit         int
+		wantPage, wantLimit int
+	}{
+		{2, 20, 2, 20},
+		{0, 20, 1, 20},
+		{-3, 0, 1, 1},
+		{1, 1000, 1, MaxCoinPageSize},
+	}
+	for _, tt := range tests {
+		page, limit := clampPage(tt.page, tt.limit, MaxCoinPageSize)
+		if page != tt.wantPage || limit != tt.wantLimit {
+			t.Errorf("clampPage(%d, %d) = %d, %d; want %d, %d", tt.page, tt.limit, page, limit, tt.wantPage, tt.wantLimit)
+		}
+	}
+}
+
+func TestPaginateUsesOneSnapshot(t *testing.T) {
+	db := newTestDB(t)
+	seedUsers(t, db, "alice", "bob", "carol", "dave", "erin")
+
+	// Record whether each query runs inside the read transaction
+	var inTx []bool
+	err := db.Callback().Query().Before("gorm:query").Register("test:record_tx", func(tx *gorm.DB) {
+		_, ok := tx.Statement.ConnPool.(gorm.TxCommitter)
+		inTx = append(inTx, ok)
+	})
+	if err != nil {
+		t.Fatalf("registering callback: %v", err)
+	}
+
+	notBob := func(tx *gorm.DB) *gorm.DB {
+		return tx.Model(&models.User{}).Where("username <> ?", "bob")
+	}
+	var users []models.User
+	page, err := paginate(db, notBob, "id", 2, 3, 10, &users)
+	if err != nil {
+		t.Fatalf("paginate: %v", err)
+	}
+
+	if len(inTx) != 2 || !inTx[0] || !inTx[1] {
+		t.Errorf("count and page in a transaction = %v, want both", inTx)
+	}
+	if page.Total != 4 || page.TotalPages != 2 || page.Page != 2 || page.Limit != 3 {
+		t.Errorf("page = %+v, want page 2 of 2 with 4 users in total", page)
+	}
+	data := page.Data.([]models.User)
+	if len(data) != 1 || data[0].Username != "erin" {
+		t.Errorf("data = %+v, want the last of the 4 matching users", data)
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	db := newTestDB(t)
+	seedUsers(t, db, "alice", "bob", "carol", "dave", "erin")
+	allUsers := func(tx *gorm.DB) *gorm.DB { return tx.Model(&models.User{}) }
+	noUsers := func(tx *gorm.DB) *gorm.DB { return tx.Model(&models.User{}).Where("username = ?", "nobody") }
+
+	tests := []struct {
+		name       string
+		query      func(*gorm.DB) *gorm.DB
+		page       int
+		limit      int
+		wantPage   int
+		wantLimit  int
+		wantNames  string
+		wantTotal  int64
+		totalPages int
+	}{
+		{"first page", allUsers, 1, 2, 1, 2, "alice,bob", 5, 3},
+		{"last partial page", allUsers, 3, 2, 3, 2, "erin", 5, 3},
+		{"past the end", allUsers, 4, 2, 4, 2, "", 5, 3},
+		{"zero limit", allUsers, 1, 0, 1, 1, "alice", 5, 5},
+		{"limit over the max", allUsers, 1, 50, 1, 10, "alice,bob,carol,dave,erin", 5, 1},
+		{"negative page", allUsers, -1, 2, 1, 2, "alice,bob", 5, 3},
+		{"no rows", noUsers, 1, 2, 1, 2, "", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var users []models.User
+			page, err := paginate(db, tt.query, "id", tt.page, tt.limit, 10, &users)
+			if err != nil {
+				t.Fatalf("paginate: %v", err)
+			}
+
+			var names []string
+			for _, user := range page.Data.([]models.User) {
+				names = append(names, user.Username)
+			}
+			if got := strings.Join(names, ","); got != tt.wantNames {
+				t.Errorf("data = %s, want %s", got, tt.wantNames)
+			}
+			if page.Page != tt.wantPage || page.Limit != tt.wantLimit || page.Total != tt.wantTotal || page.TotalPages != tt.totalPages {
+				t.Errorf("page = %+v, want page %d, limit %d, total %d, total_pages %d",
+					page, tt.wantPage, tt.wantLimit, tt.wantTotal, tt.totalPages)
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordCost is the bcrypt cost for every stored password. Raising it only
+// affects new hashes; existing ones keep verifying at their own cost.
+const PasswordCost = bcrypt.DefaultCost
+
+// HashPassword returns the bcrypt hash of password at the given cost
+func HashPassword(password string, cost int) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+// CheckPassword reports whether password matches a hash from HashPassword
+func CheckPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// generateTemporaryPassword returns a random 16 character password
+func generateTemporaryPassword() (string, error) {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
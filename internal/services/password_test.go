@@ -0,0 +1,91 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashPasswordRoundTrip(t *testing.T) {
+	hash, err := HashPassword("SecurePass123!", bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	if hash == "SecurePass123!" || !strings.HasPrefix(hash, "$2") {
+		t.Fatalf("hash %q doesn't look like bcrypt", hash)
+	}
+
+	if !CheckPassword(hash, "SecurePass123!") {
+		t.Error("CheckPassword rejected the right password")
+	}
+
+	for _, wrong := range []string{"", "securepass123!", "SecurePass123", "SecurePass123!!"} {
+		if CheckPassword(hash, wrong) {
+			t.Errorf("CheckPassword accepted %q", wrong)
+		}
+	}
+}
+
+func TestHashPasswordSalts(t *testing.T) {
+	first, err := HashPassword("same-password", bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	second, err := HashPassword("same-password", bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	if first == second {
+		t.Error("the same password hashed twice gave the same hash")
+	}
+}
+
+func TestHashPasswordCost(t *testing.T) {
+	hash, err := HashPassword("SecurePass123!", bcrypt.MinCost+1)
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		t.Fatalf("bcrypt.Cost: %v", err)
+	}
+	if cost != bcrypt.MinCost+1 {
+		t.Errorf("cost = %d, want %d", cost, bcrypt.MinCost+1)
+	}
+
+	// Hashes at another cost still verify
+	if !CheckPassword(hash, "SecurePass123!") {
+		t.Error("CheckPassword rejected a hash at a different cost")
+	}
+}
+
+func TestHashPasswordTooLong(t *testing.T) {
+	// bcrypt only reads 72 bytes; longer passwords are refused rather than truncated
+	if _, err := HashPassword(strings.Repeat("a", 73), bcrypt.MinCost); err == nil {
+		t.Error("HashPassword accepted a 73 byte password")
+	}
+}
+
+func TestCheckPasswordMalformedHash(t *testing.T) {
+	if CheckPassword("not-a-bcrypt-hash", "password") {
+		t.Error("CheckPassword accepted a malformed hash")
+	}
+}
+
+func TestGenerateTemporaryPassword(t *testing.T) {
+	first, err := generateTemporaryPassword()
+	if err != nil {
+		t.Fatalf("generateTemporaryPassword: %v", err)
+	}
+	second, err := generateTemporaryPassword()
+	if err != nil {
+		t.Fatalf("generateTemporaryPassword: %v", err)
+	}
+	if len(first) != 16 {
+		t.Errorf("length = %d, want 16", len(first))
+	}
+	if first == second {
+		t.Error("two temporary passwords were the same")
+	}
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"my-go-backend/pkg/models"
+)
+
+// Portfolio sort modes; the empty mode keeps the requested coin order
+const (
+	SortValueDesc = "value_desc"
+	SortPriceDesc = "price_desc"
+	SortRankAsc   = "rank_asc"
+)
+
+var ErrInvalidPortfolioSort = errors.New("sort must be one of value_desc, price_desc, rank_asc")
+
+// ErrNegativeQuantity is returned when a holding is below zero
+var ErrNegativeQuantity = errors.New("quantities must not be negative")
+
+// PortfolioOptions controls how GetBulkCrypto and GetPortfolioRealtime order
+// their results
+type PortfolioOptions struct {
+	Sort       string
+	Quantities map[string]float64 // Holdings per coin for value_desc and the totals (default 1)
+	Currencies []string           // Currencies to total GetPortfolioRealtime in, from NormalizeCurrencies
+}
+
+// Validate reports an unknown sort mode or a negative quantity
+func (o PortfolioOptions) Validate() error {
+	switch o.Sort {
+	case "", SortValueDesc, SortPriceDesc, SortRankAsc:
+	default:
+		return ErrInvalidPortfolioSort
+	}
+	for _, quantity := range o.Quantities {
+		if quantity < 0 {
+			return ErrNegativeQuantity
+		}
+	}
+	return nil
+}
+
+// NormalizeQuantities keys holdings by normalized coin id
+func NormalizeQuantities(quantities map[string]float64) map[string]float64 {
+	normalized := make(map[string]float64, len(quantities))
+	for coinID, quantity := range quantities {
+		normalized[strings.ToLower(strings.TrimSpace(coinID))] = quantity
+	}
+	return normalized
+}
+
+// HoldingQuantity is the quantity of coinID in quantities (from
+// NormalizeQuantities), 1 when none was given
+func HoldingQuantity(quantities map[string]float64, coinID string) float64 {
+	quantity, ok := quantities[coinID]
+	if !ok {
+		return 1
+	}
+	return quantity
+}
+
+// portfolioValue sums price times quantity over the coins fetched without
+// error; it is the TotalValue of a portfolio
+func portfolioValue(portfolio []models.CryptoData, quantities map[string]float64) float64 {
+	var total float64
+	for _, coin := range portfolio {
+		if coin.Error == "" {
+			total += coin.Price * HoldingQuantity(quantities, coin.ID)
+		}
+	}
+	return total
+}
+
+// sortPortfolio orders results by the requested coins, then by opts.Sort.
+// Errored coins always go last, in request order.
+func sortPortfolio(portfolio []models.CryptoData, coins []string, opts PortfolioOptions) {
+	position := make(map[string]int, len(coins))
+	for i, coin := range coins {
+		position[coin] = i
+	}
+	quantities := NormalizeQuantities(opts.Quantities)
+	value := func(coin models.CryptoData) float64 {
+		return coin.Price * HoldingQuantity(quantities, coin.ID)
+	}
+
+	sort.SliceStable(portfolio, func(i, j int) bool {
+		a, b := portfolio[i], portfolio[j]
+		if (a.Error == "") != (b.Error == "") {
+			return a.Error == ""
+		}
+		if a.Error == "" {
+			switch opts.Sort {
+			case SortValueDesc:
+				if value(a) != value(b) {
+					return value(a) > value(b)
+				}
+			case SortPriceDesc:
+				if a.Price != b.Price {
+					return a.Price > b.Price
+				}
+			case SortRankAsc:
+				// Unranked coins (rank 0) go after ranked ones
+				if a.Rank != b.Rank {
+					return b.Rank == 0 || (a.Rank != 0 && a.Rank < b.Rank)
+				}
+			}
+		}
+		return position[a.ID] < position[b.ID]
+	})
+}
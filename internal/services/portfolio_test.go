@@ -0,0 +1,53 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"my-go-backend/pkg/models"
+)
+
+func TestSortPortfolio(t *testing.T) {
+	coins := []string{"failed", "cheap", "bitcoin", "unranked", "also-failed", "ethereum"}
+	quantities := map[string]float64{"ethereum": 20, "cheap": 100}
+
+	tests := []struct {
+		sort string
+		want string
+	}{
+		{"", "cheap,bitcoin,unranked,ethereum,failed,also-failed"},
+		{SortValueDesc, "ethereum,bitcoin,cheap,unranked,failed,also-failed"},
+		{SortPriceDesc, "bitcoin,ethereum,unranked,cheap,failed,also-failed"},
+		{SortRankAsc, "bitcoin,ethereum,cheap,unranked,failed,also-failed"},
+	}
+
+	for _, tt := range tests {
+		// Results arrive in whatever order the fetches finished
+		portfolio := []models.CryptoData{
+			{ID: "also-failed", Error: "timeout"},
+			{ID: "unranked", Price: 20},
+			{ID: "ethereum", Price: 3000, Rank: 2},
+			{ID: "failed", Error: "coin not found"},
+			{ID: "cheap", Price: 1, Rank: 10},
+			{ID: "bitcoin", Price: 50000, Rank: 1},
+		}
+		opts := PortfolioOptions{Sort: tt.sort, Quantities: quantities}
+		if err := opts.Validate(); err != nil {
+			t.Fatalf("sort %q: Validate: %v", tt.sort, err)
+		}
+
+		sortPortfolio(portfolio, coins, opts)
+		ids := make([]string, 0, len(portfolio))
+		for _, coin := range portfolio {
+			ids = append(ids, coin.ID)
+		}
+		if got := strings.Join(ids, ","); got != tt.want {
+			t.Errorf("sort %q = %s, want %s", tt.sort, got, tt.want)
+		}
+	}
+
+	if err := (PortfolioOptions{Sort: "market_cap"}).Validate(); !errors.Is(err, ErrInvalidPortfolioSort) {
+		t.Errorf("unknown sort: error = %v, want ErrInvalidPortfolioSort", err)
+	}
+}
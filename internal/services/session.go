@@ -0,0 +1,85 @@
+package services
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"my-go-backend/pkg/models"
+	"time"
+)
+
+// ErrSessionNotFound is returned when a session doesn't exist, has been
+// revoked, or belongs to another user
+var ErrSessionNotFound = newCodedError(models.CodeSessionNotFound, "session not found")
+
+// startSession stores a new session for user, dropping their expired ones
+func (s *AuthService) startSession(userID uint, client models.ClientInfo) (*models.Session, error) {
+	now := time.Now()
+	session := models.Session{
+		ID:         uuid.New().String(),
+		UserID:     userID,
+		IP:         client.IP,
+		UserAgent:  client.UserAgent,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(s.refreshTTL),
+	}
+
+	err := withTx(s.db, func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND expires_at <= ?", userID, now).Delete(&models.Session{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&session).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// touchSession marks a session as used by a refresh, extending it to the
+// new refresh token's expiry
+func (s *AuthService) touchSession(userID uint, sessionID string, client models.ClientInfo) error {
+	now := time.Now()
+	result := s.db.Model(&models.Session{}).
+		Where("id = ? AND user_id = ? AND expires_at > ?", sessionID, userID, now).
+		Updates(map[string]interface{}{
+			"ip":           client.IP,
+			"user_agent":   client.UserAgent,
+			"last_used_at": now,
+			"expires_at":   now.Add(s.refreshTTL),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// ListSessions returns the user's unexpired sessions, most recently used first
+func (s *AuthService) ListSessions(userID uint) ([]models.Session, error) {
+	sessions := []models.Session{}
+	err := s.db.Where("user_id = ? AND expires_at > ?", userID, time.Now()).
+		Order("last_used_at desc").
+		Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// RevokeSession deletes one of the user's sessions so its refresh tokens
+// can no longer be used. Access tokens already issued stay valid until they
+// expire.
+func (s *AuthService) RevokeSession(userID uint, sessionID string, client models.ClientInfo) error {
+	return withTx(s.db, func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND user_id = ?", sessionID, userID).Delete(&models.Session{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrSessionNotFound
+		}
+		return insertEvent(tx, &userID, models.AuthEventSessionRevoked, true, client)
+	})
+}
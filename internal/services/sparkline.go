@@ -0,0 +1,46 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"my-go-backend/internal/metrics"
+)
+
+// sparklineCacheTTL is how long 7-day sparklines are cached. CoinGecko
+// only adds a point every hour, so they can be kept longer than prices.
+const sparklineCacheTTL = 10 * time.Minute
+
+// GetSparklines returns each coin's 7-day sparkline (hourly prices, oldest
+// first) in currency, fetching the ones that aren't cached with a single
+// /coins/markets call. Coins CoinGecko has no sparkline for are left out.
+func (s *CryptoService) GetSparklines(ctx context.Context, coins []string, currency string) (map[string][]float64, error) {
+	sparklines := make(map[string][]float64, len(coins))
+
+	var missing []string
+	for _, coinID := range coins {
+		if sparkline, ok := s.sparklines.get(coinID + ":" + currency); ok {
+			metrics.CacheHits.Inc()
+			sparklines[coinID] = sparkline
+			continue
+		}
+		metrics.CacheMisses.Inc()
+		missing = append(missing, coinID)
+	}
+	if len(missing) == 0 {
+		return sparklines, nil
+	}
+
+	response, err := s.fetchMarkets(ctx, missing, currency, true)
+	if err != nil {
+		return nil, err
+	}
+	for _, coin := range response {
+		if coin.SparklineIn7d == nil || len(coin.SparklineIn7d.Price) == 0 {
+			continue
+		}
+		s.sparklines.set(coin.ID+":"+currency, coin.SparklineIn7d.Price)
+		sparklines[coin.ID] = coin.SparklineIn7d.Price
+	}
+	return sparklines, nil
+}
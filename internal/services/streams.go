@@ -0,0 +1,76 @@
+package services
+
+import (
+	"context"
+	"sync"
+
+	"my-go-backend/internal/metrics"
+)
+
+// StartStream registers an SSE or NDJSON stream so shutdown can drain it.
+// ok is false once the service is shutting down, and the handler should
+// refuse the request. Otherwise it must stream on the returned context,
+// which CloseStreams cancels, and call release when the stream ends.
+func (s *CryptoService) StartStream(ctx context.Context) (streamCtx context.Context, release func(), ok bool) {
+	// Checked under subMu so no stream starts after Shutdown returns
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+
+	select {
+	case <-s.done:
+		return ctx, func() {}, false
+	default:
+	}
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	stopForceClose := context.AfterFunc(s.streamsCtx, cancel)
+
+	s.streamConns.Add(1)
+	s.activeStreams.Add(1)
+	metrics.Streams.Inc()
+
+	var releaseOnce sync.Once
+	release = func() {
+		releaseOnce.Do(func() {
+			stopForceClose()
+			cancel()
+			s.activeStreams.Add(-1)
+			metrics.Streams.Dec()
+			s.streamConns.Done()
+		})
+	}
+	return streamCtx, release, true
+}
+
+// ActiveStreams is the number of streams started and not yet released
+func (s *CryptoService) ActiveStreams() int64 {
+	return s.activeStreams.Load()
+}
+
+// WaitForStreams blocks until every stream has been released, e.g. after
+// Shutdown has sent them the "shutdown" event
+func (s *CryptoService) WaitForStreams(ctx context.Context) error {
+	return waitContext(ctx, &s.streamConns)
+}
+
+// CloseStreams cancels the context of every open stream, for those still
+// running once the shutdown grace period is over
+func (s *CryptoService) CloseStreams() {
+	s.closeStreams()
+}
+
+// waitContext waits for wg, giving up when ctx is done
+func waitContext(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,221 @@
+package services
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"my-go-backend/internal/metrics"
+	"my-go-backend/pkg/models"
+)
+
+// Slow-consumer policies, applied when a subscriber's channel is full
+const (
+	SlowPolicyDropNewest = "drop_newest" // Discard the new event
+	SlowPolicyDropOldest = "drop_oldest" // Discard the oldest queued event to make room
+	SlowPolicyDisconnect = "disconnect"  // Close the subscriber; the client must reconnect
+)
+
+// IsSlowSubscriberPolicy reports whether policy is a known slow-consumer policy
+func IsSlowSubscriberPolicy(policy string) bool {
+	switch policy {
+	case SlowPolicyDropNewest, SlowPolicyDropOldest, SlowPolicyDisconnect:
+		return true
+	}
+	return false
+}
+
+// subscriber is one WebSocket connection's event channel
+type subscriber struct {
+	id      string
+	userID  uint // 0 for unauthenticated connections
+	events  chan models.StreamEvent
+	dropped atomic.Int64 // Events lost to the slow-consumer policy
+}
+
+// AddSubscriber registers a WebSocket connection. A non-zero userID links it
+// to that user so BroadcastToUser can reach it. The returned channel is
+// closed by RemoveSubscriber or Shutdown. The connection handler must call
+// release once it is done with the connection (after sending any close
+// frame); WaitForSubscribers waits for that.
+func (s *CryptoService) AddSubscriber(id string, userID uint) (<-chan models.StreamEvent, func()) {
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+
+	// Refuse new subscribers once shutting down; the closed channel ends
+	// the connection straight away
+	select {
+	case <-s.done:
+		events := make(chan models.StreamEvent)
+		close(events)
+		return events, func() {}
+	default:
+	}
+
+	sub := &subscriber{
+		id:     id,
+		userID: userID,
+		events: make(chan models.StreamEvent, s.subscriberBuffer),
+	}
+	s.subscribers[id] = sub
+	if userID != 0 {
+		if s.userSubscribers[userID] == nil {
+			s.userSubscribers[userID] = make(map[string]*subscriber)
+		}
+		s.userSubscribers[userID][id] = sub
+	}
+	metrics.Subscribers.Set(float64(len(s.subscribers)))
+
+	log.Printf("Added subscriber: %s (user: %d)", id, userID)
+
+	s.subscriberConns.Add(1)
+	var releaseOnce sync.Once
+	release := func() {
+		releaseOnce.Do(func() {
+			s.RemoveSubscriber(id)
+			s.subscriberConns.Done()
+		})
+	}
+	return sub.events, release
+}
+
+// RemoveSubscriber unregisters a subscriber and closes its channel. It is
+// safe to call more than once.
+func (s *CryptoService) RemoveSubscriber(id string) {
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+
+	if sub, exists := s.subscribers[id]; exists {
+		s.removeSubscriberLocked(sub)
+		metrics.Subscribers.Set(float64(len(s.subscribers)))
+		log.Printf("Removed subscriber: %s", id)
+	}
+}
+
+// WaitForSubscribers blocks until every connection handler has released its
+// subscriber, e.g. after Shutdown so clients get their close frames before
+// the process exits
+func (s *CryptoService) WaitForSubscribers(ctx context.Context) error {
+	return waitContext(ctx, &s.subscriberConns)
+}
+
+// removeAllSubscribers closes every subscriber channel; used on shutdown
+func (s *CryptoService) removeAllSubscribers() {
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+
+	for _, sub := range s.subscribers {
+		s.removeSubscriberLocked(sub)
+	}
+	metrics.Subscribers.Set(0)
+	log.Println("All subscribers closed")
+}
+
+// removeSubscriberLocked must be called with subMu held
+func (s *CryptoService) removeSubscriberLocked(sub *subscriber) {
+	close(sub.events)
+	delete(s.subscribers, sub.id)
+	if userSubs := s.userSubscribers[sub.userID]; userSubs != nil {
+		delete(userSubs, sub.id)
+		if len(userSubs) == 0 {
+			delete(s.userSubscribers, sub.userID)
+		}
+	}
+}
+
+// BroadcastToSubscribers sends an event to every WebSocket subscriber
+func (s *CryptoService) BroadcastToSubscribers(event models.StreamEvent) {
+	s.subMu.RLock()
+	var slow []string
+	for _, sub := range s.subscribers {
+		if !s.deliver(sub, event) {
+			slow = append(slow, sub.id)
+		}
+	}
+	s.subMu.RUnlock()
+
+	s.disconnectSlow(slow)
+}
+
+// BroadcastToUser sends an event only to the given user's connections, e.g.
+// price alerts. Unauthenticated and other users' connections never see it.
+func (s *CryptoService) BroadcastToUser(userID uint, event models.StreamEvent) {
+	if userID == 0 {
+		return
+	}
+
+	s.subMu.RLock()
+	var slow []string
+	for _, sub := range s.userSubscribers[userID] {
+		if !s.deliver(sub, event) {
+			slow = append(slow, sub.id)
+		}
+	}
+	s.subMu.RUnlock()
+
+	s.disconnectSlow(slow)
+}
+
+// deliver queues an event without blocking, applying the slow-consumer
+// policy when the channel is full. It returns false if the subscriber should
+// be disconnected. Must be called with subMu held.
+func (s *CryptoService) deliver(sub *subscriber, event models.StreamEvent) bool {
+	for {
+		select {
+		case sub.events <- event:
+			return true
+		default:
+		}
+
+		switch s.slowPolicy {
+		case SlowPolicyDropOldest:
+			select {
+			case <-sub.events:
+				sub.dropped.Add(1)
+			default:
+				// The client drained the channel meanwhile
+			}
+		case SlowPolicyDisconnect:
+			sub.dropped.Add(1)
+			return false
+		default:
+			sub.dropped.Add(1)
+			log.Printf("Subscriber %s channel full, dropping event", sub.id)
+			return true
+		}
+	}
+}
+
+// disconnectSlow removes subscribers that fell behind under SlowPolicyDisconnect
+func (s *CryptoService) disconnectSlow(ids []string) {
+	for _, id := range ids {
+		log.Printf("Subscriber %s channel full, disconnecting", id)
+		s.RemoveSubscriber(id)
+	}
+}
+
+// SubscriberStats reports the queue length and dropped events per subscriber
+func (s *CryptoService) SubscriberStats() models.SubscriberStats {
+	s.subMu.RLock()
+	defer s.subMu.RUnlock()
+
+	stats := models.SubscriberStats{
+		Buffer:      s.subscriberBuffer,
+		SlowPolicy:  s.slowPolicy,
+		Subscribers: make([]models.SubscriberStat, 0, len(s.subscribers)),
+	}
+	for _, sub := range s.subscribers {
+		stats.Subscribers = append(stats.Subscribers, models.SubscriberStat{
+			ID:      sub.id,
+			UserID:  sub.userID,
+			Queued:  len(sub.events),
+			Dropped: sub.dropped.Load(),
+		})
+	}
+	sort.Slice(stats.Subscribers, func(i, j int) bool {
+		return stats.Subscribers[i].ID < stats.Subscribers[j].ID
+	})
+	return stats
+}
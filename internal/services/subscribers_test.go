@@ -0,0 +1,136 @@
+package services
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"my-go-backend/pkg/models"
+)
+
+// newSubscriberTestService returns a service with no upstream, for tests of
+// the subscriber registry
+func newSubscriberTestService(t *testing.T, opts ...CryptoServiceOption) *CryptoService {
+	t.Helper()
+	return newStubCryptoService(t, "http://coingecko.test/api/v3", "", func(req *http.Request) (*http.Response, error) {
+		return jsonResponse(req, http.StatusNotFound, `{}`), nil
+	}, opts...)
+}
+
+// drain returns the IDs of the events queued on a subscriber channel
+func drain(events <-chan models.StreamEvent) []string {
+	var ids []string
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return ids
+			}
+			ids = append(ids, event.ID)
+		default:
+			return ids
+		}
+	}
+}
+
+func TestBroadcastToUser(t *testing.T) {
+	svc := newSubscriberTestService(t)
+
+	alice1, release := svc.AddSubscriber("alice-1", 1)
+	defer release()
+	alice2, release := svc.AddSubscriber("alice-2", 1)
+	defer release()
+	bob, release := svc.AddSubscriber("bob", 2)
+	defer release()
+	anonymous, release := svc.AddSubscriber("anonymous", 0)
+	defer release()
+
+	svc.BroadcastToUser(1, models.StreamEvent{Type: "alert", ID: "for-alice"})
+	svc.BroadcastToUser(0, models.StreamEvent{Type: "alert", ID: "for-nobody"})
+
+	for name, events := range map[string]<-chan models.StreamEvent{"alice-1": alice1, "alice-2": alice2} {
+		if got := drain(events); len(got) != 1 || got[0] != "for-alice" {
+			t.Errorf("%s received %q, want the targeted event", name, got)
+		}
+	}
+	for name, events := range map[string]<-chan models.StreamEvent{"bob": bob, "anonymous": anonymous} {
+		if got := drain(events); len(got) != 0 {
+			t.Errorf("%s received %q, want nothing", name, got)
+		}
+	}
+
+	svc.BroadcastToSubscribers(models.StreamEvent{Type: "price_update", ID: "for-all"})
+	for name, events := range map[string]<-chan models.StreamEvent{"alice-1": alice1, "alice-2": alice2, "bob": bob, "anonymous": anonymous} {
+		if got := drain(events); len(got) != 1 || got[0] != "for-all" {
+			t.Errorf("%s received %q from the broadcast, want it once", name, got)
+		}
+	}
+}
+
+func TestSlowSubscriberPolicy(t *testing.T) {
+	tests := []struct {
+		policy       string
+		want         []string // Events left queued
+		dropped      int64
+		disconnected bool
+	}{
+		{SlowPolicyDropNewest, []string{"1", "2"}, 2, false},
+		{SlowPolicyDropOldest, []string{"3", "4"}, 2, false},
+		{SlowPolicyDisconnect, []string{"1", "2"}, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			svc := newSubscriberTestService(t, WithSubscriberBuffer(2), WithSlowSubscriberPolicy(tt.policy))
+			events, release := svc.AddSubscriber("slow", 1)
+			defer release()
+
+			for _, id := range []string{"1", "2", "3", "4"} {
+				svc.BroadcastToSubscribers(models.StreamEvent{Type: "price_update", ID: id})
+			}
+
+			stats := svc.SubscriberStats()
+			if stats.Buffer != 2 || stats.SlowPolicy != tt.policy {
+				t.Errorf("stats = buffer %d, policy %q; want 2, %q", stats.Buffer, stats.SlowPolicy, tt.policy)
+			}
+			if tt.disconnected {
+				if len(stats.Subscribers) != 0 {
+					t.Errorf("subscribers = %+v, want the slow one removed", stats.Subscribers)
+				}
+			} else if len(stats.Subscribers) != 1 || stats.Subscribers[0].Dropped != tt.dropped || stats.Subscribers[0].Queued != 2 {
+				t.Errorf("subscribers = %+v, want 2 queued and %d dropped", stats.Subscribers, tt.dropped)
+			}
+
+			got := drain(events)
+			if len(got) != len(tt.want) || got[0] != tt.want[0] || got[1] != tt.want[1] {
+				t.Errorf("queued events = %q, want %q", got, tt.want)
+			}
+			if tt.disconnected {
+				if _, open := <-events; open {
+					t.Error("channel still open, want it closed")
+				}
+			}
+		})
+	}
+}
+
+func TestClearCacheNotifiesSubscribers(t *testing.T) {
+	svc := newSubscriberTestService(t)
+	alice, release := svc.AddSubscriber("alice", 1)
+	defer release()
+	anonymous, release := svc.AddSubscriber("anonymous", 0)
+	defer release()
+
+	before := time.Now()
+	svc.ClearCache()
+
+	for name, events := range map[string]<-chan models.StreamEvent{"alice": alice, "anonymous": anonymous} {
+		select {
+		case event := <-events:
+			if event.Type != "cache_cleared" || event.Data != nil || event.Timestamp.Before(before) {
+				t.Errorf("%s received %+v, want a cache_cleared event with only a timestamp", name, event)
+			}
+		default:
+			t.Errorf("%s received nothing after the clear", name)
+		}
+	}
+}
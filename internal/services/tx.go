@@ -0,0 +1,22 @@
+package services
+
+import (
+	"database/sql"
+
+	"gorm.io/gorm"
+)
+
+// withTx runs fn in a database transaction. It commits when fn returns nil
+// and rolls back when fn returns an error or panics, so multi-step writes
+// (a user and its audit entry) land together or not at all. fn must use tx,
+// not the service's db, for every write that belongs to the transaction.
+func withTx(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	return db.Transaction(fn)
+}
+
+// withReadTx runs fn in a read-only REPEATABLE READ transaction, so every
+// query in fn sees the same snapshot. Listings use it to keep a page's total
+// consistent with its rows while users are being added or removed.
+func withReadTx(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	return db.Transaction(fn, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+	"my-go-backend/pkg/models"
+)
+
+func TestWithTx(t *testing.T) {
+	db := newTestDB(t)
+	failure := errors.New("second step failed")
+
+	err := withTx(db, func(tx *gorm.DB) error {
+		seedUsers(t, tx, "alice")
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Errorf("error = %v, want the step's error", err)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("panic was swallowed")
+			}
+		}()
+		withTx(db, func(tx *gorm.DB) error {
+			seedUsers(t, tx, "bob")
+			panic("second step panicked")
+		})
+	}()
+
+	var count int64
+	db.Model(&models.User{}).Count(&count)
+	if count != 0 {
+		t.Errorf("%d users committed, want the writes rolled back", count)
+	}
+}
+
+func TestRegisterRollsBackWithoutAuditEntry(t *testing.T) {
+	db := newTestDB(t)
+	// Fail the audit insert that follows the user insert
+	err := db.Callback().Create().Before("gorm:create").Register("test:fail_auth_events", func(tx *gorm.DB) {
+		if tx.Statement.Table == "auth_events" {
+			tx.AddError(errors.New("audit insert failed"))
+		}
+	})
+	if err != nil {
+		t.Fatalf("registering callback: %v", err)
+	}
+	s := newTestAuthService(t, db)
+
+	_, err = s.Register(&models.CreateUserRequest{Username: "alice", Email: "alice@example.com", Password: "password123"}, models.ClientInfo{})
+	if err == nil {
+		t.Fatal("Register succeeded without its audit entry")
+	}
+
+	var count int64
+	db.Unscoped().Model(&models.User{}).Count(&count)
+	if count != 0 {
+		t.Errorf("%d users committed, want the user rolled back with the audit entry", count)
+	}
+}
@@ -2,97 +2,412 @@ package services
 
 import (
 	"errors"
+	"fmt"
 	"gorm.io/gorm"
+	"log"
 	"my-go-backend/pkg/models"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// ErrNoUpdatableFields is returned when an update contains only protected fields
+var ErrNoUpdatableFields = errors.New("no updatable fields provided")
+
+// updatableUserFields lists the columns callers may change through UpdateUser.
+// Everything else (id, password, timestamps, ...) is silently dropped.
+var updatableUserFields = map[string]bool{
+	"username": true,
+	"email":    true,
+}
+
+// Pagination bounds for GetAllUsers
+const (
+	DefaultPageSize = 10
+	MaxPageSize     = 100
+)
+
+// MaxBatchUserIDs caps how many users GetUsersByIDs fetches at once
+const MaxBatchUserIDs = 100
+
+// ErrTooManyUserIDs is returned when a batch asks for more than MaxBatchUserIDs users
+var ErrTooManyUserIDs = fmt.Errorf("at most %d user ids may be requested at once", MaxBatchUserIDs)
+
+// ErrUserExists is returned when the username or email is already taken
+var ErrUserExists = newCodedError(models.CodeUserExists, "username or email already exists")
+
+// ErrUserNotFound is returned when no (non-deleted) user has the given id
+var ErrUserNotFound = newCodedError(models.CodeUserNotFound, "user not found")
+
+// ErrInvalidSort is returned when a sort column isn't in sortableUserColumns
+var ErrInvalidSort = errors.New("invalid sort column")
+
+// ErrCursorSort is returned when cursor pagination is combined with a sort
+// other than id, which the cursor depends on
+var ErrCursorSort = errors.New("cursor pagination only supports sorting by id")
+
+// sortableUserColumns is the allowlist for the "sort" parameter; values are
+// never interpolated into SQL unless they appear here.
+var sortableUserColumns = map[string]bool{
+	"id":         true,
+	"username":   true,
+	"email":      true,
+	"created_at": true,
+	"updated_at": true,
+}
+
+// UserListOptions holds optional sorting and filtering for GetAllUsers
+type UserListOptions struct {
+	Sort     string // Column name, prefixed with "-" for descending
+	Username string // Case-insensitive substring match
+	Email    string // Case-insensitive substring match
+}
+
 type UserService struct {
 	db *gorm.DB
+
+	// Recently read users, served by GetUserByID while the database is
+	// failing. Nil unless enabled with WithUserCache.
+	userCache *lruCache[uint, models.UserResponse]
 }
 
-func NewUserService(db *gorm.DB) *UserService {
-	return &UserService{db: db}
+// UserServiceOption customizes NewUserService
+type UserServiceOption func(*UserService)
+
+// WithUserCache keeps up to capacity recently read users for ttl as a
+// fallback for GetUserByID during database outages. Writes are never cached.
+func WithUserCache(capacity int, ttl time.Duration) UserServiceOption {
+	return func(s *UserService) {
+		if capacity > 0 && ttl > 0 {
+			s.userCache = newLRUCache[uint, models.UserResponse](capacity, ttl)
+		}
+	}
+}
+
+func NewUserService(db *gorm.DB, opts ...UserServiceOption) *UserService {
+	s := &UserService{db: db}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
+// GetUserByID reads a user. If the database fails and the user cache is
+// enabled, a recently read copy is returned instead, marked Stale.
 func (s *UserService) GetUserByID(id uint) (*models.UserResponse, error) {
 	var user models.User
 	if err := s.db.First(&user, id).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("user not found")
+			s.forgetUser(id)
+			return nil, ErrUserNotFound
+		}
+		if s.userCache != nil {
+			if cached, storedAt, ok := s.userCache.get(id); ok {
+				log.Printf("Database error reading user %d, serving copy from %s ago: %v",
+					id, time.Since(storedAt).Round(time.Second), err)
+				cached.Stale = true
+				return &cached, nil
+			}
 		}
 		return nil, err
 	}
 
-	return &models.UserResponse{
-		ID:       user.ID,
-		Username: user.Username,
-		Email:    user.Email,
-	}, nil
+	response := newUserResponse(&user)
+	if s.userCache != nil {
+		s.userCache.set(id, *response)
+	}
+	return response, nil
 }
 
-func (s *UserService) GetAllUsers(page, limit int) (*models.PaginatedResponse, error) {
+// GetUsersByIDs fetches users with a single query, in the order requested.
+// Repeated ids are returned once; ids without a user are listed in Missing.
+func (s *UserService) GetUsersByIDs(ids []uint) (*models.UserBatchResponse, error) {
+	seen := make(map[uint]bool, len(ids))
+	unique := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	if len(unique) > MaxBatchUserIDs {
+		return nil, ErrTooManyUserIDs
+	}
+
 	var users []models.User
-	var total int64
+	if len(unique) > 0 {
+		if err := s.db.Where("id IN ?", unique).Find(&users).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	byID := make(map[uint]*models.User, len(users))
+	for i := range users {
+		byID[users[i].ID] = &users[i]
+	}
+
+	response := &models.UserBatchResponse{
+		Users:   make([]models.UserResponse, 0, len(users)),
+		Missing: []uint{},
+	}
+	for _, id := range unique {
+		if user, ok := byID[id]; ok {
+			response.Users = append(response.Users, *newUserResponse(user))
+		} else {
+			response.Missing = append(response.Missing, id)
+		}
+	}
+	return response, nil
+}
+
+// forgetUser drops a user from the fallback cache after it changes
+func (s *UserService) forgetUser(id uint) {
+	if s.userCache != nil {
+		s.userCache.remove(id)
+	}
+}
 
-	offset := (page - 1) * limit
+// CreateUser provisions a user with the given role. When no password is
+// supplied a temporary one is generated and returned in the response.
+func (s *UserService) CreateUser(req *models.AdminCreateUserRequest) (*models.AdminCreateUserResponse, error) {
+	username, err := NormalizeUsername(req.Username)
+	if err != nil {
+		return nil, err
+	}
+	email, err := NormalizeEmail(req.Email)
+	if err != nil {
+		return nil, err
+	}
 
-	if err := s.db.Model(&models.User{}).Count(&total).Error; err != nil {
+	var count int64
+	if err := s.db.Unscoped().Model(&models.User{}).
+		Where("username = ? OR email = ?", username, email).
+		Count(&count).Error; err != nil {
 		return nil, err
 	}
+	if count > 0 {
+		return nil, ErrUserExists
+	}
+
+	password := req.Password
+	temporary := ""
+	if password == "" {
+		generated, err := generateTemporaryPassword()
+		if err != nil {
+			return nil, err
+		}
+		password = generated
+		temporary = generated
+	}
 
-	if err := s.db.Offset(offset).Limit(limit).Find(&users).Error; err != nil {
+	hashedPassword, err := HashPassword(password, PasswordCost)
+	if err != nil {
 		return nil, err
 	}
 
-	var userResponses []models.UserResponse
-	for _, user := range users {
-		userResponses = append(userResponses, models.UserResponse{
-			ID:       user.ID,
-			Username: user.Username,
-			Email:    user.Email,
-		})
+	user := models.User{
+		Username: username,
+		Email:    email,
+		Password: hashedPassword,
+		Role:     req.Role,
 	}
 
-	totalPages := int(total) / limit
-	if int(total)%limit != 0 {
-		totalPages++
+	// A concurrent create can pass the count above; the unique indexes on
+	// username and email still catch it
+	if err := s.db.Create(&user).Error; err != nil {
+		if isUniqueViolation(err) {
+			return nil, ErrUserExists
+		}
+		return nil, err
 	}
 
-	return &models.PaginatedResponse{
-		Data:       userResponses,
-		Total:      total,
-		Page:       page,
-		Limit:      limit,
-		TotalPages: totalPages,
+	return &models.AdminCreateUserResponse{
+		User:              *newUserResponse(&user),
+		TemporaryPassword: temporary,
 	}, nil
 }
 
+func (s *UserService) GetAllUsers(page, limit int, opts UserListOptions) (*models.PaginatedResponse, error) {
+	order, err := userOrderClause(opts.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	var users []models.User
+	filtered := func(tx *gorm.DB) *gorm.DB { return s.filteredUsers(tx, opts) }
+	response, err := paginate(s.db, filtered, order, page, limit, MaxPageSize, &users)
+	if err != nil {
+		return nil, err
+	}
+
+	response.Data = newUserResponses(users)
+	return response, nil
+}
+
+// GetUsersAfter lists users with an id greater than cursor, in id order.
+// Unlike offset paging it stays fast and doesn't skip or repeat rows when
+// users are added or removed between pages. NextCursor is empty on the last
+// page; Page is not set.
+func (s *UserService) GetUsersAfter(cursor uint, limit int, opts UserListOptions) (*models.PaginatedResponse, error) {
+	if opts.Sort != "" && opts.Sort != "id" {
+		return nil, ErrCursorSort
+	}
+	_, limit = clampPage(1, limit, MaxPageSize)
+
+	var total int64
+	var users []models.User
+	err := withReadTx(s.db, func(tx *gorm.DB) error {
+		if err := s.filteredUsers(tx, opts).Count(&total).Error; err != nil {
+			return err
+		}
+		// Fetch one extra row to learn whether another page follows
+		return s.filteredUsers(tx, opts).Where("id > ?", cursor).
+			Order("id asc").Limit(limit + 1).Find(&users).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	nextCursor := ""
+	if len(users) > limit {
+		users = users[:limit]
+		nextCursor = strconv.FormatUint(uint64(users[limit-1].ID), 10)
+	}
+
+	response := newPaginatedResponse(newUserResponses(users), total, 0, limit)
+	response.NextCursor = nextCursor
+	return response, nil
+}
+
+// filteredUsers applies the username and email filters to a query on db
+func (s *UserService) filteredUsers(db *gorm.DB, opts UserListOptions) *gorm.DB {
+	query := db.Model(&models.User{})
+	if opts.Username != "" {
+		query = query.Where("username ILIKE ?", "%"+escapeLike(opts.Username)+"%")
+	}
+	if opts.Email != "" {
+		query = query.Where("email ILIKE ?", "%"+escapeLike(opts.Email)+"%")
+	}
+	return query
+}
+
 func (s *UserService) UpdateUser(id uint, updates map[string]interface{}) (*models.UserResponse, error) {
+	allowed := make(map[string]interface{}, len(updates))
+	for field, value := range updates {
+		if updatableUserFields[field] {
+			allowed[field] = value
+		}
+	}
+	if len(allowed) == 0 {
+		return nil, ErrNoUpdatableFields
+	}
+	if err := normalizeUserUpdates(allowed); err != nil {
+		return nil, err
+	}
+
 	var user models.User
 	if err := s.db.First(&user, id).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("user not found")
+			return nil, ErrUserNotFound
 		}
 		return nil, err
 	}
 
-	if err := s.db.Model(&user).Updates(updates).Error; err != nil {
+	if err := s.db.Model(&user).Updates(allowed).Error; err != nil {
 		return nil, err
 	}
+	s.forgetUser(id)
 
-	return &models.UserResponse{
-		ID:       user.ID,
-		Username: user.Username,
-		Email:    user.Email,
-	}, nil
+	return newUserResponse(&user), nil
 }
 
-func (s *UserService) DeleteUser(id uint) error {
-	if err := s.db.Delete(&models.User{}, id).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return errors.New("user not found")
+// normalizeUserUpdates applies the registration rules to updated fields
+func normalizeUserUpdates(updates map[string]interface{}) error {
+	if value, ok := updates["username"]; ok {
+		username, _ := value.(string)
+		normalized, err := NormalizeUsername(username)
+		if err != nil {
+			return err
+		}
+		updates["username"] = normalized
+	}
+	if value, ok := updates["email"]; ok {
+		email, _ := value.(string)
+		normalized, err := NormalizeEmail(email)
+		if err != nil {
+			return err
 		}
-		return err
+		updates["email"] = normalized
+	}
+	return nil
+}
+
+// DeleteUser soft-deletes a user; the row is kept and can be restored
+func (s *UserService) DeleteUser(id uint) error {
+	result := s.db.Delete(&models.User{}, id)
+	if result.Error != nil {
+		return result.Error
 	}
+	if result.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	s.forgetUser(id)
 	return nil
 }
+
+// RestoreUser undeletes a soft-deleted user
+func (s *UserService) RestoreUser(id uint) (*models.UserResponse, error) {
+	result := s.db.Unscoped().Model(&models.User{}).
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		Update("deleted_at", nil)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, fmt.Errorf("deleted %w", ErrUserNotFound)
+	}
+
+	return s.GetUserByID(id)
+}
+
+// userOrderClause turns a sort parameter like "-created_at" into an ORDER BY clause
+func userOrderClause(sort string) (string, error) {
+	if sort == "" {
+		return "id asc", nil
+	}
+
+	direction := "asc"
+	column := sort
+	if strings.HasPrefix(sort, "-") {
+		direction = "desc"
+		column = sort[1:]
+	}
+
+	if !sortableUserColumns[column] {
+		return "", ErrInvalidSort
+	}
+	return column + " " + direction, nil
+}
+
+// escapeLike escapes LIKE wildcards so filters match literally
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
+// newUserResponses converts a page of users; an empty page is [] rather than null
+func newUserResponses(users []models.User) []models.UserResponse {
+	responses := make([]models.UserResponse, 0, len(users))
+	for _, user := range users {
+		responses = append(responses, *newUserResponse(&user))
+	}
+	return responses
+}
+
+func newUserResponse(user *models.User) *models.UserResponse {
+	return &models.UserResponse{
+		ID:       user.ID,
+		Username: user.Username,
+		Email:    user.Email,
+		Role:     user.Role,
+	}
+}
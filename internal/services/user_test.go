@@ -0,0 +1,334 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"my-go-backend/pkg/models"
+)
+
+// sqlStateError stands in for the driver's error (pgconn.PgError)
+type sqlStateError string
+
+func (e sqlStateError) Error() string    { return "SQLSTATE " + string(e) }
+func (e sqlStateError) SQLState() string { return string(e) }
+
+// newDryRunDB returns a database that builds statements without running
+// them: reads find nothing and writes succeed. createErr, when set, is the
+// error every insert fails with.
+func newDryRunDB(t *testing.T, createErr error) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=127.0.0.1 port=1"}), &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true, // Beginning one would connect
+	})
+	if err != nil {
+		t.Fatalf("opening dry-run database: %v", err)
+	}
+	if createErr != nil {
+		err := db.Callback().Create().Before("gorm:create").Register("test:create_error", func(tx *gorm.DB) {
+			tx.AddError(createErr)
+		})
+		if err != nil {
+			t.Fatalf("registering callback: %v", err)
+		}
+	}
+	return db
+}
+
+func TestIsUniqueViolation(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"driver unique violation", sqlStateError(uniqueViolation), true},
+		{"wrapped", fmt.Errorf("insert: %w", sqlStateError(uniqueViolation)), true},
+		{"translated by gorm", gorm.ErrDuplicatedKey, true},
+		{"other constraint", sqlStateError("23502"), false}, // not_null_violation
+		{"plain error", errors.New("connection refused"), false},
+		{"nil", nil, false},
+	}
+
+	for _, tt := range tests {
+		if got := isUniqueViolation(tt.err); got != tt.want {
+			t.Errorf("%s: isUniqueViolation = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCreateUser(t *testing.T) {
+	req := func() *models.AdminCreateUserRequest {
+		return &models.AdminCreateUserRequest{
+			Username: " NewUser ",
+			Email:    "New.User@Example.com",
+			Role:     models.RoleAdmin,
+		}
+	}
+
+	t.Run("success", func(t *testing.T) {
+		created, err := NewUserService(newDryRunDB(t, nil)).CreateUser(req())
+		if err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+		if created.User.Username != "NewUser" || created.User.Email != "new.user@example.com" || created.User.Role != models.RoleAdmin {
+			t.Errorf("user = %+v, want NewUser/new.user@example.com as admin", created.User)
+		}
+		if len(created.TemporaryPassword) != 16 {
+			t.Errorf("temporary password length = %d, want 16", len(created.TemporaryPassword))
+		}
+	})
+
+	t.Run("concurrent create of the same user", func(t *testing.T) {
+		// The count finds nothing, then the insert hits the unique index
+		_, err := NewUserService(newDryRunDB(t, sqlStateError(uniqueViolation))).CreateUser(req())
+		if !errors.Is(err, ErrUserExists) {
+			t.Errorf("error = %v, want ErrUserExists", err)
+		}
+	})
+
+	t.Run("other insert errors are kept", func(t *testing.T) {
+		dbErr := errors.New("connection reset")
+		_, err := NewUserService(newDryRunDB(t, dbErr)).CreateUser(req())
+		if !errors.Is(err, dbErr) || errors.Is(err, ErrUserExists) {
+			t.Errorf("error = %v, want the database error", err)
+		}
+	})
+}
+
+// seedUsers inserts users with the given names, in order, and returns them
+func seedUsers(t *testing.T, db *gorm.DB, names ...string) []models.User {
+	t.Helper()
+	users := make([]models.User, 0, len(names))
+	for _, name := range names {
+		user := models.User{Username: name, Email: name + "@example.com", Password: "hash-of-" + name, Role: models.RoleUser}
+		if err := db.Create(&user).Error; err != nil {
+			t.Fatalf("creating %s: %v", name, err)
+		}
+		users = append(users, user)
+	}
+	return users
+}
+
+func TestUpdateUserIgnoresProtectedFields(t *testing.T) {
+	db := newTestDB(t)
+	s := NewUserService(db)
+	user := seedUsers(t, db, "alice")[0]
+
+	updated, err := s.UpdateUser(user.ID, map[string]interface{}{
+		"username":   "Renamed",
+		"role":       models.RoleAdmin,
+		"password":   "new-password",
+		"id":         99,
+		"created_at": "2000-01-01T00:00:00Z",
+		"deleted_at": "2000-01-01T00:00:00Z",
+	})
+	if err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+	if updated.ID != user.ID || updated.Username != "Renamed" || updated.Role != models.RoleUser {
+		t.Errorf("response = %+v, want only the username changed", updated)
+	}
+
+	var stored models.User
+	if err := db.First(&stored, user.ID).Error; err != nil {
+		t.Fatalf("reading the user back: %v", err)
+	}
+	if stored.Username != "Renamed" {
+		t.Errorf("username = %q, want Renamed", stored.Username)
+	}
+	if stored.Role != user.Role || stored.Password != user.Password || !stored.CreatedAt.Equal(user.CreatedAt) {
+		t.Errorf("stored = %+v, want role, password and created_at unchanged from %+v", stored, user)
+	}
+
+	_, err = s.UpdateUser(user.ID, map[string]interface{}{"role": models.RoleAdmin, "password": "x"})
+	if !errors.Is(err, ErrNoUpdatableFields) {
+		t.Errorf("only protected fields: error = %v, want ErrNoUpdatableFields", err)
+	}
+}
+
+// usernames lists the usernames on a page of GetAllUsers
+func usernames(page *models.PaginatedResponse) []string {
+	var names []string
+	for _, user := range page.Data.([]models.UserResponse) {
+		names = append(names, user.Username)
+	}
+	return names
+}
+
+func TestGetAllUsersSort(t *testing.T) {
+	db := newTestDB(t)
+	s := NewUserService(db)
+	seedUsers(t, db, "bob", "carol", "alice")
+
+	tests := []struct {
+		sort string
+		want string
+	}{
+		{"", "bob,carol,alice"},
+		{"username", "alice,bob,carol"},
+		{"-username", "carol,bob,alice"},
+		{"-id", "alice,carol,bob"},
+	}
+	for _, tt := range tests {
+		page, err := s.GetAllUsers(1, 10, UserListOptions{Sort: tt.sort})
+		if err != nil {
+			t.Errorf("sort %q: %v", tt.sort, err)
+			continue
+		}
+		if got := strings.Join(usernames(page), ","); got != tt.want {
+			t.Errorf("sort %q = %s, want %s", tt.sort, got, tt.want)
+		}
+	}
+
+	for _, sort := range []string{"password", "-role", "id; DROP TABLE users", "--id"} {
+		if _, err := s.GetAllUsers(1, 10, UserListOptions{Sort: sort}); !errors.Is(err, ErrInvalidSort) {
+			t.Errorf("sort %q: error = %v, want ErrInvalidSort", sort, err)
+		}
+	}
+}
+
+func TestFilteredUsers(t *testing.T) {
+	// The filters use Postgres's ILIKE, so check the statement they build
+	db := newTestDB(t).Session(&gorm.Session{DryRun: true})
+	s := NewUserService(db)
+
+	var users []models.User
+	stmt := s.filteredUsers(db, UserListOptions{Username: "al_ice", Email: "100%"}).Find(&users).Statement
+	sql := stmt.SQL.String()
+	if !strings.Contains(sql, "username ILIKE ?") || !strings.Contains(sql, "email ILIKE ?") {
+		t.Errorf("SQL = %s, want username and email ILIKE filters", sql)
+	}
+	want := []interface{}{`%al\_ice%`, `%100\%%`}
+	if len(stmt.Vars) != len(want) || stmt.Vars[0] != want[0] || stmt.Vars[1] != want[1] {
+		t.Errorf("vars = %v, want %v with wildcards escaped", stmt.Vars, want)
+	}
+
+	stmt = s.filteredUsers(db, UserListOptions{}).Find(&users).Statement
+	if strings.Contains(stmt.SQL.String(), "LIKE") {
+		t.Errorf("SQL without filters = %s, want no LIKE", stmt.SQL.String())
+	}
+}
+
+func TestGetUsersAfter(t *testing.T) {
+	db := newTestDB(t)
+	s := NewUserService(db)
+	users := seedUsers(t, db, "u1", "u2", "u3", "u4", "u5", "u6", "u7")
+
+	var seen []string
+	cursor := uint(0)
+	for pages := 0; ; pages++ {
+		if pages > len(users) {
+			t.Fatal("cursor never reached the end")
+		}
+		page, err := s.GetUsersAfter(cursor, 3, UserListOptions{})
+		if err != nil {
+			t.Fatalf("GetUsersAfter(%d): %v", cursor, err)
+		}
+		seen = append(seen, usernames(page)...)
+
+		if pages == 0 {
+			// Rows removed behind or added ahead of the cursor don't shift it
+			if err := s.DeleteUser(users[0].ID); err != nil {
+				t.Fatalf("DeleteUser: %v", err)
+			}
+			seedUsers(t, db, "u8")
+		}
+
+		if page.NextCursor == "" {
+			break
+		}
+		next, err := strconv.ParseUint(page.NextCursor, 10, 32)
+		if err != nil {
+			t.Fatalf("invalid cursor %q: %v", page.NextCursor, err)
+		}
+		cursor = uint(next)
+	}
+
+	if got := strings.Join(seen, ","); got != "u1,u2,u3,u4,u5,u6,u7,u8" {
+		t.Errorf("paged through %s, want every user once in order", got)
+	}
+
+	if _, err := s.GetUsersAfter(0, 3, UserListOptions{Sort: "-created_at"}); !errors.Is(err, ErrCursorSort) {
+		t.Errorf("cursor with another sort: error = %v, want ErrCursorSort", err)
+	}
+}
+
+func TestGetUserByIDFallsBackToCache(t *testing.T) {
+	db := newTestDB(t)
+	user := seedUsers(t, db, "alice")[0]
+	cached := NewUserService(db, WithUserCache(10, time.Minute))
+	uncached := NewUserService(db)
+
+	for _, s := range []*UserService{cached, uncached} {
+		if got, err := s.GetUserByID(user.ID); err != nil || got.Stale {
+			t.Fatalf("GetUserByID with the database up = %+v, %v; want a fresh user", got, err)
+		}
+	}
+
+	// Take the database down
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("db.DB: %v", err)
+	}
+	sqlDB.Close()
+
+	got, err := cached.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatalf("GetUserByID with the cache: %v", err)
+	}
+	if !got.Stale || got.Username != "alice" {
+		t.Errorf("user = %+v, want alice marked Stale", got)
+	}
+
+	if _, err := uncached.GetUserByID(user.ID); err == nil {
+		t.Error("GetUserByID without the cache succeeded, want the database error")
+	}
+	if _, err := cached.GetUserByID(user.ID + 1); err == nil {
+		t.Error("GetUserByID of a user never read succeeded, want the database error")
+	}
+	if _, err := cached.UpdateUser(user.ID, map[string]interface{}{"username": "renamed"}); err == nil {
+		t.Error("UpdateUser succeeded, want writes to fail")
+	}
+}
+
+func TestGetUsersByIDs(t *testing.T) {
+	db := newTestDB(t)
+	s := NewUserService(db)
+	users := seedUsers(t, db, "alice", "bob", "carol")
+	if err := s.DeleteUser(users[2].ID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+
+	alice, bob, carol := users[0].ID, users[1].ID, users[2].ID
+	batch, err := s.GetUsersByIDs([]uint{bob, 999, alice, bob, carol})
+	if err != nil {
+		t.Fatalf("GetUsersByIDs: %v", err)
+	}
+
+	var names []string
+	for _, user := range batch.Users {
+		names = append(names, user.Username)
+	}
+	if got := strings.Join(names, ","); got != "bob,alice" {
+		t.Errorf("users = %s, want bob,alice in the requested order", got)
+	}
+	if len(batch.Missing) != 2 || batch.Missing[0] != 999 || batch.Missing[1] != carol {
+		t.Errorf("missing = %v, want [999 %d] (unknown and deleted)", batch.Missing, carol)
+	}
+
+	tooMany := make([]uint, MaxBatchUserIDs+1)
+	for i := range tooMany {
+		tooMany[i] = uint(i + 1)
+	}
+	if _, err := s.GetUsersByIDs(tooMany); !errors.Is(err, ErrTooManyUserIDs) {
+		t.Errorf("%d ids: error = %v, want ErrTooManyUserIDs", len(tooMany), err)
+	}
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"my-go-backend/pkg/models"
+	"net/mail"
+	"regexp"
+	"strings"
+)
+
+// Username and email bounds
+const (
+	MinUsernameLength = 3
+	MaxUsernameLength = 50
+	MaxEmailLength    = 254
+)
+
+// usernamePattern allows letters, digits, "_", "." and "-"
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// FieldError reports an invalid request field; handlers return it as a 400
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ErrorCode marks field errors as validation failures
+func (e *FieldError) ErrorCode() string {
+	return models.CodeValidation
+}
+
+// NormalizeUsername trims a username and checks its length and characters
+func NormalizeUsername(username string) (string, error) {
+	username = strings.TrimSpace(username)
+	if len(username) < MinUsernameLength || len(username) > MaxUsernameLength {
+		return "", &FieldError{Field: "username", Message: "must be between 3 and 50 characters"}
+	}
+	if !usernamePattern.MatchString(username) {
+		return "", &FieldError{Field: "username", Message: "may only contain letters, digits, '_', '.' and '-'"}
+	}
+	return username, nil
+}
+
+// NormalizeEmail trims and lowercases an email and checks it is a bare
+// address, so "User@X.com" and "user@x.com" are the same account. Display
+// names ("Bob <bob@example.com>") and addresses without a domain are rejected.
+func NormalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	invalid := &FieldError{Field: "email", Message: "must be a valid email address"}
+	if email == "" || len(email) > MaxEmailLength {
+		return "", invalid
+	}
+
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", invalid
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 1 || !strings.Contains(email[at+1:], ".") {
+		return "", invalid
+	}
+	return email, nil
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeUsername(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string // Empty when the username is rejected
+	}{
+		{"alice", "alice"},
+		{"  Bob.Smith-99_ ", "Bob.Smith-99_"},
+		{"abc", "abc"},
+		{strings.Repeat("a", 50), strings.Repeat("a", 50)},
+		{"ab", ""},
+		{strings.Repeat("a", 51), ""},
+		{"   ", ""},
+		{"bob smith", ""},
+		{"bob@home", ""},
+		{"<script>", ""},
+		{"zoë", ""},
+	}
+
+	for _, tt := range tests {
+		got, err := NormalizeUsername(tt.in)
+		if tt.want == "" {
+			var fieldErr *FieldError
+			if !errors.As(err, &fieldErr) || fieldErr.Field != "username" {
+				t.Errorf("NormalizeUsername(%q) = %q, %v; want a username field error", tt.in, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("NormalizeUsername(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string // Empty when the email is rejected
+	}{
+		{"user@example.com", "user@example.com"},
+		{"  User.Name+tag@Example.COM ", "user.name+tag@example.com"},
+		{"", ""},
+		{"not-an-email", ""},
+		{"user@", ""},
+		{"@example.com", ""},
+		{"user@localhost", ""},
+		{"Bob <bob@example.com>", ""},
+		{"a@b.c, d@e.f", ""},
+		{strings.Repeat("a", 250) + "@example.com", ""},
+	}
+
+	for _, tt := range tests {
+		got, err := NormalizeEmail(tt.in)
+		if tt.want == "" {
+			var fieldErr *FieldError
+			if !errors.As(err, &fieldErr) || fieldErr.Field != "email" {
+				t.Errorf("NormalizeEmail(%q) = %q, %v; want an email field error", tt.in, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("NormalizeEmail(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
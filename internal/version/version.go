@@ -0,0 +1,47 @@
+// Package version describes the running build. The variables are set at
+// link time, e.g.:
+//
+//	go build -ldflags "-X my-go-backend/internal/version.Version=1.4.0 \
+//		-X my-go-backend/internal/version.Commit=$(git rev-parse --short HEAD) \
+//		-X my-go-backend/internal/version.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)" \
+//		-o main cmd/server/main.go
+//
+// Without -ldflags, Commit and BuildDate fall back to the VCS details Go
+// embeds when building from a git checkout.
+package version
+
+import (
+	"runtime/debug"
+	"time"
+)
+
+// Build information, overridden with -ldflags "-X ..."
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildDate = "unknown"
+)
+
+// startTime approximates process start; package variables are initialized
+// before main runs
+var startTime = time.Now()
+
+func init() {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	for _, setting := range info.Settings {
+		switch {
+		case setting.Key == "vcs.revision" && Commit == "unknown":
+			Commit = setting.Value
+		case setting.Key == "vcs.time" && BuildDate == "unknown":
+			BuildDate = setting.Value
+		}
+	}
+}
+
+// Uptime is how long the process has been running
+func Uptime() time.Duration {
+	return time.Since(startTime)
+}
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// PriceAlert : A user's price threshold for a coin
+type PriceAlert struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	UserID      uint       `json:"user_id" gorm:"not null;index"`
+	CoinID      string     `json:"coin_id" gorm:"not null;index"`
+	Direction   string     `json:"direction" gorm:"not null"` // "above", "below"
+	TargetPrice float64    `json:"target_price" gorm:"not null"`
+	Triggered   bool       `json:"triggered" gorm:"not null;default:false"`
+	TriggeredAt *time.Time `json:"triggered_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+type CreateAlertRequest struct {
+	CoinID      string  `json:"coin_id" binding:"required"`
+	Direction   string  `json:"direction" binding:"required,oneof=above below"`
+	TargetPrice float64 `json:"target_price" binding:"required,gt=0"`
+}
+
+// AlertEvent : Payload of an "alert" StreamEvent
+type AlertEvent struct {
+	AlertID      uint      `json:"alert_id"`
+	CoinID       string    `json:"coin_id"`
+	Direction    string    `json:"direction"`
+	TargetPrice  float64   `json:"target_price"`
+	CurrentPrice float64   `json:"current_price"`
+	TriggeredAt  time.Time `json:"triggered_at"`
+}
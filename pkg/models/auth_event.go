@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Auth event types
+const (
+	AuthEventRegister       = "register"
+	AuthEventLogin          = "login"
+	AuthEventRefresh        = "refresh"
+	AuthEventAccountDeleted = "account_deleted"
+	AuthEventSessionRevoked = "session_revoked"
+	AuthEventServiceToken   = "service_token" // A service client asked for a token; there is no user
+)
+
+// AuthEvent : An authentication attempt, kept for security review
+type AuthEvent struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    *uint     `json:"user_id" gorm:"index"` // Nil when the account couldn't be identified
+	Type      string    `json:"type" gorm:"not null;index"`
+	Success   bool      `json:"success" gorm:"not null"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+// ClientInfo : Where a request came from, recorded on auth events
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
@@ -12,7 +12,15 @@ type CoinGeckoResponse struct {
 	MarketCapRank         int     `json:"market_cap_rank"`
 	PriceChange24h        float64 `json:"price_change_24h"`
 	PriceChangePercent24h float64 `json:"price_change_percentage_24h"`
+	TotalVolume           float64 `json:"total_volume"`
 	LastUpdated           string  `json:"last_updated"`
+
+	SparklineIn7d *CoinGeckoSparkline `json:"sparkline_in_7d,omitempty"` // Only sent with sparkline=true
+}
+
+// CoinGeckoSparkline : Hourly prices over the last 7 days, oldest first
+type CoinGeckoSparkline struct {
+	Price []float64 `json:"price"`
 }
 
 // CryptoData : Our internal crypto data structure
@@ -25,27 +33,92 @@ type CryptoData struct {
 	Rank          int       `json:"rank"`
 	Change24h     float64   `json:"change_24h"`
 	ChangePercent float64   `json:"change_percent_24h"`
+	Volume24h     float64   `json:"volume_24h"`
 	FetchedAt     time.Time `json:"fetched_at"`
 	Error         string    `json:"error,omitempty"`
+	Stale         bool      `json:"stale,omitempty"`        // Expired cache entry, served while CoinGecko is failing
+	Sparkline7d   []float64 `json:"sparkline_7d,omitempty"` // Hourly prices over 7 days, only sent with ?sparkline=true
+}
+
+// GlobalMarketData : Market-wide overview
+type GlobalMarketData struct {
+	ActiveCryptocurrencies int       `json:"active_cryptocurrencies"`
+	TotalMarketCapUSD      float64   `json:"total_market_cap_usd"`
+	TotalVolume24hUSD      float64   `json:"total_volume_24h_usd"`
+	BTCDominance           float64   `json:"btc_dominance"`         // Bitcoin's share of the total market cap, in percent
+	MarketCapChange24h     float64   `json:"market_cap_change_24h"` // Percent
+	UpdatedAt              time.Time `json:"updated_at"`
+	Stale                  bool      `json:"stale,omitempty"` // Last known data, served while CoinGecko is failing
+}
+
+// CoinComparison : Coin A priced relative to coin B in the same currency
+type CoinComparison struct {
+	Currency       string     `json:"currency"`
+	A              CryptoData `json:"a"`
+	B              CryptoData `json:"b"`
+	PriceRatio     float64    `json:"price_ratio"`      // A's price divided by B's
+	MarketCapRatio *float64   `json:"market_cap_ratio"` // Null when B's market cap is unknown
+	Change24hDiff  float64    `json:"change_24h_diff"`  // A's 24h change minus B's, in percentage points
+}
+
+// PricePoint : One observed price
+type PricePoint struct {
+	Price     float64   `json:"price"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// PriceHistory : Recently fetched prices of a coin, oldest first
+type PriceHistory struct {
+	CoinID string       `json:"coin_id"`
+	Points []PricePoint `json:"points"`
+}
+
+// CacheEntry : A cached coin price and how old it is
+type CacheEntry struct {
+	Data       CryptoData `json:"data"`
+	AgeSeconds float64    `json:"age_seconds"`
+	Fresh      bool       `json:"fresh"` // False once older than the cache TTL; the next request refetches it
+}
+
+// CoinListItem : Coin summary for discovering valid coin ids
+type CoinListItem struct {
+	ID     string `json:"id"`
+	Symbol string `json:"symbol"`
+	Name   string `json:"name"`
+	Rank   int    `json:"rank"`
+}
+
+// OHLCCandle : One open/high/low/close candle
+type OHLCCandle struct {
+	Timestamp time.Time `json:"timestamp"`
+	Open      float64   `json:"open"`
+	High      float64   `json:"high"`
+	Low       float64   `json:"low"`
+	Close     float64   `json:"close"`
 }
 
 // PortfolioRequest : Portfolio request/response models
 type PortfolioRequest struct {
-	Coins []string `json:"coins" binding:"required"`
+	Coins      []string           `json:"coins" binding:"required"`
+	Quantities map[string]float64 `json:"quantities,omitempty"` // Holdings per coin for the totals, CSV export and value sorting (default 1)
+	Sort       string             `json:"sort,omitempty"`       // "value_desc", "price_desc", "rank_asc" (default: request order)
+	Currencies []string           `json:"currencies,omitempty"` // Also total the portfolio in these currencies, e.g. ["usd", "eur"]
 }
 
 type PortfolioResponse struct {
-	Portfolio    []CryptoData `json:"portfolio"`
-	TotalValue   float64      `json:"total_value"`
-	SuccessCount int          `json:"success_count"`
-	ErrorCount   int          `json:"error_count"`
-	FetchTime    string       `json:"fetch_time"`
+	Portfolio    []CryptoData       `json:"portfolio"`
+	TotalValue   float64            `json:"total_value"`
+	Totals       map[string]float64 `json:"totals,omitempty"` // Total per requested currency
+	SuccessCount int                `json:"success_count"`
+	ErrorCount   int                `json:"error_count"`
+	FetchTime    string             `json:"fetch_time"`
 }
 
 // BulkCryptoRequest : Bulk crypto request
 type BulkCryptoRequest struct {
 	Coins   []string `json:"coins" binding:"required"`
 	Timeout int      `json:"timeout,omitempty"` // seconds
+	Sort    string   `json:"sort,omitempty"`    // "value_desc", "price_desc", "rank_asc" (default: request order)
 }
 
 type StreamEvent struct {
@@ -55,23 +128,60 @@ type StreamEvent struct {
 	ID        string      `json:"id,omitempty"`
 }
 
+// Why a stream ended, sent in its final "end" event
+const (
+	StreamEndMaxUpdates = "max_updates"
+	StreamEndDuration   = "duration"
+	StreamEndShutdown   = "shutdown" // Sent in a "shutdown" event rather than "end"
+)
+
+// StreamEnd : Payload of the "end" StreamEvent
+type StreamEnd struct {
+	Reason string `json:"reason"`
+}
+
+// Price update types
+const (
+	UpdateTypePrice     = "price"
+	UpdateTypeVolume    = "volume"
+	UpdateTypeMarketCap = "market_cap"
+)
+
 type PriceUpdate struct {
 	CoinID     string    `json:"coin_id"`
 	Symbol     string    `json:"symbol"`
 	Price      float64   `json:"price"`
 	Change24h  float64   `json:"change_24h"`
+	Volume     float64   `json:"volume,omitempty"`     // Set for "volume" updates
+	MarketCap  int64     `json:"market_cap,omitempty"` // Set for "market_cap" updates
 	Timestamp  time.Time `json:"timestamp"`
 	UpdateType string    `json:"update_type"` // "price", "volume", "market_cap"
 }
 
 type StreamConfig struct {
-	Coins      []string      `json:"coins"`
-	Interval   time.Duration `json:"interval"`
-	MaxUpdates int           `json:"max_updates,omitempty"`
+	Coins       []string      `json:"coins"`
+	Interval    time.Duration `json:"interval"`
+	MaxUpdates  int           `json:"max_updates,omitempty"`
+	Duration    time.Duration `json:"duration,omitempty"`     // 0 for the server maximum
+	UpdateTypes []string      `json:"update_types,omitempty"` // Default: price only
+}
+
+// SubscriberStats : WebSocket subscriber queues, reported in cache stats
+type SubscriberStats struct {
+	Buffer      int              `json:"buffer"`      // Events queued per subscriber before the policy applies
+	SlowPolicy  string           `json:"slow_policy"` // "drop_newest", "drop_oldest" or "disconnect"
+	Subscribers []SubscriberStat `json:"subscribers"`
+}
+
+type SubscriberStat struct {
+	ID      string `json:"id"`
+	UserID  uint   `json:"user_id,omitempty"`
+	Queued  int    `json:"queued"`
+	Dropped int64  `json:"dropped"`
 }
 
 type WebSocketMessage struct {
-	Action string      `json:"action"` // "subscribe", "unsubscribe", "ping"
+	Action string      `json:"action"` // "auth", "subscribe", "unsubscribe", "snapshot", "ping", "close"
 	Data   interface{} `json:"data"`
 	ID     string      `json:"id,omitempty"`
 }
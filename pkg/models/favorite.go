@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Favorite : A coin on a user's watchlist. Each coin is listed once per user.
+type Favorite struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"-" gorm:"not null;uniqueIndex:idx_favorites_user_coin"`
+	CoinID    string    `json:"coin_id" gorm:"not null;uniqueIndex:idx_favorites_user_coin"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type AddFavoriteRequest struct {
+	CoinID string `json:"coin_id" binding:"required"`
+}
+
+// FavoriteResponse : A favorite with its current market data, included when
+// prices are requested. Coins whose price couldn't be fetched have the
+// error set in Market.
+type FavoriteResponse struct {
+	Favorite
+	Market *CryptoData `json:"market,omitempty"`
+}
@@ -1,21 +1,59 @@
 package models
 
 type APIResponse struct {
-	Success bool        `json:"success"`
-	Message string      `json:"message"`
-	Data    interface{} `json:"data,omitempty"`
-	Error   string      `json:"error,omitempty"`
+	Success   bool        `json:"success"`
+	Message   string      `json:"message"`
+	Data      interface{} `json:"data,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	Code      string      `json:"code,omitempty"`       // Set on errors, one of the Code* constants
+	RequestID string      `json:"request_id,omitempty"` // Set on errors for correlation
 }
 
+// Error codes for APIResponse.Code. The generic ones follow the HTTP status;
+// the rest name a specific failure. Messages may change, codes don't.
+const (
+	CodeValidation      = "VALIDATION_ERROR"
+	CodeUnauthorized    = "UNAUTHORIZED"
+	CodeForbidden       = "FORBIDDEN"
+	CodeNotFound        = "NOT_FOUND"
+	CodeConflict        = "CONFLICT"
+	CodePayloadTooLarge = "PAYLOAD_TOO_LARGE"
+	CodeRateLimited     = "RATE_LIMITED"
+	CodeQuotaExceeded   = "QUOTA_EXCEEDED"
+	CodeInternal        = "INTERNAL_ERROR"
+	CodeUpstream        = "UPSTREAM_ERROR"
+	CodeUnavailable     = "SERVICE_UNAVAILABLE"
+
+	CodeCoinNotFound          = "COIN_NOT_FOUND"
+	CodeUserNotFound          = "USER_NOT_FOUND"
+	CodeSessionNotFound       = "SESSION_NOT_FOUND"
+	CodeAlertNotFound         = "ALERT_NOT_FOUND"
+	CodeUserExists            = "USER_EXISTS"
+	CodeInvalidCredentials    = "INVALID_CREDENTIALS"
+	CodeInvalidPassword       = "INVALID_PASSWORD"
+	CodeInvalidRefreshToken   = "INVALID_REFRESH_TOKEN"
+	CodeUpstreamUnavailable   = "UPSTREAM_UNAVAILABLE"
+	CodeIdempotencyInProgress = "IDEMPOTENCY_IN_PROGRESS"
+	CodeIdempotencyMismatch   = "IDEMPOTENCY_MISMATCH"
+	CodeInvalidClient         = "INVALID_CLIENT"
+	CodeInvalidScope          = "INVALID_SCOPE"
+	CodeFavoriteExists        = "FAVORITE_EXISTS"
+	CodeFavoriteNotFound      = "FAVORITE_NOT_FOUND"
+	CodeFavoritesLimit        = "FAVORITES_LIMIT"
+)
+
 type AuthResponse struct {
-	Token string       `json:"token"`
-	User  UserResponse `json:"user"`
+	Token        string       `json:"token"`         // Access token for the Authorization header
+	RefreshToken string       `json:"refresh_token"` // Exchanged at /auth/refresh for a new pair
+	ExpiresIn    int64        `json:"expires_in"`    // Access token lifetime in seconds
+	User         UserResponse `json:"user"`
 }
 
 type PaginatedResponse struct {
 	Data       interface{} `json:"data"`
 	Total      int64       `json:"total"`
-	Page       int         `json:"page"`
+	Page       int         `json:"page,omitempty"` // Offset mode only
 	Limit      int         `json:"limit"`
 	TotalPages int         `json:"total_pages"`
+	NextCursor string      `json:"next_cursor,omitempty"` // Cursor mode only; empty on the last page
 }
@@ -0,0 +1,26 @@
+package models
+
+// Scopes a service token can be granted
+const (
+	ScopeCrypto = "crypto" // The /crypto endpoints, except admin-only routes and price alerts
+)
+
+// ServiceScopes lists every scope, for validating configured clients
+var ServiceScopes = []string{ScopeCrypto}
+
+// ServiceTokenRequest : OAuth2 client credentials grant. The client id and
+// secret may be sent with HTTP Basic auth instead.
+type ServiceTokenRequest struct {
+	GrantType    string `json:"grant_type" form:"grant_type" binding:"required,eq=client_credentials"`
+	ClientID     string `json:"client_id" form:"client_id"`
+	ClientSecret string `json:"client_secret" form:"client_secret"`
+	Scope        string `json:"scope" form:"scope"` // Space-separated; all of the client's scopes when empty
+}
+
+// ServiceTokenResponse : Access token for a service client, shaped like an OAuth2 token response
+type ServiceTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"` // Seconds
+	Scope       string `json:"scope"`
+}
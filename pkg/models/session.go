@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Session : A login, identified by the "sid" claim of its refresh tokens.
+// Deleting the row revokes every refresh token issued for it.
+type Session struct {
+	ID         string    `json:"id" gorm:"primaryKey;size:36"` // UUID
+	UserID     uint      `json:"-" gorm:"not null;index"`
+	IP         string    `json:"ip"`         // Of the last login or refresh
+	UserAgent  string    `json:"user_agent"` // Of the last login or refresh
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at" gorm:"index"` // When its newest refresh token expires
+}
@@ -5,29 +5,72 @@ import (
 	"time"
 )
 
+// User roles
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+
+	// RoleService is the role of tokens from POST /auth/token, which belong
+	// to a configured client rather than a user
+	RoleService = "service"
+)
+
 type User struct {
 	ID        uint           `json:"id" gorm:"primaryKey"`
 	Username  string         `json:"username" gorm:"unique;not null"`
 	Email     string         `json:"email" gorm:"unique;not null"`
 	Password  string         `json:"-" gorm:"not null"`
+	Role      string         `json:"role" gorm:"not null;default:user"`
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
+// CreateUserRequest : Username and email are trimmed, then checked by the service
 type CreateUserRequest struct {
-	Username string `json:"username" binding:"required,min=3,max=50"`
-	Email    string `json:"email" binding:"required,email"`
+	Username string `json:"username" binding:"required"` // 3-50 letters, digits, "_", "." or "-"
+	Email    string `json:"email" binding:"required"`
 	Password string `json:"password" binding:"required,min=6"`
 }
 
+// AdminCreateUserRequest : Admin provisioning; a temporary password is generated when Password is empty
+type AdminCreateUserRequest struct {
+	Username string `json:"username" binding:"required"`
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"omitempty,min=6"`
+	Role     string `json:"role" binding:"required,oneof=user admin"`
+}
+
+type AdminCreateUserResponse struct {
+	User              UserResponse `json:"user"`
+	TemporaryPassword string       `json:"temporary_password,omitempty"` // Only returned once
+}
+
 type LoginRequest struct {
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required"`
 }
 
+// RefreshRequest : Refresh token to exchange for a new token pair
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// DeleteAccountRequest : Password re-confirmation for deleting one's own account
+type DeleteAccountRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
 type UserResponse struct {
 	ID       uint   `json:"id"`
 	Username string `json:"username"`
 	Email    string `json:"email"`
+	Role     string `json:"role"`
+	Stale    bool   `json:"stale,omitempty"` // Served from cache while the database is unavailable
+}
+
+// UserBatchResponse : Users fetched by id, in the requested order
+type UserBatchResponse struct {
+	Users   []UserResponse `json:"users"`
+	Missing []uint         `json:"missing"` // Requested ids with no (non-deleted) user
 }